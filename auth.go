@@ -0,0 +1,358 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// set the Authorization header for HTTP Basic authentication
+func BasicAuth(user, password string) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		req.SetBasicAuth(user, password)
+		return req, nil
+	}
+}
+
+// set the Authorization header for Bearer token authentication
+func BearerToken(token string) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req, nil
+	}
+}
+
+type digestKey struct{}
+
+// use HTTP Digest authentication (RFC 7616) for this request
+// (if the server returns a Digest challenge the request is sent again with the credentials,
+// so the request body must be replayable)
+func DigestAuth(user, password string) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		da := &DigestAuthenticator{Username: user, Password: password}
+		return req.WithContext(context.WithValue(req.Context(), digestKey{}, da)), nil
+	}
+}
+
+// Set the client Authorization header for HTTP Basic authentication.
+// The user and password can be secret references (see ResolveSecret), resolved for each request
+// if enabled with SetSecretResolver.
+func (self *HttpClient) SetBasicAuth(user, password string) {
+	self.digest = nil
+
+	if IsSecretRef(user) || IsSecretRef(password) {
+		self.Headers["Authorization"] = "Basic " + user + ":" + password // encoded by resolveSecrets
+	} else {
+		self.Headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	}
+}
+
+// Set the client Authorization header for Bearer token authentication
+// (the token can be a secret reference, see SetSecretResolver)
+func (self *HttpClient) SetBearerToken(token string) {
+	self.digest = nil
+	self.Headers["Authorization"] = "Bearer " + token
+}
+
+// Use HTTP Digest authentication for all requests.
+// The first request (and any request after the nonce expires) is sent twice,
+// the first time to get the server challenge.
+func (self *HttpClient) SetDigestAuth(user, password string) {
+	delete(self.Headers, "Authorization")
+	self.digest = &DigestAuthenticator{Username: user, Password: password}
+}
+
+// Remove all client authentication settings
+func (self *HttpClient) ClearAuth() {
+	self.digest = nil
+	delete(self.Headers, "Authorization")
+}
+
+// return the digest authenticator for this request, if any
+func (self *HttpClient) digestAuth(req *http.Request) *DigestAuthenticator {
+	if da, ok := req.Context().Value(digestKey{}).(*DigestAuthenticator); ok {
+		return da
+	}
+
+	if !self.InScope(req.URL) {
+		return nil
+	}
+
+	return self.digest
+}
+
+// DigestAuthenticator implements HTTP Digest authentication (RFC 7616),
+// with MD5, SHA-256 and SHA-512-256 algorithms (and their -sess variants),
+// qop "auth" and "auth-int", and userhash.
+type DigestAuthenticator struct {
+	Username string
+	Password string
+
+	lock      sync.Mutex
+	challenge map[string]string
+	nc        int
+
+	cnonce func() string // for testing
+}
+
+// Challenge updates the authenticator with the Digest challenge in the response, if any.
+// It returns false if the response doesn't contain a supported Digest challenge.
+func (da *DigestAuthenticator) Challenge(resp *http.Response) bool {
+	var best map[string]string
+
+	for _, h := range resp.Header.Values("WWW-Authenticate") {
+		for _, c := range splitChallenges(h) {
+			if !strings.EqualFold(c.scheme, "Digest") || digestHash(c.params["algorithm"]) == nil {
+				continue
+			}
+
+			if best == nil || digestStrength(c.params["algorithm"]) > digestStrength(best["algorithm"]) {
+				best = c.params
+			}
+		}
+	}
+
+	if best == nil {
+		return false
+	}
+
+	da.lock.Lock()
+	da.challenge = best
+	da.nc = 0
+	da.lock.Unlock()
+	return true
+}
+
+// Authorize sets the Authorization header for the request, if a challenge was received
+func (da *DigestAuthenticator) Authorize(req *http.Request) error {
+	da.lock.Lock()
+	defer da.lock.Unlock()
+
+	if da.challenge == nil {
+		return nil
+	}
+
+	da.nc++
+
+	var body []byte
+
+	if qop := selectQop(da.challenge["qop"]); qop == "auth-int" && req.GetBody != nil {
+		r, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+
+		body, err = io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	cnonce := da.cnonce
+	if cnonce == nil {
+		cnonce = randomNonce
+	}
+
+	auth := digestAuthorization(da.challenge, da.Username, da.Password,
+		req.Method, req.URL.RequestURI(), body, da.nc, cnonce())
+
+	req.Header.Set("Authorization", auth)
+	return nil
+}
+
+func randomNonce() string {
+	var b [24]byte
+	rand.Read(b[:])
+	return base64.StdEncoding.EncodeToString(b[:])
+}
+
+func digestStrength(algorithm string) int {
+	switch strings.ToUpper(strings.TrimSuffix(strings.ToLower(algorithm), "-sess")) {
+	case "SHA-512-256":
+		return 3
+	case "SHA-256":
+		return 2
+	default:
+		return 1
+	}
+}
+
+// return the hash function for the algorithm, or nil if not supported
+func digestHash(algorithm string) func() hash.Hash {
+	switch strings.ToUpper(strings.TrimSuffix(strings.ToLower(algorithm), "-sess")) {
+	case "", "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	case "SHA-512-256":
+		return sha512.New512_256
+	default:
+		return nil
+	}
+}
+
+// select the qop, preferring "auth"
+func selectQop(qops string) string {
+	if qops == "" {
+		return ""
+	}
+
+	selected := ""
+
+	for _, q := range strings.Split(qops, ",") {
+		switch q = strings.TrimSpace(q); q {
+		case "auth":
+			return q
+		case "auth-int":
+			selected = q
+		}
+	}
+
+	return selected
+}
+
+// compute the Authorization header value for the challenge
+func digestAuthorization(challenge map[string]string, user, password, method, uri string, body []byte, nc int, cnonce string) string {
+	algorithm := challenge["algorithm"]
+	newHash := digestHash(algorithm)
+
+	h := func(s string) string {
+		hh := newHash()
+		io.WriteString(hh, s)
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	realm := challenge["realm"]
+	nonce := challenge["nonce"]
+	qop := selectQop(challenge["qop"])
+	ncs := fmt.Sprintf("%08x", nc)
+
+	ha1 := h(user + ":" + realm + ":" + password)
+	if strings.HasSuffix(strings.ToLower(algorithm), "-sess") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+
+	ha2 := h(method + ":" + uri)
+	if qop == "auth-int" {
+		ha2 = h(method + ":" + uri + ":" + h(string(body)))
+	}
+
+	var response string
+	if qop == "" {
+		response = h(ha1 + ":" + nonce + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + nonce + ":" + ncs + ":" + cnonce + ":" + qop + ":" + ha2)
+	}
+
+	username := user
+	if strings.EqualFold(challenge["userhash"], "true") {
+		username = h(user + ":" + realm)
+	}
+
+	parts := []string{
+		fmt.Sprintf("username=%q", username),
+		fmt.Sprintf("realm=%q", realm),
+		fmt.Sprintf("uri=%q", uri),
+	}
+
+	if algorithm != "" {
+		parts = append(parts, "algorithm="+algorithm)
+	}
+
+	parts = append(parts, fmt.Sprintf("nonce=%q", nonce))
+
+	if qop != "" {
+		parts = append(parts, "nc="+ncs, fmt.Sprintf("cnonce=%q", cnonce), "qop="+qop)
+	}
+
+	parts = append(parts, fmt.Sprintf("response=%q", response))
+
+	if opaque, ok := challenge["opaque"]; ok {
+		parts = append(parts, fmt.Sprintf("opaque=%q", opaque))
+	}
+
+	if strings.EqualFold(challenge["userhash"], "true") {
+		parts = append(parts, "userhash=true")
+	}
+
+	return "Digest " + strings.Join(parts, ", ")
+}
+
+type authChallenge struct {
+	scheme string
+	params map[string]string
+}
+
+// splitChallenges parses a WWW-Authenticate header value, that may contain multiple challenges
+func splitChallenges(h string) (challenges []authChallenge) {
+	var curr *authChallenge
+
+	for len(h) > 0 {
+		h = strings.TrimLeft(h, " \t,")
+		if h == "" {
+			break
+		}
+
+		// read a token
+		i := strings.IndexAny(h, " \t,=")
+		if i < 0 {
+			i = len(h)
+		}
+
+		token := h[:i]
+		h = strings.TrimLeft(h[i:], " \t")
+
+		if !strings.HasPrefix(h, "=") { // new scheme
+			challenges = append(challenges, authChallenge{scheme: token, params: map[string]string{}})
+			curr = &challenges[len(challenges)-1]
+			continue
+		}
+
+		h = strings.TrimLeft(h[1:], " \t")
+
+		var value string
+
+		if strings.HasPrefix(h, `"`) { // quoted string
+			var sb strings.Builder
+
+			j := 1
+			for ; j < len(h) && h[j] != '"'; j++ {
+				if h[j] == '\\' && j+1 < len(h) {
+					j++
+				}
+				sb.WriteByte(h[j])
+			}
+
+			value = sb.String()
+			if j < len(h) {
+				j++
+			}
+			h = h[j:]
+		} else {
+			j := strings.IndexAny(h, " \t,")
+			if j < 0 {
+				j = len(h)
+			}
+
+			value = h[:j]
+			h = h[j:]
+		}
+
+		if curr != nil {
+			curr.params[strings.ToLower(token)] = value
+		}
+	}
+
+	return
+}
@@ -0,0 +1,443 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Load balancing strategies (see Balancer)
+type BalanceStrategy int
+
+const (
+	RoundRobin   BalanceStrategy = iota // the endpoints in turn
+	LeastPending                        // the endpoint with fewer requests in progress
+	Weighted                            // the endpoints in turn, proportionally to their weights (smooth weighted round-robin)
+)
+
+var NoEndpoints = errors.New("No endpoints")
+
+// ParseBalanceStrategy parses a strategy name: round-robin, least-pending or weighted
+func ParseBalanceStrategy(s string) (BalanceStrategy, error) {
+	switch strings.ToLower(s) {
+	case "round-robin", "roundrobin", "rr", "":
+		return RoundRobin, nil
+	case "least-pending", "leastpending", "lp":
+		return LeastPending, nil
+	case "weighted", "wrr":
+		return Weighted, nil
+	}
+
+	return RoundRobin, fmt.Errorf("Invalid balance strategy %q", s)
+}
+
+func (s BalanceStrategy) String() string {
+	switch s {
+	case LeastPending:
+		return "least-pending"
+	case Weighted:
+		return "weighted"
+	}
+
+	return "round-robin"
+}
+
+// EndpointStatus is the state of a Balancer endpoint
+type EndpointStatus struct {
+	URL          string    `json:"url"`
+	Weight       int       `json:"weight"`
+	Pending      int       `json:"pending"`
+	Requests     int64     `json:"requests"`
+	Failures     int64     `json:"failures"`
+	Ejected      bool      `json:"ejected"`
+	EjectedUntil time.Time `json:"ejected_until,omitempty"`
+}
+
+type endpoint struct {
+	url    *url.URL
+	weight int
+
+	current      int // smooth weighted round-robin
+	pending      int
+	requests     int64
+	failures     int64
+	fails        int // consecutive failures
+	ejectedUntil time.Time
+}
+
+// Balancer selects the endpoint for each request, ejecting for EjectTime the endpoints that failed
+// MaxFails consecutive requests (connection errors or 5xx responses, passive health checks).
+// If all the endpoints are ejected, the one that was ejected first is used.
+type Balancer struct {
+	Strategy  BalanceStrategy
+	MaxFails  int           // default 3
+	EjectTime time.Duration // default 30s
+
+	lock      sync.Mutex
+	endpoints []*endpoint
+	next      int
+}
+
+// NewBalancer creates a Balancer for the endpoints (base URLs, with an optional weight as in "http://host:8080 weight=3")
+func NewBalancer(strategy BalanceStrategy, endpoints ...string) (*Balancer, error) {
+	b := &Balancer{Strategy: strategy}
+
+	for _, e := range endpoints {
+		weight := 1
+
+		if u, w, ok := strings.Cut(strings.TrimSpace(e), " "); ok {
+			e = u
+
+			w = strings.TrimSpace(w)
+			if !strings.HasPrefix(w, "weight=") {
+				return nil, fmt.Errorf("Invalid endpoint %q", e+" "+w)
+			}
+
+			if _, err := fmt.Sscan(strings.TrimPrefix(w, "weight="), &weight); err != nil || weight <= 0 {
+				return nil, fmt.Errorf("Invalid endpoint weight %q", w)
+			}
+		}
+
+		if err := b.Add(e, weight); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(b.endpoints) == 0 {
+		return nil, NoEndpoints
+	}
+
+	return b, nil
+}
+
+// Add adds an endpoint (a base URL) with the specified weight (used by the Weighted strategy)
+func (b *Balancer) Add(base string, weight int) error {
+	u, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("Invalid endpoint %q", base)
+	}
+	if weight <= 0 {
+		weight = 1
+	}
+
+	b.lock.Lock()
+	b.endpoints = append(b.endpoints, &endpoint{url: u, weight: weight})
+	b.lock.Unlock()
+	return nil
+}
+
+// Remove removes the endpoint
+func (b *Balancer) Remove(base string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for i, e := range b.endpoints {
+		if e.url.String() == base {
+			b.endpoints = append(b.endpoints[:i], b.endpoints[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetEndpoints replaces the endpoints (base URLs) and their weights (nil: all 1),
+// keeping the state of the endpoints that didn't change (i.e. after a service discovery refresh)
+func (b *Balancer) SetEndpoints(bases []string, weights []int) error {
+	endpoints := make([]*endpoint, 0, len(bases))
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	current := make(map[string]*endpoint, len(b.endpoints))
+	for _, e := range b.endpoints {
+		current[e.url.String()] = e
+	}
+
+	for i, base := range bases {
+		u, err := url.Parse(base)
+		if err != nil {
+			return err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("Invalid endpoint %q", base)
+		}
+
+		weight := 1
+		if i < len(weights) && weights[i] > 0 {
+			weight = weights[i]
+		}
+
+		e, ok := current[u.String()]
+		if !ok {
+			e = &endpoint{url: u}
+		}
+
+		e.weight = weight
+		endpoints = append(endpoints, e)
+	}
+
+	b.endpoints = endpoints
+	return nil
+}
+
+// Endpoints returns the status of the endpoints
+func (b *Balancer) Endpoints() []EndpointStatus {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	status := make([]EndpointStatus, len(b.endpoints))
+
+	for i, e := range b.endpoints {
+		status[i] = EndpointStatus{
+			URL:      e.url.String(),
+			Weight:   e.weight,
+			Pending:  e.pending,
+			Requests: e.requests,
+			Failures: e.failures,
+			Ejected:  now.Before(e.ejectedUntil),
+		}
+
+		if status[i].Ejected {
+			status[i].EjectedUntil = e.ejectedUntil
+		}
+	}
+
+	return status
+}
+
+// acquire selects an endpoint (excluding the ones in skip) and counts the request as pending
+func (b *Balancer) acquire(skip map[*endpoint]bool) *endpoint {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+
+	var available []*endpoint
+	var first *endpoint // the first ejected endpoint to return
+
+	for _, e := range b.endpoints {
+		if skip[e] {
+			continue
+		}
+
+		if now.Before(e.ejectedUntil) {
+			if first == nil || e.ejectedUntil.Before(first.ejectedUntil) {
+				first = e
+			}
+			continue
+		}
+
+		available = append(available, e)
+	}
+
+	var selected *endpoint
+
+	switch {
+	case len(available) == 0:
+		selected = first
+
+	case b.Strategy == LeastPending:
+		for i := range available {
+			e := available[(b.next+i)%len(available)] // rotate the ties
+			if selected == nil || e.pending < selected.pending {
+				selected = e
+			}
+		}
+
+		b.next++
+
+	case b.Strategy == Weighted:
+		total := 0
+
+		for _, e := range available {
+			e.current += e.weight
+			total += e.weight
+
+			if selected == nil || e.current > selected.current {
+				selected = e
+			}
+		}
+
+		selected.current -= total
+
+	default:
+		selected = available[b.next%len(available)]
+		b.next++
+	}
+
+	if selected != nil {
+		selected.pending++
+		selected.requests++
+	}
+
+	return selected
+}
+
+// release updates the endpoint state with the request result
+func (b *Balancer) release(e *endpoint, failed bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	e.pending--
+
+	if !failed {
+		e.fails = 0
+		return
+	}
+
+	e.failures++
+	e.fails++
+
+	maxFails := b.MaxFails
+	if maxFails <= 0 {
+		maxFails = 3
+	}
+
+	if e.fails >= maxFails {
+		ejectTime := b.EjectTime
+		if ejectTime <= 0 {
+			ejectTime = 30 * time.Second
+		}
+
+		e.ejectedUntil = time.Now().Add(ejectTime)
+		e.fails = 0
+	}
+}
+
+// BalancedTransport sends the requests for Host to the Balancer endpoints, replacing the URL scheme and host
+// (the path is not changed, so the endpoints should have the same base path).
+// Retryable requests (see IsRetryable) that fail with a connection error are sent to the next endpoint.
+type BalancedTransport struct {
+	Transport http.RoundTripper // the transport for the requests (http.DefaultTransport if nil)
+	Balancer  *Balancer
+	Host      string // the (virtual) host of the balanced requests, as in URL.Host
+}
+
+func (t *BalancedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr := t.Transport
+	if tr == nil {
+		tr = http.DefaultTransport
+	}
+
+	if !strings.EqualFold(req.URL.Host, t.Host) {
+		return tr.RoundTrip(req)
+	}
+
+	tried := map[*endpoint]bool{}
+
+	var lastErr error
+
+	for {
+		e := t.Balancer.acquire(tried)
+		if e == nil && lastErr != nil {
+			return nil, lastErr
+		} else if e == nil {
+			return nil, NoEndpoints
+		}
+
+		tried[e] = true
+
+		breq := req.Clone(req.Context())
+		breq.URL.Scheme = e.url.Scheme
+		breq.URL.Host = e.url.Host
+		if req.Host == "" || strings.EqualFold(req.Host, req.URL.Host) {
+			breq.Host = "" // use the endpoint host
+		}
+
+		resp, err := tr.RoundTrip(breq)
+		t.Balancer.release(e, err != nil || resp.StatusCode >= 500)
+
+		if err == nil {
+			return resp, nil
+		}
+
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+
+		lastErr = err
+
+		rreq, ok := replayRequest(req)
+		if !ok {
+			return nil, err
+		}
+
+		req = rreq
+	}
+}
+
+// Balance the requests to the client base URL across the endpoints (that replace the scheme and host of the base URL).
+// A nil balancer removes the load balancing.
+//
+// Note that the balancer wraps the current transport (see BalancedTransport).
+func (self *HttpClient) SetBalancer(b *Balancer) error {
+	if b != nil && self.BaseURL == nil {
+		return NoBaseURL
+	}
+
+	// the balancer may be wrapped by a LoggingTransport (see StartLogging)
+	tr := self.client.Transport
+	lt, logging := tr.(*LoggingTransport)
+	if logging {
+		tr = lt.t
+	}
+
+	if bt, ok := tr.(*BalancedTransport); ok {
+		tr = bt.Transport
+	} else if b == nil {
+		return nil
+	}
+
+	if b != nil {
+		tr = &BalancedTransport{Transport: tr, Balancer: b, Host: self.BaseURL.Host}
+	}
+
+	if logging {
+		lt.t = tr
+	} else {
+		self.client.Transport = tr
+	}
+
+	return nil
+}
+
+// Return the client balancer (nil if not set)
+func (self *HttpClient) GetBalancer() *Balancer {
+	tr := self.client.Transport
+	if lt, ok := tr.(*LoggingTransport); ok {
+		tr = lt.t
+	}
+
+	if bt, ok := tr.(*BalancedTransport); ok {
+		return bt.Balancer
+	}
+
+	return nil
+}
+
+// Create a new HttpClient that balances the requests across the base URLs (see NewBalancer for the format),
+// using the first one as the client base URL
+func NewBalancedClient(strategy BalanceStrategy, bases ...string) (*HttpClient, error) {
+	b, err := NewBalancer(strategy, bases...)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewHttpClientE(b.endpoints[0].url.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.SetBalancer(b); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
@@ -0,0 +1,32 @@
+package httpclient
+
+import (
+	"bytes"
+	"sync"
+)
+
+// buffers larger than this are not returned to the pool, to avoid retaining too much memory
+const maxPooledBuffer = 1 << 20
+
+// the pool of buffers for reading the response bodies (see ContentE).
+// The request bodies are not pooled: the transport can read them (or recreate them with GetBody) after the response is returned.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// get an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// return the buffer to the pool
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+
+	buf.Reset()
+	bufferPool.Put(buf)
+}
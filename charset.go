@@ -0,0 +1,104 @@
+package httpclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+var UnsupportedCharset = errors.New("Unsupported charset")
+
+var (
+	reMetaCharset = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([A-Za-z0-9._:-]+)`)
+	reXMLEncoding = regexp.MustCompile(`^<\?xml[^>]+encoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+)
+
+// Text reads the response body and returns it converted to UTF-8 (see DecodeText)
+func (resp *HttpResponse) Text() (string, error) {
+	body, err := resp.ContentE()
+	if err != nil {
+		return string(body), err
+	}
+
+	return DecodeText(resp.Header.Get("Content-Type"), body)
+}
+
+// DecodeText converts body to UTF-8, according to its charset (see DetectCharset).
+//
+// If the charset is not supported the body is returned as is, with an error wrapping UnsupportedCharset.
+func DecodeText(contentType string, body []byte) (string, error) {
+	name, bom := DetectCharset(contentType, body)
+	body = body[bom:]
+
+	switch name {
+	case "", "utf-8":
+		return string(body), nil
+	}
+
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return string(body), fmt.Errorf("%w %q", UnsupportedCharset, name)
+	}
+
+	b, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return string(body), err
+	}
+
+	return string(b), nil
+}
+
+// DetectCharset returns the (lowercase) charset of body and the length of the byte order mark, if present.
+//
+// The charset is taken from the byte order mark, the Content-Type charset parameter,
+// the meta tags (for HTML) or the XML declaration. HTML documents without a charset
+// that are not valid UTF-8 are assumed to be windows-1252. It returns "" if the charset is unknown.
+func DetectCharset(contentType string, body []byte) (string, int) {
+	switch {
+	case bytes.HasPrefix(body, []byte("\xef\xbb\xbf")):
+		return "utf-8", 3
+	case bytes.HasPrefix(body, []byte("\xfe\xff")):
+		return "utf-16be", 2
+	case bytes.HasPrefix(body, []byte("\xff\xfe")):
+		return "utf-16le", 2
+	}
+
+	ctype, params, _ := mime.ParseMediaType(contentType)
+	if cs := strings.ToLower(strings.TrimSpace(params["charset"])); cs != "" {
+		return cs, 0
+	}
+
+	head := body
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+
+	switch {
+	case ctype == "text/html" || ctype == "application/xhtml+xml":
+		if m := reMetaCharset.FindSubmatch(head); m != nil {
+			cs := strings.ToLower(string(m[1]))
+			if strings.HasPrefix(cs, "utf-16") { // the meta tag was readable as ASCII
+				cs = "utf-8"
+			}
+
+			return cs, 0
+		}
+
+		if !utf8.Valid(body) {
+			return "windows-1252", 0
+		}
+
+	case ctype == "text/xml" || ctype == "application/xml" || strings.HasSuffix(ctype, "+xml"):
+		if m := reXMLEncoding.FindSubmatch(head); m != nil {
+			return strings.ToLower(string(m[1])), 0
+		}
+	}
+
+	return "", 0
+}
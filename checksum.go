@@ -0,0 +1,291 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	NoDigest    = errors.New("No digest")
+	BodyNotRead = errors.New("Body not completely read")
+)
+
+// DigestMismatchError is returned by the last read of a response body that doesn't match its digest (see VerifyDigest)
+type DigestMismatchError struct {
+	Header    string // Content-Digest, Repr-Digest or Content-MD5
+	Algorithm string // sha-256, sha-512 or md5
+	Expected  string // base64
+	Actual    string // base64
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("Digest mismatch (%v %v): expected %v, got %v", e.Header, e.Algorithm, e.Expected, e.Actual)
+}
+
+// checksumHash returns the canonical name (sha256, sha512, sha1 or md5) and the hash function for the algorithm
+func checksumHash(algorithm string) (string, func() hash.Hash, error) {
+	switch strings.ToLower(strings.Replace(algorithm, "-", "", 1)) {
+	case "sha256":
+		return "sha256", sha256.New, nil
+	case "sha512":
+		return "sha512", sha512.New, nil
+	case "sha1":
+		return "sha1", sha1.New, nil
+	case "md5":
+		return "md5", md5.New, nil
+	}
+
+	return "", nil, fmt.Errorf("Unsupported checksum algorithm %q", algorithm)
+}
+
+type verifyDigestKey struct{}
+type checksumsKey struct{}
+
+// verify the response body against the Content-Digest or Repr-Digest (RFC 9530, sha-256 or sha-512) or Content-MD5 header:
+// the last read of a body that doesn't match returns a *DigestMismatchError (instead of io.EOF).
+// The Want-Repr-Digest header is set (if not already set) to ask the server for a digest.
+//
+// The responses without a supported digest are not verified. Note that Repr-Digest is not verified for partial (206) responses,
+// and the digests are not verified if the body was decompressed by the transport (they are computed on the compressed content).
+func VerifyDigest() RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		if req.Header.Get("Want-Repr-Digest") == "" {
+			req.Header.Set("Want-Repr-Digest", "sha-256=5, sha-512=3")
+		}
+
+		return req.WithContext(context.WithValue(req.Context(), verifyDigestKey{}, true)), nil
+	}
+}
+
+// compute the checksums of the response body (sha256, sha512, sha1 or md5, default sha256) while it's read (see HttpResponse.Checksum)
+func Checksums(algorithms ...string) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		if len(algorithms) == 0 {
+			algorithms = []string{"sha256"}
+		}
+
+		for _, a := range algorithms {
+			if _, _, err := checksumHash(a); err != nil {
+				return nil, err
+			}
+		}
+
+		return req.WithContext(context.WithValue(req.Context(), checksumsKey{}, algorithms)), nil
+	}
+}
+
+// an expected digest
+type expectedDigest struct {
+	header    string
+	algorithm string // the digest algorithm name (i.e. sha-256)
+	checksum  string // the checksum name (i.e. sha256)
+	value     []byte
+}
+
+// responseDigests returns the supported digests in the response headers (the strongest one for each header)
+func responseDigests(resp *http.Response) []expectedDigest {
+	var digests []expectedDigest
+
+	if resp.Uncompressed {
+		return nil
+	}
+
+	for _, header := range []string{"Content-Digest", "Repr-Digest"} {
+		if header == "Repr-Digest" && resp.StatusCode == http.StatusPartialContent {
+			continue
+		}
+
+		var best *expectedDigest
+
+		for _, item := range strings.Split(strings.Join(resp.Header.Values(header), ","), ",") {
+			item, _, _ = strings.Cut(item, ";") // parameters
+			k, v, ok := strings.Cut(strings.TrimSpace(item), "=")
+			if !ok {
+				continue
+			}
+
+			k = strings.ToLower(k)
+			if k != "sha-256" && k != "sha-512" {
+				continue
+			}
+			if best != nil && best.algorithm == "sha-512" { // the strongest
+				continue
+			}
+
+			v = strings.TrimSpace(v)
+			if len(v) < 2 || v[0] != ':' || v[len(v)-1] != ':' { // byte sequence
+				continue
+			}
+
+			value, err := base64.StdEncoding.DecodeString(v[1 : len(v)-1])
+			if err != nil {
+				continue
+			}
+
+			checksum, _, _ := checksumHash(k)
+			best = &expectedDigest{header: header, algorithm: k, checksum: checksum, value: value}
+		}
+
+		if best != nil {
+			digests = append(digests, *best)
+		}
+	}
+
+	if v := resp.Header.Get("Content-MD5"); v != "" {
+		if value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v)); err == nil {
+			digests = append(digests, expectedDigest{header: "Content-MD5", algorithm: "md5", checksum: "md5", value: value})
+		}
+	}
+
+	return digests
+}
+
+// a response body that computes its checksums while it's read, and verifies the expected digests
+type checksumBody struct {
+	io.ReadCloser
+
+	hashes   map[string]hash.Hash
+	expected []expectedDigest
+	read     int64
+	done     bool
+	err      error // the verification result
+}
+
+func (b *checksumBody) add(checksum string) {
+	if _, ok := b.hashes[checksum]; !ok {
+		_, newHash, _ := checksumHash(checksum)
+		b.hashes[checksum] = newHash()
+	}
+}
+
+func (b *checksumBody) Read(p []byte) (int, error) {
+	if b.done {
+		if b.err != nil {
+			return 0, b.err
+		}
+
+		return 0, io.EOF
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.read += int64(n)
+
+		for _, h := range b.hashes {
+			h.Write(p[:n])
+		}
+	}
+
+	if err == io.EOF {
+		b.done = true
+		b.err = b.verify()
+
+		if b.err != nil {
+			return n, b.err
+		}
+	}
+
+	return n, err
+}
+
+// verify returns a *DigestMismatchError for the first expected digest that doesn't match
+func (b *checksumBody) verify() error {
+	for _, d := range b.expected {
+		if actual := b.hashes[d.checksum].Sum(nil); !bytes.Equal(actual, d.value) {
+			return &DigestMismatchError{
+				Header:    d.header,
+				Algorithm: d.algorithm,
+				Expected:  base64.StdEncoding.EncodeToString(d.value),
+				Actual:    base64.StdEncoding.EncodeToString(actual),
+			}
+		}
+	}
+
+	return nil
+}
+
+// wrap the response body to compute the requested checksums and verify the digests (see VerifyDigest and Checksums)
+func checksumResponse(req *http.Request, resp *http.Response) {
+	verify, _ := req.Context().Value(verifyDigestKey{}).(bool)
+	checksums, _ := req.Context().Value(checksumsKey{}).([]string)
+
+	if (!verify && len(checksums) == 0) || resp.Body == nil || req.Method == "HEAD" {
+		return
+	}
+
+	b := &checksumBody{ReadCloser: resp.Body, hashes: map[string]hash.Hash{}}
+
+	for _, c := range checksums {
+		c, _, _ = checksumHash(c)
+		b.add(c)
+	}
+
+	if verify {
+		b.expected = responseDigests(resp)
+
+		for _, d := range b.expected {
+			b.add(d.checksum)
+		}
+	}
+
+	resp.Body = b
+}
+
+// VerifyDigest verifies the response body against the digest headers, as the VerifyDigest option does,
+// returning NoDigest if the response doesn't have a supported digest. It must be called before reading the body.
+func (resp *HttpResponse) VerifyDigest() error {
+	expected := responseDigests(&resp.Response)
+	if len(expected) == 0 {
+		return NoDigest
+	}
+
+	b, ok := resp.Body.(*checksumBody)
+	if ok && b.read > 0 {
+		return errors.New("Body already read")
+	}
+	if !ok {
+		b = &checksumBody{ReadCloser: resp.Body, hashes: map[string]hash.Hash{}}
+		resp.Body = b
+	}
+
+	b.expected = expected
+
+	for _, d := range expected {
+		b.add(d.checksum)
+	}
+
+	return nil
+}
+
+// Checksum returns the hex checksum of the response body (sha256, sha512, sha1 or md5), computed while it was read.
+// The checksum must be requested with the Checksums option (or be one of the verified digests, see VerifyDigest)
+// and the body must have been completely read, otherwise BodyNotRead is returned.
+func (resp *HttpResponse) Checksum(algorithm string) (string, error) {
+	checksum, _, err := checksumHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	b, ok := resp.Body.(*checksumBody)
+	if !ok || b.hashes[checksum] == nil {
+		return "", fmt.Errorf("No %v checksum for the response (see Checksums)", checksum)
+	}
+
+	if !b.done {
+		return "", BodyNotRead
+	}
+
+	return hex.EncodeToString(b.hashes[checksum].Sum(nil)), nil
+}
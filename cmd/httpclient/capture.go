@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gobs/cmd"
+)
+
+var (
+	reCapture = regexp.MustCompile(`(^|\s)--capture(=|\s+)(\S+)`) // --capture name=expr
+)
+
+// a variable to set from the response
+type captureVar struct {
+	name string
+	expr string
+}
+
+// parseCaptures removes the --capture name=expr options from the request parameters,
+// returning the remaining parameters and the list of variables to capture
+func parseCaptures(params string) (string, []captureVar, error) {
+	var captures []captureVar
+	var err error
+
+	params = reCapture.ReplaceAllStringFunc(params, func(m string) string {
+		c := reCapture.FindStringSubmatch(m)[3]
+
+		kv := strings.SplitN(c, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			err = fmt.Errorf("invalid capture %q (expected name=expression)", c)
+		} else {
+			captures = append(captures, captureVar{name: kv[0], expr: kv[1]})
+		}
+
+		return " "
+	})
+
+	return strings.TrimSpace(params), captures, err
+}
+
+// capture sets the variables from the last response. The expressions are the same as in expect
+// (status, header.name, body, body.path) plus header:name for headers and $.path for JSON body fields.
+//
+// Variables for values that are not found are set to the empty string.
+func capture(commander *cmd.Cmd, captures []captureVar) {
+	for _, c := range captures {
+		expr := c.expr
+
+		switch {
+		case strings.HasPrefix(expr, "header:"):
+			expr = "header." + expr[7:]
+
+		case expr == "$":
+			expr = "body"
+
+		case strings.HasPrefix(expr, "$."):
+			expr = "body." + expr[2:]
+		}
+
+		value, ok := responseValue(commander, expr)
+		if !ok {
+			fmt.Printf("capture: %v not found\n", c.expr)
+		}
+
+		commander.SetVar(c.name, value)
+	}
+}
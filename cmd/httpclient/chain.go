@@ -0,0 +1,170 @@
+package main
+
+// Request chains: a scenario composed of steps, where the values captured from a response
+// are used in the following requests.
+//
+//	step login
+//	  post /login {"user": "me", "password": "secret"}
+//	  expect status == 200
+//	  capture token = body.token
+//	  header Authorization "Bearer {{token}}"
+//
+//	step create
+//	  post /items {"name": "test"}
+//	  expect status == 201
+//	  capture id = body.id
+//	  rollback delete /items/{{id}}
+//
+//	step verify
+//	  get /items/{{id}}
+//	  expect body.name == test
+//
+// Any other line is executed as a command, after expanding the {{variables}}.
+// If a step fails, the rollback commands registered by the previous steps are executed in reverse order.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gobs/cmd"
+)
+
+var (
+	reChainCapture = regexp.MustCompile(`^capture\s+([\w.-]+)\s*=\s*(\S+)$`) // capture name = expression
+)
+
+// a step in a chain
+type chainStep struct {
+	Name  string
+	Lines []string
+}
+
+// parseChain parses a chain definition
+func parseChain(r io.Reader) ([]*chainStep, error) {
+	var steps []*chainStep
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+
+		case line == "step" || strings.HasPrefix(line, "step "):
+			name := strings.TrimSpace(strings.TrimPrefix(line, "step"))
+			if name == "" {
+				name = fmt.Sprint(len(steps) + 1)
+			}
+
+			steps = append(steps, &chainStep{Name: name})
+
+		case len(steps) == 0:
+			return nil, fmt.Errorf("line %v: expected step", lineno)
+
+		case strings.HasPrefix(line, "capture ") && !reChainCapture.MatchString(line):
+			return nil, fmt.Errorf("line %v: invalid capture %q", lineno, line)
+
+		default:
+			step := steps[len(steps)-1]
+			step.Lines = append(step.Lines, line)
+		}
+	}
+
+	return steps, scanner.Err()
+}
+
+func readChain(filename string) ([]*chainStep, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseChain(f)
+}
+
+// runChain executes the steps in order, stopping at the first failure.
+// If cleanup is true, the rollback commands are executed also when all the steps succeed.
+// It returns true if all the steps succeeded.
+func runChain(commander *cmd.Cmd, steps []*chainStep, cleanup bool) bool {
+	var rollbacks []string
+
+	lookup := func(name string) (string, bool) {
+		if v, ok := dynamicVar(name); ok {
+			return v, true
+		}
+
+		if v := commander.GetVar(name); v != "" {
+			return v, true
+		}
+
+		return "", false
+	}
+
+	ok := true
+
+steps:
+	for _, step := range steps {
+		fmt.Println("step", step.Name)
+
+		commander.SetVar("error", "")
+
+		for _, line := range step.Lines {
+			line = expandTemplateWith(line, lookup)
+
+			switch {
+			case strings.HasPrefix(line, "capture "):
+				m := reChainCapture.FindStringSubmatch(line)
+
+				v, found := responseValue(commander, m[2])
+				if !found {
+					fail(commander, fmt.Sprintf("step %v: cannot capture %v", step.Name, m[2]))
+					ok = false
+					break steps
+				}
+
+				commander.SetVar(m[1], v)
+
+			case strings.HasPrefix(line, "expect "):
+				if !checkExpect(commander, strings.TrimSpace(line[7:])) {
+					ok = false
+					break steps
+				}
+
+			case strings.HasPrefix(line, "rollback "):
+				rollbacks = append(rollbacks, strings.TrimSpace(line[9:]))
+
+			default:
+				if commander.OneCmd(line) {
+					ok = false
+					break steps
+				}
+
+				if err := commander.GetVar("error"); err != "" {
+					fmt.Printf("step %v failed: %v\n", step.Name, err)
+					ok = false
+					break steps
+				}
+			}
+		}
+	}
+
+	if !ok || cleanup {
+		for i := len(rollbacks) - 1; i >= 0; i-- {
+			fmt.Println("rollback", rollbacks[i])
+
+			err := commander.GetVar("error")
+			commander.OneCmd(rollbacks[i])
+			commander.SetVar("error", err) // keep the original error
+		}
+	}
+
+	return ok
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+var errNoClipboard = errors.New("No clipboard command available (install xclip, xsel or wl-clipboard)")
+
+// clipboardCommands returns the commands to write to and read from the system clipboard
+func clipboardCommands() (copyCmd, pasteCmd []string, err error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"pbcopy"}, []string{"pbpaste"}, nil
+
+	case "windows":
+		return []string{"clip"}, []string{"powershell", "-NoProfile", "-Command", "Get-Clipboard"}, nil
+	}
+
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if _, err := exec.LookPath("wl-copy"); err == nil {
+			return []string{"wl-copy"}, []string{"wl-paste", "--no-newline"}, nil
+		}
+	}
+
+	if _, err := exec.LookPath("xclip"); err == nil {
+		return []string{"xclip", "-selection", "clipboard"}, []string{"xclip", "-selection", "clipboard", "-o"}, nil
+	}
+
+	if _, err := exec.LookPath("xsel"); err == nil {
+		return []string{"xsel", "--clipboard", "--input"}, []string{"xsel", "--clipboard", "--output"}, nil
+	}
+
+	return nil, nil, errNoClipboard
+}
+
+// copyToClipboard puts the text on the system clipboard
+func copyToClipboard(text string) error {
+	copyCmd, _, err := clipboardCommands()
+	if err != nil {
+		return err
+	}
+
+	c := exec.Command(copyCmd[0], copyCmd[1:]...)
+	c.Stdin = strings.NewReader(text)
+	return c.Run()
+}
+
+// readClipboard returns the content of the system clipboard
+func readClipboard() (string, error) {
+	_, pasteCmd, err := clipboardCommands()
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+
+	c := exec.Command(pasteCmd[0], pasteCmd[1:]...)
+	c.Stdout = &out
+	if err := c.Run(); err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(out.String(), "\r\n"), nil
+}
+
+// curlCommand returns the curl command line for the request
+func curlCommand(r *restRequest) string {
+	parts := []string{"curl"}
+
+	if r.Method != "GET" {
+		if r.Method == "HEAD" {
+			parts = append(parts, "-I")
+		} else {
+			parts = append(parts, "-X", r.Method)
+		}
+	}
+
+	parts = append(parts, shellQuote(r.URL))
+
+	for _, h := range r.Headers {
+		parts = append(parts, "-H", shellQuote(fmt.Sprintf("%v: %v", h[0], h[1])))
+	}
+
+	if r.Body != "" {
+		parts = append(parts, "--data-raw", shellQuote(r.Body))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// shellQuote quotes a string for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,150 @@
+package main
+
+// Named requests collections, saved in .http format (so they can also be executed with the "http" command)
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gobs/httpclient"
+)
+
+// the default collection file
+const COLLECTION_FILE = "httpclient_collection.http"
+
+var (
+	collectionFile = COLLECTION_FILE
+
+	// headers that are not saved in the collection (set by the client, or credentials)
+	unsavedHeaders = map[string]bool{
+		"Authorization":   true,
+		"Cookie":          true,
+		"User-Agent":      true,
+		"Content-Length":  true,
+		"Accept-Encoding": true,
+	}
+)
+
+// readCollection reads the collection file (an empty collection if the file doesn't exist)
+func readCollection(filename string) (*restFile, error) {
+	f, err := readRestFile(filename)
+	if os.IsNotExist(err) {
+		return &restFile{Vars: map[string]string{}}, nil
+	}
+
+	return f, err
+}
+
+// writeCollection writes the collection file
+func writeCollection(filename string, f *restFile) error {
+	fd, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	err = f.Write(fd)
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// Write writes the file variables and the requests in .http format
+func (f *restFile) Write(w io.Writer) error {
+	names := make([]string, 0, len(f.Vars))
+	for k := range f.Vars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		if _, err := fmt.Fprintf(w, "@%v = %v\n", k, f.Vars[k]); err != nil {
+			return err
+		}
+	}
+
+	for i, r := range f.Requests {
+		if i > 0 || len(names) > 0 {
+			if _, err := fmt.Fprintln(w, "\n###"); err != nil {
+				return err
+			}
+		}
+
+		if _, err := io.WriteString(w, r.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Set adds the request to the file, replacing the request with the same name
+func (f *restFile) Set(r *restRequest) {
+	for i, fr := range f.Requests {
+		if fr.Name == r.Name {
+			f.Requests[i] = r
+			return
+		}
+	}
+
+	f.Requests = append(f.Requests, r)
+}
+
+// Remove removes the named request, returning false if not found
+func (f *restFile) Remove(name string) bool {
+	for i, r := range f.Requests {
+		if r.Name == name {
+			f.Requests = append(f.Requests[:i], f.Requests[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// namedRequest returns a copy of the request with the specified name, with the URL relative
+// to the base URL (if possible) and without the client or credential headers
+func namedRequest(r *restRequest, name string, base *url.URL) *restRequest {
+	nr := &restRequest{Name: name, Method: r.Method, URL: relativeURL(r.URL, base), Body: r.Body}
+
+	for _, h := range r.Headers {
+		if !unsavedHeaders[http.CanonicalHeaderKey(h[0])] && h[1] != httpclient.RedactedValue {
+			nr.Headers = append(nr.Headers, h)
+		}
+	}
+
+	return nr
+}
+
+// relativeURL returns the URL relative to the base URL, if it resolves back to the same URL
+func relativeURL(u string, base *url.URL) string {
+	if base == nil {
+		return u
+	}
+
+	var rel string
+
+	if b := base.String(); strings.HasSuffix(b, "/") && strings.HasPrefix(u, b) {
+		rel = u[len(b):]
+	} else if pu, err := url.Parse(u); err == nil && pu.Scheme == base.Scheme && pu.Host == base.Host {
+		rel = pu.RequestURI()
+	} else {
+		return u
+	}
+
+	if rel == "" {
+		rel = "./"
+	}
+
+	if ru, err := base.Parse(rel); err != nil || ru.String() != u {
+		return u
+	}
+
+	return rel
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	jsonplugin "github.com/gobs/cmd/plugins/json"
+	"github.com/gobs/simplejson"
+)
+
+// a color theme (ANSI escape sequences)
+type colorTheme struct {
+	Name string
+
+	Key    string
+	String string
+	Number string
+	Bool   string
+	Null   string
+
+	Header string
+
+	Status2xx string
+	Status3xx string
+	Status4xx string
+	Status5xx string
+}
+
+const colorReset = "\x1b[0m"
+
+var themes = map[string]*colorTheme{
+	"dark": {
+		Name:      "dark",
+		Key:       "\x1b[1;34m",
+		String:    "\x1b[32m",
+		Number:    "\x1b[36m",
+		Bool:      "\x1b[33m",
+		Null:      "\x1b[90m",
+		Header:    "\x1b[1;36m",
+		Status2xx: "\x1b[1;32m",
+		Status3xx: "\x1b[1;36m",
+		Status4xx: "\x1b[1;33m",
+		Status5xx: "\x1b[1;31m",
+	},
+
+	"light": {
+		Name:      "light",
+		Key:       "\x1b[34m",
+		String:    "\x1b[32m",
+		Number:    "\x1b[35m",
+		Bool:      "\x1b[33m",
+		Null:      "\x1b[37m",
+		Header:    "\x1b[34m",
+		Status2xx: "\x1b[32m",
+		Status3xx: "\x1b[36m",
+		Status4xx: "\x1b[33m",
+		Status5xx: "\x1b[31m",
+	},
+
+	"none": {Name: "none"},
+}
+
+// the current theme (see the "color" command)
+var theme = defaultTheme()
+
+// defaultTheme returns the "dark" theme, or "none" if NO_COLOR is set
+// or the output is not a terminal
+func defaultTheme() *colorTheme {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return themes["none"]
+	}
+
+	if fi, err := os.Stdout.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return themes["none"]
+	}
+
+	return themes["dark"]
+}
+
+func (t *colorTheme) enabled() bool {
+	return t.Name != "none"
+}
+
+func (t *colorTheme) color(c, s string) string {
+	if c == "" {
+		return s
+	}
+
+	return c + s + colorReset
+}
+
+// Status returns the status colored according to the status code
+func (t *colorTheme) Status(status string, code int) string {
+	switch code / 100 {
+	case 2:
+		return t.color(t.Status2xx, status)
+	case 3:
+		return t.color(t.Status3xx, status)
+	case 4:
+		return t.color(t.Status4xx, status)
+	case 5:
+		return t.color(t.Status5xx, status)
+	}
+
+	return status
+}
+
+// formatJson returns the value as indented JSON, with syntax highlighting if color is true
+// and the theme is enabled
+func formatJson(v interface{}, color bool) string {
+	if !color || !theme.enabled() {
+		return simplejson.MustDumpString(v, simplejson.Indent("  "))
+	}
+
+	var sb strings.Builder
+	theme.writeJson(&sb, v, "")
+	return sb.String()
+}
+
+// printHeaders prints the response headers, sorted by name
+func printHeaders(h http.Header) {
+	if !theme.enabled() {
+		jsonplugin.PrintJson(h)
+		return
+	}
+
+	names := make([]string, 0, len(h))
+	for k := range h {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		for _, v := range h[k] {
+			fmt.Printf("%v: %v\n", theme.color(theme.Header, k), v)
+		}
+	}
+}
+
+func (t *colorTheme) writeJson(w io.StringWriter, v interface{}, indent string) {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		if len(vv) == 0 {
+			w.WriteString("{}")
+			return
+		}
+
+		keys := make([]string, 0, len(vv))
+		for k := range vv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		w.WriteString("{\n")
+		for i, k := range keys {
+			kb, _ := json.Marshal(k)
+
+			w.WriteString(indent + "  " + t.color(t.Key, string(kb)) + ": ")
+			t.writeJson(w, vv[k], indent+"  ")
+			if i < len(keys)-1 {
+				w.WriteString(",")
+			}
+			w.WriteString("\n")
+		}
+		w.WriteString(indent + "}")
+
+	case []interface{}:
+		if len(vv) == 0 {
+			w.WriteString("[]")
+			return
+		}
+
+		w.WriteString("[\n")
+		for i, e := range vv {
+			w.WriteString(indent + "  ")
+			t.writeJson(w, e, indent+"  ")
+			if i < len(vv)-1 {
+				w.WriteString(",")
+			}
+			w.WriteString("\n")
+		}
+		w.WriteString(indent + "]")
+
+	case string:
+		b, _ := json.Marshal(vv)
+		w.WriteString(t.color(t.String, string(b)))
+
+	case bool:
+		w.WriteString(t.color(t.Bool, fmt.Sprint(vv)))
+
+	case nil:
+		w.WriteString(t.color(t.Null, "null"))
+
+	case float64, json.Number, int, int64:
+		w.WriteString(t.color(t.Number, fmt.Sprint(vv)))
+
+	default: // other types: convert to generic JSON first
+		b, err := json.Marshal(vv)
+		if err != nil {
+			w.WriteString(fmt.Sprint(vv))
+			return
+		}
+
+		var g interface{}
+		if err := json.Unmarshal(b, &g); err != nil {
+			w.WriteString(string(b))
+			return
+		}
+
+		t.writeJson(w, g, indent)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gobs/args"
+	"github.com/gobs/cmd"
+	"github.com/gobs/httpclient"
+)
+
+const cookieUsage = "usage: cookie set name=value [domain] [--path=path] [--secure] | cookie del name [domain] | cookie list [url] | cookie import file | cookie export file"
+
+// cookieCommand manages the client cookies (sent to the matching hosts on every request)
+func cookieCommand(commander *cmd.Cmd, client *httpclient.HttpClient, line string) {
+	pargs := args.ParseArgs(line)
+	options, parts := pargs.Options, pargs.Arguments
+	if len(parts) == 0 {
+		parts = []string{"list"}
+	}
+
+	fail := func(err error) {
+		fmt.Println(err)
+		commander.SetVar("error", err)
+	}
+
+	switch {
+	case parts[0] == "set" && (len(parts) == 2 || len(parts) == 3):
+		kv := strings.SplitN(parts[1], "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			fmt.Println(cookieUsage)
+			return
+		}
+
+		c := &http.Cookie{Name: kv[0], Value: kv[1], Path: options["path"]}
+		if len(parts) == 3 {
+			c.Domain = parts[2]
+		}
+		if _, ok := options["secure"]; ok {
+			c.Secure = true
+		}
+
+		client.AddCookie(c)
+
+	case parts[0] == "del" && (len(parts) == 2 || len(parts) == 3):
+		domain := ""
+		if len(parts) == 3 {
+			domain = parts[2]
+		}
+
+		if client.RemoveCookie(parts[1], domain) == 0 {
+			fmt.Println("cookie not found:", parts[1])
+		}
+
+	case parts[0] == "list" && len(parts) <= 2:
+		var cookies []*http.Cookie
+		if len(parts) == 2 {
+			cookies = client.CookiesFor(parts[1])
+		} else {
+			cookies = client.Cookies
+		}
+
+		if len(cookies) == 0 {
+			fmt.Println("no cookies")
+			return
+		}
+
+		for _, c := range cookies {
+			domain := c.Domain
+			if domain == "" {
+				domain = "(base)"
+			}
+
+			fmt.Printf("  %-20v %v=%v %v\n", domain, c.Name, c.Value, c.Path)
+		}
+
+	case parts[0] == "import" && len(parts) == 2:
+		f, err := os.Open(parts[1])
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		defer f.Close()
+
+		if err := client.ImportCookies(f); err != nil {
+			fail(err)
+		}
+
+	case parts[0] == "export" && len(parts) == 2:
+		f, err := os.Create(parts[1])
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		err = client.ExportCookies(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fail(err)
+		}
+
+	default:
+		fmt.Println(cookieUsage)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gobs/cmd"
+)
+
+// the paths ignored by diff, in addition to the --ignore ones
+var defaultDiffIgnore = []string{"header.Date", "header.Age"}
+
+// a response, for diff
+type diffResponse struct {
+	Status string
+	Header http.Header
+	Body   string
+}
+
+// lastResponses keeps the last two responses (see processResponse)
+type lastResponses struct {
+	lock      sync.Mutex
+	responses []*diffResponse
+	count     int
+}
+
+var recentResponses = &lastResponses{}
+
+func (l *lastResponses) add(r *diffResponse) {
+	l.lock.Lock()
+	l.responses = append(l.responses, r)
+	l.count++
+	if len(l.responses) > 2 {
+		l.responses = l.responses[len(l.responses)-2:]
+	}
+	l.lock.Unlock()
+}
+
+// Count returns the number of responses added
+func (l *lastResponses) Count() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.count
+}
+
+// Last returns the last response (nil if there are no responses)
+func (l *lastResponses) Last() *diffResponse {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if len(l.responses) == 0 {
+		return nil
+	}
+
+	return l.responses[len(l.responses)-1]
+}
+
+// Last2 returns the last two responses (nil if there are less than two)
+func (l *lastResponses) Last2() (*diffResponse, *diffResponse) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if len(l.responses) < 2 {
+		return nil, nil
+	}
+
+	return l.responses[0], l.responses[1]
+}
+
+// a difference between two responses (the value is missing if not ok)
+type difference struct {
+	Path string // status, header.name, body or body.path (as in expect)
+
+	A, B     string
+	okA, okB bool
+
+	Lines []string // the line differences of non-JSON bodies
+}
+
+// diffIgnored returns true if path matches (or is inside) one of the ignored paths,
+// where "*" matches any key or index (i.e. body.items.*.id)
+func diffIgnored(path string, ignore []string) bool {
+	parts := strings.Split(path, ".")
+
+	for _, ig := range ignore {
+		iparts := strings.Split(ig, ".")
+		if len(iparts) > len(parts) {
+			continue
+		}
+
+		match := true
+
+		for i, p := range iparts {
+			if p == "*" {
+				continue
+			}
+
+			if i == 1 && parts[0] == "header" {
+				match = strings.EqualFold(p, parts[i])
+			} else {
+				match = p == parts[i]
+			}
+
+			if !match {
+				break
+			}
+		}
+
+		if match {
+			return true
+		}
+	}
+
+	return false
+}
+
+// diffResponses returns the differences in status, headers and body between a and b.
+// JSON bodies are compared structurally (object keys in any order), the others line by line.
+func diffResponses(a, b *diffResponse, ignore []string) []difference {
+	var diffs []difference
+
+	add := func(d difference) {
+		if !diffIgnored(d.Path, ignore) {
+			diffs = append(diffs, d)
+		}
+	}
+
+	if a.Status != b.Status {
+		add(difference{Path: "status", A: a.Status, B: b.Status, okA: true, okB: true})
+	}
+
+	names := map[string]bool{}
+	for k := range a.Header {
+		names[k] = true
+	}
+	for k := range b.Header {
+		names[k] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for k := range names {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		va, okA := a.Header[k]
+		vb, okB := b.Header[k]
+
+		if sa, sb := strings.Join(va, ", "), strings.Join(vb, ", "); okA != okB || sa != sb {
+			add(difference{Path: "header." + k, A: sa, B: sb, okA: okA, okB: okB})
+		}
+	}
+
+	if a.Body == b.Body || diffIgnored("body", ignore) {
+		return diffs
+	}
+
+	var ja, jb interface{}
+
+	if json.Unmarshal([]byte(a.Body), &ja) == nil && json.Unmarshal([]byte(b.Body), &jb) == nil {
+		diffJson("body", ja, jb, add)
+		return diffs
+	}
+
+	lines := lineDiff(strings.Split(a.Body, "\n"), strings.Split(b.Body, "\n"))
+	add(difference{Path: "body", okA: true, okB: true, Lines: lines})
+	return diffs
+}
+
+// diffJson adds the differences between the JSON values a and b, at path
+func diffJson(path string, a, b interface{}, add func(difference)) {
+	switch va := a.(type) {
+	case map[string]interface{}:
+		if vb, ok := b.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(va)+len(vb))
+			for k := range va {
+				keys = append(keys, k)
+			}
+			for k := range vb {
+				if _, ok := va[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				diffJsonItem(path+"."+k, va, vb, k, add)
+			}
+			return
+		}
+
+	case []interface{}:
+		if vb, ok := b.([]interface{}); ok {
+			n := len(va)
+			if len(vb) > n {
+				n = len(vb)
+			}
+
+			for i := 0; i < n; i++ {
+				p := path + "." + strconv.Itoa(i)
+
+				switch {
+				case i >= len(va):
+					add(difference{Path: p, B: jsonString(vb[i]), okB: true})
+				case i >= len(vb):
+					add(difference{Path: p, A: jsonString(va[i]), okA: true})
+				default:
+					diffJson(p, va[i], vb[i], add)
+				}
+			}
+			return
+		}
+	}
+
+	if sa, sb := jsonString(a), jsonString(b); sa != sb {
+		add(difference{Path: path, A: sa, B: sb, okA: true, okB: true})
+	}
+}
+
+// diffJsonItem compares the key of the objects a and b
+func diffJsonItem(path string, a, b map[string]interface{}, k string, add func(difference)) {
+	va, okA := a[k]
+	vb, okB := b[k]
+
+	switch {
+	case okA && okB:
+		diffJson(path, va, vb, add)
+	case okA:
+		add(difference{Path: path, A: jsonString(va), okA: true})
+	default:
+		add(difference{Path: path, B: jsonString(vb), okB: true})
+	}
+}
+
+// jsonString returns the compact JSON representation of v
+func jsonString(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// printDiff prints the differences ("-" for the first response, "+" for the second one)
+func printDiff(diffs []difference) {
+	if len(diffs) == 0 {
+		fmt.Println("  (no differences)")
+		return
+	}
+
+	for _, d := range diffs {
+		if d.Lines != nil {
+			fmt.Println(d.Path + ":")
+
+			for _, l := range d.Lines {
+				switch l[0] {
+				case '-':
+					l = theme.color(theme.Status5xx, l)
+				case '+':
+					l = theme.color(theme.Status2xx, l)
+				}
+
+				fmt.Println(l)
+			}
+
+			continue
+		}
+
+		if d.okA {
+			fmt.Println(theme.color(theme.Status5xx, "- "+d.Path+": "+d.A))
+		}
+		if d.okB {
+			fmt.Println(theme.color(theme.Status2xx, "+ "+d.Path+": "+d.B))
+		}
+	}
+}
+
+// diffRequests executes the two requests (commands, or names of requests in the collection)
+// and returns their responses
+func diffRequests(commander *cmd.Cmd, a, b string) (*diffResponse, *diffResponse, error) {
+	print := commander.GetVar("print")
+	commander.SetVar("print", false)
+	defer commander.SetVar("print", print)
+
+	for _, line := range []string{a, b} {
+		if !strings.ContainsAny(line, " \t") && !strings.HasPrefix(line, "@") {
+			line = "load " + line // a request in the collection
+		}
+
+		count := recentResponses.Count()
+		commander.OneCmd(line)
+
+		if recentResponses.Count() == count {
+			return nil, nil, fmt.Errorf("no response for %q", line)
+		}
+	}
+
+	ra, rb := recentResponses.Last2()
+	return ra, rb, nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobs/cmd"
+)
+
+var (
+	reExpectTime = regexp.MustCompile(`^time\s*(<=|<|>=|>)\s*(\S+)$`)                                    // time < 300ms
+	reExpect     = regexp.MustCompile(`^(\S+)\s*(==|!=|<=|<|>=|>|\s+contains\s+|\s+matches\s+)\s*(.*)$`) // value op expected
+)
+
+// parseExpectTime parses a latency assertion (time < 300ms)
+func parseExpectTime(line string) (op string, limit time.Duration, err error) {
+	m := reExpectTime.FindStringSubmatch(line)
+	if m == nil {
+		return "", 0, fmt.Errorf("invalid expression %q", line)
+	}
+
+	limit, err = time.ParseDuration(m[2])
+	return m[1], limit, err
+}
+
+// compareTime returns true if the elapsed time satisfies the condition
+func compareTime(elapsed time.Duration, op string, limit time.Duration) bool {
+	switch op {
+	case "<":
+		return elapsed < limit
+	case "<=":
+		return elapsed <= limit
+	case ">":
+		return elapsed > limit
+	case ">=":
+		return elapsed >= limit
+	}
+
+	return false
+}
+
+// checkTime verifies the latency of the last request and reports a failure
+// (with the request trace breakdown) if the condition is not satisfied
+func checkTime(commander *cmd.Cmd, op string, limit time.Duration) bool {
+	elapsed, err := time.ParseDuration(commander.GetVar("elapsed"))
+	if err != nil {
+		fail(commander, "no request to check")
+		return false
+	}
+
+	if compareTime(elapsed, op, limit) {
+		return true
+	}
+
+	fail(commander, fmt.Sprintf("time %v, expected %v %v %v", elapsed.Truncate(100*time.Microsecond),
+		op, limit, commander.GetVar("rtrace")))
+	return false
+}
+
+// checkExpect evaluates an assertion on the last response:
+//
+//	time < 300ms
+//	status == 200
+//	header.Content-Type contains json
+//	body.items.0.name == "test"
+func checkExpect(commander *cmd.Cmd, line string) bool {
+	if op, limit, err := parseExpectTime(line); err == nil {
+		return checkTime(commander, op, limit)
+	}
+
+	m := reExpect.FindStringSubmatch(line)
+	if m == nil {
+		fail(commander, fmt.Sprintf("invalid expression %q", line))
+		return false
+	}
+
+	name, op, expected := m[1], strings.TrimSpace(m[2]), unquote(strings.TrimSpace(m[3]))
+
+	value, ok := responseValue(commander, name)
+	if !ok && op != "!=" {
+		fail(commander, fmt.Sprintf("%v not found", name))
+		return false
+	}
+
+	ok, err := compareValues(value, op, expected)
+	if err != nil {
+		fail(commander, err.Error())
+		return false
+	}
+
+	if !ok {
+		fail(commander, fmt.Sprintf("%v is %q, expected %v %q", name, value, op, expected))
+	}
+
+	return ok
+}
+
+// compareValues compares two values, as numbers if they are both numeric
+func compareValues(value, op, expected string) (bool, error) {
+	switch op {
+	case "contains":
+		return strings.Contains(value, expected), nil
+
+	case "matches":
+		re, err := regexp.Compile(expected)
+		if err != nil {
+			return false, err
+		}
+
+		return re.MatchString(value), nil
+	}
+
+	c := strings.Compare(value, expected)
+
+	if v, err := strconv.ParseFloat(value, 64); err == nil {
+		if e, err := strconv.ParseFloat(expected, 64); err == nil {
+			switch {
+			case v < e:
+				c = -1
+			case v > e:
+				c = 1
+			default:
+				c = 0
+			}
+		}
+	}
+
+	switch op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+
+	return false, fmt.Errorf("invalid operator %q", op)
+}
+
+// responseValue returns a value from the last response:
+//
+//	status         the status code
+//	elapsed        the request latency
+//	header.name    a response header
+//	body           the response body
+//	body.path      a field of the JSON body (i.e. body.items.0.id)
+//	name           any other variable
+func responseValue(commander *cmd.Cmd, name string) (string, bool) {
+	switch {
+	case name == "status":
+		status := commander.GetVar("status")
+		if i := strings.Index(status, " "); i > 0 {
+			status = status[:i]
+		}
+
+		return status, status != ""
+
+	case name == "body":
+		return commander.GetVar("body"), true
+
+	case strings.HasPrefix(name, "header."):
+		var headers http.Header
+		if err := json.Unmarshal([]byte(commander.GetVar("headers")), &headers); err != nil {
+			return "", false
+		}
+
+		values, ok := headers[http.CanonicalHeaderKey(name[7:])]
+		return strings.Join(values, ", "), ok
+
+	case strings.HasPrefix(name, "body."):
+		var body interface{}
+		if err := json.Unmarshal([]byte(commander.GetVar("body")), &body); err != nil {
+			return "", false
+		}
+
+		v, ok := jsonPath(body, name[5:])
+		if !ok {
+			return "", false
+		}
+
+		if s, ok := v.(string); ok {
+			return s, true
+		}
+
+		b, _ := json.Marshal(v)
+		return string(b), true
+
+	default:
+		v := commander.GetVar(name)
+		return v, v != ""
+	}
+}
+
+// jsonPath returns the value at the dotted path (object keys or array indices)
+func jsonPath(v interface{}, path string) (interface{}, bool) {
+	for _, k := range strings.Split(path, ".") {
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			val, ok := vv[k]
+			if !ok {
+				return nil, false
+			}
+
+			v = val
+
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(vv) {
+				return nil, false
+			}
+
+			v = vv[i]
+
+		default:
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+// fail reports an assertion failure, setting the error variable and incrementing the failures counter
+func fail(commander *cmd.Cmd, msg string) {
+	fmt.Println("FAIL:", msg)
+
+	commander.SetVar("error", msg)
+	commander.SetVar("failures", commander.GetIntVar("failures")+1)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	reTemplateVar = regexp.MustCompile(`\{\{\s*(\$?[\w.-]+)\s*\}\}`) // {{name}}
+)
+
+// expandTemplate replaces {{name}} with the corresponding value
+// (unknown names are left as they are)
+func expandTemplate(s string, vars map[string]string) string {
+	return expandTemplateWith(s, func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	})
+}
+
+// expandTemplateWith replaces {{name}} with the value returned by lookup
+// (names not found are left as they are)
+func expandTemplateWith(s string, lookup func(name string) (string, bool)) string {
+	return reTemplateVar.ReplaceAllStringFunc(s, func(m string) string {
+		name := reTemplateVar.FindStringSubmatch(m)[1]
+		if v, ok := lookup(name); ok {
+			return v
+		}
+
+		return m
+	})
+}
+
+// readRows reads a data file and returns the list of rows as name/value maps.
+//
+// Files with a .jsonl, .ndjson or .json extension are read as JSON lines (one object per line),
+// other files as CSV, where the first line is the header.
+// Values are also available as col1, col2... in column order (CSV only).
+func readRows(filename string) ([]map[string]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jsonl", ".ndjson", ".json":
+		return readJsonRows(f)
+	default:
+		return readCsvRows(f)
+	}
+}
+
+func readCsvRows(r io.Reader) ([]map[string]string, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	rows := make([]map[string]string, 0, len(records)-1)
+
+	for _, rec := range records[1:] {
+		row := map[string]string{}
+
+		for i, v := range rec {
+			row["col"+strconv.Itoa(i+1)] = v
+
+			if i < len(header) && header[i] != "" {
+				row[strings.TrimSpace(header[i])] = v
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func readJsonRows(r io.Reader) ([]map[string]string, error) {
+	var rows []map[string]string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &obj); err != nil {
+			return nil, fmt.Errorf("line %v: %v", lineno, err)
+		}
+
+		row := make(map[string]string, len(obj))
+
+		for k, v := range obj {
+			switch v.(type) {
+			case map[string]interface{}, []interface{}:
+				b, _ := json.Marshal(v)
+				row[k] = string(b)
+			case nil:
+				row[k] = "null"
+			default:
+				row[k] = fmt.Sprint(v)
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func FuzzParseValue(f *testing.F) {
+	for _, s := range []string{`{"a": 1}`, `[1, "two"]`, `"quoted"`, `'single'`, "true", "null", "42", "-3.14", "1e400", "{", ""} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		v, err := parseValue(s)
+		if err != nil {
+			if !strings.HasPrefix(s, "{") && !strings.HasPrefix(s, "[") {
+				t.Fatalf("%q: unexpected error %v", s, err)
+			}
+
+			return
+		}
+
+		switch v := v.(type) {
+		case int64:
+			if n, err := strconv.ParseInt(s, 10, 64); err != nil || n != v {
+				t.Fatalf("%q: unexpected integer %v", s, v)
+			}
+
+		case string:
+			if len(v) > len(s) {
+				t.Fatalf("%q: unexpected string %q", s, v)
+			}
+		}
+	})
+}
+
+func FuzzHeader(f *testing.F) {
+	for _, s := range []string{"content-type", "X-API-KEY", "x--double", "ünïcode-name", "bad name", "-"} {
+		f.Add(s, "value")
+	}
+
+	f.Add("x-injected", "a\r\nEvil: 1")
+
+	f.Fuzz(func(t *testing.T, name, value string) {
+		hname := headerName(name)
+
+		if headerName(hname) != hname {
+			t.Fatalf("%q: header name not idempotent: %q", name, hname)
+		}
+		if isASCII(name) && !strings.EqualFold(hname, name) {
+			t.Fatalf("%q: header name changed: %q", name, hname)
+		}
+
+		if checkHeader(hname, value) != nil {
+			return
+		}
+
+		if strings.ContainsAny(hname, ": \r\n") || strings.ContainsAny(value, "\r\n") {
+			t.Fatalf("%q: %q: invalid header accepted", hname, value)
+		}
+	})
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobs/cmd"
+	"github.com/gobs/httpclient/httpserve"
+	"github.com/gobs/simplejson"
+)
+
+// the default time listen wait waits for the requests
+const defaultListenWait = 60 * time.Second
+
+// listener is the background server started by the listen command
+type listener struct {
+	server *httpserve.Server
+	seen   int // the number of requests already printed
+}
+
+// the canned response of the listen command
+type listenResponse struct {
+	path        string
+	status      int
+	body        string
+	contentType string
+}
+
+// startListener starts a recording server on addr that responds to all the requests under path with the canned response
+func startListener(addr string, secure bool, r listenResponse) (*listener, error) {
+	if strings.HasPrefix(r.body, "@") {
+		b, err := os.ReadFile(r.body[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		r.body = string(b)
+	}
+
+	var headers map[string]string
+	if r.contentType != "" {
+		headers = map[string]string{"Content-Type": r.contentType}
+	}
+
+	if r.path == "" {
+		r.path = "/"
+	}
+	if r.status == 0 {
+		r.status = 200
+	}
+
+	server := httpserve.New(addr).Record(true).Respond("", r.path, r.status, r.body, headers)
+
+	if secure {
+		if err := server.SelfSigned(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := server.Start(); err != nil {
+		return nil, err
+	}
+
+	return &listener{server: server}, nil
+}
+
+// wait waits until count new requests are received (or the timeout expires) and returns the new requests
+func (l *listener) wait(count int, timeout time.Duration) ([]httpserve.Request, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	requests, err := l.server.WaitRequests(ctx, l.seen+count)
+	if l.seen > len(requests) { // cleared
+		l.seen = 0
+	}
+
+	requests, l.seen = requests[l.seen:], len(requests)
+	return requests, err
+}
+
+// printRequest prints the request line, headers and body
+func printRequest(n int, r httpserve.Request) {
+	fmt.Printf("#%d %v %v %v %v\n", n, r.Time.Format(time.TimeOnly), r.RemoteAddr,
+		theme.color(theme.Status2xx, r.Method), r.URL)
+
+	printHeaders(r.Header)
+
+	if len(r.Body) > 0 {
+		fmt.Println()
+		fmt.Println(formatBody(r.Header.Get("Content-Type"), r.Body))
+	}
+
+	fmt.Println()
+}
+
+// setRequestVars sets the request_* variables to the request values
+func setRequestVars(cmd *cmd.Cmd, r httpserve.Request, count int) {
+	cmd.SetVar("request_method", r.Method)
+	cmd.SetVar("request_url", r.URL)
+	cmd.SetVar("request_headers", simplejson.MustDumpString(r.Header))
+	cmd.SetVar("request_body", string(r.Body))
+	cmd.SetVar("requests", strconv.Itoa(count))
+}
@@ -7,32 +7,47 @@ import (
 	"github.com/gobs/cmd/plugins/json"
 	"github.com/gobs/cmd/plugins/stats"
 	"github.com/gobs/httpclient"
+	"github.com/gobs/httpclient/httpenv"
+	"github.com/gobs/httpclient/httpserve"
+	"github.com/gobs/httpclient/webdav"
 	"github.com/gobs/simplejson"
 	"github.com/google/uuid"
 
 	"golang.org/x/net/publicsuffix"
-	"net/http"
 
 	//"net/http/cookiejar"
 	"github.com/juju/persistent-cookiejar"
 
+	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"fmt"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 const (
 	HISTORY_FILE = ".httpclient_history"
 	COOKIE_FILE  = ".httpclient_cookies"
+	STORE_DIR    = ".httpclient_store"
 )
 
 var (
 	reFieldValue = regexp.MustCompile(`(\w[\d\w-]*)(=(.*))?`) // field-name=value
+
+	bodyStore *httpclient.BodyStore // response bodies store (see the "store" command)
+
+	redactPaths []string             // JSON paths redacted in exports and logs (see the "redact" command)
+	redactor    *httpclient.Redactor // nil if there are no paths
 )
 
 func request(cmd *cmd.Cmd, client *httpclient.HttpClient, method, params string, print, trace bool) *httpclient.HttpResponse {
@@ -44,21 +59,98 @@ func request(cmd *cmd.Cmd, client *httpclient.HttpClient, method, params string,
 
 	options := []httpclient.RequestOption{httpclient.Method(method)}
 
-	var rtrace *httpclient.RequestTrace
+	rtrace := &httpclient.RequestTrace{}
+	options = append(options, httpclient.Trace(rtrace.NewClientTrace(trace)))
 
-	if trace {
-		rtrace = &httpclient.RequestTrace{}
-		options = append(options, httpclient.Trace(rtrace.NewClientTrace(true)))
+	params, captures, err := parseCaptures(params)
+	if err != nil {
+		fmt.Println(err)
+		cmd.SetVar("error", err)
+		return nil
 	}
 
 	args := args.ParseArgs(params, args.InfieldBrackets())
 
+	var budget time.Duration
+
+	if v, ok := args.Options["budget"]; ok {
+		delete(args.Options, "budget")
+
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			fmt.Println("invalid budget:", err)
+			cmd.SetVar("error", err)
+			return nil
+		}
+
+		budget = d
+	}
+
+	if key, ok := args.Options["idempotency-key"]; ok {
+		delete(args.Options, "idempotency-key")
+		options = append(options, httpclient.IdempotencyKey(key))
+	}
+
+	notifyTarget, notifyDone := args.Options["notify"]
+	delete(args.Options, "notify")
+
+	_, dryRun := args.Options["dry-run"]
+	delete(args.Options, "dry-run")
+
+	_, jsonPatch := args.Options["json-patch"]
+	_, mergePatch := args.Options["merge-patch"]
+	delete(args.Options, "json-patch")
+	delete(args.Options, "merge-patch")
+
 	if len(args.Arguments) > 0 {
 		options = append(options, client.Path(args.Arguments[0]))
 	}
 
+	var data string
+
 	if len(args.Arguments) > 1 {
-		data := strings.Join(args.Arguments[1:], " ")
+		data = strings.Join(args.Arguments[1:], " ")
+	}
+
+	if _, ok := args.Options["interactive"]; ok {
+		delete(args.Options, "interactive")
+
+		body, err := interactiveBody(client, method, args.Arguments)
+		if err != nil {
+			fmt.Println(err)
+			cmd.SetVar("error", err)
+			return nil
+		}
+
+		data = body
+		options = append(options, httpclient.ContentType("application/json"))
+	}
+
+	if _, ok := args.Options["paste"]; ok {
+		delete(args.Options, "paste")
+
+		body, err := readClipboard()
+		if err != nil {
+			fmt.Println(err)
+			cmd.SetVar("error", err)
+			return nil
+		}
+
+		data = body
+	}
+
+	switch {
+	case data != "" && (jsonPatch || mergePatch):
+		body, err := patchBody(data, jsonPatch)
+		if err != nil {
+			fmt.Println(err)
+			cmd.SetVar("error", err)
+			return nil
+		}
+
+		options = append(options, body)
+
+	case data != "":
 		options = append(options, httpclient.Body(strings.NewReader(data)))
 	}
 
@@ -66,33 +158,133 @@ func request(cmd *cmd.Cmd, client *httpclient.HttpClient, method, params string,
 		options = append(options, httpclient.StringParams(args.Options))
 	}
 
+	if dryRun { // print the request without sending it
+		_, dump, err := client.DumpRequest(options...)
+		if err != nil {
+			fmt.Println(err)
+			cmd.SetVar("error", err)
+			return nil
+		}
+
+		fmt.Println(dump)
+		return nil
+	}
+
+	if err := oauth.Authorize(client); err != nil {
+		fmt.Println("ERROR:", err)
+		cmd.SetVar("error", err)
+		return nil
+	}
+
+	start := time.Now()
 	res, err := client.SendRequest(options...)
-	if rtrace != nil {
-		rtrace.Done()
+	elapsed := time.Since(start)
+	rtrace.Done()
+
+	history.add(res, method, data)
+	body := processResponse(cmd, res, err, print)
+
+	if res != nil && len(captures) > 0 {
+		capture(cmd, captures)
+	}
+
+	cmd.SetVar("elapsed", elapsed)
+	cmd.SetVar("rtrace", simplejson.MustDumpString(rtrace))
+	setTraceVars(cmd, rtrace, elapsed)
+
+	if bodyStore != nil && res != nil && len(body) > 0 {
+		hash, err := bodyStore.Put(body)
+		if err == nil {
+			err = bodyStore.SetURL(res.Request.URL.String(), hash)
+		}
+		if err != nil {
+			fmt.Println("store:", err)
+		}
+
+		cmd.SetVar("body_hash", hash)
+	}
+
+	if cmd.GetBoolVar("summary") && res != nil {
+		printSummary(res, body, elapsed, rtrace)
+	}
+
+	if budget > 0 && err == nil {
+		checkTime(cmd, "<=", budget)
+	}
+
+	if notifyDone {
+		title := strings.ToUpper(method)
+		if len(args.Arguments) > 0 {
+			title += " " + args.Arguments[0]
+		}
+
+		message := fmt.Sprintf("completed in %v", elapsed.Round(time.Millisecond))
+		if res != nil {
+			message = res.Status + ", " + message
+		}
+
+		failed := cmd.GetVar("error") != ""
+		if failed {
+			message = "FAILED: " + cmd.GetVar("error")
+		}
+
+		if err := notify(notifyTarget, title, message, failed); err != nil {
+			fmt.Println("notify:", err)
+		}
+	}
+
+	return res
+}
+
+// processResponse sets the status, error and body variables and prints the response body
+func processResponse(cmd *cmd.Cmd, res *httpclient.HttpResponse, err error, print bool) []byte {
+	if res != nil {
+		setHeaderVars(cmd, res.Header)
+		cmd.SetVar("headers", simplejson.MustDumpString(res.Header))
+	} else {
+		setHeaderVars(cmd, nil)
+		cmd.SetVar("headers", "")
 	}
+
 	if err == nil {
 		cmd.SetVar("status", res.Status)
 		err = res.ResponseError()
 	}
 	if err != nil {
 		if print {
-			fmt.Println("ERROR:", err)
+			code := 500
+			if res != nil {
+				code = res.StatusCode
+			}
+
+			fmt.Println(theme.Status("ERROR:", code), err)
 		}
 
 		cmd.SetVar("error", err)
 	}
 
 	body := res.Content()
+	if len(body) > 0 {
+		// convert non UTF-8 text to UTF-8
+		if text, err := httpclient.DecodeText(res.Header.Get("Content-Type"), body); err == nil {
+			body = []byte(text)
+		}
+	}
 	if len(body) > 0 && print {
-		if strings.Contains(res.Header.Get("Content-Type"), "json") {
-			jbody, err := simplejson.LoadBytes(body)
-			if err != nil {
-				fmt.Println(err)
-			} else {
-				json.PrintJson(jbody.Data())
+		ct := res.Header.Get("Content-Type")
+		printed := false
+
+		if format.Name == "table" && pretty != "raw" && strings.Contains(ct, "json") {
+			if jbody, err := simplejson.LoadBytes(body); err == nil {
+				if rows, ok := tableRows(jbody.Data()); ok {
+					printTable(os.Stdout, rows, format.Columns, format.PageSize)
+					printed = true
+				}
 			}
-		} else {
-			fmt.Println(string(body))
+		}
+
+		if !printed {
+			printPaged(formatBody(ct, body))
 		}
 	}
 
@@ -101,25 +293,104 @@ func request(cmd *cmd.Cmd, client *httpclient.HttpClient, method, params string,
 	//        client.Cookies = cookies
 	//}
 
+	if res != nil {
+		recentResponses.add(&diffResponse{Status: res.Status, Header: res.Header, Body: string(body)})
+	}
+
 	cmd.SetVar("body", string(body))
-	if rtrace != nil {
-		cmd.SetVar("rtrace", simplejson.MustDumpString(rtrace))
+	return body
+}
+
+// printSummary prints a one-line summary of the response: status, total time, time to first byte,
+// size, protocol and if the connection was reused
+func printSummary(res *httpclient.HttpResponse, body []byte, elapsed time.Duration, rtrace *httpclient.RequestTrace) {
+	ttfb := rtrace.DNS + rtrace.Connect + rtrace.TLSHandshake + rtrace.Request + rtrace.Wait
+
+	size := len(body)
+	if size == 0 && res.ContentLength > 0 {
+		size = int(res.ContentLength) // i.e. HEAD requests
 	}
 
-	return res
+	fmt.Printf("%v time=%v ttfb=%v size=%v proto=%v reused=%v\n",
+		theme.Status(res.Status, res.StatusCode),
+		elapsed.Round(time.Millisecond/10),
+		ttfb.Round(time.Millisecond/10),
+		formatSize(size),
+		res.Proto,
+		rtrace.Reused)
+}
+
+// formatSize returns the size in bytes in a human readable format (i.e. 1.5KB)
+func formatSize(n int) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%vB", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1fKB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1024*1024))
+	}
+}
+
+// formFields parses a list of field=value into a map.
+// A value in the form @filename is read from the file.
+func formFields(fields []string) (map[string]string, error) {
+	params := map[string]string{}
+
+	for _, f := range fields {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid field %q (expected field=value)", f)
+		}
+
+		if strings.HasPrefix(kv[1], "@") {
+			b, err := os.ReadFile(kv[1][1:])
+			if err != nil {
+				return nil, err
+			}
+
+			kv[1] = string(b)
+		}
+
+		params[kv[0]] = kv[1]
+	}
+
+	return params, nil
 }
 
 func headerName(s string) string {
 	s = strings.ToLower(s)
 	parts := strings.Split(s, "-")
 	for i, p := range parts {
-		if len(p) > 0 {
+		if len(p) > 0 && p[0] < utf8.RuneSelf {
 			parts[i] = strings.ToUpper(p[0:1]) + p[1:]
 		}
 	}
 	return strings.Join(parts, "-")
 }
 
+// checkHeader returns an error if the header name is not a valid token
+// or the value contains control characters (i.e. CR/LF)
+func checkHeader(name, value string) error {
+	if name == "" {
+		return fmt.Errorf("empty header name")
+	}
+
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+	}
+
+	for _, c := range value {
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return fmt.Errorf("invalid header value %q", value)
+		}
+	}
+
+	return nil
+}
+
 func unquote(s string) string {
 	if res, err := strconv.Unquote(strings.TrimSpace(s)); err == nil {
 		return res
@@ -168,12 +439,10 @@ func parseValue(v string) (interface{}, error) {
 	}
 }
 
-func main() {
+// newCommander creates a command interpreter for the specified client
+func newCommander(client *httpclient.HttpClient) *cmd.Cmd {
 	//var interrupted bool
 	var logBody bool
-	var client = httpclient.NewHttpClient("")
-
-	client.UserAgent = "httpclient/0.1"
 
 	commander := &cmd.Cmd{
 		HistoryFile: HISTORY_FILE,
@@ -185,8 +454,39 @@ func main() {
 
 	commander.Add(cmd.Command{
 		"base",
-		`base [url]`,
+		`
+                base [url]
+                base add name url
+                base remove name
+                base list
+
+                named bases can be used as "@name command" (i.e. @prod get /health)
+                `,
 		func(line string) (stop bool) {
+			parts := args.GetArgs(line)
+
+			switch {
+			case len(parts) == 3 && parts[0] == "add":
+				val, err := url.Parse(parts[2])
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				bases.Add(parts[1], val)
+				return
+
+			case len(parts) == 2 && parts[0] == "remove":
+				bases.Remove(parts[1])
+				return
+
+			case len(parts) == 1 && parts[0] == "list":
+				for _, name := range bases.Names() {
+					fmt.Printf("  @%v: %v\n", name, bases.Get(name))
+				}
+				return
+			}
+
 			if line != "" {
 				val, err := url.Parse(line)
 				if err != nil {
@@ -208,140 +508,677 @@ func main() {
 		},
 		nil})
 
+	var envConfig *httpenv.Config
+
 	commander.Add(cmd.Command{
-		"insecure",
-		`insecure [true|false]`,
+		"env",
+		`
+                env load {file.yaml|file.json}
+                env list
+                env use [name]
+
+                load the environments definitions (base URL, headers, authentication, TLS) and configure
+                the client for the named environment (or the default one)
+                `,
 		func(line string) (stop bool) {
-			if line != "" {
-				val, err := strconv.ParseBool(line)
+			parts := args.GetArgs(line)
+
+			switch {
+			case len(parts) == 2 && parts[0] == "load":
+				config, err := httpenv.Load(parts[1])
 				if err != nil {
 					fmt.Println(err)
+					commander.SetVar("error", err)
 					return
 				}
 
-				client.AllowInsecure(val)
-			}
+				envConfig = config
 
-			// assume if there is a transport, it's because we set AllowInsecure
-			fmt.Println("insecure", client.GetTransport() != nil)
+				for _, name := range config.Names() {
+					if u, err := url.Parse(config.Environments[name].BaseURL); err == nil && u.IsAbs() {
+						bases.Add(name, u) // environments are also available as named bases
+					}
+				}
 
-			return
-		},
-		nil})
+				fmt.Println("environments:", strings.Join(config.Names(), " "))
 
-	commander.Add(cmd.Command{
-		"timeout",
-		`timeout [duration]`,
-		func(line string) (stop bool) {
-			if line != "" {
-				val, err := time.ParseDuration(line)
+			case envConfig == nil:
+				fmt.Println("no environments loaded")
+
+			case len(parts) == 1 && parts[0] == "list":
+				for _, name := range envConfig.Names() {
+					mark := " "
+					if name == envConfig.Default {
+						mark = "*"
+					}
+
+					fmt.Printf(" %v %-20v %v\n", mark, name, envConfig.Environments[name].BaseURL)
+				}
+
+			case len(parts) <= 2 && parts[0] == "use":
+				name := ""
+				if len(parts) == 2 {
+					name = parts[1]
+				}
+
+				env, err := envConfig.Get(name)
+				if err == nil {
+					err = env.Apply(client)
+				}
 				if err != nil {
 					fmt.Println(err)
+					commander.SetVar("error", err)
 					return
 				}
 
-				client.SetTimeout(val)
+				commander.SetVar("env", env.Name)
+				commander.SetPrompt(fmt.Sprintf("%v> ", client.BaseURL), 40)
+				fmt.Println("env", env.Name, client.BaseURL)
+
+			default:
+				fmt.Println("usage: env load {file} | env list | env use [name]")
 			}
 
-			fmt.Println("timeout", client.GetTimeout())
 			return
 		},
 		nil})
 
 	commander.Add(cmd.Command{
-		"verbose",
-		`verbose [true|false|body]`,
+		"insecure",
+		`insecure [true|false]`,
 		func(line string) (stop bool) {
-			if line == "body" {
-				if !logBody {
-					client.StartLogging(true, true, true)
-					logBody = true
-				}
-			} else if line != "" {
+			if line != "" {
 				val, err := strconv.ParseBool(line)
 				if err != nil {
 					fmt.Println(err)
 					return
 				}
 
-				client.Verbose = val
-
-				if !val && logBody {
-					client.StopLogging()
-					logBody = false
-				}
+				client.AllowInsecure(val)
 			}
 
-			fmt.Println("Verbose", client.Verbose)
-			if logBody {
-				fmt.Println("Logging Request/Response body")
-			}
+			// assume if there is a transport, it's because we set AllowInsecure
+			fmt.Println("insecure", client.GetTransport() != nil)
+
 			return
 		},
 		nil})
 
 	commander.Add(cmd.Command{
-		"timing",
-		`timing [true|false]`,
+		"timeout",
+		`timeout [duration]`,
 		func(line string) (stop bool) {
 			if line != "" {
-				val, err := strconv.ParseBool(line)
+				val, err := time.ParseDuration(line)
 				if err != nil {
 					fmt.Println(err)
 					return
 				}
 
-				commander.Timing = val
+				client.SetTimeout(val)
 			}
 
-			fmt.Println("Timing", commander.Timing)
+			fmt.Println("timeout", client.GetTimeout())
 			return
 		},
 		nil})
 
 	commander.Add(cmd.Command{
-		"agent",
-		`agent user-agent-string`,
+		"archive",
+		`archive [directory|off]`,
 		func(line string) (stop bool) {
-			if line != "" {
-				client.UserAgent = line
+			if line == "off" {
+				line = ""
+			} else if line == "" {
+				line = client.GetResponseArchive()
 			}
 
-			fmt.Println("User-Agent:", client.UserAgent)
+			if err := client.SetResponseArchive(line); err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			if dir := client.GetResponseArchive(); dir != "" {
+				fmt.Println("archive", dir)
+			} else {
+				fmt.Println("archive off")
+			}
 			return
 		},
 		nil})
 
 	commander.Add(cmd.Command{
-		"header",
-		`header [name [value]]`,
+		"tls",
+		`
+                tls [--min=version] [--max=version] [--ciphers=name,...] [--curves=name,...] [--sni=server-name]
+
+                set the TLS policy (versions 1.0 to 1.3, cipher suites as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+                curves X25519, P256, P384, P521 or X25519MLKEM768) and the server name sent in the handshake
+                `,
 		func(line string) (stop bool) {
-			if line == "" {
-				if len(client.Headers) == 0 {
-					fmt.Println("No headers")
-				} else {
-					fmt.Println("Headers:")
-					for k, v := range client.Headers {
-						fmt.Printf("  %v: %v\n", k, v)
-					}
-				}
+			pargs := args.ParseArgs(line)
 
-				return
-			}
+			if len(pargs.Options) > 0 {
+				config := client.GetTLSConfig()
+				if config == nil {
+					config = &tls.Config{}
+				}
 
-			parts := args.GetArgsN(line, 2)
-			name := headerName(parts[0])
+				min, max, ciphers, curves := config.MinVersion, config.MaxVersion, config.CipherSuites, config.CurvePreferences
 
-			if len(parts) == 2 {
-				value := unquote(parts[1])
+				var err error
 
-				if value == "" {
-					delete(client.Headers, name)
-				} else {
-					client.Headers[name] = value
+				if v, ok := pargs.Options["min"]; ok {
+					if min, err = httpclient.ParseTLSVersion(v); err != nil {
+						fmt.Println(err)
+						return
+					}
+				}
+				if v, ok := pargs.Options["max"]; ok {
+					if max, err = httpclient.ParseTLSVersion(v); err != nil {
+						fmt.Println(err)
+						return
+					}
+				}
+				if v, ok := pargs.Options["ciphers"]; ok {
+					if ciphers, err = httpclient.ParseCipherSuites(strings.Split(v, ",")...); err != nil {
+						fmt.Println(err)
+						return
+					}
+				}
+				if v, ok := pargs.Options["curves"]; ok {
+					if curves, err = httpclient.ParseCurves(strings.Split(v, ",")...); err != nil {
+						fmt.Println(err)
+						return
+					}
 				}
 
-				if !commander.GetBoolVar("print") {
+				if err := client.SetTLSConfig(min, max, ciphers, curves); err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				if v, ok := pargs.Options["sni"]; ok {
+					if err := client.SetServerName(v); err != nil {
+						fmt.Println(err)
+						return
+					}
+				}
+			}
+
+			config := client.GetTLSConfig()
+			if config == nil {
+				fmt.Println("tls default")
+				return
+			}
+
+			version := func(v uint16) string {
+				if v == 0 {
+					return "default"
+				}
+
+				return tls.VersionName(v)
+			}
+
+			fmt.Println("min:", version(config.MinVersion), "max:", version(config.MaxVersion))
+
+			for _, c := range config.CipherSuites {
+				fmt.Println("cipher:", tls.CipherSuiteName(c))
+			}
+			for _, c := range config.CurvePreferences {
+				fmt.Println("curve:", c)
+			}
+			if config.ServerName != "" {
+				fmt.Println("sni:", config.ServerName)
+			}
+			if config.InsecureSkipVerify {
+				fmt.Println("insecure")
+			}
+			return
+		},
+		nil})
+
+	var pins []string
+
+	commander.Add(cmd.Command{
+		"pin",
+		`
+                pin [--report-only] [sha256-pin...] | off
+
+                pin the server public keys (base64 SHA-256 of the SubjectPublicKeyInfo, including backup pins).
+                With --report-only the pinning failures are only logged
+                `,
+		func(line string) (stop bool) {
+			pargs := args.ParseArgs(line)
+
+			if len(pargs.Arguments) == 1 && pargs.Arguments[0] == "off" {
+				pargs.Arguments = nil
+			} else if len(pargs.Arguments) == 0 {
+				if len(pins) == 0 {
+					fmt.Println("pinning off")
+				}
+				for _, p := range pins {
+					fmt.Println("pin:", p)
+				}
+				return
+			}
+
+			var err error
+
+			if _, ok := pargs.Options["report-only"]; ok {
+				err = client.PinCertificatesReportOnly(pargs.Arguments, nil)
+			} else {
+				err = client.PinCertificates(pargs.Arguments)
+			}
+
+			if err != nil {
+				fmt.Println(err)
+			} else {
+				pins = pargs.Arguments
+			}
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{
+		"dryrun",
+		`
+                dryrun [on|off] [method...]
+
+                in dry-run mode the requests (or only the ones with the specified methods, i.e. dryrun on DELETE PUT)
+                are printed instead of being sent, and an empty 200 response is returned
+                `,
+		func(line string) (stop bool) {
+			if parts := strings.Fields(line); len(parts) > 0 {
+				enable, err := strconv.ParseBool(strings.NewReplacer("on", "true", "off", "false").Replace(parts[0]))
+				if err != nil {
+					fmt.Println("usage: dryrun [on|off] [method...]")
+					return
+				}
+
+				client.DryRun(enable, parts[1:]...)
+			}
+
+			if client.GetDryRun() {
+				fmt.Println("dryrun on")
+			} else {
+				fmt.Println("dryrun off")
+			}
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{
+		"lenient",
+		`lenient [true|false]`,
+		func(line string) (stop bool) {
+			if line != "" {
+				val, err := strconv.ParseBool(line)
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				client.SetLenient(val)
+			}
+
+			fmt.Println("lenient", client.GetLenient())
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{
+		"proxyproto",
+		`proxyproto [off|v1|v2] [source-ip:port]`,
+		func(line string) (stop bool) {
+			if line != "" {
+				parts := strings.Fields(line)
+
+				version, err := httpclient.ParseProxyVersion(parts[0])
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				var source *net.TCPAddr
+				if len(parts) > 1 {
+					if source, err = net.ResolveTCPAddr("tcp", parts[1]); err != nil {
+						fmt.Println(err)
+						return
+					}
+				}
+
+				if err := client.SetProxyProtocol(version, source); err != nil {
+					fmt.Println(err)
+					return
+				}
+			}
+
+			fmt.Println("proxyproto", client.GetProxyProtocol())
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{
+		"balance",
+		`
+                balance [--strategy=round-robin|least-pending|weighted] [--max-fails=n] [--eject=duration] url ["url weight=n"] ...
+                balance off
+
+                balance the requests to the base URL across the endpoints, ejecting the failing ones.
+                Without arguments print the endpoints status
+                `,
+		func(line string) (stop bool) {
+			pargs := args.ParseArgs(line)
+
+			switch {
+			case len(pargs.Arguments) == 1 && pargs.Arguments[0] == "off":
+				client.SetBalancer(nil)
+
+			case len(pargs.Arguments) > 0:
+				strategy, err := httpclient.ParseBalanceStrategy(pargs.Options["strategy"])
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				balancer, err := httpclient.NewBalancer(strategy, pargs.Arguments...)
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				if v, ok := pargs.Options["max-fails"]; ok {
+					if balancer.MaxFails, err = strconv.Atoi(v); err != nil {
+						fmt.Println("invalid max-fails:", err)
+						return
+					}
+				}
+
+				if v, ok := pargs.Options["eject"]; ok {
+					if balancer.EjectTime, err = time.ParseDuration(v); err != nil {
+						fmt.Println("invalid eject:", err)
+						return
+					}
+				}
+
+				if err := client.SetBalancer(balancer); err != nil {
+					fmt.Println(err)
+					return
+				}
+			}
+
+			balancer := client.GetBalancer()
+			if balancer == nil {
+				fmt.Println("balance off")
+				return
+			}
+
+			fmt.Println("balance", balancer.Strategy)
+			for _, e := range balancer.Endpoints() {
+				status := "ok"
+				if e.Ejected {
+					status = "ejected until " + e.EjectedUntil.Format(time.TimeOnly)
+				}
+
+				fmt.Printf("  %v weight=%v requests=%v failures=%v pending=%v %v\n",
+					e.URL, e.Weight, e.Requests, e.Failures, e.Pending, status)
+			}
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{
+		"ipver",
+		`
+                ipver [any|4|6|4only|6only] [fallback-delay]
+
+                set the IP family preference for dual-stack hosts: 4 or 6 prefer the family and fall back to the other
+                after fallback-delay (default 300ms, negative: only if the first connection fails), 4only and 6only
+                don't fall back (i.e. for broken IPv6 networks)
+                `,
+		func(line string) (stop bool) {
+			if parts := strings.Fields(line); len(parts) > 0 {
+				if len(parts) > 2 {
+					fmt.Println("usage: ipver [any|4|6|4only|6only] [fallback-delay]")
+					return
+				}
+
+				pref, err := httpclient.ParseIPPreference(parts[0])
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				var delay time.Duration
+				if len(parts) > 1 {
+					if delay, err = time.ParseDuration(parts[1]); err != nil {
+						fmt.Println(err)
+						return
+					}
+				}
+
+				if err := client.SetIPPreference(pref, delay); err != nil {
+					fmt.Println(err)
+					return
+				}
+			}
+
+			pref, delay := client.GetIPPreference()
+			if delay != 0 {
+				fmt.Println("ipver", pref, "fallback", delay)
+			} else {
+				fmt.Println("ipver", pref)
+			}
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{
+		"dns",
+		`
+                dns [on [ttl [negative-ttl]]|off|flush [host ...]]
+
+                cache the DNS lookups (default TTLs 1m and 5s for failed lookups), without arguments print the cache stats
+                `,
+		func(line string) (stop bool) {
+			parts := strings.Fields(line)
+
+			switch {
+			case len(parts) == 0:
+
+			case parts[0] == "on" && len(parts) <= 3:
+				var ttls [2]time.Duration
+
+				for i, v := range parts[1:] {
+					d, err := time.ParseDuration(v)
+					if err != nil {
+						fmt.Println(err)
+						return
+					}
+
+					ttls[i] = d
+				}
+
+				if err := client.SetDNSCache(httpclient.NewDNSCache(ttls[0], ttls[1])); err != nil {
+					fmt.Println(err)
+					return
+				}
+
+			case parts[0] == "off" && len(parts) == 1:
+				client.SetDNSCache(nil)
+
+			case parts[0] == "flush":
+				if cache := client.GetDNSCache(); cache != nil {
+					cache.Flush(parts[1:]...)
+				}
+
+			default:
+				fmt.Println("usage: dns [on [ttl [negative-ttl]]|off|flush [host ...]]")
+				return
+			}
+
+			if cache := client.GetDNSCache(); cache != nil {
+				stats := cache.Stats()
+				commander.SetVar("dns", simplejson.MustDumpString(stats))
+				fmt.Printf("dns cache: entries: %v hits: %v misses: %v negative hits: %v\n",
+					stats.Entries, stats.Hits, stats.Misses, stats.NegativeHits)
+			} else {
+				fmt.Println("dns cache off")
+			}
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{
+		"verbose",
+		`
+                verbose [true|false]
+                verbose body [--max-body=size] [--binary] [--headers]
+
+                with body, log the request and response bodies, truncated to --max-body bytes (default 8192, 0: no limit).
+                Binary bodies are logged only with --binary and the credential headers only with --headers.
+                `,
+		func(line string) (stop bool) {
+			if pargs := args.ParseArgs(line); len(pargs.Arguments) == 1 && pargs.Arguments[0] == "body" {
+				maxBody := 8192
+				if v, ok := pargs.Options["max-body"]; ok {
+					n, err := strconv.Atoi(v)
+					if err != nil {
+						fmt.Println("invalid max-body:", err)
+						return
+					}
+
+					maxBody = n
+				}
+
+				_, binary := pargs.Options["binary"]
+
+				var sensitive []string
+				if _, ok := pargs.Options["headers"]; !ok {
+					sensitive = httpclient.SensitiveHeaders
+				}
+
+				client.StartLogging(true, true, true,
+					httpclient.MaxLogBodySize(maxBody),
+					httpclient.LogBinaryBodies(binary),
+					httpclient.RedactLogHeaders(sensitive...),
+					httpclient.RedactLogBodies(redactor))
+				logBody = true
+			} else if line != "" {
+				val, err := strconv.ParseBool(line)
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				client.Verbose = val
+
+				if !val && logBody {
+					client.StopLogging()
+					logBody = false
+				}
+			}
+
+			fmt.Println("Verbose", client.Verbose)
+			if logBody {
+				fmt.Println("Logging Request/Response body")
+			}
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{
+		"timing",
+		`timing [true|false]`,
+		func(line string) (stop bool) {
+			if line != "" {
+				val, err := strconv.ParseBool(line)
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				commander.Timing = val
+			}
+
+			fmt.Println("Timing", commander.Timing)
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{
+		"summary",
+		`
+                summary [true|false]
+
+                print a summary line after each request (status, time, time to first byte, size, protocol, reused connection)
+                `,
+		func(line string) (stop bool) {
+			if line != "" {
+				val, err := strconv.ParseBool(line)
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				commander.SetVar("summary", val)
+			}
+
+			fmt.Println("summary", commander.GetBoolVar("summary"))
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{
+		"agent",
+		`agent user-agent-string`,
+		func(line string) (stop bool) {
+			if line != "" {
+				client.UserAgent = line
+			}
+
+			fmt.Println("User-Agent:", client.UserAgent)
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{
+		"header",
+		`header [name [value]]`,
+		func(line string) (stop bool) {
+			if line == "" {
+				if len(client.Headers) == 0 {
+					fmt.Println("No headers")
+				} else {
+					fmt.Println("Headers:")
+					for k, v := range client.Headers {
+						fmt.Printf("  %v: %v\n", k, v)
+					}
+				}
+
+				return
+			}
+
+			parts := args.GetArgsN(line, 2)
+			name := headerName(parts[0])
+
+			if len(parts) == 2 {
+				value := unquote(parts[1])
+
+				if err := checkHeader(name, value); err != nil {
+					fmt.Println(err)
+					commander.SetVar("error", err)
+					return
+				}
+
+				if value == "" {
+					delete(client.Headers, name)
+				} else {
+					client.Headers[name] = value
+				}
+
+				if !commander.GetBoolVar("print") {
 					return
 				}
 			}
@@ -351,174 +1188,1805 @@ func main() {
 		},
 		nil})
 
-	commander.Add(cmd.Command{"head",
+	authInfo := ""
+
+	commander.Add(cmd.Command{"auth",
+		`
+                auth basic user password
+                auth bearer token
+                auth digest user password
+                auth none
+                `,
+		func(line string) (stop bool) {
+			parts := args.GetArgs(line)
+
+			if len(parts) > 0 {
+				switch {
+				case parts[0] == "basic" && len(parts) == 3:
+					oauth.Clear()
+					client.SetBasicAuth(unquote(parts[1]), unquote(parts[2]))
+					authInfo = "basic " + unquote(parts[1])
+
+				case parts[0] == "bearer" && len(parts) == 2:
+					oauth.Clear()
+					client.SetBearerToken(unquote(parts[1]))
+					authInfo = "bearer"
+
+				case parts[0] == "digest" && len(parts) == 3:
+					oauth.Clear()
+					client.SetDigestAuth(unquote(parts[1]), unquote(parts[2]))
+					authInfo = "digest " + unquote(parts[1])
+
+				case parts[0] == "none" && len(parts) == 1:
+					oauth.Clear()
+					client.ClearAuth()
+					authInfo = ""
+
+				default:
+					fmt.Println("usage: auth basic user password | bearer token | digest user password | none")
+					return
+				}
+			}
+
+			if authInfo == "" {
+				fmt.Println("No authentication")
+			} else {
+				fmt.Println("Authentication:", authInfo)
+			}
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"login",
+		`
+                login oauth2 --device|--pkce --client-id=id [--client-secret=secret] [--scope=scope]
+                             [--issuer=url | --auth-url=url --device-url=url --token-url=url] [--name=profile]
+                login profile
+                login form [--form=name] [--success=selector] [--failure=selector] [--csrf-header=name] login-path field=value ...
+
+                authenticate using the OAuth2 device code or authorization code with PKCE flows,
+                or use a token saved by a previous login.
+                The tokens are stored encrypted and refreshed automatically.
+
+                login form submits the login page form (hidden and CSRF fields included) with the specified
+                fields and keeps the session cookies (selectors are as "div.error", "a#logout", "input[name=x]")
+                `,
+		func(line string) (stop bool) {
+			pargs := args.ParseArgs(line)
+
+			if len(pargs.Arguments) == 0 {
+				if name, token := oauth.Info(); token != nil {
+					fmt.Println("Logged in:", name, "expires:", token.Expiry.Format(time.RFC3339))
+				} else {
+					fmt.Println("Not logged in")
+				}
+
+				if tokens, err := loadTokens(); err == nil && len(tokens) > 0 {
+					fmt.Println("Profiles:")
+					for name := range tokens {
+						fmt.Println(" ", name)
+					}
+				}
+
+				return
+			}
+
+			if pargs.Arguments[0] == "form" {
+				if len(pargs.Arguments) < 2 {
+					fmt.Println("usage: login form [--form=name] [--success=selector] [--failure=selector] [--csrf-header=name] login-path field=value ...")
+					return
+				}
+
+				fields, err := formFields(pargs.Arguments[2:])
+				if err == nil {
+					var res *httpclient.HttpResponse
+
+					res, err = client.FormLogin(pargs.Arguments[1], fields, &httpclient.FormLoginOptions{
+						Form:            pargs.Options["form"],
+						CSRFHeader:      pargs.Options["csrf-header"],
+						SuccessSelector: pargs.Options["success"],
+						FailureSelector: pargs.Options["failure"],
+					})
+					if res != nil {
+						commander.SetVar("status", res.Status)
+						res.Close()
+					}
+				}
+				if err != nil {
+					fmt.Println(err)
+					commander.SetVar("error", err)
+					return
+				}
+
+				authInfo = "form " + pargs.Arguments[1]
+				fmt.Println("Logged in")
+				return
+			}
+
+			if pargs.Arguments[0] != "oauth2" { // use a saved token
+				name := pargs.Arguments[0]
+
+				tokens, err := loadTokens()
+				if err != nil {
+					fmt.Println(err)
+					commander.SetVar("error", err)
+					return
+				}
+
+				token, ok := tokens[name]
+				if !ok {
+					fmt.Println("no saved token for", name)
+					return
+				}
+
+				oauth.Set(name, token)
+				if err := oauth.Authorize(client); err != nil {
+					fmt.Println(err)
+					commander.SetVar("error", err)
+					return
+				}
+
+				authInfo = "oauth2 " + name
+				fmt.Println("Logged in:", name)
+				return
+			}
+
+			config := oauth2Config{
+				ClientID:     pargs.Options["client-id"],
+				ClientSecret: pargs.Options["client-secret"],
+				Scope:        pargs.Options["scope"],
+				AuthURL:      pargs.Options["auth-url"],
+				DeviceURL:    pargs.Options["device-url"],
+				TokenURL:     pargs.Options["token-url"],
+			}
+
+			if issuer := pargs.Options["issuer"]; issuer != "" {
+				if err := discoverOAuth2(issuer, &config); err != nil {
+					fmt.Println("discovery:", err)
+					commander.SetVar("error", err)
+					return
+				}
+			}
+
+			if config.ClientID == "" || config.TokenURL == "" {
+				fmt.Println("missing --client-id or --token-url (or --issuer)")
+				return
+			}
+
+			name := pargs.Options["name"]
+			if name == "" {
+				name = config.ClientID
+			}
+
+			var token *oauth2Token
+			var err error
+
+			if _, ok := pargs.Options["device"]; ok {
+				token, err = deviceLogin(&config)
+			} else if _, ok := pargs.Options["pkce"]; ok {
+				token, err = pkceLogin(&config)
+			} else {
+				fmt.Println("usage: login oauth2 --device|--pkce ...")
+				return
+			}
+
+			if err != nil {
+				fmt.Println("login failed:", err)
+				commander.SetVar("error", err)
+				return
+			}
+
+			if err := oauth.Set(name, token); err != nil {
+				fmt.Println("cannot save token:", err)
+			}
+
+			oauth.Authorize(client)
+			authInfo = "oauth2 " + name
+			fmt.Println("Logged in:", name)
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"logout",
+		`
+                logout [--forget]
+
+                stop using the OAuth2 token (--forget also removes it from the token store)
+                `,
+		func(line string) (stop bool) {
+			name, token := oauth.Info()
+			if token == nil {
+				fmt.Println("Not logged in")
+				return
+			}
+
+			if line == "--forget" {
+				if err := saveToken(name, nil); err != nil {
+					fmt.Println(err)
+				}
+			}
+
+			oauth.Clear()
+			client.ClearAuth()
+			authInfo = ""
+			fmt.Println("Logged out:", name)
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"expect",
+		`
+                expect time < duration
+                expect value op expected
+
+                fail if the last response doesn't satisfy the condition, where value is one of
+                status, header.name, body, body.path (JSON field) or a variable name,
+                and op is one of ==, !=, <, <=, >, >=, contains, matches.
+                The request commands also accept a --budget=duration option.
+                `,
+		func(line string) (stop bool) {
+			if line = strings.TrimSpace(line); line == "" {
+				fmt.Println("usage: expect value op expected")
+				return
+			}
+
+			checkExpect(commander, line)
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"openapi",
+		`
+                openapi [file-or-url]
+
+                load an OpenAPI (or Swagger) JSON specification, used to build request bodies
+                with the --interactive option (i.e. post --interactive /users)
+                `,
+		func(line string) (stop bool) {
+			if line = strings.TrimSpace(line); line != "" {
+				spec, err := loadOpenAPI(line)
+				if err != nil {
+					fmt.Println(err)
+					commander.SetVar("error", err)
+					return
+				}
+
+				apiSpec = spec
+			}
+
+			if apiSpec == nil {
+				fmt.Println("No OpenAPI specification")
+			} else {
+				fmt.Println("OpenAPI specification:", len(apiSpec.Paths), "paths")
+			}
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"chain",
+		`
+                chain [--cleanup] chain-file
+
+                execute a request chain (see chain.go for the format).
+                If a step fails the rollback commands are executed (--cleanup: execute them also on success)
+                `,
+		func(line string) (stop bool) {
+			cleanup := false
+
+			if strings.HasPrefix(line, "--cleanup") {
+				cleanup = true
+				line = strings.TrimPrefix(line, "--cleanup")
+			}
+
+			filename := strings.TrimSpace(line)
+			if filename == "" {
+				fmt.Println("usage: chain [--cleanup] chain-file")
+				return
+			}
+
+			steps, err := readChain(filename)
+			if err != nil {
+				fmt.Println(err)
+				commander.SetVar("error", err)
+				return
+			}
+
+			if runChain(commander, steps, cleanup) {
+				fmt.Println("chain completed")
+			} else {
+				fmt.Println("chain failed")
+			}
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"workflow",
+		`
+                workflow run file.yaml
+                workflow check file.yaml
+
+                execute (or validate) a workflow: setup, steps and teardown with requests, extractions,
+                assertions, loops and waits (see workflow.go for the format).
+                Each step can have a timeout and a failure policy (stop, continue or retry)
+                `,
+		func(line string) (stop bool) {
+			workflowCommand(commander, client, line)
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"format",
+		`
+                format [json|table] [--columns=id,name,...] [--page=rows]
+
+                set the output format for JSON responses: table renders arrays of objects as aligned tables
+                (columns can be field names or paths, i.e. owner.name)
+                `,
+		func(line string) (stop bool) {
+			pargs := args.ParseArgs(line)
+
+			if len(pargs.Arguments) > 0 {
+				switch name := pargs.Arguments[0]; name {
+				case "json", "table":
+					format.Name = name
+				default:
+					fmt.Println("usage: format [json|table] [--columns=id,name,...] [--page=rows]")
+					return
+				}
+			}
+
+			if columns, ok := pargs.Options["columns"]; ok {
+				format.Columns = nil
+
+				for _, c := range strings.Split(columns, ",") {
+					if c = strings.TrimSpace(c); c != "" {
+						format.Columns = append(format.Columns, c)
+					}
+				}
+			}
+
+			if page, ok := pargs.Options["page"]; ok {
+				n, err := strconv.Atoi(page)
+				if err != nil {
+					fmt.Println("invalid page size:", page)
+					return
+				}
+
+				format.PageSize = n
+			}
+
+			fmt.Println("format", format.Name, "columns:", strings.Join(format.Columns, ","), "page:", format.PageSize)
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"color",
+		`
+                color [dark|light|none]
+
+                set the output color theme (the default is "none" if NO_COLOR is set or the output is not a terminal)
+                `,
+		func(line string) (stop bool) {
+			if line = strings.TrimSpace(line); line != "" {
+				t, ok := themes[line]
+				if !ok {
+					fmt.Println("usage: color [dark|light|none]")
+					return
+				}
+
+				theme = t
+			}
+
+			fmt.Println("color", theme.Name)
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"pretty",
+		`
+                pretty [on|off|raw]
+
+                set how the response body is printed: on (indented and highlighted), off (indented, no highlighting)
+                or raw (as received). Large bodies are paged if the output is a terminal.
+                `,
+		func(line string) (stop bool) {
+			switch line = strings.TrimSpace(line); line {
+			case "":
+			case "on", "off", "raw":
+				pretty = line
+			default:
+				fmt.Println("usage: pretty [on|off|raw]")
+				return
+			}
+
+			fmt.Println("pretty", pretty)
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"copy",
+		`
+                copy [body|headers|url|curl]
+
+                copy the last response body (default) or headers, or the last request URL or curl command,
+                to the system clipboard (use "--paste" in a request to use the clipboard as request body)
+                `,
+		func(line string) (stop bool) {
+			var text string
+
+			switch what := strings.TrimSpace(line); what {
+			case "", "body":
+				text = commander.GetVar("body")
+
+			case "headers":
+				text = commander.GetVar("headers")
+
+			case "url", "curl":
+				r := history.Last()
+				if r == nil {
+					fmt.Println("no request")
+					return
+				}
+
+				if what == "url" {
+					text = r.URL
+				} else {
+					text = curlCommand(r)
+				}
+
+			default:
+				fmt.Println("usage: copy [body|headers|url|curl]")
+				return
+			}
+
+			if err := copyToClipboard(text); err != nil {
+				fmt.Println(err)
+				commander.SetVar("error", err)
+			}
+
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"head",
+		`
+                head [url-path] [short-data]
+                `,
+		func(line string) (stop bool) {
+			res := request(commander, client, "head", line, false, commander.GetBoolVar("trace"))
+			if res != nil {
+				fmt.Println(theme.Status(res.Status, res.StatusCode))
+				printHeaders(res.Header)
+			}
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"raw",
+		`
+                raw {file}
+                raw request-line\r\nheader: value\r\n...
+
+                send a raw HTTP/1.1 request (read from a file, or from the command line with \r and \n escapes)
+                to the base URL host, as is. The response is parsed leniently.
+                `,
+		func(line string) (stop bool) {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				fmt.Println("usage: raw {file} | raw request")
+				return
+			}
+
+			var raw []byte
+
+			if b, err := os.ReadFile(line); err == nil {
+				raw = b
+			} else {
+				s := strings.NewReplacer(`\r`, "\r", `\n`, "\n", `\t`, "\t").Replace(line)
+				if !strings.HasSuffix(s, "\n\n") && !strings.HasSuffix(s, "\r\n\r\n") {
+					s += "\r\n\r\n"
+				}
+
+				raw = []byte(s)
+			}
+
+			res, err := client.SendRaw(context.Background(), raw)
+			if res != nil && commander.GetBoolVar("verbose") {
+				fmt.Println(theme.Status(res.Status, res.StatusCode))
+				printHeaders(res.Header)
+			}
+
+			processResponse(commander, res, err, commander.GetBoolVar("print"))
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"get",
+		`
+                get [--capture name=expr ...] [--dry-run] [url-path] [short-data]
+
+                with --capture, set the variable name from the response (the same for post, put, delete and head):
+                expr can be status, body, body.path or $.path (a JSON body field, i.e. body.auth.token),
+                header.name or header:name (i.e. header:Location).
+                with --dry-run, print the request (in canonical form) without sending it
+
+                after each request the status, body, error, headers (as JSON) and elapsed variables are set, with
+                a header.Name variable for each response header (i.e. ${header.Content-Type}) and the trace.DNS,
+                trace.Connect, trace.TLSHandshake, trace.Request, trace.Wait, trace.Response, trace.TTFB and trace.Total
+                variables in milliseconds (i.e. ${trace.Wait}), trace.Reused, trace.Local and trace.Remote.
+                In request templates use {{var "header.Content-Type"}}
+                `,
+		func(line string) (stop bool) {
+			request(commander, client, "get", line, commander.GetBoolVar("print"), commander.GetBoolVar("trace"))
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"post",
+		`
+                post [--idempotency-key[=key]] [url-path] [short-data]
+
+                with --idempotency-key, send an Idempotency-Key header (with a random key if not specified)
+                `,
+		func(line string) (stop bool) {
+			request(commander, client, "post", line, commander.GetBoolVar("print"), commander.GetBoolVar("trace"))
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"postform",
+		`
+                postform url-path field=value ...
+
+                send a POST request with an urlencoded form body (use field=@filename to read the value from a file)
+                `,
+		func(line string) (stop bool) {
+			parts := args.GetArgs(line)
+			if len(parts) == 0 {
+				fmt.Println("usage: postform url-path field=value ...")
+				return
+			}
+
+			fields, err := formFields(parts[1:])
+			if err != nil {
+				fmt.Println(err)
+				commander.SetVar("error", err)
+				return
+			}
+
+			params := make(map[string]interface{}, len(fields))
+			for k, v := range fields {
+				params[k] = v
+			}
+
+			commander.SetVar("error", "")
+
+			res, err := client.SendRequest(httpclient.Method("POST"), client.Path(parts[0]), httpclient.FormBody(params))
+			history.add(res, "post", httpclient.ParamValues(params, nil).Encode())
+			processResponse(commander, res, err, commander.GetBoolVar("print"))
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"upload",
+		`
+                upload url-path file [field=name] [field=value ...]
+
+                upload a file as multipart/form-data (the file field name is "file", unless specified with field=name).
+                Use field=@filename to read a value from a file.
+                `,
+		func(line string) (stop bool) {
+			parts := args.GetArgs(line)
+			if len(parts) < 2 {
+				fmt.Println("usage: upload url-path file [field=name] [field=value ...]")
+				return
+			}
+
+			fields, err := formFields(parts[2:])
+			if err != nil {
+				fmt.Println(err)
+				commander.SetVar("error", err)
+				return
+			}
+
+			fileParam := "file"
+			if name, ok := fields["field"]; ok {
+				fileParam = name
+				delete(fields, "field")
+			}
+
+			commander.SetVar("error", "")
+
+			res, err := client.UploadFile("POST", parts[0], fileParam, parts[1], nil, fields, nil)
+			history.add(res, "post", "")
+			processResponse(commander, res, err, commander.GetBoolVar("print"))
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"put",
+		`
+                put [url-path] [short-data]
+                `,
+		func(line string) (stop bool) {
+			request(commander, client, "put", line, commander.GetBoolVar("print"), commander.GetBoolVar("trace"))
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"delete",
+		`
+                delete [url-path] [short-data]
+                `,
+		func(line string) (stop bool) {
+			request(commander, client, "delete", line, commander.GetBoolVar("print"), commander.GetBoolVar("trace"))
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"patch",
+		`
+                patch [--json-patch|--merge-patch] [url-path] [short-data]
+
+                with --json-patch, short-data is a JSON Patch document (RFC 6902: [{"op": "replace", "path": "/a", "value": 1}])
+                with --merge-patch, a JSON Merge Patch document (RFC 7386: {"a": 1, "b": null}), sent with the patch content type
+                `,
+		func(line string) (stop bool) {
+			request(commander, client, "patch", line, commander.GetBoolVar("print"), commander.GetBoolVar("trace"))
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"options",
+		`
+                options [url-path|*]
+
+                send an OPTIONS request and print the allowed methods (and the CORS headers, if any)
+                `,
+		func(line string) (stop bool) {
+			res := request(commander, client, "options", line, commander.GetBoolVar("print"), commander.GetBoolVar("trace"))
+			if res != nil {
+				fmt.Println(theme.Status(res.Status, res.StatusCode))
+
+				allow := http.Header{}
+				for k, v := range res.Header {
+					if k == "Allow" || strings.HasPrefix(k, "Access-Control-") {
+						allow[k] = v
+					}
+				}
+
+				printHeaders(allow)
+			}
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"trace",
+		`
+                trace [url-path]
+
+                send a TRACE request: the server echoes the request it received (if enabled)
+                `,
+		func(line string) (stop bool) {
+			request(commander, client, "trace", line, commander.GetBoolVar("print"), commander.GetBoolVar("trace"))
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"request",
+		`
+                request METHOD [url-path] [short-data]
+
+                send a request with any method (i.e. PROPFIND, MKCOL, PURGE), with the same options as get or post
+                `,
+		func(line string) (stop bool) {
+			method, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+			if method == "" || strings.HasPrefix(method, "-") || strings.ContainsAny(method, "()<>@,;:\\\"/[]?={}") {
+				fmt.Println("usage: request METHOD [url-path] [short-data]")
+				return
+			}
+
+			request(commander, client, strings.ToUpper(method), rest, commander.GetBoolVar("print"), commander.GetBoolVar("trace"))
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"dav",
+		`
+                dav ls [path]
+                dav get remote-path [local-file]
+                dav put local-file [remote-path]
+
+                list a WebDAV collection, download or upload a file (the paths are relative to the base URL)
+                `,
+		func(line string) (stop bool) {
+			parts := args.GetArgs(line)
+			if len(parts) == 0 {
+				fmt.Println("usage: dav ls|get|put ...")
+				return
+			}
+
+			dav := webdav.New(client)
+
+			switch {
+			case parts[0] == "ls" && len(parts) <= 2:
+				p := ""
+				if len(parts) == 2 {
+					p = parts[1]
+				}
+
+				resources, err := dav.List(p)
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				for _, r := range resources {
+					if r.IsDir {
+						fmt.Printf("d %12s %v %v/\n", "-", r.ModTime.Format(time.DateTime), r.Name)
+					} else {
+						fmt.Printf("- %12d %v %v\n", r.Size, r.ModTime.Format(time.DateTime), r.Name)
+					}
+				}
+
+			case parts[0] == "get" && (len(parts) == 2 || len(parts) == 3):
+				local := path.Base(parts[1])
+				if len(parts) == 3 {
+					local = parts[2]
+				}
+
+				f, err := dav.Open(parts[1])
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+				defer f.Close()
+
+				out, err := os.Create(local)
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				n, err := f.WriteTo(out)
+				if cerr := out.Close(); err == nil {
+					err = cerr
+				}
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				fmt.Println(local, n, "bytes")
+
+			case parts[0] == "put" && (len(parts) == 2 || len(parts) == 3):
+				remote := filepath.Base(parts[1])
+				if len(parts) == 3 {
+					remote = parts[2]
+				}
+
+				f, err := os.Open(parts[1])
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+				defer f.Close()
+
+				st, err := f.Stat()
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				if err := dav.Put(remote, f, st.Size()); err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				fmt.Println(remote, st.Size(), "bytes")
+
+			default:
+				fmt.Println("usage: dav ls [path] | dav get remote-path [local-file] | dav put local-file [remote-path]")
+			}
+
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"http",
+		`
+                http {file.http} [request-name|request-number]
+                http --list {file.http}
+                http --export {file.http}
+
+                execute the requests in a .http/.rest file (all, or the specified one),
+                list them, or export the requests executed in this session
+                `,
+		func(line string) (stop bool) {
+			parts := strings.Fields(line)
+
+			if len(parts) == 2 && parts[0] == "--export" {
+				f, err := os.Create(parts[1])
+				if err == nil {
+					err = history.Export(f, redactor)
+					if cerr := f.Close(); err == nil {
+						err = cerr
+					}
+				}
+				if err != nil {
+					fmt.Println(err)
+					commander.SetVar("error", err)
+				}
+
+				return
+			}
+
+			list := len(parts) > 0 && parts[0] == "--list"
+			if list {
+				parts = parts[1:]
+			}
+
+			if len(parts) == 0 || len(parts) > 2 || strings.HasPrefix(parts[0], "-") {
+				fmt.Println("usage: http [--list|--export] {file.http} [request-name|request-number]")
+				return
+			}
+
+			f, err := readRestFile(strings.TrimPrefix(parts[0], "@"))
+			if err != nil {
+				fmt.Println(err)
+				commander.SetVar("error", err)
+				return
+			}
+
+			if list {
+				for i, r := range f.Requests {
+					fmt.Printf("%3d %-20v %v %v\n", i+1, r.Name, r.Method, r.URL)
+				}
+
+				return
+			}
+
+			requests := f.Requests
+
+			if len(parts) == 2 {
+				r := f.Find(parts[1])
+				if r == nil {
+					fmt.Println("request not found:", parts[1])
+					return
+				}
+
+				requests = []*restRequest{r}
+			}
+
+			for _, r := range requests {
+				executeRestRequest(commander, client, f, r, commander.GetBoolVar("print"))
+
+				if commander.GetVar("error") != "" {
+					break
+				}
+			}
+
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"foreach",
+		`
+                foreach @{data-file} command...
+
+                execute command for each row of the data file (CSV with header, or JSON lines),
+                replacing {{name}} with the row values (CSV columns are also available as {{col1}}, {{col2}}...)
+                `,
+		func(line string) (stop bool) {
+			parts := args.GetArgsN(line, 2)
+			if len(parts) != 2 {
+				fmt.Println("usage: foreach @{data-file} command...")
+				return
+			}
+
+			rows, err := readRows(strings.TrimPrefix(parts[0], "@"))
+			if err != nil {
+				fmt.Println(err)
+				commander.SetVar("error", err)
+				return
+			}
+
+			var failures []string
+
+			for i, row := range rows {
+				for k, v := range row {
+					commander.SetVar(k, v)
+				}
+
+				commander.SetVar("error", "")
+
+				if commander.OneCmd(expandTemplate(parts[1], row)) {
+					stop = true
+					break
+				}
+
+				if err := commander.GetVar("error"); err != "" {
+					failures = append(failures, fmt.Sprintf("row %v: %v", i+1, err))
+				}
+			}
+
+			fmt.Printf("foreach: %v rows, %v failures\n", len(rows), len(failures))
+			for _, f := range failures {
+				fmt.Println("  ", f)
+			}
+
+			commander.SetVar("failures", len(failures))
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"jwt",
 		`
-                head [url-path] [short-data]
+                jwt token
                 `,
 		func(line string) (stop bool) {
-			res := request(commander, client, "head", line, false, commander.GetBoolVar("trace"))
-			if res != nil {
-				json.PrintJson(res.Header)
+			parts := strings.Split(line, ".")
+			if len(parts) != 3 {
+				fmt.Println("not a JWT token")
+			}
+
+			decoded, err := base64.RawStdEncoding.DecodeString(parts[1])
+			if err != nil {
+				fmt.Println(err)
+			} else {
+				fmt.Println(string(decoded))
+				commander.SetVar("body", string(decoded))
+			}
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"cookiejar",
+		`
+                cookiejar [--add|--delete|--save|domain]
+                `,
+		func(line string) (stop bool) {
+			if line == "--add" {
+				if client.GetCookieJar() != nil {
+					fmt.Println("you already have a cookie jar")
+					return
+				}
+
+				jar, err := cookiejar.New(&cookiejar.Options{
+					PublicSuffixList: publicsuffix.List,
+					Filename:         COOKIE_FILE,
+				})
+				if err != nil {
+					fmt.Println("cannot create cookiejar:", err)
+					commander.SetVar("error", err)
+				}
+
+				client.SetCookieJar(jar)
+				fmt.Println("cookiejar added")
+			} else if line == "--delete" || line == "--remove" {
+				client.SetCookieJar(nil)
+				fmt.Println("cookiejar removed")
+			} else if line == "--save" {
+				if jar := client.GetCookieJar(); jar != nil {
+					jar.(*cookiejar.Jar).Save()
+				}
+			} else if strings.HasPrefix(line, "-") {
+				fmt.Println("invalid option", line)
+				fmt.Println("usage: cookiejar [--add|--delete|--save]")
+			} else {
+				if client.GetCookieJar() == nil {
+					fmt.Println("no cookiejar")
+					return
+				}
+
+				if line == "" {
+					fmt.Println("usage: cookiejar baseurl")
+					return
+				}
+
+				u, err := url.Parse(line)
+				if err != nil {
+					fmt.Println(err)
+					commander.SetVar("error", err)
+					return
+				}
+
+				cookies := client.GetCookieJar().Cookies(u)
+				if len(cookies) == 0 {
+					fmt.Println("no cookies in the cookiejar")
+					return
+				}
+
+				fmt.Println("Cookies:")
+				for _, cookie := range cookies {
+					//fmt.Println(simplejson.MustDumpString(cookie, simplejson.Indent(" ")))
+					fmt.Printf("  %v: %v\n", cookie.Name, cookie.Value)
+				}
+			}
+
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"cookie",
+		`
+                cookie set name=value [domain] [--path=path] [--secure]
+                cookie del name [domain]
+                cookie list [url]
+                cookie import file
+                cookie export file
+
+                manage the client cookies. A cookie with no domain is only sent to the base URL host,
+                a domain with a leading "." also matches the subdomains.
+                import and export use the Netscape cookies.txt format (as curl and wget).
+                `,
+		func(line string) (stop bool) {
+			cookieCommand(commander, client, line)
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"proto",
+		`
+                proto load descriptor.pb
+                proto list
+                proto call [--grpc-web] [--method=post] url-path request-type response-type [json]
+
+                send protobuf requests: load a descriptor set (protoc --include_imports --descriptor_set_out=descriptor.pb),
+                then call an endpoint with a request message (from JSON) and print the response message as JSON.
+                With --grpc-web the request uses the gRPC-Web framing (url-path is /package.Service/Method).
+                `,
+		func(line string) (stop bool) {
+			protoCommand(commander, client, line)
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"template",
+		`
+                template load file.tmpl ...
+                template list
+                template show name
+                template render name [field=value ...]
+                template send method url-path name [field=value ...]
+
+                manage request body templates (Go text/template, the name is the file name without extensions
+                and body.json.tmpl sets the Content-Type to application/json).
+                The fields are available as {{.field}} and the variables as {{var "name"}}, url-path can also be a template.
+                `,
+		func(line string) (stop bool) {
+			templateCommand(commander, client, line)
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"serve",
+		`
+                serve [--tls] [[host]:port] [dir]
+                `,
+		func(line string) (stop bool) {
+			port := ":3000"
+			dir := "."
+			secure := false
+
+			parts := strings.Fields(line)
+			if len(parts) > 0 && parts[0] == "--tls" {
+				secure = true
+				parts = parts[1:]
+			}
+
+			if len(parts) > 2 {
+				fmt.Println("too many arguments")
+				fmt.Println()
+				fmt.Println("usage: serve [--tls] [[host]:port] [dir]")
+				return
+			}
+
+			for _, p := range parts {
+				if strings.Contains(p, ":") {
+					port = p
+				} else {
+					dir = p
+				}
+			}
+
+			server := httpserve.New(port).Static(dir)
+			server.Verbose = client.Verbose
+
+			if secure {
+				if err := server.SelfSigned(); err != nil {
+					fmt.Println(err)
+					return
+				}
+			}
+
+			fmt.Printf("Serving directory %q on port %v\n", dir, port)
+			if err := server.Serve(); err != nil {
+				fmt.Println(err)
+			}
+
+			return
+		},
+		nil})
+
+	var listening *listener
+
+	commander.Add(cmd.Command{"listen",
+		`
+                listen [--tls] [--status=code] [--body=text|@file] [--content-type=type] [--path=path] [[host]:port]
+                listen wait [count] [timeout]
+                listen show|clear|stop
+
+                start a server in background that records the incoming requests (i.e. to test outbound webhooks)
+                and responds with the canned response (default 200, empty body).
+                wait prints the next count requests (default 1, waiting up to 60s) and show all the recorded ones,
+                setting the request_method, request_url, request_headers and request_body variables to the last one
+                `,
+		func(line string) (stop bool) {
+			pargs := args.ParseArgs(line)
+
+			sub := ""
+			if len(pargs.Arguments) > 0 {
+				sub = pargs.Arguments[0]
+			}
+
+			switch sub {
+			case "wait", "show", "clear", "stop":
+				if listening == nil {
+					fmt.Println("not listening")
+					return
+				}
+			}
+
+			switch sub {
+			case "wait":
+				count, timeout := 1, defaultListenWait
+
+				if len(pargs.Arguments) > 1 {
+					n, err := strconv.Atoi(pargs.Arguments[1])
+					if err != nil || n <= 0 {
+						fmt.Println("invalid count", pargs.Arguments[1])
+						return
+					}
+
+					count = n
+				}
+
+				if len(pargs.Arguments) > 2 {
+					d, err := time.ParseDuration(pargs.Arguments[2])
+					if err != nil {
+						fmt.Println("invalid timeout:", err)
+						return
+					}
+
+					timeout = d
+				}
+
+				first := listening.seen + 1
+				requests, err := listening.wait(count, timeout)
+
+				for i, r := range requests {
+					printRequest(first+i, r)
+				}
+				if len(requests) > 0 {
+					setRequestVars(commander, requests[len(requests)-1], listening.seen)
+				}
+
+				if err != nil {
+					fmt.Printf("received %v of %v requests: %v\n", len(requests), count, err)
+					commander.SetVar("error", err)
+				}
+
+			case "show":
+				requests := listening.server.Requests()
+				for i, r := range requests {
+					printRequest(i+1, r)
+				}
+
+				if len(requests) > 0 {
+					setRequestVars(commander, requests[len(requests)-1], len(requests))
+				}
+
+				listening.seen = len(requests)
+
+			case "clear":
+				listening.server.Reset()
+				listening.seen = 0
+
+			case "stop":
+				listening.server.Close()
+				listening = nil
+
+			default:
+				if len(pargs.Arguments) > 1 {
+					fmt.Println("too many arguments")
+					return
+				}
+
+				addr := ":3000"
+				if sub != "" {
+					addr = sub
+				}
+
+				response := listenResponse{
+					path:        pargs.Options["path"],
+					body:        pargs.Options["body"],
+					contentType: pargs.Options["content-type"],
+				}
+
+				if v, ok := pargs.Options["status"]; ok {
+					status, err := strconv.Atoi(v)
+					if err != nil || status < 100 || status > 999 {
+						fmt.Println("invalid status", v)
+						return
+					}
+
+					response.status = status
+				}
+
+				if listening != nil {
+					listening.server.Close()
+					listening = nil
+				}
+
+				_, secure := pargs.Options["tls"]
+
+				l, err := startListener(addr, secure, response)
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				listening = l
+				commander.SetVar("listen_url", l.server.URL())
+				fmt.Println("Listening on", l.server.URL())
+			}
+
+			return
+		},
+		nil})
+
+	// "@name command" is executed as "load name command": if name is a named base
+	// run the command against it, if it's a request in the collection execute it,
+	// otherwise load the script file
+	loadScript, hasLoadScript := commander.Commands["load"]
+
+	commander.Add(cmd.Command{"load",
+		loadScript.Help,
+		func(line string) (stop bool) {
+			if parts := args.GetArgsN(line, 2); len(parts) == 2 {
+				if base := bases.Get(parts[0]); base != nil {
+					return runWithBase(commander, client, base, parts[1])
+				}
+			}
+
+			if name := strings.TrimSpace(line); name != "" {
+				if _, err := os.Stat(name); os.IsNotExist(err) {
+					if coll, err := readCollection(collectionFile); err == nil {
+						if r := coll.Find(name); r != nil && r.Name == name {
+							executeRestRequest(commander, client, coll, r, commander.GetBoolVar("print"))
+							return
+						}
+					}
+				}
+			}
+
+			if hasLoadScript {
+				return loadScript.Call(line)
+			}
+
+			fmt.Println("unknown base, request or script", line)
+			return
+		},
+		loadScript.Complete})
+
+	var harFile string
+
+	commander.Add(cmd.Command{"har",
+		`
+                har start {file.har}
+                har stop
+                har replay {file.har}
+
+                record all the requests and responses in HAR format (written to the file on "har stop"),
+                or replay the requests in a HAR file against the current base URL
+                `,
+		func(line string) (stop bool) {
+			parts := args.GetArgs(line)
+
+			switch {
+			case len(parts) == 2 && parts[0] == "start":
+				rec := client.StartHAR()
+				rec.Reset()
+				rec.Store = bodyStore // if enabled, the response bodies are saved in the store
+				rec.Redactor = redactor
+				harFile = parts[1]
+				fmt.Println("recording to", harFile)
+
+			case len(parts) == 1 && parts[0] == "stop":
+				h := client.StopHAR()
+				if h == nil {
+					fmt.Println("not recording")
+					return
+				}
+
+				if redactor != nil { // the rules may have changed while recording
+					h.Redact(redactor)
+				}
+
+				if err := h.WriteFile(harFile); err != nil {
+					fmt.Println(err)
+					commander.SetVar("error", err)
+					return
+				}
+
+				fmt.Println(len(h.Log.Entries), "entries saved to", harFile)
+
+			case len(parts) == 2 && parts[0] == "replay":
+				h, err := httpclient.ReadHARFile(parts[1])
+				if err != nil {
+					fmt.Println(err)
+					commander.SetVar("error", err)
+					return
+				}
+
+				commander.SetVar("error", "")
+
+				err = client.ReplayHAR(h, func(e *httpclient.HAREntry, res *httpclient.HttpResponse, err error) error {
+					if err != nil {
+						fmt.Println(e.Request.Method, e.Request.URL, "ERROR:", err)
+						commander.SetVar("error", err)
+					} else {
+						fmt.Printf("%v %v %v (recorded %v)\n",
+							e.Request.Method, res.Request.URL, theme.Status(res.Status, res.StatusCode), e.Response.Status)
+					}
+
+					return nil
+				})
+				if err != nil {
+					fmt.Println(err)
+					commander.SetVar("error", err)
+				}
+
+			default:
+				fmt.Println("usage: har start {file.har} | har stop | har replay {file.har}")
 			}
+
 			return
 		},
 		nil})
 
-	commander.Add(cmd.Command{"get",
+	commander.Add(cmd.Command{"redact",
 		`
-                get [url-path] [short-data]
+                redact [list]
+                redact add {json-path} ...
+                redact remove {json-path}
+                redact clear
+
+                set the fields of JSON bodies that are redacted in the exports (http --export, har) and logs (verbose body),
+                i.e. "redact add $.password $..token $.items[*].secret"
                 `,
 		func(line string) (stop bool) {
-			request(commander, client, "get", line, commander.GetBoolVar("print"), commander.GetBoolVar("trace"))
+			parts := args.GetArgs(line)
+			if len(parts) == 0 {
+				parts = []string{"list"}
+			}
+
+			paths := redactPaths
+
+			switch {
+			case parts[0] == "list" && len(parts) == 1:
+				for _, p := range redactPaths {
+					fmt.Println(" ", p)
+				}
+				return
+
+			case parts[0] == "add" && len(parts) > 1:
+				paths = append(append([]string(nil), redactPaths...), parts[1:]...)
+
+			case parts[0] == "remove" && len(parts) == 2:
+				paths = nil
+				for _, p := range redactPaths {
+					if p != parts[1] {
+						paths = append(paths, p)
+					}
+				}
+
+			case parts[0] == "clear" && len(parts) == 1:
+				paths = nil
+
+			default:
+				fmt.Println("usage: redact [list] | redact add {json-path} ... | redact remove {json-path} | redact clear")
+				return
+			}
+
+			r, err := httpclient.NewRedactor(paths...)
+			if err != nil {
+				fmt.Println(err)
+				commander.SetVar("error", err)
+				return
+			}
+
+			redactPaths = paths
+			redactor = r
+			if len(paths) == 0 {
+				redactor = nil
+			}
+
+			if lt, ok := client.GetTransport().(*httpclient.LoggingTransport); ok {
+				lt.Redactor = redactor
+			}
+
 			return
 		},
 		nil})
 
-	commander.Add(cmd.Command{"post",
+	commander.Add(cmd.Command{"store",
 		`
-                post [url-path] [short-data]
+                store [on [dir]|off]
+                store list
+                store show {url|hash}
+                store prune
+
+                save the response bodies in a content-addressable store (identical bodies are saved once),
+                indexed by URL. Recorded HAR files reference the bodies in the store.
+                "store prune" removes the bodies that are not referenced by the URL index.
                 `,
 		func(line string) (stop bool) {
-			request(commander, client, "post", line, commander.GetBoolVar("print"), commander.GetBoolVar("trace"))
+			parts := args.GetArgs(line)
+
+			if len(parts) > 0 && parts[0] == "on" && len(parts) <= 2 {
+				dir := STORE_DIR
+				if len(parts) == 2 {
+					dir = parts[1]
+				}
+
+				store, err := httpclient.OpenBodyStore(dir)
+				if err != nil {
+					fmt.Println(err)
+					commander.SetVar("error", err)
+					return
+				}
+
+				bodyStore = store
+				parts = nil
+			} else if len(parts) == 1 && parts[0] == "off" {
+				bodyStore = nil
+				parts = nil
+			}
+
+			switch {
+			case len(parts) == 0:
+				if bodyStore == nil {
+					fmt.Println("store off")
+				} else {
+					fmt.Println("store", bodyStore.Dir())
+				}
+
+			case bodyStore == nil:
+				fmt.Println("store is off")
+
+			case len(parts) == 1 && parts[0] == "list":
+				for _, u := range bodyStore.URLs() {
+					hash, _ := bodyStore.Lookup(u)
+					fmt.Println(" ", hash[:12], u)
+				}
+
+			case len(parts) == 2 && parts[0] == "show":
+				body, err := bodyStore.GetURL(parts[1])
+				if err != nil {
+					body, err = bodyStore.Get(parts[1])
+				}
+				if err != nil {
+					fmt.Println("not found:", parts[1])
+					return
+				}
+
+				printPaged(string(body))
+				commander.SetVar("body", string(body))
+
+			case len(parts) == 1 && parts[0] == "prune":
+				n, err := bodyStore.Prune()
+				if err != nil {
+					fmt.Println(err)
+					commander.SetVar("error", err)
+				}
+
+				fmt.Println(n, "bodies removed")
+
+			default:
+				fmt.Println("usage: store [on [dir]|off] | store list | store show {url|hash} | store prune")
+			}
+
 			return
 		},
 		nil})
 
-	commander.Add(cmd.Command{"put",
+	commander.Add(cmd.Command{"save",
 		`
-                put [url-path] [short-data]
+                save name
+
+                save the last request (method, path, headers, parameters and body) in the collection,
+                to be executed later with "load name"
                 `,
 		func(line string) (stop bool) {
-			request(commander, client, "put", line, commander.GetBoolVar("print"), commander.GetBoolVar("trace"))
+			name := strings.TrimSpace(line)
+			if name == "" || strings.ContainsAny(name, " \t") {
+				fmt.Println("usage: save name")
+				return
+			}
+
+			last := history.Last()
+			if last == nil {
+				fmt.Println("no request")
+				return
+			}
+
+			coll, err := readCollection(collectionFile)
+			if err == nil {
+				coll.Set(namedRequest(last, name, client.BaseURL))
+				err = writeCollection(collectionFile, coll)
+			}
+			if err != nil {
+				fmt.Println(err)
+				commander.SetVar("error", err)
+			}
+
 			return
 		},
 		nil})
 
-	commander.Add(cmd.Command{"delete",
+	commander.Add(cmd.Command{"collection",
 		`
-                delete [url-path] [short-data]
+                collection [list]
+                collection show name
+                collection remove name
+                collection file [filename]
+
+                manage the collection of named requests (saved with "save name", executed with "load name")
                 `,
 		func(line string) (stop bool) {
-			request(commander, client, "delete", line, commander.GetBoolVar("print"), commander.GetBoolVar("trace"))
+			parts := args.GetArgs(line)
+			if len(parts) == 0 {
+				parts = []string{"list"}
+			}
+
+			if parts[0] == "file" && len(parts) <= 2 {
+				if len(parts) == 2 {
+					collectionFile = parts[1]
+				}
+
+				fmt.Println("collection", collectionFile)
+				return
+			}
+
+			coll, err := readCollection(collectionFile)
+			if err != nil {
+				fmt.Println(err)
+				commander.SetVar("error", err)
+				return
+			}
+
+			switch {
+			case parts[0] == "list" && len(parts) == 1:
+				for _, r := range coll.Requests {
+					fmt.Printf("  %-20v %v %v\n", r.Name, r.Method, r.URL)
+				}
+
+			case parts[0] == "show" && len(parts) == 2:
+				if r := coll.Find(parts[1]); r != nil {
+					fmt.Print(r)
+				} else {
+					fmt.Println("request not found:", parts[1])
+				}
+
+			case parts[0] == "remove" && len(parts) == 2:
+				if !coll.Remove(parts[1]) {
+					fmt.Println("request not found:", parts[1])
+					return
+				}
+
+				if err := writeCollection(collectionFile, coll); err != nil {
+					fmt.Println(err)
+					commander.SetVar("error", err)
+				}
+
+			default:
+				fmt.Println("usage: collection [list|show name|remove name|file [filename]]")
+			}
+
 			return
 		},
 		nil})
 
-	commander.Add(cmd.Command{"jwt",
+	commander.Add(cmd.Command{"compare",
 		`
-                jwt token
+                compare @name1 @name2... command
+
+                execute the command against multiple named bases and show the differences
                 `,
 		func(line string) (stop bool) {
-			parts := strings.Split(line, ".")
-			if len(parts) != 3 {
-				fmt.Println("not a JWT token")
+			var names []string
+
+			rest := strings.TrimSpace(line)
+			for strings.HasPrefix(rest, "@") {
+				parts := args.GetArgsN(rest, 2)
+				names = append(names, parts[0][1:])
+
+				if len(parts) < 2 {
+					rest = ""
+					break
+				}
+
+				rest = strings.TrimSpace(parts[1])
 			}
 
-			decoded, err := base64.RawStdEncoding.DecodeString(parts[1])
-			if err != nil {
-				fmt.Println(err)
-			} else {
-				fmt.Println(string(decoded))
-				commander.SetVar("body", string(decoded))
+			if len(names) < 2 || rest == "" {
+				fmt.Println("usage: compare @name1 @name2... command")
+				return
+			}
+
+			if !compareTargets(commander, client, names, rest) {
+				commander.SetVar("error", "responses differ")
 			}
 			return
 		},
 		nil})
 
-	commander.Add(cmd.Command{"cookiejar",
+	commander.Add(cmd.Command{"diff",
 		`
-                cookiejar [--add|--delete|--save|domain]
+                diff [--ignore=path,...] [request-a request-b]
+
+                compare the status, headers and body of the last two responses (or of the responses to the two requests,
+                commands or names of requests in the collection, i.e. diff "@staging get /users" "@prod get /users").
+                JSON bodies are compared by field. The ignored paths are as in expect (header.name, body.items.*.id),
+                header.Date and header.Age are always ignored
                 `,
 		func(line string) (stop bool) {
-			if line == "--add" {
-				if client.GetCookieJar() != nil {
-					fmt.Println("you already have a cookie jar")
-					return
-				}
+			pargs := args.ParseArgs(line)
 
-				jar, err := cookiejar.New(&cookiejar.Options{
-					PublicSuffixList: publicsuffix.List,
-					Filename:         COOKIE_FILE,
-				})
-				if err != nil {
-					fmt.Println("cannot create cookiejar:", err)
-					commander.SetVar("error", err)
-				}
+			ignore := defaultDiffIgnore
+			if v := pargs.Options["ignore"]; v != "" {
+				ignore = append(strings.Split(v, ","), ignore...)
+			}
 
-				client.SetCookieJar(jar)
-				fmt.Println("cookiejar added")
-			} else if line == "--delete" || line == "--remove" {
-				client.SetCookieJar(nil)
-				fmt.Println("cookiejar removed")
-			} else if line == "--save" {
-				if jar := client.GetCookieJar(); jar != nil {
-					jar.(*cookiejar.Jar).Save()
-				}
-			} else if strings.HasPrefix(line, "-") {
-				fmt.Println("invalid option", line)
-				fmt.Println("usage: cookiejar [--add|--delete|--save]")
-			} else {
-				if client.GetCookieJar() == nil {
-					fmt.Println("no cookiejar")
-					return
-				}
+			var a, b *diffResponse
 
-				if line == "" {
-					fmt.Println("usage: cookiejar baseurl")
+			switch len(pargs.Arguments) {
+			case 0:
+				if a, b = recentResponses.Last2(); a == nil {
+					fmt.Println("less than two responses to compare")
 					return
 				}
 
-				u, err := url.Parse(line)
-				if err != nil {
+			case 2:
+				var err error
+				if a, b, err = diffRequests(commander, pargs.Arguments[0], pargs.Arguments[1]); err != nil {
 					fmt.Println(err)
 					commander.SetVar("error", err)
 					return
 				}
 
-				cookies := client.GetCookieJar().Cookies(u)
-				if len(cookies) == 0 {
-					fmt.Println("no cookies in the cookiejar")
-					return
-				}
+			default:
+				fmt.Println("usage: diff [--ignore=path,...] [request-a request-b]")
+				return
+			}
 
-				fmt.Println("Cookies:")
-				for _, cookie := range cookies {
-					//fmt.Println(simplejson.MustDumpString(cookie, simplejson.Indent(" ")))
-					fmt.Printf("  %v: %v\n", cookie.Name, cookie.Value)
-				}
+			diffs := diffResponses(a, b, ignore)
+			printDiff(diffs)
+
+			if len(diffs) > 0 {
+				commander.SetVar("error", "responses differ")
 			}
+			return
+		},
+		nil})
 
+	commander.Add(cmd.Command{"watch",
+		`
+                watch [-n interval] [--count=n] command...
+
+                repeat the command every interval (in seconds, or a duration as 500ms, default 2s) until interrupted,
+                printing the full response the first time and then the differences with the previous response.
+                The status changes are printed when they happen and as a history at the end (i.e. watch -n 5 get /health)
+                `,
+		func(line string) (stop bool) {
+			watchCommand(commander, line)
 			return
 		},
 		nil})
 
-	commander.Add(cmd.Command{"serve",
+	// the stats plugin "stats" command is still available for lists of values
+	pluginStats, hasPluginStats := commander.Commands["stats"]
+
+	commander.Add(cmd.Command{"stats",
 		`
-                serve [[host]:port] [dir]
+                stats [--reset]
                 `,
 		func(line string) (stop bool) {
-			port := ":3000"
-			dir := "."
+			switch line {
+			case "":
+				stats := client.Stats()
+
+				fmt.Println("Requests:      ", stats.Requests)
+				fmt.Println("Errors:        ", stats.Errors)
+				fmt.Println("Timeouts:      ", stats.Timeouts)
+				for _, class := range []string{"1xx", "2xx", "3xx", "4xx", "5xx"} {
+					if n := stats.Status[class]; n > 0 {
+						fmt.Printf("Status %v:     %v\n", class, n)
+					}
+				}
+				fmt.Println("New conns:     ", stats.NewConns)
+				fmt.Println("Reused conns:  ", stats.ReusedConns)
+				fmt.Println("Bytes sent:    ", stats.BytesSent)
+				fmt.Println("Bytes received:", stats.BytesReceived)
+				fmt.Println("Latency:        min", stats.MinLatency.Round(time.Millisecond),
+					"max", stats.MaxLatency.Round(time.Millisecond),
+					"mean", stats.MeanLatency.Round(time.Millisecond),
+					"p50", stats.P50Latency.Round(time.Millisecond),
+					"p90", stats.P90Latency.Round(time.Millisecond),
+					"p99", stats.P99Latency.Round(time.Millisecond))
+
+				commander.SetVar("stats", simplejson.MustDumpString(stats))
+
+			case "--reset":
+				client.ResetStats()
+				fmt.Println("stats reset")
+
+			default:
+				if hasPluginStats {
+					return pluginStats.Call(line)
+				}
 
-			parts := strings.Fields(line)
-			if len(parts) > 2 {
-				fmt.Println("too many arguments")
-				fmt.Println()
-				fmt.Println("usage: serve [[host]:port] [dir]")
-				return
+				fmt.Println("usage: stats [--reset]")
 			}
 
-			for _, p := range parts {
-				if strings.Contains(p, ":") {
-					port = p
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"traces",
+		`
+                traces start|stop|reset
+                traces [--json]
+
+                collect the traces of all the requests and report the count and min/avg/p50/p95/p99/max
+                of each phase (dns, connect, tls, request, wait, response, ttfb and total)
+                `,
+		func(line string) (stop bool) {
+			traces := client.GetTraceCollector()
+
+			switch line {
+			case "start":
+				if traces == nil {
+					client.SetTraceCollector(httpclient.NewTraceCollector())
+				}
+
+			case "stop":
+				client.SetTraceCollector(nil)
+
+			case "reset":
+				if traces != nil {
+					traces.Reset()
+				}
+
+			case "", "--json":
+				if traces == nil {
+					fmt.Println("not collecting (use traces start)")
+					return
+				}
+
+				report := traces.Report()
+				commander.SetVar("traces", simplejson.MustDumpString(report))
+
+				if line == "--json" {
+					report.WriteJSON(os.Stdout)
 				} else {
-					dir = p
+					report.WriteTable(os.Stdout)
 				}
-			}
 
-			fmt.Printf("Serving directory %q on port %v\n", dir, port)
-			if err := http.ListenAndServe(port, http.FileServer(http.Dir(dir))); err != nil {
-				fmt.Println(err)
+			default:
+				fmt.Println("usage: traces start|stop|reset | traces [--json]")
 			}
 
 			return
@@ -550,7 +3018,62 @@ func main() {
 		},
 		nil})
 
+	commander.Add(cmd.Command{"run",
+		`
+                run script-file [--vus n] [--iterations n] [--notify[=webhook-url]]
+
+                execute the script concurrently with n virtual users (each with its own variables),
+                for the specified number of iterations, and report the aggregated results.
+                The commands that change the settings shared by the virtual users (i.e. base add, format,
+                redact, store, template load, tls, timeout) are not available in the script.
+                With --notify, send a desktop notification (or post to the webhook) when done.
+                `,
+		func(line string) (stop bool) {
+			line, notifyTarget, notifyDone := notifyOption(line)
+
+			script, vus, iterations, err := parseRunArgs(line)
+			if err != nil {
+				fmt.Println(err)
+				fmt.Println("usage: run script-file [--vus n] [--iterations n] [--notify[=webhook-url]]")
+				return
+			}
+
+			res := runScript(client, script, vus, iterations)
+			res.Print()
+
+			commander.SetVar("failures", res.Failures)
+
+			if notifyDone {
+				message := fmt.Sprintf("%v iterations, %v failures, elapsed %v",
+					res.Iterations, res.Failures, res.Elapsed.Round(time.Millisecond))
+
+				if err := notify(notifyTarget, "run "+script, message, res.Failures > 0); err != nil {
+					fmt.Println("notify:", err)
+				}
+			}
+			return
+		},
+		nil})
+
 	commander.Commands["set"] = commander.Commands["var"]
+	return commander
+}
+
+func main() {
+	var client = httpclient.NewHttpClient("")
+
+	client.UserAgent = "httpclient/0.1"
+	client.EnableStats(true)
+
+	commander := newCommander(client)
+
+	for i, arg := range os.Args {
+		if arg == "--no-color" || arg == "-no-color" {
+			theme = themes["none"]
+			os.Args = append(os.Args[:i], os.Args[i+1:]...)
+			break
+		}
+	}
 
 	if len(os.Args) > 1 && os.Args[1] == "serve" {
 		commander.OneCmd(strings.Join(os.Args[1:], " "))
@@ -575,6 +3098,10 @@ func main() {
 		if os.Args[1] == "-script" || os.Args[1] == "--script" {
 			cmd := "@" + os.Args[2]
 			commander.OneCmd(cmd)
+
+			if commander.GetIntVar("failures") > 0 {
+				os.Exit(1)
+			}
 		} else {
 			fmt.Println("usage:", os.Args[0], "[{base-url} | @{script-file} | -script {script-file}]")
 		}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// notifyOption removes the --notify[=target] option from the command line
+func notifyOption(line string) (rest, target string, ok bool) {
+	var fields []string
+
+	for _, f := range strings.Fields(line) {
+		switch {
+		case f == "--notify":
+			ok = true
+		case strings.HasPrefix(f, "--notify="):
+			ok = true
+			target = strings.TrimPrefix(f, "--notify=")
+		default:
+			fields = append(fields, f)
+		}
+	}
+
+	return strings.Join(fields, " "), target, ok
+}
+
+// notify sends a notification when a long running operation completes:
+// a desktop notification if target is empty, or a JSON POST to target if it's a webhook URL.
+func notify(target, title, message string, failed bool) error {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		return notifyWebhook(target, title, message, failed)
+	}
+
+	if target != "" {
+		return fmt.Errorf("invalid notify target %q (expected a webhook URL)", target)
+	}
+
+	return notifyDesktop(title, message)
+}
+
+// notifyDesktop shows a desktop notification
+func notifyDesktop(title, message string) error {
+	var c *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %v with title %v", strconv.Quote(message), strconv.Quote(title))
+		c = exec.Command("osascript", "-e", script)
+	case "windows":
+		c = exec.Command("msg", "*", title+": "+message)
+	default:
+		c = exec.Command("notify-send", title, message)
+	}
+
+	return c.Run()
+}
+
+// notifyWebhook posts the notification as JSON, in a format compatible with Slack and Mattermost webhooks
+func notifyWebhook(u, title, message string, failed bool) error {
+	status := "ok"
+	if failed {
+		status = "failed"
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"title":   title,
+		"message": message,
+		"status":  status,
+		"text":    title + ": " + message,
+	})
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	resp, err := client.Post(u, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Notification failed: %v", resp.Status)
+	}
+
+	return nil
+}
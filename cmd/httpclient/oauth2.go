@@ -0,0 +1,594 @@
+package main
+
+// OAuth2 interactive login (device authorization grant - RFC 8628, authorization code with PKCE - RFC 7636)
+//
+// Tokens are stored encrypted in the user configuration directory and refreshed automatically
+// before sending requests.
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobs/httpclient"
+)
+
+const (
+	TOKENS_FILE = "tokens"
+	KEY_FILE    = "key"
+
+	// if set, the passphrase used to encrypt the tokens file (instead of the generated key file)
+	TOKEN_KEY_ENV = "HTTPCLIENT_TOKEN_KEY"
+)
+
+// refresh tokens that expire within this interval
+const tokenRefreshMargin = 30 * time.Second
+
+// oauth2Config contains the OAuth2 client and endpoints configuration
+type oauth2Config struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	AuthURL      string `json:"auth_url,omitempty"`
+	DeviceURL    string `json:"device_url,omitempty"`
+	TokenURL     string `json:"token_url"`
+}
+
+// oauth2Token is a token obtained from the token endpoint, with the configuration used to refresh it
+type oauth2Token struct {
+	Config oauth2Config `json:"config"`
+
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// Valid returns true if the token is not expired (or about to expire)
+func (t *oauth2Token) Valid() bool {
+	return t.AccessToken != "" && (t.Expiry.IsZero() || time.Now().Add(tokenRefreshMargin).Before(t.Expiry))
+}
+
+// the response from the token (or device authorization) endpoint
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+
+	// device authorization response
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	Interval                int    `json:"interval"`
+}
+
+func (r *tokenResponse) err() error {
+	if r.Error == "" {
+		return nil
+	}
+
+	if r.ErrorDescription != "" {
+		return fmt.Errorf("%v: %v", r.Error, r.ErrorDescription)
+	}
+
+	return errors.New(r.Error)
+}
+
+// oauth2Session keeps the current token and refreshes it when needed
+type oauth2Session struct {
+	lock  sync.Mutex
+	name  string
+	token *oauth2Token
+}
+
+var oauth = &oauth2Session{}
+
+// Set the current token, and save it in the token store
+func (s *oauth2Session) Set(name string, token *oauth2Token) error {
+	s.lock.Lock()
+	s.name = name
+	s.token = token
+	s.lock.Unlock()
+
+	return saveToken(name, token)
+}
+
+// Clear the current token
+func (s *oauth2Session) Clear() {
+	s.lock.Lock()
+	s.name = ""
+	s.token = nil
+	s.lock.Unlock()
+}
+
+// Info returns the current profile name and token, if any
+func (s *oauth2Session) Info() (string, *oauth2Token) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.name, s.token
+}
+
+// Authorize sets the client bearer token, refreshing it if expired
+func (s *oauth2Session) Authorize(client *httpclient.HttpClient) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.token == nil {
+		return nil
+	}
+
+	if !s.token.Valid() && s.token.RefreshToken != "" {
+		token, err := refreshToken(s.token)
+		if err != nil {
+			return fmt.Errorf("cannot refresh token: %v", err)
+		}
+
+		s.token = token
+
+		if err := saveToken(s.name, token); err != nil {
+			fmt.Println("cannot save token:", err)
+		}
+	}
+
+	client.SetBearerToken(s.token.AccessToken)
+	return nil
+}
+
+// discover the endpoints from the issuer OpenID configuration
+func discoverOAuth2(issuer string, config *oauth2Config) error {
+	res, err := httpclient.NewHttpClient("").Get(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", nil, nil)
+	if err == nil {
+		err = res.ResponseError()
+	}
+	if err != nil {
+		res.Close()
+		return err
+	}
+
+	var meta struct {
+		AuthorizationEndpoint       string `json:"authorization_endpoint"`
+		DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+		TokenEndpoint               string `json:"token_endpoint"`
+	}
+
+	if err := res.JsonDecode(&meta, false); err != nil {
+		return err
+	}
+
+	if config.AuthURL == "" {
+		config.AuthURL = meta.AuthorizationEndpoint
+	}
+	if config.DeviceURL == "" {
+		config.DeviceURL = meta.DeviceAuthorizationEndpoint
+	}
+	if config.TokenURL == "" {
+		config.TokenURL = meta.TokenEndpoint
+	}
+
+	return nil
+}
+
+// postToken sends a form request to an OAuth2 endpoint and decodes the response.
+// OAuth2 errors (returned with status 400 or 401) are returned in the response Error field.
+func postToken(endpoint string, config *oauth2Config, data url.Values) (*tokenResponse, error) {
+	data.Set("client_id", config.ClientID)
+	if config.ClientSecret != "" {
+		data.Set("client_secret", config.ClientSecret)
+	}
+
+	res, err := httpclient.NewHttpClient("").PostForm(endpoint, data, map[string]string{"Accept": "application/json"})
+	if err != nil {
+		return nil, err
+	}
+
+	var tr tokenResponse
+
+	if err := res.JsonDecode(&tr, false); err != nil {
+		if res.StatusCode/100 != 2 {
+			return nil, fmt.Errorf("Unexpected Status %s", res.Status)
+		}
+
+		return nil, err
+	}
+
+	if tr.Error == "" && res.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("Unexpected Status %s", res.Status)
+	}
+
+	return &tr, nil
+}
+
+func newToken(config *oauth2Config, tr *tokenResponse, prev *oauth2Token) *oauth2Token {
+	token := &oauth2Token{
+		Config:       *config,
+		AccessToken:  tr.AccessToken,
+		TokenType:    tr.TokenType,
+		RefreshToken: tr.RefreshToken,
+	}
+
+	if token.RefreshToken == "" && prev != nil { // the refresh token may not be rotated
+		token.RefreshToken = prev.RefreshToken
+	}
+
+	if tr.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+
+	return token
+}
+
+// refreshToken gets a new access token using the refresh token
+func refreshToken(token *oauth2Token) (*oauth2Token, error) {
+	data := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {token.RefreshToken},
+	}
+
+	if token.Config.Scope != "" {
+		data.Set("scope", token.Config.Scope)
+	}
+
+	tr, err := postToken(token.Config.TokenURL, &token.Config, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := tr.err(); err != nil {
+		return nil, err
+	}
+
+	return newToken(&token.Config, tr, token), nil
+}
+
+// deviceLogin executes the device authorization flow (RFC 8628)
+func deviceLogin(config *oauth2Config) (*oauth2Token, error) {
+	if config.DeviceURL == "" {
+		return nil, errors.New("missing device authorization URL")
+	}
+
+	data := url.Values{}
+	if config.Scope != "" {
+		data.Set("scope", config.Scope)
+	}
+
+	dr, err := postToken(config.DeviceURL, config, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := dr.err(); err != nil {
+		return nil, err
+	}
+
+	if dr.VerificationURIComplete != "" {
+		fmt.Println("Open", dr.VerificationURIComplete)
+		openBrowser(dr.VerificationURIComplete)
+	} else {
+		fmt.Println("Open", dr.VerificationURI)
+	}
+
+	fmt.Println("and enter the code", dr.UserCode)
+
+	interval := time.Duration(dr.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	deadline := time.Now().Add(10 * time.Minute)
+	if dr.ExpiresIn > 0 {
+		deadline = time.Now().Add(time.Duration(dr.ExpiresIn) * time.Second)
+	}
+
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		tr, err := postToken(config.TokenURL, config, url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code": {dr.DeviceCode},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		switch tr.Error {
+		case "":
+			return newToken(config, tr, nil), nil
+
+		case "authorization_pending":
+			continue
+
+		case "slow_down":
+			interval += 5 * time.Second
+			continue
+
+		default:
+			return nil, tr.err()
+		}
+	}
+
+	return nil, errors.New("expired_token: the device code has expired")
+}
+
+// pkceLogin executes the authorization code flow with PKCE (RFC 7636),
+// receiving the authorization code on a local redirect URI
+func pkceLogin(config *oauth2Config) (*oauth2Token, error) {
+	if config.AuthURL == "" {
+		return nil, errors.New("missing authorization URL")
+	}
+
+	verifier := randomString(32)
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	state := randomString(16)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	redirectURI := "http://" + l.Addr().String() + "/callback"
+
+	type result struct {
+		code string
+		err  error
+	}
+
+	results := make(chan result, 1)
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+
+		q := r.URL.Query()
+
+		var res result
+
+		switch {
+		case q.Get("error") != "":
+			res.err = (&tokenResponse{Error: q.Get("error"), ErrorDescription: q.Get("error_description")}).err()
+		case q.Get("state") != state:
+			res.err = errors.New("invalid state")
+		default:
+			res.code = q.Get("code")
+		}
+
+		if res.err != nil {
+			fmt.Fprintln(w, "Login failed:", res.err)
+		} else {
+			fmt.Fprintln(w, "Login completed, you can close this window.")
+		}
+
+		select {
+		case results <- res:
+		default:
+		}
+	})}
+
+	go server.Serve(l)
+	defer server.Close()
+
+	u, err := url.Parse(config.AuthURL)
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", config.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("state", state)
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
+	if config.Scope != "" {
+		q.Set("scope", config.Scope)
+	}
+	u.RawQuery = q.Encode()
+
+	fmt.Println("Open", u.String())
+	openBrowser(u.String())
+
+	var res result
+
+	select {
+	case res = <-results:
+	case <-time.After(5 * time.Minute):
+		return nil, errors.New("timeout waiting for authorization")
+	}
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	tr, err := postToken(config.TokenURL, config, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {res.code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tr.err(); err != nil {
+		return nil, err
+	}
+
+	return newToken(config, tr, nil), nil
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// try to open the URL in the default browser
+func openBrowser(u string) {
+	var c *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		c = exec.Command("open", u)
+	case "windows":
+		c = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		c = exec.Command("xdg-open", u)
+	}
+
+	c.Start()
+}
+
+////////////////////////////////////////////////////////////////////////////////////
+//
+// Encrypted token store
+
+// return the path of a file in the httpclient configuration directory
+func configPath(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir = filepath.Join(dir, "httpclient")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, name), nil
+}
+
+// return the encryption key for the token store, creating the key file if needed
+func tokenKey() ([]byte, error) {
+	if pass := os.Getenv(TOKEN_KEY_ENV); pass != "" {
+		key := sha256.Sum256([]byte(pass))
+		return key[:], nil
+	}
+
+	keyfile, err := configPath(KEY_FILE)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := os.ReadFile(keyfile)
+	if err == nil && len(key) == 32 {
+		return key, nil
+	}
+
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return key, os.WriteFile(keyfile, key, 0600)
+}
+
+func tokenCipher() (cipher.AEAD, error) {
+	key, err := tokenKey()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// loadTokens reads and decrypts the token store
+func loadTokens() (map[string]*oauth2Token, error) {
+	tokens := map[string]*oauth2Token{}
+
+	filename, err := configPath(TOKENS_FILE)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := tokenCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	ns := aead.NonceSize()
+	if len(data) < ns {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	plain, err := aead.Open(nil, data[:ns], data[ns:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt %v: %v", filename, err)
+	}
+
+	err = json.Unmarshal(plain, &tokens)
+	return tokens, err
+}
+
+// saveToken encrypts and saves the token in the token store (a nil token removes it)
+func saveToken(name string, token *oauth2Token) error {
+	tokens, err := loadTokens()
+	if err != nil {
+		return err
+	}
+
+	if token == nil {
+		delete(tokens, name)
+	} else {
+		tokens[name] = token
+	}
+
+	plain, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+
+	aead, err := tokenCipher()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	filename, err := configPath(TOKENS_FILE)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, aead.Seal(nonce, nonce, plain, nil), 0600)
+}
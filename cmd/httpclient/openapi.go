@@ -0,0 +1,516 @@
+package main
+
+// OpenAPI support: load a specification (OpenAPI 3 or Swagger 2, JSON format) and build
+// request bodies interactively, prompting for each field of the request schema.
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gobs/httpclient"
+)
+
+// an OpenAPI specification (only the parts needed to find the request schemas)
+type openAPISpec struct {
+	Swagger     string                                `json:"swagger"`
+	OpenAPI     string                                `json:"openapi"`
+	BasePath    string                                `json:"basePath"`
+	Paths       map[string]map[string]json.RawMessage `json:"paths"`
+	Definitions map[string]*apiSchema                 `json:"definitions"`
+	Components  struct {
+		Schemas map[string]*apiSchema `json:"schemas"`
+	} `json:"components"`
+}
+
+// a JSON schema
+type apiSchema struct {
+	Ref         string                `json:"$ref"`
+	Type        string                `json:"type"`
+	Format      string                `json:"format"`
+	Description string                `json:"description"`
+	Enum        []interface{}         `json:"enum"`
+	Default     interface{}           `json:"default"`
+	Required    []string              `json:"required"`
+	Properties  map[string]*apiSchema `json:"properties"`
+	Items       *apiSchema            `json:"items"`
+	AllOf       []*apiSchema          `json:"allOf"`
+	OneOf       []*apiSchema          `json:"oneOf"`
+	AnyOf       []*apiSchema          `json:"anyOf"`
+}
+
+// an operation (only the request body)
+type apiOperation struct {
+	RequestBody *struct {
+		Ref     string `json:"$ref"`
+		Content map[string]struct {
+			Schema *apiSchema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+
+	Parameters []struct {
+		In     string     `json:"in"`
+		Schema *apiSchema `json:"schema"`
+	} `json:"parameters"` // Swagger 2 body parameter
+}
+
+// the current specification (see the "openapi" command)
+var apiSpec *openAPISpec
+
+// loadOpenAPI loads a specification from a file or URL
+func loadOpenAPI(source string) (*openAPISpec, error) {
+	var r io.ReadCloser
+
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		res, err := httpclient.NewHttpClient("").Get(source, nil, nil)
+		if err == nil {
+			err = res.ResponseError()
+		}
+		if err != nil {
+			res.Close()
+			return nil, err
+		}
+
+		r = res.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+
+		r = f
+	}
+
+	defer r.Close()
+
+	var spec openAPISpec
+
+	if err := json.NewDecoder(r).Decode(&spec); err != nil {
+		return nil, fmt.Errorf("cannot parse %v (only JSON specifications are supported): %v", source, err)
+	}
+
+	if spec.OpenAPI == "" && spec.Swagger == "" {
+		return nil, errors.New("not an OpenAPI specification")
+	}
+
+	return &spec, nil
+}
+
+// resolve a local reference (#/components/schemas/name or #/definitions/name)
+func (spec *openAPISpec) resolve(s *apiSchema) *apiSchema {
+	for depth := 0; s != nil && s.Ref != "" && depth < 32; depth++ {
+		name := s.Ref[strings.LastIndex(s.Ref, "/")+1:]
+
+		switch {
+		case strings.HasPrefix(s.Ref, "#/components/schemas/"):
+			s = spec.Components.Schemas[name]
+		case strings.HasPrefix(s.Ref, "#/definitions/"):
+			s = spec.Definitions[name]
+		default:
+			return nil
+		}
+	}
+
+	if s == nil || len(s.AllOf) == 0 {
+		return s
+	}
+
+	// merge allOf in a single object schema
+	merged := &apiSchema{Type: "object", Description: s.Description, Properties: map[string]*apiSchema{}}
+	merged.Required = append(merged.Required, s.Required...)
+
+	for k, p := range s.Properties {
+		merged.Properties[k] = p
+	}
+
+	for _, sub := range s.AllOf {
+		if sub = spec.resolve(sub); sub != nil {
+			for k, p := range sub.Properties {
+				merged.Properties[k] = p
+			}
+
+			merged.Required = append(merged.Required, sub.Required...)
+		}
+	}
+
+	return merged
+}
+
+// RequestSchema returns the JSON request body schema for the method and path
+func (spec *openAPISpec) RequestSchema(method, path string) (*apiSchema, error) {
+	if u, err := url.Parse(path); err == nil {
+		path = u.Path
+	}
+
+	if spec.BasePath != "" && spec.BasePath != "/" {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(spec.BasePath, "/"))
+	}
+
+	for template, ops := range spec.Paths {
+		if !matchPathTemplate(template, path) {
+			continue
+		}
+
+		raw, ok := ops[strings.ToLower(method)]
+		if !ok {
+			return nil, fmt.Errorf("no %v operation for %v", strings.ToUpper(method), template)
+		}
+
+		var op apiOperation
+		if err := json.Unmarshal(raw, &op); err != nil {
+			return nil, err
+		}
+
+		if op.RequestBody != nil {
+			for ctype, content := range op.RequestBody.Content {
+				if strings.Contains(ctype, "json") {
+					return spec.resolve(content.Schema), nil
+				}
+			}
+		}
+
+		for _, p := range op.Parameters {
+			if p.In == "body" {
+				return spec.resolve(p.Schema), nil
+			}
+		}
+
+		return nil, fmt.Errorf("no JSON request body for %v %v", strings.ToUpper(method), template)
+	}
+
+	return nil, fmt.Errorf("no operation for %v", path)
+}
+
+// matchPathTemplate matches a path with an OpenAPI path template (/users/{id})
+func matchPathTemplate(template, path string) bool {
+	tparts := strings.Split(strings.Trim(template, "/"), "/")
+	pparts := strings.Split(strings.Trim(path, "/"), "/")
+
+	if len(tparts) != len(pparts) {
+		return false
+	}
+
+	for i, t := range tparts {
+		if strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}") {
+			continue
+		}
+
+		if t != pparts[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// bodyBuilder prompts for the schema fields and builds the corresponding value
+type bodyBuilder struct {
+	spec *openAPISpec
+	in   *bufio.Reader
+	out  io.Writer
+}
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// buildBody builds the request body prompting the user on stdin
+func buildBody(spec *openAPISpec, schema *apiSchema) (string, error) {
+	b := &bodyBuilder{spec: spec, in: stdinReader, out: os.Stdout}
+
+	v, err := b.build("body", schema, true)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func (b *bodyBuilder) readLine(prompt string) (string, error) {
+	fmt.Fprint(b.out, prompt)
+
+	line, err := b.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+
+	return strings.TrimSpace(line), nil
+}
+
+// hint returns the type description for the prompt: (type, required) [a|b|c] default=x
+func (b *bodyBuilder) hint(s *apiSchema, required bool) string {
+	var sb strings.Builder
+
+	t := s.Type
+	if t == "" {
+		t = "any"
+	}
+	if s.Format != "" {
+		t += "/" + s.Format
+	}
+	if t == "array" && s.Items != nil {
+		if items := b.spec.resolve(s.Items); items != nil && items.Type != "" {
+			t = "array of " + items.Type
+		}
+	}
+
+	sb.WriteString("(" + t)
+	if required {
+		sb.WriteString(", required")
+	}
+	sb.WriteString(")")
+
+	if len(s.Enum) > 0 {
+		values := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			values[i] = fmt.Sprint(e)
+		}
+
+		sb.WriteString(" [" + strings.Join(values, "|") + "]")
+	}
+
+	if s.Default != nil {
+		fmt.Fprintf(&sb, " default=%v", s.Default)
+	}
+
+	if s.Description != "" {
+		sb.WriteString(" - " + s.Description)
+	}
+
+	return sb.String()
+}
+
+// build returns the value for the schema, or nil if an optional field was skipped
+func (b *bodyBuilder) build(name string, s *apiSchema, required bool) (interface{}, error) {
+	s = b.spec.resolve(s)
+	if s == nil {
+		s = &apiSchema{}
+	}
+
+	if len(s.OneOf) > 0 || len(s.AnyOf) > 0 {
+		alts := s.OneOf
+		if len(alts) == 0 {
+			alts = s.AnyOf
+		}
+
+		s = b.spec.resolve(alts[0])
+		if s == nil {
+			s = &apiSchema{}
+		}
+
+		fmt.Fprintf(b.out, "%v: using the first of %v alternative schemas\n", name, len(alts))
+	}
+
+	if s.Type == "" && len(s.Properties) > 0 {
+		obj := *s
+		obj.Type = "object"
+		s = &obj
+	}
+
+	switch s.Type {
+	case "object":
+		if !required {
+			answer, err := b.readLine(fmt.Sprintf("%v %v - add? [y/N]: ", name, b.hint(s, false)))
+			if err != nil {
+				return nil, err
+			}
+
+			if !strings.HasPrefix(strings.ToLower(answer), "y") {
+				return nil, nil
+			}
+		}
+
+		return b.buildObject(name, s)
+
+	case "array":
+		return b.buildArray(name, s, required)
+	}
+
+	for {
+		line, err := b.readLine(fmt.Sprintf("%v %v: ", name, b.hint(s, required)))
+		if err != nil {
+			return nil, err
+		}
+
+		if line == "" {
+			if s.Default != nil {
+				return s.Default, nil
+			}
+
+			if !required {
+				return nil, nil
+			}
+
+			fmt.Fprintln(b.out, "  value required")
+			continue
+		}
+
+		v, err := convertValue(s, line)
+		if err != nil {
+			fmt.Fprintln(b.out, " ", err)
+			continue
+		}
+
+		return v, nil
+	}
+}
+
+func (b *bodyBuilder) buildObject(name string, s *apiSchema) (interface{}, error) {
+	obj := map[string]interface{}{}
+
+	required := map[string]bool{}
+	for _, r := range s.Required {
+		required[r] = true
+	}
+
+	// required fields first, then the others in alphabetical order
+	names := make([]string, 0, len(s.Properties))
+	for k := range s.Properties {
+		names = append(names, k)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if required[names[i]] != required[names[j]] {
+			return required[names[i]]
+		}
+
+		return names[i] < names[j]
+	})
+
+	for _, k := range names {
+		v, err := b.build(name+"."+k, s.Properties[k], required[k])
+		if err != nil {
+			return nil, err
+		}
+
+		if v != nil {
+			obj[k] = v
+		}
+	}
+
+	return obj, nil
+}
+
+func (b *bodyBuilder) buildArray(name string, s *apiSchema, required bool) (interface{}, error) {
+	items := b.spec.resolve(s.Items)
+	if items == nil {
+		items = &apiSchema{}
+	}
+
+	arr := []interface{}{}
+
+	if items.Type != "object" && items.Type != "array" && len(items.Properties) == 0 {
+		// scalar items: comma separated list
+		line, err := b.readLine(fmt.Sprintf("%v %v, comma separated: ", name, b.hint(s, required)))
+		if err != nil {
+			return nil, err
+		}
+
+		if line == "" {
+			if required {
+				return arr, nil
+			}
+
+			return nil, nil
+		}
+
+		for _, item := range strings.Split(line, ",") {
+			v, err := convertValue(items, strings.TrimSpace(item))
+			if err != nil {
+				return nil, err
+			}
+
+			arr = append(arr, v)
+		}
+
+		return arr, nil
+	}
+
+	for i := 0; ; i++ {
+		answer, err := b.readLine(fmt.Sprintf("%v %v - add item %v? [y/N]: ", name, b.hint(s, required), i+1))
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.HasPrefix(strings.ToLower(answer), "y") {
+			break
+		}
+
+		v, err := b.build(fmt.Sprintf("%v[%v]", name, i), items, true)
+		if err != nil {
+			return nil, err
+		}
+
+		arr = append(arr, v)
+	}
+
+	if len(arr) == 0 && !required {
+		return nil, nil
+	}
+
+	return arr, nil
+}
+
+// convertValue converts the input to the schema type, checking the enum values
+func convertValue(s *apiSchema, input string) (interface{}, error) {
+	var v interface{}
+	var err error
+
+	switch s.Type {
+	case "integer":
+		v, err = strconv.ParseInt(input, 10, 64)
+	case "number":
+		v, err = strconv.ParseFloat(input, 64)
+	case "boolean":
+		v, err = strconv.ParseBool(input)
+	case "string":
+		v = unquote(input)
+	default:
+		v, err = parseValue(input)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v value %q", s.Type, input)
+	}
+
+	if len(s.Enum) > 0 {
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				return v, nil
+			}
+		}
+
+		return nil, fmt.Errorf("value %q not in %v", input, s.Enum)
+	}
+
+	return v, nil
+}
+
+// interactiveBody builds the body for the request (method, url-path) using the loaded specification
+func interactiveBody(client *httpclient.HttpClient, method string, arguments []string) (string, error) {
+	if apiSpec == nil {
+		return "", errors.New("no OpenAPI specification loaded (see openapi command)")
+	}
+
+	path := ""
+	if len(arguments) > 0 {
+		path = arguments[0]
+	}
+
+	schema, err := apiSpec.RequestSchema(method, path)
+	if err != nil && client.BaseURL != nil && client.BaseURL.Path != "" && !strings.HasPrefix(path, "/") {
+		// try with the path relative to the base URL
+		schema, err = apiSpec.RequestSchema(method, strings.TrimSuffix(client.BaseURL.Path, "/")+"/"+path)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return buildBody(apiSpec, schema)
+}
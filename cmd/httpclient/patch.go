@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gobs/httpclient"
+)
+
+// patchBody returns the request body for a JSON Patch (RFC 6902) or JSON Merge Patch (RFC 7386) document
+func patchBody(data string, jsonPatch bool) (httpclient.RequestOption, error) {
+	if jsonPatch {
+		var ops []httpclient.PatchOp
+		if err := json.Unmarshal([]byte(data), &ops); err != nil {
+			return nil, fmt.Errorf("invalid JSON Patch: %w", err)
+		}
+
+		return httpclient.JsonPatchBody(ops), nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+
+	return httpclient.MergePatchBody(doc), nil
+}
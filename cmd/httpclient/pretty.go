@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gobs/simplejson"
+)
+
+// response body output mode (see the "pretty" command):
+//
+//	on:  indented and highlighted JSON, highlighted XML/HTML
+//	off: indented JSON, no highlighting
+//	raw: the body as received
+var pretty = "on"
+
+// the default number of lines per page, if LINES is not set
+const defaultPageLines = 40
+
+// isTerminal returns true if the standard output is a terminal
+func isTerminal() bool {
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// pageLines returns the number of lines per page (the terminal height from LINES, minus the prompt line)
+func pageLines() int {
+	if n, err := strconv.Atoi(os.Getenv("LINES")); err == nil && n > 2 {
+		return n - 1
+	}
+
+	return defaultPageLines
+}
+
+// formatBody returns the response body formatted according to the content type and the "pretty" mode
+func formatBody(contentType string, body []byte) string {
+	if pretty == "raw" {
+		return string(body)
+	}
+
+	ct := strings.ToLower(contentType)
+
+	switch {
+	case strings.Contains(ct, "json"):
+		jbody, err := simplejson.LoadBytes(body)
+		if err != nil {
+			return string(body)
+		}
+
+		return formatJson(jbody.Data(), pretty == "on")
+
+	case strings.Contains(ct, "xml") || strings.Contains(ct, "html"):
+		if pretty == "on" && theme.enabled() {
+			return theme.highlightMarkup(string(body))
+		}
+	}
+
+	return string(body)
+}
+
+// highlightMarkup returns the XML/HTML text with the tags, attributes and comments highlighted
+func (t *colorTheme) highlightMarkup(s string) string {
+	var sb strings.Builder
+
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			sb.WriteString(s)
+			break
+		}
+
+		sb.WriteString(s[:i])
+		s = s[i:]
+
+		if strings.HasPrefix(s, "<!--") {
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				end = len(s)
+			} else {
+				end += 3
+			}
+
+			sb.WriteString(t.color(t.Null, s[:end]))
+			s = s[end:]
+			continue
+		}
+
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			sb.WriteString(s)
+			break
+		}
+
+		sb.WriteString(t.highlightTag(s[:end+1]))
+		s = s[end+1:]
+	}
+
+	return sb.String()
+}
+
+// highlightTag highlights a single tag (i.e. <a href="/">)
+func (t *colorTheme) highlightTag(tag string) string {
+	// the tag name, including the leading < and optional / ! ?
+	n := 1
+	for n < len(tag) && strings.IndexByte("/!?", tag[n]) >= 0 {
+		n++
+	}
+	for n < len(tag) && !strings.ContainsRune(" \t\r\n/>", rune(tag[n])) {
+		n++
+	}
+
+	var sb strings.Builder
+	sb.WriteString(t.color(t.Key, tag[:n]))
+
+	rest := tag[n:]
+
+	for len(rest) > 0 {
+		switch c := rest[0]; {
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(rest[1:], c)
+			if end < 0 {
+				end = len(rest) - 1
+			} else {
+				end += 2
+			}
+
+			sb.WriteString(t.color(t.String, rest[:end]))
+			rest = rest[end:]
+
+		case c == '/' || c == '>' || c == '?':
+			sb.WriteString(t.color(t.Key, rest))
+			rest = ""
+
+		case c == '=' || c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			sb.WriteByte(c)
+			rest = rest[1:]
+
+		default: // attribute name
+			end := strings.IndexAny(rest, "= \t\r\n/>")
+			if end < 0 {
+				end = len(rest)
+			}
+
+			sb.WriteString(t.color(t.Header, rest[:end]))
+			rest = rest[end:]
+		}
+	}
+
+	return sb.String()
+}
+
+// printPaged prints the text, pausing after each page if the output is a terminal
+func printPaged(text string) {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	size := pageLines()
+
+	if !isTerminal() || len(lines) <= size {
+		fmt.Println(strings.Join(lines, "\n"))
+		return
+	}
+
+	for i := 0; i < len(lines); i += size {
+		end := i + size
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		fmt.Println(strings.Join(lines[i:end], "\n"))
+
+		if end == len(lines) {
+			break
+		}
+
+		fmt.Printf("-- %v/%v lines, Enter for more, q to quit -- ", end, len(lines))
+		answer, _ := stdinReader.ReadString('\n')
+		if strings.HasPrefix(strings.TrimSpace(answer), "q") {
+			return
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gobs/args"
+	"github.com/gobs/cmd"
+	"github.com/gobs/httpclient"
+	"github.com/gobs/httpclient/protobody"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const protoUsage = "usage: proto load descriptor.pb | proto list | proto call [--grpc-web] [--method=post] url-path request-type response-type [json]"
+
+var protoFiles *protoregistry.Files // the message types loaded with "proto load"
+
+// protoCommand loads protobuf descriptors and sends protobuf (or gRPC-Web) requests with JSON bodies
+func protoCommand(commander *cmd.Cmd, client *httpclient.HttpClient, line string) {
+	pargs := args.ParseArgs(line, args.InfieldBrackets())
+	options, parts := pargs.Options, pargs.Arguments
+	if len(parts) == 0 {
+		fmt.Println(protoUsage)
+		return
+	}
+
+	commander.SetVar("error", "")
+
+	fail := func(err error) {
+		fmt.Println(err)
+		commander.SetVar("error", err)
+	}
+
+	switch {
+	case parts[0] == "load" && len(parts) == 2:
+		b, err := os.ReadFile(parts[1])
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		var set descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(b, &set); err != nil {
+			fail(fmt.Errorf("invalid descriptor set: %w", err))
+			return
+		}
+
+		files, err := protodesc.NewFiles(&set)
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		protoFiles = files
+
+	case parts[0] == "list" && len(parts) == 1:
+		if protoFiles == nil {
+			fmt.Println("no descriptors (use proto load)")
+			return
+		}
+
+		var names []string
+
+		var add func(ms protoreflect.MessageDescriptors)
+		add = func(ms protoreflect.MessageDescriptors) {
+			for i := 0; i < ms.Len(); i++ {
+				names = append(names, string(ms.Get(i).FullName()))
+				add(ms.Get(i).Messages())
+			}
+		}
+
+		protoFiles.RangeFiles(func(f protoreflect.FileDescriptor) bool {
+			add(f.Messages())
+			return true
+		})
+
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(" ", name)
+		}
+
+	case parts[0] == "call" && len(parts) >= 4:
+		in, err := protoMessage(parts[2])
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		out, err := protoMessage(parts[3])
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		if data := strings.Join(parts[4:], " "); data != "" {
+			if err := protojson.Unmarshal([]byte(data), in); err != nil {
+				fail(fmt.Errorf("invalid %v: %w", parts[2], err))
+				return
+			}
+		}
+
+		method := "POST"
+		if m, ok := options["method"]; ok {
+			method = m
+		}
+
+		body := protobody.Body(in)
+		if _, ok := options["grpc-web"]; ok {
+			body = protobody.GrpcWebBody(in)
+		}
+
+		res, err := client.SendRequest(httpclient.Method(method), client.Path(parts[1]), body)
+		if err == nil {
+			commander.SetVar("status", res.Status)
+			err = res.ResponseError()
+		}
+		if err == nil {
+			err = protobody.Decode(res, out)
+		}
+		if err != nil {
+			res.Close()
+			fail(err)
+			return
+		}
+
+		b, err := protojson.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(out)
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		commander.SetVar("body", string(b))
+		if commander.GetBoolVar("print") {
+			fmt.Println(string(b))
+		}
+
+	default:
+		fmt.Println(protoUsage)
+	}
+}
+
+// protoMessage returns an empty message of the specified type (from the loaded descriptors)
+func protoMessage(name string) (*dynamicpb.Message, error) {
+	if protoFiles == nil {
+		return nil, fmt.Errorf("no descriptors (use proto load)")
+	}
+
+	d, err := protoFiles.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("unknown message type %q", name)
+	}
+
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a message type", name)
+	}
+
+	return dynamicpb.NewMessage(md), nil
+}
@@ -0,0 +1,351 @@
+package main
+
+// Support for the .http/.rest request file format (JetBrains HTTP Client / VS Code REST Client)
+//
+//	@host = https://example.com
+//
+//	### login
+//	# @name login
+//	POST {{host}}/login
+//	Content-Type: application/json
+//
+//	{"user": "me", "password": "secret"}
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobs/cmd"
+	"github.com/gobs/httpclient"
+	"github.com/google/uuid"
+)
+
+const maxHistory = 100
+
+var (
+	reRestVar     = regexp.MustCompile(`^@([\w.-]+)\s*=\s*(.*)$`)                    // @name = value
+	reRestName    = regexp.MustCompile(`^(?:#|//)\s*@name\s+(\S+)`)                  // # @name request-name
+	reRestRequest = regexp.MustCompile(`^(?:([A-Z]+)\s+)?(\S+)(?:\s+HTTP/[\d.]+)?$`) // [METHOD] url [HTTP/version]
+
+	history = &requestHistory{}
+)
+
+// a request from a .http file
+type restRequest struct {
+	Name    string
+	Method  string
+	URL     string
+	Headers [][2]string
+	Body    string
+}
+
+// String returns the request in .http format
+func (r *restRequest) String() string {
+	var sb strings.Builder
+
+	if r.Name != "" {
+		fmt.Fprintf(&sb, "# @name %v\n", r.Name)
+	}
+
+	fmt.Fprintf(&sb, "%v %v\n", r.Method, r.URL)
+
+	for _, h := range r.Headers {
+		fmt.Fprintf(&sb, "%v: %v\n", h[0], h[1])
+	}
+
+	if r.Body != "" {
+		fmt.Fprintf(&sb, "\n%v\n", r.Body)
+	}
+
+	return sb.String()
+}
+
+// a .http file: the file variables and the list of requests
+type restFile struct {
+	Vars     map[string]string
+	Requests []*restRequest
+}
+
+// Find a request by name or number (starting from 1)
+func (f *restFile) Find(id string) *restRequest {
+	for i, r := range f.Requests {
+		if r.Name == id || fmt.Sprint(i+1) == id {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// parseRestFile parses a .http file
+func parseRestFile(r io.Reader) (*restFile, error) {
+	f := &restFile{Vars: map[string]string{}}
+
+	var curr *restRequest
+	var name string
+	var body []string
+	inBody := false
+
+	flush := func() {
+		if curr != nil {
+			curr.Body = strings.TrimSpace(strings.Join(body, "\n"))
+			f.Requests = append(f.Requests, curr)
+		}
+
+		curr = nil
+		name = ""
+		body = nil
+		inBody = false
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "###"): // request separator
+			flush()
+
+		case inBody:
+			body = append(body, line)
+
+		case reRestName.MatchString(trimmed):
+			name = reRestName.FindStringSubmatch(trimmed)[1]
+			if curr != nil {
+				curr.Name = name
+			}
+
+		case strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "//"): // comment
+
+		case curr == nil && reRestVar.MatchString(trimmed):
+			m := reRestVar.FindStringSubmatch(trimmed)
+			f.Vars[m[1]] = strings.TrimSpace(m[2])
+
+		case curr == nil:
+			if trimmed == "" {
+				continue
+			}
+
+			m := reRestRequest.FindStringSubmatch(trimmed)
+			if m == nil {
+				return nil, fmt.Errorf("line %v: invalid request line %q", lineno, trimmed)
+			}
+
+			method := m[1]
+			if method == "" {
+				method = "GET"
+			}
+
+			curr = &restRequest{Name: name, Method: method, URL: m[2]}
+
+		case trimmed == "": // end of headers
+			inBody = true
+
+		case strings.HasPrefix(trimmed, "?") || strings.HasPrefix(trimmed, "&"): // query continuation
+			if len(curr.Headers) > 0 {
+				return nil, fmt.Errorf("line %v: query parameters after headers", lineno)
+			}
+
+			curr.URL += trimmed
+
+		default:
+			parts := strings.SplitN(trimmed, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("line %v: invalid header %q", lineno, trimmed)
+			}
+
+			curr.Headers = append(curr.Headers, [2]string{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])})
+		}
+	}
+
+	flush()
+	return f, scanner.Err()
+}
+
+func readRestFile(filename string) (*restFile, error) {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return parseRestFile(fd)
+}
+
+// executeRestRequest sends the request, after expanding the {{variables}} with the file variables
+// and the command variables.
+// The results of named requests are also available as {{name.status}} and {{name.body}}.
+func executeRestRequest(commander *cmd.Cmd, client *httpclient.HttpClient, f *restFile, r *restRequest, print bool) {
+	var lookup func(name string) (string, bool)
+
+	depth := 0 // file variables can reference other variables
+
+	lookup = func(name string) (string, bool) {
+		if v, ok := f.Vars[name]; ok && depth < 10 {
+			depth++
+			defer func() { depth-- }()
+
+			return expandTemplateWith(v, lookup), true
+		}
+
+		if v, ok := dynamicVar(name); ok {
+			return v, true
+		}
+
+		if v := commander.GetVar(name); v != "" {
+			return v, true
+		}
+
+		return "", false
+	}
+
+	commander.SetVar("body", "")
+	commander.SetVar("status", "")
+	commander.SetVar("error", "")
+
+	options := []httpclient.RequestOption{httpclient.Method(r.Method)}
+
+	u := expandTemplateWith(r.URL, lookup)
+	if strings.Contains(u, "://") {
+		options = append(options, httpclient.URLString(u))
+	} else {
+		options = append(options, client.Path(u))
+	}
+
+	headers := map[string]string{}
+	for _, h := range r.Headers {
+		headers[h[0]] = expandTemplateWith(h[1], lookup)
+	}
+
+	options = append(options, httpclient.Header(headers))
+
+	body := expandTemplateWith(r.Body, lookup)
+	if body != "" {
+		options = append(options, httpclient.Body(strings.NewReader(body)))
+	}
+
+	if print {
+		fmt.Println(r.Method, u)
+	}
+
+	if err := oauth.Authorize(client); err != nil {
+		fmt.Println("ERROR:", err)
+		commander.SetVar("error", err)
+		return
+	}
+
+	res, err := client.SendRequest(options...)
+	history.add(res, r.Method, body)
+	rbody := processResponse(commander, res, err, print)
+
+	if r.Name != "" {
+		commander.SetVar(r.Name+".status", commander.GetVar("status"))
+		commander.SetVar(r.Name+".body", string(rbody))
+	}
+}
+
+// dynamicVar returns the value of the .http dynamic variables ($uuid, $timestamp, $randomInt)
+func dynamicVar(name string) (string, bool) {
+	switch name {
+	case "$uuid":
+		if uid, err := uuid.NewRandom(); err == nil {
+			return uid.String(), true
+		}
+
+	case "$timestamp":
+		return strconv.FormatInt(time.Now().Unix(), 10), true
+
+	case "$randomInt":
+		return strconv.Itoa(rand.Intn(1000)), true
+	}
+
+	return "", false
+}
+
+// requestHistory keeps a list of the last requests executed (with the sensitive headers redacted)
+type requestHistory struct {
+	lock     sync.Mutex
+	requests []*restRequest
+}
+
+func (h *requestHistory) add(res *httpclient.HttpResponse, method, body string) {
+	if res == nil || res.Request == nil {
+		return
+	}
+
+	r := &restRequest{Method: strings.ToUpper(method), URL: res.Request.URL.String(), Body: body}
+
+	// the credentials are not kept in the history (that can be exported or saved)
+	header := httpclient.RedactHeaders(res.Request.Header, httpclient.SensitiveHeaders...)
+
+	names := make([]string, 0, len(header))
+	for k := range header {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		for _, v := range header[k] {
+			r.Headers = append(r.Headers, [2]string{http.CanonicalHeaderKey(k), v})
+		}
+	}
+
+	h.lock.Lock()
+	h.requests = append(h.requests, r)
+	if len(h.requests) > maxHistory {
+		h.requests = h.requests[len(h.requests)-maxHistory:]
+	}
+	h.lock.Unlock()
+}
+
+// Last returns the last request executed (nil if none)
+func (h *requestHistory) Last() *restRequest {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.requests) == 0 {
+		return nil
+	}
+
+	return h.requests[len(h.requests)-1]
+}
+
+// Export writes the requests in .http format, redacting the selected fields of the JSON bodies
+// (if redactor is not nil)
+func (h *requestHistory) Export(w io.Writer, redactor *httpclient.Redactor) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i, r := range h.requests {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w, "\n###"); err != nil {
+				return err
+			}
+		}
+
+		if redactor != nil && r.Body != "" {
+			rr := *r
+			rr.Body = redactor.RedactString(r.Body)
+			r = &rr
+		}
+
+		if _, err := io.WriteString(w, r.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
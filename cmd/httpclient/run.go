@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobs/cmd"
+	"github.com/gobs/cmd/plugins/controlflow"
+	"github.com/gobs/cmd/plugins/json"
+	"github.com/gobs/cmd/plugins/stats"
+	"github.com/gobs/httpclient"
+)
+
+// parseRunArgs parses "script-file [--vus n] [--iterations n]"
+func parseRunArgs(line string) (script string, vus, iterations int, err error) {
+	vus = 1
+	iterations = 1
+
+	fields := strings.Fields(line)
+
+	for i := 0; i < len(fields); i++ {
+		switch f := fields[i]; f {
+		case "--vus", "--iterations":
+			if i+1 >= len(fields) {
+				return "", 0, 0, fmt.Errorf("missing value for %v", f)
+			}
+
+			i++
+
+			n, err := strconv.Atoi(fields[i])
+			if err != nil || n <= 0 {
+				return "", 0, 0, fmt.Errorf("invalid value for %v: %q", f, fields[i])
+			}
+
+			if f == "--vus" {
+				vus = n
+			} else {
+				iterations = n
+			}
+
+		default:
+			if strings.HasPrefix(f, "-") || script != "" {
+				return "", 0, 0, fmt.Errorf("invalid argument %q", f)
+			}
+
+			script = strings.TrimPrefix(f, "@")
+		}
+	}
+
+	if script == "" {
+		return "", 0, 0, fmt.Errorf("missing script file")
+	}
+
+	return
+}
+
+// the results of a run
+type runResult struct {
+	VUs        int
+	Iterations int
+	Failures   int
+	Errors     map[string]int
+	Elapsed    time.Duration
+	Stats      httpclient.Stats
+}
+
+func (r *runResult) Print() {
+	fmt.Printf("run: %v iterations, %v virtual users, %v failures, elapsed %v\n",
+		r.Iterations, r.VUs, r.Failures, r.Elapsed.Round(time.Millisecond))
+
+	errors := make([]string, 0, len(r.Errors))
+	for e := range r.Errors {
+		errors = append(errors, e)
+	}
+	sort.Strings(errors)
+
+	for _, e := range errors {
+		fmt.Printf("  %5d  %v\n", r.Errors[e], e)
+	}
+
+	fmt.Println("requests:", r.Stats.Requests,
+		"errors:", r.Stats.Errors,
+		"timeouts:", r.Stats.Timeouts,
+		"status:", r.Stats.Status)
+	fmt.Println("latency: min", r.Stats.MinLatency.Round(time.Millisecond),
+		"max", r.Stats.MaxLatency.Round(time.Millisecond),
+		"mean", r.Stats.MeanLatency.Round(time.Millisecond),
+		"p50", r.Stats.P50Latency.Round(time.Millisecond),
+		"p90", r.Stats.P90Latency.Round(time.Millisecond),
+		"p99", r.Stats.P99Latency.Round(time.Millisecond))
+
+	if r.Elapsed > 0 {
+		fmt.Printf("throughput: %.1f req/s\n", float64(r.Stats.Requests)/r.Elapsed.Seconds())
+	}
+}
+
+// the commands available in the scripts executed by run, that don't change the state shared by the virtual users
+// (the CLI settings, the named bases, the environments, the loaded files, the OAuth2 session, the http.Client,
+// its transport and cookie jar): with any arguments (runAny), or only with the arguments accepted by the function.
+//
+// The other commands, including the ones added later and not listed here, are disabled in the scripts
+// (the commands of the interpreter and its plugins, that only change the interpreter variables, are available).
+var runCommands = map[string]func(args []string) bool{
+	"dryrun":   runAny,
+	"timing":   runAny,
+	"summary":  runAny,
+	"agent":    runAny,
+	"header":   runAny,
+	"expect":   runAny,
+	"chain":    runAny,
+	"workflow": runAny,
+	"copy":     runAny,
+	"head":     runAny,
+	"raw":      runAny,
+	"get":      runAny,
+	"post":     runAny,
+	"postform": runAny,
+	"upload":   runAny,
+	"put":      runAny,
+	"delete":   runAny,
+	"patch":    runAny,
+	"options":  runAny,
+	"trace":    runAny,
+	"request":  runAny,
+	"dav":      runAny,
+	"foreach":  runAny,
+	"jwt":      runAny,
+	"load":     runAny,
+	"compare":  runAny,
+	"diff":     runAny,
+	"watch":    runAny,
+	"uuid":     runAny,
+
+	"auth":       runSubcommands(""),
+	"env":        runSubcommands("list"),
+	"template":   runSubcommands("list", "show", "render", "send"),
+	"proto":      runSubcommands("list", "call"),
+	"redact":     runSubcommands("", "list"),
+	"store":      runSubcommands("list", "show"),
+	"collection": runSubcommands("", "list", "show"),
+	"har":        runSubcommands("replay"),
+	"cookie":     runSubcommands("list", "export"),
+	"traces":     runSubcommands("", "--json"),
+
+	// the base URL of the virtual user client, not the named bases
+	"base": func(args []string) bool {
+		return len(args) == 0 || args[0] == "list" || strings.Contains(args[0], "://")
+	},
+
+	// a .http file, not the export of the requests
+	"http": func(args []string) bool {
+		return len(args) > 0 && (args[0] == "--list" || !strings.HasPrefix(args[0], "-"))
+	},
+
+	// the stats plugin command, or the client stats without --reset
+	"stats": func(args []string) bool {
+		return len(args) == 0 || args[0] != "--reset"
+	},
+}
+
+// runAny allows a command with any arguments
+func runAny(args []string) bool {
+	return true
+}
+
+// runSubcommands allows a command only with the specified subcommands ("" for no arguments)
+func runSubcommands(subcommands ...string) func(args []string) bool {
+	return func(args []string) bool {
+		sub := ""
+		if len(args) > 0 {
+			sub = args[0]
+		}
+
+		for _, s := range subcommands {
+			if s == sub {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+var (
+	interpreterOnce     sync.Once
+	interpreterCommands map[string]bool
+)
+
+// isInterpreterCommand returns true for the commands of the command interpreter and its plugins
+// (see newCommander), that are not overridden by the CLI
+func isInterpreterCommand(name string) bool {
+	interpreterOnce.Do(func() {
+		interpreter := &cmd.Cmd{}
+		interpreter.Init(controlflow.Plugin, json.Plugin, stats.Plugin)
+
+		interpreterCommands = map[string]bool{}
+		for n := range interpreter.Commands {
+			interpreterCommands[n] = true
+		}
+	})
+
+	_, listed := runCommands[name]
+	return interpreterCommands[name] && !listed
+}
+
+// disableSharedCommands replaces the commands of the virtual user command interpreter that are not
+// in runCommands (or only the invocations not accepted by runCommands) with a command that fails
+// (setting the "error" variable)
+func disableSharedCommands(commander *cmd.Cmd) {
+	for name, command := range commander.Commands {
+		if isInterpreterCommand(name) {
+			continue
+		}
+
+		allowed, ok := runCommands[name]
+		if !ok {
+			allowed = func(args []string) bool { return false }
+		}
+
+		call, command := command.Call, command
+
+		command.Call = func(line string) (stop bool) {
+			if allowed(strings.Fields(line)) {
+				return call(line)
+			}
+
+			err := fmt.Errorf("%q is not available in run scripts (it changes the state shared by the virtual users)",
+				strings.TrimSpace(command.Name+" "+line))
+			fmt.Println(err)
+			commander.SetVar("error", err)
+			return
+		}
+
+		commander.Commands[name] = command
+	}
+}
+
+// runScript executes the script (a command script or a .http file) with the specified number of virtual users,
+// each one with its own command interpreter (and variables) and a clone of the client
+// (with its own base URL and headers, so "base url" and "@name command" only apply to the virtual user).
+// The commands that change the shared state are disabled (see runCommands).
+//
+// An iteration fails if the "error" variable is set at the end of the script.
+func runScript(client *httpclient.HttpClient, script string, vus, iterations int) *runResult {
+	// the virtual users share the transport and the stats for this run
+	rclient := client.Clone()
+	rclient.EnableStats(false)
+	rclient.EnableStats(true)
+
+	res := &runResult{VUs: vus, Iterations: iterations, Errors: map[string]int{}}
+
+	line := "@" + script
+	if ext := strings.ToLower(filepath.Ext(script)); ext == ".http" || ext == ".rest" {
+		line = "http " + script
+	}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+
+	next := 0
+	start := time.Now()
+
+	for vu := 1; vu <= vus; vu++ {
+		wg.Add(1)
+
+		go func(vu int) {
+			defer wg.Done()
+
+			commander := newCommander(rclient.Clone())
+			disableSharedCommands(commander)
+			commander.SetVar("print", false)
+			commander.SetVar("vu", vu)
+
+			for {
+				lock.Lock()
+				iteration := next
+				next++
+				lock.Unlock()
+
+				if iteration >= iterations {
+					return
+				}
+
+				commander.SetVar("iteration", iteration)
+				commander.SetVar("error", "")
+
+				commander.OneCmd(line)
+
+				if err := commander.GetVar("error"); err != "" {
+					lock.Lock()
+					res.Failures++
+					res.Errors[err]++
+					lock.Unlock()
+				}
+			}
+		}(vu)
+	}
+
+	wg.Wait()
+
+	res.Elapsed = time.Since(start)
+	res.Stats = rclient.Stats()
+	return res
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gobs/httpclient"
+)
+
+// run with -race: the virtual users must not share any state
+func TestRunVUs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Path", r.URL.Path)
+		if r.URL.Path == "/one" {
+			w.Header().Set("X-One", "1")
+		}
+		fmt.Fprintf(w, `{"path": %q}`, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	script := filepath.Join(t.TempDir(), "test.http")
+	content := fmt.Sprintf("GET %v/one\n\n###\n\nGET %v/two\n", ts.URL, ts.URL)
+	if err := os.WriteFile(script, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res := runScript(httpclient.NewHttpClient(ts.URL), script, 2, 10)
+	if res.Failures != 0 {
+		t.Fatalf("expected no failures, got %v: %v", res.Failures, res.Errors)
+	}
+	if res.Stats.Requests != 20 {
+		t.Errorf("expected 20 requests, got %v", res.Stats.Requests)
+	}
+}
+
+func TestRunSharedCommands(t *testing.T) {
+	commander := newCommander(httpclient.NewHttpClient("http://localhost"))
+	disableSharedCommands(commander)
+
+	for _, line := range []string{"base add test http://example.com", "format table", "redact add $.password", "template load *.tmpl",
+		"cookie set name=value", "login oauth2", "stats --reset", "http --export out.http"} {
+		commander.SetVar("error", "")
+		commander.OneCmd(line)
+
+		if commander.GetVar("error") == "" {
+			t.Errorf("%q: expected the command to be disabled", line)
+		}
+	}
+
+	if bases.Get("test") != nil {
+		t.Error("unexpected named base")
+	}
+	if format.Name != "json" {
+		t.Error("unexpected format", format.Name)
+	}
+
+	commander.SetVar("error", "")
+	commander.OneCmd("base list")
+
+	if err := commander.GetVar("error"); err != "" {
+		t.Error("unexpected error", err)
+	}
+}
+
+// all the commands (except the interpreter ones) must be listed in runCommands, or be disabled
+func TestRunCommands(t *testing.T) {
+	commander := newCommander(httpclient.NewHttpClient("http://localhost"))
+
+	for name := range runCommands {
+		if _, ok := commander.Commands[name]; !ok {
+			t.Errorf("%q is not a command", name)
+		}
+	}
+
+	disableSharedCommands(commander)
+
+	for name := range commander.Commands {
+		if _, ok := runCommands[name]; ok || isInterpreterCommand(name) {
+			continue
+		}
+
+		commander.SetVar("error", "")
+		commander.OneCmd(name + " --disabled")
+
+		if !strings.Contains(commander.GetVar("error"), "is not available in run scripts") {
+			t.Errorf("%q: expected the command to be disabled", name)
+		}
+	}
+}
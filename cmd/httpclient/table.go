@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// max width of a table cell
+const maxCellWidth = 40
+
+// output format options (see the "format" command)
+type outputFormat struct {
+	Name     string   // json (default) or table
+	Columns  []string // table columns (default: all the fields)
+	PageSize int      // rows per page (0: no paging)
+}
+
+var format = outputFormat{Name: "json", PageSize: 20}
+
+// tableRows returns the list of rows for a JSON array, or for an object with a single array field
+// (i.e. {"items": [...], "total": 10})
+func tableRows(v interface{}) ([]interface{}, bool) {
+	switch vv := v.(type) {
+	case []interface{}:
+		return vv, true
+
+	case map[string]interface{}:
+		var rows []interface{}
+
+		for _, f := range vv {
+			if arr, ok := f.([]interface{}); ok {
+				if rows != nil {
+					return nil, false // more than one array
+				}
+
+				rows = arr
+			}
+		}
+
+		return rows, rows != nil
+	}
+
+	return nil, false
+}
+
+// tableColumns returns the sorted list of fields in the rows ("id" and "name" first)
+func tableColumns(rows []interface{}) []string {
+	seen := map[string]bool{}
+
+	for _, r := range rows {
+		if obj, ok := r.(map[string]interface{}); ok {
+			for k := range obj {
+				seen[k] = true
+			}
+		}
+	}
+
+	if len(seen) == 0 {
+		return []string{"value"}
+	}
+
+	rank := func(k string) int {
+		switch strings.ToLower(k) {
+		case "id":
+			return 0
+		case "name":
+			return 1
+		}
+
+		return 2
+	}
+
+	columns := make([]string, 0, len(seen))
+	for k := range seen {
+		columns = append(columns, k)
+	}
+
+	sort.Slice(columns, func(i, j int) bool {
+		if ri, rj := rank(columns[i]), rank(columns[j]); ri != rj {
+			return ri < rj
+		}
+
+		return columns[i] < columns[j]
+	})
+
+	return columns
+}
+
+// tableCell returns the value of the column (a field name or path) as a string
+func tableCell(row interface{}, column string) string {
+	var v interface{}
+
+	if obj, ok := row.(map[string]interface{}); ok {
+		if fv, ok := obj[column]; ok {
+			v = fv
+		} else if pv, ok := jsonPath(obj, column); ok {
+			v = pv
+		} else {
+			return ""
+		}
+	} else if column == "value" {
+		v = row
+	}
+
+	var s string
+
+	switch vv := v.(type) {
+	case nil:
+		s = ""
+	case string:
+		s = vv
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(vv)
+		s = string(b)
+	default:
+		s = fmt.Sprint(vv)
+	}
+
+	s = strings.Join(strings.Fields(s), " ") // no tabs or newlines
+
+	if r := []rune(s); len(r) > maxCellWidth {
+		s = string(r[:maxCellWidth-1]) + "…"
+	}
+
+	return s
+}
+
+// printTable prints the rows as an aligned table, pausing after each page if the output is a terminal
+func printTable(w io.Writer, rows []interface{}, columns []string, pageSize int) {
+	if len(columns) == 0 {
+		columns = tableColumns(rows)
+	}
+
+	interactive := false
+	if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		interactive = true
+	}
+
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = strings.ToUpper(c) // no colors: escape sequences break the alignment
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for i, r := range rows {
+		cells := make([]string, len(columns))
+		for j, c := range columns {
+			cells[j] = tableCell(r, c)
+		}
+
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+
+		if interactive && pageSize > 0 && (i+1)%pageSize == 0 && i+1 < len(rows) {
+			tw.Flush()
+
+			fmt.Fprintf(w, "-- %v/%v rows, Enter for more, q to quit -- ", i+1, len(rows))
+			answer, _ := stdinReader.ReadString('\n')
+			if strings.HasPrefix(strings.TrimSpace(answer), "q") {
+				return
+			}
+		}
+	}
+
+	tw.Flush()
+	fmt.Fprintf(w, "(%v rows)\n", len(rows))
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gobs/cmd"
+	"github.com/gobs/httpclient"
+)
+
+// namedBases contains the base URLs defined with "base add name url"
+type namedBases struct {
+	lock  sync.Mutex
+	bases map[string]*url.URL
+}
+
+var bases = &namedBases{}
+
+func (b *namedBases) Add(name string, u *url.URL) {
+	b.lock.Lock()
+	if b.bases == nil {
+		b.bases = map[string]*url.URL{}
+	}
+	b.bases[name] = u
+	b.lock.Unlock()
+}
+
+func (b *namedBases) Remove(name string) {
+	b.lock.Lock()
+	delete(b.bases, name)
+	b.lock.Unlock()
+}
+
+func (b *namedBases) Get(name string) *url.URL {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.bases[name]
+}
+
+// Names returns the sorted list of names
+func (b *namedBases) Names() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	names := make([]string, 0, len(b.bases))
+	for name := range b.bases {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// runWithBase executes the command with the client base URL temporarily set to base
+func runWithBase(commander *cmd.Cmd, client *httpclient.HttpClient, base *url.URL, line string) bool {
+	prev := client.BaseURL
+	client.BaseURL = base
+	defer func() { client.BaseURL = prev }()
+
+	return commander.OneCmd(line)
+}
+
+// a request result, for compare
+type targetResult struct {
+	Name   string
+	Status string
+	Error  string
+	Body   string
+}
+
+// compareTargets executes the command against each named base and prints the differences
+// between the first result and the others. It returns true if all results are equal.
+func compareTargets(commander *cmd.Cmd, client *httpclient.HttpClient, names []string, line string) bool {
+	var results []targetResult
+
+	print := commander.GetVar("print")
+	commander.SetVar("print", false)
+	defer commander.SetVar("print", print)
+
+	for _, name := range names {
+		base := bases.Get(name)
+		if base == nil {
+			fmt.Println("unknown base", name)
+			return false
+		}
+
+		runWithBase(commander, client, base, line)
+
+		results = append(results, targetResult{
+			Name:   name,
+			Status: commander.GetVar("status"),
+			Error:  commander.GetVar("error"),
+			Body:   normalizeBody(commander.GetVar("body")),
+		})
+	}
+
+	equal := true
+	first := results[0]
+
+	for _, r := range results[1:] {
+		fmt.Printf("--- @%v\n+++ @%v\n", first.Name, r.Name)
+
+		same := true
+
+		if first.Status != r.Status {
+			fmt.Printf("- status: %v\n+ status: %v\n", first.Status, r.Status)
+			same = false
+		}
+
+		if first.Error != r.Error {
+			fmt.Printf("- error: %v\n+ error: %v\n", first.Error, r.Error)
+			same = false
+		}
+
+		if first.Body != r.Body {
+			for _, d := range lineDiff(strings.Split(first.Body, "\n"), strings.Split(r.Body, "\n")) {
+				fmt.Println(d)
+			}
+
+			same = false
+		}
+
+		if same {
+			fmt.Println("  (no differences)")
+		}
+
+		equal = equal && same
+	}
+
+	return equal
+}
+
+// normalizeBody returns JSON bodies indented and with sorted keys, so that they can be compared
+func normalizeBody(body string) string {
+	var v interface{}
+
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		return body
+	}
+
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return body
+	}
+
+	return string(b)
+}
+
+// lineDiff returns the differences between a and b, as a list of lines prefixed with
+// "  " (common), "- " (only in a) or "+ " (only in b)
+func lineDiff(a, b []string) []string {
+	// longest common subsequence table
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, "- "+a[i])
+			i++
+		default:
+			diff = append(diff, "+ "+b[j])
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		diff = append(diff, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, "+ "+b[j])
+	}
+
+	return diff
+}
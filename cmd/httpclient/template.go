@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/gobs/args"
+	"github.com/gobs/cmd"
+	"github.com/gobs/httpclient"
+)
+
+const templateUsage = "usage: template load file.tmpl ... | template list | template show name | template render name [field=value ...] | template send method url-path name [field=value ...]"
+
+// a request body template (see the "template" command)
+type requestTemplate struct {
+	text  string
+	ctype string // from the file extension before .tmpl (i.e. body.json.tmpl)
+}
+
+// the loaded templates (shared by the command interpreters of run)
+type requestTemplates struct {
+	lock      sync.Mutex
+	templates map[string]requestTemplate
+}
+
+var templates = &requestTemplates{}
+
+func (t *requestTemplates) Add(name string, rt requestTemplate) {
+	t.lock.Lock()
+	if t.templates == nil {
+		t.templates = map[string]requestTemplate{}
+	}
+	t.templates[name] = rt
+	t.lock.Unlock()
+}
+
+func (t *requestTemplates) Get(name string) (requestTemplate, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	rt, ok := t.templates[name]
+	return rt, ok
+}
+
+// Names returns the sorted list of names
+func (t *requestTemplates) Names() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	names := make([]string, 0, len(t.templates))
+	for name := range t.templates {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// renderTemplate renders the template with data, and the command variables available as {{var "name"}}
+func renderTemplate(commander *cmd.Cmd, tmpl string, data interface{}) ([]byte, error) {
+	return httpclient.RenderTemplateFuncs(tmpl, data, template.FuncMap{"var": commander.GetVar})
+}
+
+// templateCommand loads request body templates and sends requests with the rendered bodies
+func templateCommand(commander *cmd.Cmd, client *httpclient.HttpClient, line string) {
+	parts := args.GetArgs(line)
+	if len(parts) == 0 {
+		parts = []string{"list"}
+	}
+
+	fail := func(err error) {
+		fmt.Println(err)
+		commander.SetVar("error", err)
+	}
+
+	commander.SetVar("error", "")
+
+	switch {
+	case parts[0] == "load" && len(parts) >= 2:
+		for _, pattern := range parts[1:] {
+			files, err := filepath.Glob(pattern)
+			if err == nil && len(files) == 0 {
+				err = fmt.Errorf("no files matching %q", pattern)
+			}
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			for _, f := range files {
+				b, err := os.ReadFile(f)
+				if err != nil {
+					fail(err)
+					return
+				}
+
+				name := strings.TrimSuffix(filepath.Base(f), ".tmpl")
+				ext := filepath.Ext(name)
+				name = strings.TrimSuffix(name, ext)
+
+				templates.Add(name, requestTemplate{text: string(b), ctype: mime.TypeByExtension(ext)})
+			}
+		}
+
+	case parts[0] == "list" && len(parts) == 1:
+		names := templates.Names()
+		if len(names) == 0 {
+			fmt.Println("no templates")
+			return
+		}
+
+		for _, name := range names {
+			t, _ := templates.Get(name)
+			fmt.Printf("  %-20v %v\n", name, t.ctype)
+		}
+
+	case parts[0] == "show" && len(parts) == 2:
+		t, ok := templates.Get(parts[1])
+		if !ok {
+			fail(fmt.Errorf("unknown template %q", parts[1]))
+			return
+		}
+
+		fmt.Println(t.text)
+
+	case parts[0] == "render" && len(parts) >= 2:
+		t, data, err := templateData(parts[1], parts[2:])
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		b, err := renderTemplate(commander, t.text, data)
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		fmt.Println(string(b))
+
+	case parts[0] == "send" && len(parts) >= 4:
+		t, data, err := templateData(parts[3], parts[4:])
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		path, err := renderTemplate(commander, parts[2], data)
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		body, err := renderTemplate(commander, t.text, data)
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		options := []httpclient.RequestOption{
+			httpclient.Method(parts[1]),
+			httpclient.Path(strings.TrimSpace(string(path))),
+			httpclient.Body(bytes.NewReader(body)),
+		}
+
+		if t.ctype != "" {
+			options = append(options, httpclient.ContentType(t.ctype))
+		}
+
+		res, err := client.SendRequest(options...)
+		history.add(res, strings.ToLower(parts[1]), "")
+		processResponse(commander, res, err, commander.GetBoolVar("print"))
+
+	default:
+		fmt.Println(templateUsage)
+	}
+}
+
+// templateData returns the template and the data from the field=value arguments
+// (the values are parsed as in the "set" command, @filename reads the value from a file)
+func templateData(name string, fields []string) (requestTemplate, map[string]interface{}, error) {
+	t, ok := templates.Get(name)
+	if !ok {
+		return t, nil, fmt.Errorf("unknown template %q", name)
+	}
+
+	values, err := formFields(fields)
+	if err != nil {
+		return t, nil, err
+	}
+
+	data := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if data[k], err = parseValue(v); err != nil {
+			return t, nil, err
+		}
+	}
+
+	return t, data, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobs/cmd"
+	"github.com/gobs/httpclient"
+)
+
+// setHeaderVars sets a header.Name variable (with the canonical header name) for each response header,
+// with the values joined by ", ", and clears the ones of the previous response that are not set.
+// The previous response headers are read from the "headers" variable, so it must be called before updating it
+// (the state is kept in the command interpreter, since each virtual user of run has its own).
+func setHeaderVars(cmd *cmd.Cmd, h http.Header) {
+	var prev http.Header
+	if v := cmd.GetVar("headers"); v != "" {
+		json.Unmarshal([]byte(v), &prev)
+	}
+
+	for k, v := range h {
+		cmd.SetVar("header."+k, strings.Join(v, ", "))
+	}
+
+	for k := range prev {
+		if _, ok := h[k]; !ok {
+			cmd.SetVar("header."+k, "")
+		}
+	}
+}
+
+// setTraceVars sets the trace.* variables from the request trace: the phase durations
+// (and the total, with the response body) in milliseconds, the connection addresses and reuse
+func setTraceVars(cmd *cmd.Cmd, rt *httpclient.RequestTrace, elapsed time.Duration) {
+	ms := func(d time.Duration) string {
+		return strconv.FormatFloat(float64(d.Microseconds())/1000, 'f', -1, 64)
+	}
+
+	cmd.SetVar("trace.DNS", ms(rt.DNS))
+	cmd.SetVar("trace.Connect", ms(rt.Connect))
+	cmd.SetVar("trace.TLSHandshake", ms(rt.TLSHandshake))
+	cmd.SetVar("trace.Request", ms(rt.Request))
+	cmd.SetVar("trace.Wait", ms(rt.Wait))
+	cmd.SetVar("trace.Response", ms(rt.Response))
+	cmd.SetVar("trace.TTFB", ms(rt.DNS+rt.Connect+rt.TLSHandshake+rt.Request+rt.Wait))
+	cmd.SetVar("trace.Total", ms(elapsed))
+	cmd.SetVar("trace.Reused", rt.Reused)
+	cmd.SetVar("trace.Local", rt.Local)
+	cmd.SetVar("trace.Remote", rt.Remote)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobs/cmd"
+)
+
+// a status change, for the watch history
+type watchChange struct {
+	Time   time.Time
+	Status string
+}
+
+// parseWatchArgs parses "[-n interval] [--count=n] command...", where the interval is in seconds
+// or a duration (i.e. 500ms)
+func parseWatchArgs(line string) (interval time.Duration, count int, command string, err error) {
+	interval = 2 * time.Second
+	line = strings.TrimSpace(line)
+
+	for strings.HasPrefix(line, "-") {
+		parts := strings.SplitN(line, " ", 2)
+		opt, rest := parts[0], ""
+		if len(parts) == 2 {
+			rest = strings.TrimSpace(parts[1])
+		}
+
+		switch {
+		case opt == "-n":
+			parts = strings.SplitN(rest, " ", 2)
+			if interval, err = parseInterval(parts[0]); err != nil {
+				return
+			}
+
+			rest = ""
+			if len(parts) == 2 {
+				rest = strings.TrimSpace(parts[1])
+			}
+
+		case strings.HasPrefix(opt, "--interval="):
+			if interval, err = parseInterval(strings.TrimPrefix(opt, "--interval=")); err != nil {
+				return
+			}
+
+		case strings.HasPrefix(opt, "--count="):
+			if count, err = strconv.Atoi(strings.TrimPrefix(opt, "--count=")); err != nil || count < 0 {
+				err = fmt.Errorf("invalid count %q", opt)
+				return
+			}
+
+		default:
+			err = fmt.Errorf("invalid option %q", opt)
+			return
+		}
+
+		line = rest
+	}
+
+	if line == "" {
+		err = fmt.Errorf("missing command")
+	}
+
+	return interval, count, line, err
+}
+
+func parseInterval(s string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(s, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, nil
+	}
+
+	return 0, fmt.Errorf("invalid interval %q", s)
+}
+
+// watchCommand repeats the command every interval, until interrupted (or for count times),
+// printing the full response the first time and then only the differences with the previous one.
+// The status changes are printed when they happen and as a history at the end.
+func watchCommand(commander *cmd.Cmd, line string) {
+	interval, count, command, err := parseWatchArgs(line)
+	if err != nil {
+		fmt.Println(err)
+		fmt.Println("usage: watch [-n interval] [--count=n] command...")
+		return
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	print := commander.GetVar("print")
+	defer commander.SetVar("print", print)
+
+	var prev *diffResponse
+	var history []watchChange
+
+loop:
+	for n := 1; count == 0 || n <= count; n++ {
+		if n > 1 {
+			select {
+			case <-interrupt:
+				break loop
+			case <-time.After(interval):
+			}
+		}
+
+		now := time.Now()
+		before := recentResponses.Count()
+
+		commander.SetVar("error", "")
+		if commander.OneCmd(command) {
+			break
+		}
+
+		var cur *diffResponse
+		status := ""
+
+		if recentResponses.Count() != before {
+			cur = recentResponses.Last()
+			status = cur.Status
+		} else {
+			status = "error: " + commander.GetVar("error")
+		}
+
+		if len(history) == 0 || history[len(history)-1].Status != status {
+			if len(history) > 0 {
+				fmt.Printf("%v status changed: %v -> %v\n", now.Format("15:04:05"),
+					watchStatus(history[len(history)-1].Status), watchStatus(status))
+			}
+
+			history = append(history, watchChange{Time: now, Status: status})
+		}
+
+		if n > 1 {
+			fmt.Printf("--- %v #%v %v\n", now.Format("15:04:05"), n, watchStatus(status))
+
+			if prev != nil && cur != nil {
+				printDiff(diffResponses(prev, cur, defaultDiffIgnore))
+			}
+		}
+
+		if cur != nil {
+			prev = cur
+		}
+
+		// only print the full response the first time
+		commander.SetVar("print", false)
+	}
+
+	fmt.Println("status history:")
+	for _, c := range history {
+		fmt.Printf("  %v %v\n", c.Time.Format("15:04:05"), watchStatus(c.Status))
+	}
+}
+
+// the status colored according to the status code
+func watchStatus(status string) string {
+	code, _ := strconv.Atoi(strings.SplitN(status, " ", 2)[0])
+	if code == 0 {
+		code = 500 // error
+	}
+
+	return theme.Status(status, code)
+}
@@ -0,0 +1,498 @@
+package main
+
+// Workflows: declarative multi-step scenarios, in YAML (or JSON).
+//
+//	name: items
+//	vars:
+//	  user: me
+//	setup:
+//	  - request: post /login {"user": "{{user}}"}
+//	    extract:
+//	      token: body.token
+//	    assert:
+//	      - status == 200
+//	  - command: header Authorization "Bearer {{token}}"
+//	steps:
+//	  - name: create
+//	    request: post /items {"name": "test"}
+//	    timeout: 5s
+//	    extract:
+//	      id: body.id
+//	    assert:
+//	      - status == 201
+//	  - name: wait until ready
+//	    request: get /items/{{id}}
+//	    loop:
+//	      until: body.status == ready
+//	      count: 10
+//	      interval: 1s
+//	  - name: tags
+//	    request: put /items/{{id}}/tags/{{tag}}
+//	    loop:
+//	      over: [red, green]
+//	      var: tag
+//	    on_failure: continue
+//	  - wait: 2s
+//	teardown:
+//	  - request: delete /items/{{id}}
+//
+// A step executes (in order) wait, command, request, extract and assert. Requests and commands use
+// the command line syntax and the values are expanded with the {{variables}}.
+//
+// Loops repeat a step count times (the index is in the variable "index", or var), for each value in over
+// (the value is in the variable "item", or var) or until the condition is true (at most count times, default 10).
+//
+// If a step fails, on_failure decides what to do: stop (the default) skips the following steps,
+// continue executes the next step and retry repeats the step (retries times, default 3, waiting retry_interval).
+// If a setup step fails the steps are skipped. The teardown steps are always executed.
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobs/cmd"
+	"github.com/gobs/httpclient"
+	"gopkg.in/yaml.v3"
+)
+
+// a workflow definition
+type workflow struct {
+	Name     string            `json:"name" yaml:"name"`
+	Vars     map[string]string `json:"vars,omitempty" yaml:"vars,omitempty"`
+	Setup    []*workflowStep   `json:"setup,omitempty" yaml:"setup,omitempty"`
+	Steps    []*workflowStep   `json:"steps" yaml:"steps"`
+	Teardown []*workflowStep   `json:"teardown,omitempty" yaml:"teardown,omitempty"`
+}
+
+// a workflow step
+type workflowStep struct {
+	Name    string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Wait    string            `json:"wait,omitempty" yaml:"wait,omitempty"`       // wait before executing the step
+	Command string            `json:"command,omitempty" yaml:"command,omitempty"` // any command
+	Request string            `json:"request,omitempty" yaml:"request,omitempty"` // method path [body]
+	Timeout string            `json:"timeout,omitempty" yaml:"timeout,omitempty"` // the request timeout
+	Extract map[string]string `json:"extract,omitempty" yaml:"extract,omitempty"` // variable: expression (as --capture)
+	Assert  []string          `json:"assert,omitempty" yaml:"assert,omitempty"`   // assertions (as expect)
+	Loop    *workflowLoop     `json:"loop,omitempty" yaml:"loop,omitempty"`
+
+	OnFailure     string `json:"on_failure,omitempty" yaml:"on_failure,omitempty"` // stop, continue or retry
+	Retries       int    `json:"retries,omitempty" yaml:"retries,omitempty"`
+	RetryInterval string `json:"retry_interval,omitempty" yaml:"retry_interval,omitempty"`
+
+	wait, timeout, retryInterval time.Duration
+}
+
+// a step loop
+type workflowLoop struct {
+	Count    int      `json:"count,omitempty" yaml:"count,omitempty"`
+	Over     []string `json:"over,omitempty" yaml:"over,omitempty"`
+	Until    string   `json:"until,omitempty" yaml:"until,omitempty"`
+	Var      string   `json:"var,omitempty" yaml:"var,omitempty"`
+	Interval string   `json:"interval,omitempty" yaml:"interval,omitempty"`
+
+	interval time.Duration
+}
+
+// readWorkflow reads and validates a workflow file
+func readWorkflow(filename string) (*workflow, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var w workflow
+	if err := yaml.Unmarshal(b, &w); err != nil {
+		return nil, fmt.Errorf("%v: %w", filename, err)
+	}
+
+	if err := w.validate(); err != nil {
+		return nil, fmt.Errorf("%v: %w", filename, err)
+	}
+
+	return &w, nil
+}
+
+// validate checks the steps and parses the durations
+func (w *workflow) validate() error {
+	if len(w.Steps) == 0 {
+		return fmt.Errorf("no steps")
+	}
+
+	duration := func(step, field, v string) (time.Duration, error) {
+		if v == "" {
+			return 0, nil
+		}
+
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("step %v: invalid %v %q", step, field, v)
+		}
+
+		return d, nil
+	}
+
+	for phase, steps := range map[string][]*workflowStep{"setup": w.Setup, "steps": w.Steps, "teardown": w.Teardown} {
+		for i, s := range steps {
+			if s == nil {
+				return fmt.Errorf("%v: empty step %v", phase, i+1)
+			}
+
+			if s.Name == "" {
+				s.Name = fmt.Sprintf("%v.%v", phase, i+1)
+			}
+
+			if s.Request == "" && s.Command == "" && s.Wait == "" {
+				return fmt.Errorf("step %v: expected request, command or wait", s.Name)
+			}
+
+			var err error
+
+			if s.wait, err = duration(s.Name, "wait", s.Wait); err != nil {
+				return err
+			}
+			if s.timeout, err = duration(s.Name, "timeout", s.Timeout); err != nil {
+				return err
+			}
+			if s.retryInterval, err = duration(s.Name, "retry_interval", s.RetryInterval); err != nil {
+				return err
+			}
+
+			switch s.OnFailure {
+			case "", "stop", "continue":
+			case "retry":
+				if s.Retries <= 0 {
+					s.Retries = 3
+				}
+				if s.retryInterval == 0 {
+					s.retryInterval = time.Second
+				}
+			default:
+				return fmt.Errorf("step %v: invalid on_failure %q (expected stop, continue or retry)", s.Name, s.OnFailure)
+			}
+
+			for _, a := range s.Assert {
+				if _, _, err := parseWorkflowCondition(a); err != nil {
+					return fmt.Errorf("step %v: %w", s.Name, err)
+				}
+			}
+
+			if l := s.Loop; l != nil {
+				if l.Count < 0 || (l.Count == 0 && len(l.Over) == 0 && l.Until == "") {
+					return fmt.Errorf("step %v: expected loop count, over or until", s.Name)
+				}
+
+				if l.Until != "" {
+					if _, _, err := parseWorkflowCondition(l.Until); err != nil {
+						return fmt.Errorf("step %v: %w", s.Name, err)
+					}
+				}
+
+				if l.interval, err = duration(s.Name, "loop interval", l.Interval); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseWorkflowCondition checks an assertion (see checkExpect)
+func parseWorkflowCondition(s string) (string, string, error) {
+	if _, _, err := parseExpectTime(s); err == nil {
+		return "time", s, nil
+	}
+
+	if m := reExpect.FindStringSubmatch(s); m != nil {
+		return m[1], s, nil
+	}
+
+	return "", "", fmt.Errorf("invalid assertion %q", s)
+}
+
+// workflowRunner executes the workflow steps
+type workflowRunner struct {
+	commander *cmd.Cmd
+	client    *httpclient.HttpClient
+	failed    []string // the failed steps
+}
+
+func (r *workflowRunner) expand(s string) string {
+	return expandTemplateWith(s, func(name string) (string, bool) {
+		if v, ok := dynamicVar(name); ok {
+			return v, true
+		}
+
+		if v := r.commander.GetVar(name); v != "" {
+			return v, true
+		}
+
+		return "", false
+	})
+}
+
+// run executes setup, steps and teardown and returns true if all the steps succeeded
+func (r *workflowRunner) run(w *workflow) bool {
+	names := make([]string, 0, len(w.Vars))
+	for k := range w.Vars {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+	for _, k := range names {
+		r.commander.SetVar(k, r.expand(w.Vars[k]))
+	}
+
+	if r.runSteps(w.Setup) {
+		r.runSteps(w.Steps)
+	} else {
+		fmt.Println("setup failed: skipping the steps")
+	}
+
+	err := r.commander.GetVar("error")
+	r.runSteps(w.Teardown)
+	r.commander.SetVar("error", err) // keep the original error
+
+	return len(r.failed) == 0
+}
+
+// runSteps executes the steps, according to their failure policy. It returns false if a step stopped the execution.
+func (r *workflowRunner) runSteps(steps []*workflowStep) bool {
+	for _, step := range steps {
+		fmt.Println("step", step.Name)
+
+		if r.runStep(step) {
+			continue
+		}
+
+		r.failed = append(r.failed, step.Name)
+
+		if step.OnFailure != "continue" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// runStep executes the step (with retries)
+func (r *workflowRunner) runStep(step *workflowStep) bool {
+	for attempt := 0; ; attempt++ {
+		if r.runLoop(step) {
+			return true
+		}
+
+		if step.OnFailure != "retry" || attempt >= step.Retries {
+			return false
+		}
+
+		fmt.Printf("step %v: retry %v of %v\n", step.Name, attempt+1, step.Retries)
+		time.Sleep(step.retryInterval)
+	}
+}
+
+// runLoop executes the step once, or according to the loop definition
+func (r *workflowRunner) runLoop(step *workflowStep) bool {
+	l := step.Loop
+
+	switch {
+	case l == nil:
+		return r.runOnce(step)
+
+	case len(l.Over) > 0:
+		name := l.Var
+		if name == "" {
+			name = "item"
+		}
+
+		for i, v := range l.Over {
+			if i > 0 {
+				time.Sleep(l.interval)
+			}
+
+			r.commander.SetVar(name, r.expand(v))
+			if !r.runOnce(step) {
+				return false
+			}
+		}
+
+		return true
+
+	case l.Until != "":
+		count := l.Count
+		if count == 0 {
+			count = 10
+		}
+
+		for i := 0; i < count; i++ {
+			if i > 0 {
+				time.Sleep(l.interval)
+			}
+
+			r.setIndex(l, i)
+			if !r.runOnce(step) {
+				return false
+			}
+
+			if ok, _ := r.condition(l.Until); ok {
+				return true
+			}
+		}
+
+		fail(r.commander, fmt.Sprintf("step %v: %q not satisfied after %v iterations", step.Name, l.Until, count))
+		return false
+
+	default:
+		for i := 0; i < l.Count; i++ {
+			if i > 0 {
+				time.Sleep(l.interval)
+			}
+
+			r.setIndex(l, i)
+			if !r.runOnce(step) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+func (r *workflowRunner) setIndex(l *workflowLoop, i int) {
+	name := l.Var
+	if name == "" {
+		name = "index"
+	}
+
+	r.commander.SetVar(name, i)
+}
+
+// condition evaluates an assertion without reporting a failure
+func (r *workflowRunner) condition(s string) (bool, error) {
+	s = r.expand(s)
+
+	if op, limit, err := parseExpectTime(s); err == nil {
+		elapsed, err := time.ParseDuration(r.commander.GetVar("elapsed"))
+		if err != nil {
+			return false, err
+		}
+
+		return compareTime(elapsed, op, limit), nil
+	}
+
+	m := reExpect.FindStringSubmatch(s)
+	if m == nil {
+		return false, fmt.Errorf("invalid assertion %q", s)
+	}
+
+	name, op, expected := m[1], strings.TrimSpace(m[2]), unquote(strings.TrimSpace(m[3]))
+
+	value, ok := responseValue(r.commander, name)
+	if !ok && op != "!=" {
+		return false, nil
+	}
+
+	return compareValues(value, op, expected)
+}
+
+// runOnce executes the step actions: wait, command, request, extract and assert
+func (r *workflowRunner) runOnce(step *workflowStep) bool {
+	r.commander.SetVar("error", "")
+
+	if step.wait > 0 {
+		time.Sleep(step.wait)
+	}
+
+	exec := func(line string) bool {
+		if r.commander.OneCmd(r.expand(line)) {
+			return false
+		}
+
+		if err := r.commander.GetVar("error"); err != "" {
+			fmt.Printf("step %v failed: %v\n", step.Name, err)
+			return false
+		}
+
+		return true
+	}
+
+	if step.Command != "" && !exec(step.Command) {
+		return false
+	}
+
+	if step.Request != "" {
+		if step.timeout > 0 {
+			timeout := r.client.GetTimeout()
+			r.client.SetTimeout(step.timeout)
+			defer r.client.SetTimeout(timeout)
+		}
+
+		if !exec(step.Request) {
+			return false
+		}
+	}
+
+	names := make([]string, 0, len(step.Extract))
+	for k := range step.Extract {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		expr := r.expand(step.Extract[name])
+
+		v, ok := responseValue(r.commander, expr)
+		if !ok {
+			fail(r.commander, fmt.Sprintf("step %v: cannot extract %v", step.Name, expr))
+			return false
+		}
+
+		r.commander.SetVar(name, v)
+	}
+
+	for _, a := range step.Assert {
+		if !checkExpect(r.commander, r.expand(a)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// workflowCommand implements "workflow run file.yaml" and "workflow check file.yaml"
+func workflowCommand(commander *cmd.Cmd, client *httpclient.HttpClient, line string) {
+	parts := strings.Fields(line)
+	if len(parts) != 2 || (parts[0] != "run" && parts[0] != "check") {
+		fmt.Println("usage: workflow run|check file.yaml")
+		return
+	}
+
+	w, err := readWorkflow(parts[1])
+	if err != nil {
+		fmt.Println(err)
+		commander.SetVar("error", err)
+		return
+	}
+
+	if parts[0] == "check" {
+		fmt.Printf("workflow %v: %v setup, %v steps, %v teardown\n",
+			strconv.Quote(w.Name), len(w.Setup), len(w.Steps), len(w.Teardown))
+		return
+	}
+
+	start := time.Now()
+
+	r := &workflowRunner{commander: commander, client: client}
+	if r.run(w) {
+		fmt.Println("workflow completed in", time.Since(start).Round(time.Millisecond))
+	} else {
+		fmt.Println("workflow failed:", strings.Join(r.failed, ", "))
+		if commander.GetVar("error") == "" {
+			commander.SetVar("error", "workflow failed")
+		}
+	}
+}
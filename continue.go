@@ -0,0 +1,119 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+type expectContinueKey struct{}
+
+// send the request with Expect: 100-continue: the body is only sent after the server accepts the request
+// with a 100 Continue response or, if the server doesn't respond, after the timeout (0: wait for the response).
+// This avoids sending a large body that the server would reject (i.e. with 401 Unauthorized or 413 Content Too Large).
+//
+// Note that the transport ExpectContinueTimeout (1 second for the DefaultTransport) also applies, if longer.
+func ExpectContinue(timeout time.Duration) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		req.Header.Set("Expect", "100-continue")
+		return req.WithContext(context.WithValue(req.Context(), expectContinueKey{}, timeout)), nil
+	}
+}
+
+// set the request trailers (a value can be empty, to declare the trailer). The request body is sent
+// with chunked encoding, since the trailers are not sent with a fixed content length (HTTP/1.1).
+func Trailer(headers map[string]string) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		if req.Trailer == nil {
+			req.Trailer = http.Header{}
+		}
+
+		for k, v := range headers {
+			req.Trailer.Set(k, v)
+		}
+
+		return req, nil
+	}
+}
+
+// a request body that is not read until the server sends 100 Continue, the timeout expires
+// (after the request headers are written) or the body is closed (i.e. the server sent the final response)
+type continueBody struct {
+	io.ReadCloser
+
+	ctx     context.Context
+	timeout time.Duration
+	ready   chan struct{}
+	once    sync.Once
+
+	lock  sync.Mutex
+	timer *time.Timer
+}
+
+func (b *continueBody) open() {
+	b.once.Do(func() {
+		close(b.ready)
+	})
+}
+
+func (b *continueBody) wroteHeaders() {
+	if b.timeout <= 0 {
+		return
+	}
+
+	b.lock.Lock()
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.timeout, b.open)
+	}
+	b.lock.Unlock()
+}
+
+func (b *continueBody) Read(p []byte) (int, error) {
+	select {
+	case <-b.ready:
+	case <-b.ctx.Done():
+		return 0, b.ctx.Err()
+	}
+
+	return b.ReadCloser.Read(p)
+}
+
+func (b *continueBody) Close() error {
+	b.lock.Lock()
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.lock.Unlock()
+
+	b.open()
+	return b.ReadCloser.Close()
+}
+
+// prepare the request body for Expect: 100-continue (see ExpectContinue) and trailers (see Trailer)
+func prepareBody(req *http.Request) *http.Request {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req
+	}
+
+	if len(req.Trailer) > 0 && req.ContentLength > 0 { // chunked
+		req.ContentLength = -1
+	}
+
+	timeout, ok := req.Context().Value(expectContinueKey{}).(time.Duration)
+	if !ok || req.Header.Get("Expect") != "100-continue" {
+		return req
+	}
+
+	b := &continueBody{ReadCloser: req.Body, ctx: req.Context(), timeout: timeout, ready: make(chan struct{})}
+
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		WroteHeaders:   b.wroteHeaders,
+		Got100Continue: b.open,
+	}))
+
+	req.Body = b
+	return req
+}
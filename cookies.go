@@ -0,0 +1,266 @@
+package httpclient
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The client cookies (HttpClient.Cookies) are only sent to the matching hosts:
+//
+//   - Domain "example.com": only example.com
+//   - Domain ".example.com": example.com and all its subdomains
+//   - no Domain: the hosts in the client scope (see SetHeaderScope)
+//
+// Cookies with a Path are only sent for matching paths, Secure cookies only via https
+// and expired cookies are not sent.
+
+// AddCookie adds a cookie to the client cookies, replacing a cookie with the same name, domain and path.
+// A cookie with MaxAge < 0 removes the existing cookie.
+func (self *HttpClient) AddCookie(c *http.Cookie) {
+	for i, cc := range self.Cookies {
+		if cc.Name == c.Name && strings.EqualFold(cc.Domain, c.Domain) && cc.Path == c.Path {
+			self.Cookies = append(self.Cookies[:i:i], self.Cookies[i+1:]...)
+			break
+		}
+	}
+
+	if c.MaxAge >= 0 {
+		self.Cookies = append(self.Cookies, c)
+	}
+}
+
+// RemoveCookie removes the client cookies with the specified name and domain (an empty domain matches all the cookies
+// with that name) and returns the number of cookies removed.
+func (self *HttpClient) RemoveCookie(name, domain string) int {
+	var cookies []*http.Cookie
+
+	for _, c := range self.Cookies {
+		if c.Name == name && (domain == "" || strings.EqualFold(c.Domain, domain)) {
+			continue
+		}
+
+		cookies = append(cookies, c)
+	}
+
+	n := len(self.Cookies) - len(cookies)
+	self.Cookies = cookies
+	return n
+}
+
+// CookiesFor returns the cookies that would be sent to the URL (relative to the client base URL):
+// the matching client cookies and the cookies in the cookie jar, if any.
+func (self *HttpClient) CookiesFor(path string) []*http.Cookie {
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil
+	}
+
+	if self.BaseURL != nil {
+		u = self.BaseURL.ResolveReference(u)
+	}
+
+	cookies := self.matchCookies(u)
+
+	if jar := self.GetCookieJar(); jar != nil {
+		cookies = append(cookies, jar.Cookies(u)...)
+	}
+
+	return cookies
+}
+
+// return the client cookies to be sent to the URL
+func (self *HttpClient) matchCookies(u *url.URL) []*http.Cookie {
+	var cookies []*http.Cookie
+
+	now := time.Now()
+
+	for _, c := range self.Cookies {
+		if cookieMatch(c, u, self.InScope(u), now) {
+			cookies = append(cookies, c)
+		}
+	}
+
+	return cookies
+}
+
+// check if the cookie should be sent to the URL (inScope is used for cookies with no domain)
+func cookieMatch(c *http.Cookie, u *url.URL, inScope bool, now time.Time) bool {
+	if !c.Expires.IsZero() && c.Expires.Before(now) {
+		return false
+	}
+
+	if c.Secure && u.Scheme != "https" {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+
+	switch domain := strings.ToLower(c.Domain); {
+	case domain == "":
+		if !inScope {
+			return false
+		}
+
+	case strings.HasPrefix(domain, "."):
+		if host != domain[1:] && !strings.HasSuffix(host, domain) {
+			return false
+		}
+
+	default:
+		if host != domain {
+			return false
+		}
+	}
+
+	if c.Path != "" && c.Path != "/" {
+		path := u.Path
+		if path == "" {
+			path = "/"
+		}
+
+		if !strings.HasPrefix(path, c.Path) {
+			return false
+		}
+
+		if len(path) > len(c.Path) && !strings.HasSuffix(c.Path, "/") && path[len(c.Path)] != '/' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ImportCookies reads the cookies in Netscape cookies.txt format and adds them to the client cookies.
+func (self *HttpClient) ImportCookies(r io.Reader) error {
+	cookies, err := ReadCookies(r)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cookies {
+		self.AddCookie(c)
+	}
+
+	return nil
+}
+
+// ExportCookies writes the client cookies in Netscape cookies.txt format.
+// Cookies with no domain are exported with the base URL host.
+func (self *HttpClient) ExportCookies(w io.Writer) error {
+	cookies := make([]*http.Cookie, 0, len(self.Cookies))
+
+	for _, c := range self.Cookies {
+		if c.Domain == "" && self.BaseURL != nil {
+			cc := *c
+			cc.Domain = self.BaseURL.Hostname()
+			c = &cc
+		}
+
+		cookies = append(cookies, c)
+	}
+
+	return WriteCookies(w, cookies)
+}
+
+// ReadCookies reads cookies in Netscape cookies.txt format (as used by curl and wget):
+//
+//	domain <TAB> include-subdomains <TAB> path <TAB> secure <TAB> expires <TAB> name <TAB> value
+//
+// Domains that include the subdomains are returned with a leading "." and
+// lines with the #HttpOnly_ prefix are returned as HttpOnly cookies.
+func ReadCookies(r io.Reader) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+
+	scanner := bufio.NewScanner(r)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		httpOnly := false
+		if strings.HasPrefix(line, "#HttpOnly_") {
+			line = line[10:]
+			httpOnly = true
+		}
+
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) == 6 { // empty value
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("Invalid cookie at line %d", n)
+		}
+
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cookie expiration at line %d", n)
+		}
+
+		domain := strings.TrimPrefix(fields[0], ".")
+		if strings.EqualFold(fields[1], "TRUE") {
+			domain = "." + domain
+		}
+
+		c := &http.Cookie{
+			Domain:   domain,
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+
+		if expires > 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+
+		cookies = append(cookies, c)
+	}
+
+	return cookies, scanner.Err()
+}
+
+// WriteCookies writes the cookies in Netscape cookies.txt format (see ReadCookies)
+func WriteCookies(w io.Writer, cookies []*http.Cookie) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# Netscape HTTP Cookie File\n\n")
+
+	tf := func(b bool) string {
+		if b {
+			return "TRUE"
+		}
+
+		return "FALSE"
+	}
+
+	for _, c := range cookies {
+		path := c.Path
+		if path == "" {
+			path = "/"
+		}
+
+		var expires int64
+		if !c.Expires.IsZero() {
+			expires = c.Expires.Unix()
+		}
+
+		prefix := ""
+		if c.HttpOnly {
+			prefix = "#HttpOnly_"
+		}
+
+		fmt.Fprintf(bw, "%s%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			prefix, c.Domain, tf(strings.HasPrefix(c.Domain, ".")), path, tf(c.Secure), expires, c.Name, c.Value)
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,325 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServiceInstance is an instance of a service, returned by a ServiceResolver
+type ServiceInstance struct {
+	Host   string
+	Port   int
+	Weight int // relative weight (0: default)
+}
+
+// ServiceResolver resolves a logical service name to the list of its instances
+// (i.e. via DNS SRV records, Consul or etcd), see RegisterServiceResolver
+type ServiceResolver interface {
+	Resolve(ctx context.Context, service string) ([]ServiceInstance, error)
+}
+
+// ServiceResolverFunc is a function that implements ServiceResolver
+type ServiceResolverFunc func(ctx context.Context, service string) ([]ServiceInstance, error)
+
+func (f ServiceResolverFunc) Resolve(ctx context.Context, service string) ([]ServiceInstance, error) {
+	return f(ctx, service)
+}
+
+var (
+	resolversLock    sync.RWMutex
+	serviceResolvers = map[string]ServiceResolver{
+		"service": &SRVResolver{Service: "http", Proto: "tcp"},
+		"srv":     &SRVResolver{},
+		"consul":  &ConsulResolver{},
+	}
+)
+
+// RegisterServiceResolver registers (or replaces) the resolver for the base URL scheme (see EnableServiceDiscovery).
+// A nil resolver removes the registration.
+//
+// The builtin resolvers are:
+//
+//	service://name   the DNS SRV records for _http._tcp.name (the resolver search domains apply, as in Kubernetes)
+//	srv://name       the DNS SRV records for name (i.e. srv://_api._tcp.example.com)
+//	consul://name    the healthy instances from the Consul agent (CONSUL_HTTP_ADDR, default http://127.0.0.1:8500)
+func RegisterServiceResolver(scheme string, r ServiceResolver) {
+	scheme = strings.ToLower(scheme)
+
+	resolversLock.Lock()
+	defer resolversLock.Unlock()
+
+	if r == nil {
+		delete(serviceResolvers, scheme)
+	} else {
+		serviceResolvers[scheme] = r
+	}
+}
+
+// return the resolver for the URL scheme, if registered
+func serviceResolver(scheme string) (ServiceResolver, bool) {
+	resolversLock.RLock()
+	defer resolversLock.RUnlock()
+
+	r, ok := serviceResolvers[strings.ToLower(scheme)]
+	return r, ok
+}
+
+// SRVResolver resolves the services via DNS SRV records (only the records with the lowest priority are returned)
+type SRVResolver struct {
+	Service  string        // the SRV service (i.e. "http"), empty to look up the service name directly
+	Proto    string        // the SRV protocol (i.e. "tcp")
+	Resolver *net.Resolver // default net.DefaultResolver
+}
+
+func (r *SRVResolver) Resolve(ctx context.Context, service string) ([]ServiceInstance, error) {
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	_, records, err := resolver.LookupSRV(ctx, r.Service, r.Proto, service)
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []ServiceInstance
+
+	for _, rec := range records { // sorted by priority
+		if rec.Priority != records[0].Priority {
+			break
+		}
+
+		instances = append(instances, ServiceInstance{
+			Host:   strings.TrimSuffix(rec.Target, "."),
+			Port:   int(rec.Port),
+			Weight: int(rec.Weight),
+		})
+	}
+
+	return instances, nil
+}
+
+// ConsulResolver resolves the services via the Consul health API (only the instances passing the health checks)
+type ConsulResolver struct {
+	Address    string // the Consul agent URL (default: CONSUL_HTTP_ADDR or http://127.0.0.1:8500)
+	Token      string // the ACL token (default: CONSUL_HTTP_TOKEN)
+	Datacenter string
+
+	Client *HttpClient // the client for the Consul requests (default: a new client)
+}
+
+// the fields of the Consul health API response
+type consulEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+		Weights struct {
+			Passing int
+		}
+	}
+}
+
+func (r *ConsulResolver) Resolve(ctx context.Context, service string) ([]ServiceInstance, error) {
+	client := r.Client
+	if client == nil {
+		address := r.Address
+		if address == "" {
+			address = os.Getenv("CONSUL_HTTP_ADDR")
+		}
+		if address == "" {
+			address = "http://127.0.0.1:8500"
+		}
+		if !strings.Contains(address, "://") {
+			address = "http://" + address
+		}
+
+		var err error
+		if client, err = NewHttpClientE(address); err != nil {
+			return nil, err
+		}
+	}
+
+	token := r.Token
+	if token == "" {
+		token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+
+	params := map[string]string{"passing": "true"}
+	if r.Datacenter != "" {
+		params["dc"] = r.Datacenter
+	}
+
+	options := []RequestOption{Context(ctx), client.Path("/v1/health/service/" + url.PathEscape(service)), StringParams(params)}
+	if token != "" {
+		options = append(options, Header(map[string]string{"X-Consul-Token": token}))
+	}
+
+	resp, err := CheckStatus(client.SendRequest(options...))
+	if err != nil {
+		if resp != nil {
+			resp.Close()
+		}
+
+		return nil, err
+	}
+
+	var entries []consulEntry
+	if err := resp.JsonDecode(&entries, false); err != nil {
+		return nil, err
+	}
+
+	instances := make([]ServiceInstance, 0, len(entries))
+
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+
+		instances = append(instances, ServiceInstance{Host: host, Port: e.Service.Port, Weight: e.Service.Weights.Passing})
+	}
+
+	return instances, nil
+}
+
+// ServiceDiscovery keeps the endpoints of a Balancer updated with the instances of a service
+// (see HttpClient.EnableServiceDiscovery)
+type ServiceDiscovery struct {
+	Resolver ServiceResolver
+	Service  string
+	Scheme   string // the scheme of the endpoint URLs (default: http, or https for port 443)
+	Balancer *Balancer
+
+	logger DebugLogger
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Refresh resolves the service and updates the balancer endpoints
+// (the endpoints are not changed if the resolution fails or returns no instances)
+func (d *ServiceDiscovery) Refresh(ctx context.Context) error {
+	instances, err := d.Resolver.Resolve(ctx, d.Service)
+	if err == nil && len(instances) == 0 {
+		err = fmt.Errorf("%w for service %q", NoEndpoints, d.Service)
+	}
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].Host != instances[j].Host {
+			return instances[i].Host < instances[j].Host
+		}
+
+		return instances[i].Port < instances[j].Port
+	})
+
+	bases := make([]string, len(instances))
+	weights := make([]int, len(instances))
+
+	for i, inst := range instances {
+		scheme := d.Scheme
+		if scheme == "" && inst.Port == 443 {
+			scheme = "https"
+		} else if scheme == "" {
+			scheme = "http"
+		}
+
+		bases[i] = scheme + "://" + net.JoinHostPort(inst.Host, strconv.Itoa(inst.Port))
+		weights[i] = inst.Weight
+	}
+
+	return d.Balancer.SetEndpoints(bases, weights)
+}
+
+// refresh the endpoints every interval, until stopped
+func (d *ServiceDiscovery) run(ctx context.Context, interval time.Duration) {
+	defer close(d.done)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := d.Refresh(ctx); err != nil && ctx.Err() == nil {
+				d.logger.Println("DISCOVERY:", d.Service, err)
+			}
+		}
+	}
+}
+
+// Stop stops the periodic refresh
+func (d *ServiceDiscovery) Stop() {
+	if d.cancel != nil {
+		d.cancel()
+		<-d.done
+	}
+}
+
+// Balance the requests across the instances of the service of the client base URL (i.e. service://payments/api,
+// see RegisterServiceResolver), refreshing the instances every refresh interval (0: never) until the returned
+// ServiceDiscovery is stopped. The base URL path is kept for all the instances.
+func (self *HttpClient) EnableServiceDiscovery(strategy BalanceStrategy, refresh time.Duration) (*ServiceDiscovery, error) {
+	if self.BaseURL == nil {
+		return nil, NoBaseURL
+	}
+
+	resolver, ok := serviceResolver(self.BaseURL.Scheme)
+	if !ok {
+		return nil, fmt.Errorf("No service resolver for %q", self.BaseURL.Scheme)
+	}
+
+	d := &ServiceDiscovery{
+		Resolver: resolver,
+		Service:  self.BaseURL.Hostname(),
+		Balancer: &Balancer{Strategy: strategy},
+		logger:   self.debugLog(),
+	}
+
+	if err := d.Refresh(context.Background()); err != nil {
+		return nil, err
+	}
+
+	if err := self.SetBalancer(d.Balancer); err != nil {
+		return nil, err
+	}
+
+	if refresh > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		d.cancel, d.done = cancel, make(chan struct{})
+
+		go d.run(ctx, refresh)
+	}
+
+	return d, nil
+}
+
+// Create a new HttpClient for a service URL (i.e. service://payments/api or consul://payments),
+// balancing the requests across the service instances (see EnableServiceDiscovery)
+func NewServiceClient(base string, strategy BalanceStrategy, refresh time.Duration) (*HttpClient, *ServiceDiscovery, error) {
+	client, err := NewHttpClientE(base)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d, err := client.EnableServiceDiscovery(strategy, refresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, d, nil
+}
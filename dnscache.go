@@ -0,0 +1,270 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Default TTLs for the DNS cache entries
+var (
+	DefaultDNSTTL         = time.Minute
+	DefaultDNSNegativeTTL = 5 * time.Second
+)
+
+// DNSCacheStats contains the DNS cache metrics
+type DNSCacheStats struct {
+	Hits         int64 `json:"hits"`
+	Misses       int64 `json:"misses"`
+	NegativeHits int64 `json:"negative_hits"` // hits for failed lookups
+	Entries      int   `json:"entries"`
+}
+
+// a cached lookup
+type dnsEntry struct {
+	ready   chan struct{} // closed when the lookup completes
+	addrs   []net.IPAddr
+	err     error
+	expires time.Time
+}
+
+// DNSCache is an in-process cache for host name lookups (see HttpClient.SetDNSCache).
+// It's safe for concurrent use and can be shared by many clients.
+//
+// Since the Go resolver doesn't return the record TTLs, the entries expire after TTL
+// (or NegativeTTL for failed lookups). Concurrent lookups for the same host are coalesced.
+type DNSCache struct {
+	TTL         time.Duration // default DefaultDNSTTL
+	NegativeTTL time.Duration // default DefaultDNSNegativeTTL, negative values disable the negative caching
+	Resolver    *net.Resolver // default net.DefaultResolver
+
+	lock    sync.Mutex
+	entries map[string]*dnsEntry
+
+	hits, misses, negativeHits int64
+}
+
+// NewDNSCache creates a DNS cache with the specified TTLs (0 for the defaults)
+func NewDNSCache(ttl, negativeTTL time.Duration) *DNSCache {
+	return &DNSCache{TTL: ttl, NegativeTTL: negativeTTL}
+}
+
+// LookupIPAddr returns the addresses for host, from the cache if available, and true if it was a cache hit
+func (c *DNSCache) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, bool, error) {
+	now := time.Now()
+
+	c.lock.Lock()
+	if c.entries == nil {
+		c.entries = map[string]*dnsEntry{}
+	}
+
+	e, ok := c.entries[host]
+	if ok {
+		select {
+		case <-e.ready:
+			if now.After(e.expires) {
+				ok = false
+			}
+		default: // a lookup is in progress
+		}
+	}
+
+	if ok {
+		c.lock.Unlock()
+
+		select {
+		case <-e.ready:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+
+		c.lock.Lock()
+		if e.err != nil {
+			c.negativeHits++
+		} else {
+			c.hits++
+		}
+		c.lock.Unlock()
+
+		return e.addrs, true, e.err
+	}
+
+	e = &dnsEntry{ready: make(chan struct{})}
+	c.entries[host] = e
+	c.misses++
+	c.lock.Unlock()
+
+	resolver := c.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	// don't cache the lookups canceled by the request context
+	addrs, err := resolver.LookupIPAddr(context.WithoutCancel(ctx), host)
+
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = DefaultDNSTTL
+	}
+
+	if err != nil {
+		ttl = c.NegativeTTL
+		if ttl == 0 {
+			ttl = DefaultDNSNegativeTTL
+		}
+	}
+
+	e.addrs, e.err, e.expires = addrs, err, time.Now().Add(ttl)
+	close(e.ready)
+
+	if ttl < 0 { // negative caching disabled
+		c.lock.Lock()
+		if c.entries[host] == e {
+			delete(c.entries, host)
+		}
+		c.lock.Unlock()
+	}
+
+	return addrs, false, err
+}
+
+// Flush removes the specified hosts from the cache (all the entries, if no hosts are specified)
+func (c *DNSCache) Flush(hosts ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(hosts) == 0 {
+		c.entries = nil
+		return
+	}
+
+	for _, h := range hosts {
+		delete(c.entries, h)
+	}
+}
+
+// Stats returns the cache metrics
+func (c *DNSCache) Stats() DNSCacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return DNSCacheStats{Hits: c.hits, Misses: c.misses, NegativeHits: c.negativeHits, Entries: len(c.entries)}
+}
+
+// Dialer returns a DialContext function that resolves the host names with the cache
+// and dials the addresses (in order, until a connection succeeds) with dial
+func (c *DNSCache) Dialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+
+		trace := httptrace.ContextClientTrace(ctx)
+
+		addrs, hit, err := c.LookupIPAddr(ctx, host)
+		if hit && trace != nil { // for a miss the resolver calls the trace hooks
+			if trace.DNSStart != nil {
+				trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+			}
+			if trace.DNSDone != nil {
+				trace.DNSDone(httptrace.DNSDoneInfo{Addrs: addrs, Err: err})
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+
+		for _, a := range addrs {
+			if (network == "tcp4" && a.IP.To4() == nil) || (network == "tcp6" && a.IP.To4() != nil) {
+				continue
+			}
+
+			conn, err := dial(ctx, network, net.JoinHostPort(a.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		if lastErr == nil {
+			lastErr = &net.DNSError{Err: "no suitable address", Name: host, IsNotFound: true}
+		}
+
+		return nil, lastErr
+	}
+}
+
+// a transport dialer that uses the DNS cache, if set
+type dnsCacheDialer struct {
+	tr   *http.Transport
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	lock  sync.RWMutex
+	cache *DNSCache
+}
+
+func (d *dnsCacheDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.lock.RLock()
+	cache := d.cache
+	d.lock.RUnlock()
+
+	if cache == nil {
+		return d.dial(ctx, network, addr)
+	}
+
+	return cache.Dialer(d.dial)(ctx, network, addr)
+}
+
+// Resolve the host names with the DNS cache (nil disables the cache).
+//
+// Note that it only works with an *http.Transport (or a LoggingTransport or LenientTransport wrapping it),
+// that is cloned first if it's shared with other clients (i.e. the DefaultTransport).
+// A cache hit is reported to the request trace as a DNS lookup with the cached addresses.
+func (self *HttpClient) SetDNSCache(c *DNSCache) error {
+	tr := self.ownTransport()
+	if tr == nil {
+		return fmt.Errorf("Unsupported transport %T", self.client.Transport)
+	}
+
+	d := self.dnsCache
+	if d == nil || d.tr != tr { // the transport may have been replaced
+		if c == nil {
+			return nil
+		}
+
+		d = &dnsCacheDialer{tr: tr, dial: tr.DialContext}
+		if d.dial == nil {
+			d.dial = (&net.Dialer{Timeout: DefaultTimeout, KeepAlive: DefaultTimeout}).DialContext
+		}
+
+		tr.DialContext = d.DialContext
+		self.dnsCache = d
+	}
+
+	d.lock.Lock()
+	d.cache = c
+	d.lock.Unlock()
+	return nil
+}
+
+// Get the DNS cache (nil if not set)
+func (self *HttpClient) GetDNSCache() *DNSCache {
+	if self.dnsCache == nil {
+		return nil
+	}
+
+	self.dnsCache.lock.RLock()
+	defer self.dnsCache.lock.RUnlock()
+	return self.dnsCache.cache
+}
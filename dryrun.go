@@ -0,0 +1,76 @@
+package httpclient
+
+import (
+	"net/http"
+	"strings"
+)
+
+// The header set in the responses synthesized in dry-run mode (see DryRun)
+const DryRunHeader = "X-Dry-Run"
+
+// Enable or disable the dry-run mode: the requests are logged (in canonical form, see CanonicalRequest)
+// instead of being sent, and a synthesized response (200 OK, with an empty body and the DryRunHeader) is returned.
+// If methods are specified, only the requests with these methods are not sent (i.e. DryRun(true, "POST", "PUT", "PATCH", "DELETE")
+// to still execute the read-only requests).
+//
+// Note that the secret references are not resolved in the logged requests and the requests are not signed.
+func (self *HttpClient) DryRun(enabled bool, methods ...string) {
+	if !enabled {
+		self.dryRun = nil
+		return
+	}
+
+	if len(methods) == 0 {
+		methods = []string{"*"}
+	}
+
+	self.dryRun = map[string]bool{}
+	for _, m := range methods {
+		self.dryRun[strings.ToUpper(m)] = true
+	}
+}
+
+// Return true if the dry-run mode is enabled (for some or all the methods)
+func (self *HttpClient) GetDryRun() bool {
+	return self.dryRun != nil
+}
+
+// isDryRun returns true if the request should not be sent
+func (self *HttpClient) isDryRun(req *http.Request) bool {
+	if self.dryRun == nil {
+		return false
+	}
+
+	method := req.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	return self.dryRun["*"] || self.dryRun[method]
+}
+
+// dryRunResponse logs the request and returns the synthesized response
+func (self *HttpClient) dryRunResponse(req *http.Request) (*HttpResponse, error) {
+	dump, err := CanonicalRequest(req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	stdLogger(self.logger).Println("DRY RUN:", dump)
+
+	return &HttpResponse{http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{DryRunHeader: {"true"}},
+		Body:          http.NoBody,
+		ContentLength: 0,
+		Request:       req,
+	}}, nil
+}
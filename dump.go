@@ -0,0 +1,123 @@
+package httpclient
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// BuildRequest creates the request with the specified options, as SendRequest does, and applies the request hooks,
+// without sending it (i.e. for a "dry-run" mode).
+//
+// Note that the secret references are not resolved and the request is not signed (this happens when the request is sent).
+func (self *HttpClient) BuildRequest(options ...RequestOption) (*http.Request, error) {
+	req, err := self.makeRequest(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hook := range self.requestHooks {
+		hook(req)
+	}
+
+	return req, nil
+}
+
+// DumpRequest creates the request with the specified options (see BuildRequest) and returns
+// its canonical representation, including the body (see CanonicalRequest)
+func (self *HttpClient) DumpRequest(options ...RequestOption) (*http.Request, string, error) {
+	req, err := self.BuildRequest(options...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dump, err := CanonicalRequest(req, true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return req, dump, nil
+}
+
+// CanonicalRequest returns a canonical textual representation of the request, that is the same for equivalent requests:
+//
+//	METHOD URL
+//	Host: host
+//	Header-Name: value
+//	...
+//
+//	body
+//
+// The URL has lowercase scheme and host, no default port and sorted query parameters, the headers are sorted
+// by canonical name (the values in the original order). If body is true the request body is included
+// (and restored, so that the request can still be sent).
+func CanonicalRequest(req *http.Request, body bool) (string, error) {
+	var b strings.Builder
+
+	u := *req.URL
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment, u.RawFragment = "", ""
+
+	if (u.Scheme == "http" && strings.HasSuffix(u.Host, ":80")) ||
+		(u.Scheme == "https" && strings.HasSuffix(u.Host, ":443")) {
+		u.Host = u.Host[:strings.LastIndex(u.Host, ":")]
+	}
+	if u.Path == "" && u.Opaque == "" {
+		u.Path = "/"
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = u.Query().Encode() // Encode sorts by key
+	}
+
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = "GET"
+	}
+
+	host := u.Host
+	if req.Host != "" && !strings.EqualFold(req.Host, req.URL.Host) {
+		host = req.Host
+	}
+
+	b.WriteString(method + " " + u.String() + "\n")
+	b.WriteString("Host: " + strings.ToLower(host) + "\n")
+
+	names := make([]string, 0, len(req.Header))
+	headers := make(map[string][]string, len(req.Header))
+
+	for k, v := range req.Header {
+		name := http.CanonicalHeaderKey(k)
+		if name == "Host" {
+			continue
+		}
+
+		if _, ok := headers[name]; !ok {
+			names = append(names, name)
+		}
+
+		headers[name] = append(headers[name], v...)
+	}
+
+	sort.Strings(names)
+
+	for _, k := range names {
+		for _, v := range headers[k] {
+			b.WriteString(k + ": " + strings.TrimSpace(v) + "\n")
+		}
+	}
+
+	if body {
+		content, err := requestBody(req)
+		if err != nil {
+			return "", err
+		}
+
+		if len(content) > 0 {
+			b.WriteString("\n")
+			b.Write(content)
+		}
+	}
+
+	return b.String(), nil
+}
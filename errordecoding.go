@@ -0,0 +1,101 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type errorDecodingKey struct{}
+
+// ErrorDecoding configures how ResponseError captures the body of error responses
+type ErrorDecoding struct {
+	// max number of bytes of the body captured in HttpError.Body (0: DefaultErrorBodyLimit)
+	BodyLimit int
+
+	// the fields of a JSON error body that are decoded into HttpError.Details (i.e. "error", "message", "code").
+	// Nested fields can be specified as "error.message". Use "*" to decode all the top level fields.
+	Fields []string
+}
+
+// the default max number of bytes of the body captured in HttpError.Body
+const DefaultErrorBodyLimit = 256
+
+// Set how error responses are decoded for all requests (see ErrorDecoding)
+func (self *HttpClient) SetErrorDecoding(d ErrorDecoding) {
+	self.errorDecoding = &d
+}
+
+// set how the error response is decoded for this request (overrides the client setting)
+func DecodeErrors(d ErrorDecoding) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		return req.WithContext(context.WithValue(req.Context(), errorDecodingKey{}, &d)), nil
+	}
+}
+
+// add the client error decoding configuration to the request, if not already set
+func (self *HttpClient) errorDecodingRequest(req *http.Request) *http.Request {
+	if self.errorDecoding == nil || req.Context().Value(errorDecodingKey{}) != nil {
+		return req
+	}
+
+	return req.WithContext(context.WithValue(req.Context(), errorDecodingKey{}, self.errorDecoding))
+}
+
+// return the error decoding configuration for the response
+func responseErrorDecoding(r *HttpResponse) *ErrorDecoding {
+	if r.Request != nil {
+		if d, ok := r.Request.Context().Value(errorDecodingKey{}).(*ErrorDecoding); ok {
+			return d
+		}
+	}
+
+	return &ErrorDecoding{}
+}
+
+// decode the requested fields of a JSON error body (returning the decoding error, if any)
+func (d *ErrorDecoding) details(contentType string, body []byte) (map[string]interface{}, error) {
+	if len(d.Fields) == 0 || !strings.Contains(contentType, "json") {
+		return nil, nil
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+
+	details := map[string]interface{}{}
+
+	for _, f := range d.Fields {
+		if f == "*" {
+			for k, v := range data {
+				details[k] = v
+			}
+
+			continue
+		}
+
+		var v interface{} = data
+
+		for _, k := range strings.Split(f, ".") {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				v = nil
+				break
+			}
+
+			v = m[k]
+		}
+
+		if v != nil {
+			details[f] = v
+		}
+	}
+
+	if len(details) == 0 {
+		return nil, nil
+	}
+
+	return details, nil
+}
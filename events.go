@@ -0,0 +1,202 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Event describes a request sent by the client (see SetEventSink), with the timings of the request phases
+// (see RequestTrace). It's emitted when the response body is closed, or when the request fails.
+type Event struct {
+	Time   time.Time // request start
+	Method string
+	URL    string // without the password, if any
+	Host   string
+	Proto  string
+
+	Status        int   // 0 if the request failed
+	RequestBytes  int64 // request content length (-1 if unknown)
+	ResponseBytes int64 // response body bytes read
+	Retries       int   // the number of times the request was replayed (i.e. for Digest authentication or 425 Too Early)
+	Error         string
+
+	Remote     string
+	ReusedConn bool
+
+	// phase timings (DNS, Connect and TLSHandshake are only set for new connections)
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	Request      time.Duration
+	Wait         time.Duration
+	Response     time.Duration
+	Duration     time.Duration // total
+
+	// custom fields (see EventFields)
+	Extra map[string]interface{}
+}
+
+// Fields returns the event as a flat map (durations in milliseconds), i.e. to send it to an observability pipeline.
+// The custom fields are added as is.
+func (e *Event) Fields() map[string]interface{} {
+	ms := func(d time.Duration) float64 {
+		return float64(d.Microseconds()) / 1000
+	}
+
+	fields := map[string]interface{}{
+		"timestamp":      e.Time.Format(time.RFC3339Nano),
+		"method":         e.Method,
+		"url":            e.URL,
+		"host":           e.Host,
+		"proto":          e.Proto,
+		"status":         e.Status,
+		"request_bytes":  e.RequestBytes,
+		"response_bytes": e.ResponseBytes,
+		"retries":        e.Retries,
+		"remote":         e.Remote,
+		"reused_conn":    e.ReusedConn,
+		"dns_ms":         ms(e.DNS),
+		"connect_ms":     ms(e.Connect),
+		"tls_ms":         ms(e.TLSHandshake),
+		"request_ms":     ms(e.Request),
+		"wait_ms":        ms(e.Wait),
+		"response_ms":    ms(e.Response),
+		"duration_ms":    ms(e.Duration),
+	}
+
+	if e.Error != "" {
+		fields["error"] = e.Error
+	}
+
+	for k, v := range e.Extra {
+		fields[k] = v
+	}
+
+	return fields
+}
+
+// MarshalJSON encodes the event fields (see Fields)
+func (e *Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.Fields())
+}
+
+// JSONEventSink returns an event sink that writes the events to w as JSON lines (it's safe for concurrent use)
+func JSONEventSink(w io.Writer) func(e *Event) {
+	var lock sync.Mutex
+	enc := json.NewEncoder(w)
+
+	return func(e *Event) {
+		lock.Lock()
+		enc.Encode(e)
+		lock.Unlock()
+	}
+}
+
+// Set the sink for the events of all the requests sent by this client (nil disables the events).
+// The sink is called for each request, from the goroutine that closes the response body
+// (or sends the request, if it fails), so it should be safe for concurrent use.
+func (self *HttpClient) SetEventSink(sink func(e *Event)) {
+	self.events = sink
+}
+
+type eventFieldsKey struct{}
+
+// add custom fields to the event of this request (see SetEventSink)
+func EventFields(fields map[string]interface{}) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		return req.WithContext(context.WithValue(req.Context(), eventFieldsKey{}, fields)), nil
+	}
+}
+
+// the data collected for the event of a request
+type requestEvent struct {
+	sink  func(e *Event)
+	start time.Time
+	rt    RequestTrace
+}
+
+// add a RequestTrace for the event to the request
+func newRequestEvent(req *http.Request, sink func(e *Event)) (*http.Request, *requestEvent) {
+	ev := &requestEvent{sink: sink, start: time.Now()}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), ev.rt.NewClientTrace(false))), ev
+}
+
+// emit the event for the request (and response or error)
+func (ev *requestEvent) emit(req *http.Request, resp *http.Response, err error, retries int, read int64) {
+	e := &Event{
+		Time:          ev.start,
+		Method:        req.Method,
+		URL:           req.URL.Redacted(),
+		Host:          req.Host,
+		RequestBytes:  req.ContentLength,
+		ResponseBytes: read,
+		Retries:       retries,
+		Remote:        ev.rt.Remote,
+		ReusedConn:    ev.rt.Reused,
+		DNS:           ev.rt.DNS,
+		Connect:       ev.rt.Connect,
+		TLSHandshake:  ev.rt.TLSHandshake,
+		Request:       ev.rt.Request,
+		Wait:          ev.rt.Wait,
+		Response:      ev.rt.Response,
+		Duration:      time.Since(ev.start),
+	}
+
+	if e.Host == "" {
+		e.Host = req.URL.Host
+	}
+
+	if resp != nil {
+		e.Status = resp.StatusCode
+		e.Proto = resp.Proto
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	if fields, ok := req.Context().Value(eventFieldsKey{}).(map[string]interface{}); ok {
+		e.Extra = fields
+	}
+
+	ev.sink(e)
+}
+
+// a response body that emits the request event when closed
+type eventBody struct {
+	io.ReadCloser
+
+	ev      *requestEvent
+	req     *http.Request
+	resp    *http.Response
+	retries int
+
+	read int64
+	err  error
+	once sync.Once
+}
+
+func (b *eventBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+
+	return n, err
+}
+
+func (b *eventBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.ev.rt.Done()
+		b.ev.emit(b.req, b.resp, b.err, b.retries, b.read)
+	})
+
+	return err
+}
@@ -0,0 +1,11 @@
+// Package examples contains runnable recipes for common httpclient tasks.
+//
+// Each recipe is a testable example (see the Example functions), using a local test server,
+// so that it's compiled and verified by "go test" and shown in the package documentation:
+//
+//   - Example_paginate: consume a paginated API (Link header)
+//   - Example_resumableDownload: resume an interrupted download with a Range request
+//   - Example_remoteZip: list and read the files of a remote zip archive, without downloading it
+//   - Example_oauth2: get a token with the OAuth2 client credentials flow and call an API
+//   - Example_retryMetrics: retry rate-limited requests and collect the client metrics
+package examples
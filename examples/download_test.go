@@ -0,0 +1,79 @@
+package examples
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gobs/httpclient"
+)
+
+func Example_resumableDownload() {
+	content := strings.Repeat("0123456789", 1000)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer ts.Close()
+
+	dir, _ := os.MkdirTemp("", "download")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "data.txt")
+
+	// a previous download was interrupted after 4000 bytes
+	os.WriteFile(path, []byte(content[:4000]), 0644)
+
+	client := httpclient.NewHttpClient(ts.URL)
+
+	download := func() error {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		resp, err := httpclient.CheckStatus(client.SendRequest(client.Path("/data.txt"),
+			httpclient.Header(map[string]string{"Range": fmt.Sprintf("bytes=%d-", fi.Size())})))
+		defer resp.Close()
+
+		switch {
+		case httpclient.IsStatus(err, http.StatusRequestedRangeNotSatisfiable):
+			return nil // already complete
+
+		case err != nil:
+			return err
+
+		case resp.StatusCode == http.StatusOK: // the server doesn't support ranges: start again
+			if err := f.Truncate(0); err != nil {
+				return err
+			}
+		}
+
+		fmt.Println("resume:", resp.Status, resp.Header.Get("Content-Range"))
+
+		_, err = resp.WriteTo(f)
+		return err
+	}
+
+	if err := download(); err != nil {
+		fmt.Println(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	fmt.Println("complete:", bytes.Equal(data, []byte(content)))
+
+	// Output:
+	// resume: 206 Partial Content bytes 4000-9999/10000
+	// complete: true
+}
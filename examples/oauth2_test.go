@@ -0,0 +1,80 @@
+package examples
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gobs/httpclient"
+)
+
+func Example_oauth2() {
+	mux := http.NewServeMux()
+
+	// the token endpoint (client credentials grant, RFC 6749 section 4.4)
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if r.PostFormValue("grant_type") != "client_credentials" || id != "my-client" || secret != "my-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "token-" + r.PostFormValue("scope"),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	})
+
+	// the API
+	mux.HandleFunc("/api/me", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-read" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		fmt.Fprint(w, `{"name": "example"}`)
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := httpclient.NewHttpClient(ts.URL)
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+
+	resp, err := httpclient.CheckStatus(client.SendRequest(httpclient.POST,
+		client.Path("/oauth/token"),
+		httpclient.BasicAuth("my-client", "my-secret"),
+		httpclient.FormBody(map[string]interface{}{"grant_type": "client_credentials", "scope": "read"})))
+	if err == nil {
+		err = resp.JsonDecode(&token, false)
+	}
+	if err != nil {
+		fmt.Println("token:", err)
+		return
+	}
+
+	fmt.Println("token:", token.TokenType, token.ExpiresIn)
+
+	// all the following requests use the token
+	client.SetBearerToken(token.AccessToken)
+
+	resp, err = httpclient.CheckStatus(client.SendRequest(client.Path("/api/me")))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(string(resp.Content()))
+
+	// Output:
+	// token: Bearer 3600
+	// {"name": "example"}
+}
@@ -0,0 +1,50 @@
+package examples
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/gobs/httpclient"
+)
+
+func Example_paginate() {
+	// an API that returns 3 pages of items, with a Link header for the next page
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+
+		if page < 3 {
+			w.Header().Set("Link", fmt.Sprintf(`</items?page=%d>; rel="next"`, page+1))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `[{"id": %d}, {"id": %d}]`, page*2-1, page*2)
+	}))
+	defer ts.Close()
+
+	client := httpclient.NewHttpClient(ts.URL)
+
+	err := client.Paginate(httpclient.PageOptions{
+		Options: []httpclient.RequestOption{client.Path("/items")},
+	}, func(page *httpclient.HttpResponse) error {
+		var items []struct{ ID int }
+		if err := page.JsonDecode(&items, false); err != nil {
+			return err
+		}
+
+		fmt.Println(page.Request.URL.RequestURI(), items)
+		return nil
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// /items [{1} {2}]
+	// /items?page=2 [{3} {4}]
+	// /items?page=3 [{5} {6}]
+}
@@ -0,0 +1,67 @@
+package examples
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+
+	"github.com/gobs/httpclient"
+)
+
+func Example_retryMetrics() {
+	var calls int32
+
+	// every third request is rate-limited
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%3 == 0 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	client := httpclient.NewHttpClient(ts.URL)
+	client.EnableStats(true)
+
+	var limited int
+	client.OnResponse(func(resp *httpclient.HttpResponse) {
+		if resp.StatusCode == http.StatusTooManyRequests {
+			limited++
+		}
+	})
+
+	var requests [][]httpclient.RequestOption
+	for i := 0; i < 6; i++ {
+		requests = append(requests, []httpclient.RequestOption{client.Path(fmt.Sprintf("/items/%d", i))})
+	}
+
+	// the rate-limited requests are retried after the Retry-After delay
+	ok := 0
+	err := client.DrainWithRateLimit(context.Background(), requests, httpclient.NewRateLimiter(0, 1),
+		func(i int, resp *httpclient.HttpResponse, err error) error {
+			if err == nil && resp.StatusCode == http.StatusOK {
+				ok++
+			}
+
+			return err
+		})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	stats := client.Stats()
+
+	fmt.Println("completed:", ok)
+	fmt.Println("rate limited:", limited)
+	fmt.Println("requests:", stats.Requests, "2xx:", stats.Status["2xx"], "4xx:", stats.Status["4xx"])
+
+	// Output:
+	// completed: 6
+	// rate limited: 2
+	// requests: 8 2xx: 6 4xx: 2
+}
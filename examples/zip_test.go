@@ -0,0 +1,70 @@
+package examples
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gobs/httpclient"
+)
+
+func Example_remoteZip() {
+	// a zip archive served with Range support
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"README.txt", "data/one.txt", "data/two.txt"} {
+		w, _ := zw.Create(name)
+		fmt.Fprintf(w, "this is %v\n", name)
+	}
+	zw.Close()
+
+	requests := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.ServeContent(w, r, "archive.zip", time.Time{}, bytes.NewReader(buf.Bytes()))
+	}))
+	defer ts.Close()
+
+	// HttpFile implements io.ReaderAt, reading only the requested ranges
+	f, err := httpclient.OpenHttpFile(ts.URL+"/archive.zip", nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer f.Close()
+
+	zr, err := zip.NewReader(f, f.Size())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, zf := range zr.File {
+		fmt.Println(zf.Name, zf.UncompressedSize64)
+	}
+
+	rc, err := zr.Open("data/two.txt")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	content, _ := io.ReadAll(rc)
+	rc.Close()
+
+	fmt.Print(string(content))
+	fmt.Println("partial reads:", requests > 1)
+
+	// Output:
+	// README.txt 19
+	// data/one.txt 21
+	// data/two.txt 21
+	// this is data/two.txt
+	// partial reads: true
+}
@@ -0,0 +1,150 @@
+package httpclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http/cookiejar"
+)
+
+var (
+	NoLoginForm = errors.New("No login form")
+	LoginFailed = errors.New("Login failed")
+)
+
+// FormLoginOptions configures FormLogin (all optional)
+type FormLoginOptions struct {
+	// the login form name or id (default: the first form with a password field, or the first form)
+	Form string
+
+	// if set, the CSRF token (see HTMLDocument.CSRFToken) is also sent in this header (i.e. X-CSRF-Token)
+	CSRFHeader string
+
+	// the expected status of the (final) login response (default: any 2xx)
+	SuccessStatus int
+
+	// an element that must be present in the login response page (i.e. "a.logout"), see HTMLDocument.Select
+	SuccessSelector string
+
+	// an element that is present in the login response page if the login failed (i.e. "div.error")
+	FailureSelector string
+
+	// additional options for the login requests
+	RequestOptions []RequestOption
+}
+
+// FormLogin logs in with an HTML form: it gets the login page, fills the form (hidden and CSRF fields
+// included) with fields (i.e. username and password), submits it and checks the response according to opts
+// (that can be nil). The session cookies are stored in the client cookie jar (a new jar is created if not set).
+//
+// It returns the login response (with the body still readable, also when the selectors check fails)
+// and an error wrapping NoLoginForm or LoginFailed if the login failed.
+func (self *HttpClient) FormLogin(loginURL string, fields map[string]string, opts *FormLoginOptions) (*HttpResponse, error) {
+	if opts == nil {
+		opts = &FormLoginOptions{}
+	}
+
+	if self.GetCookieJar() == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		self.SetCookieJar(jar)
+	}
+
+	resp, err := CheckStatus(self.SendRequest(append([]RequestOption{Method("GET"), self.Path(loginURL)}, opts.RequestOptions...)...))
+	if err != nil {
+		if resp != nil {
+			resp.Close()
+		}
+
+		return nil, err
+	}
+
+	doc, err := resp.HTML()
+	if err != nil {
+		return nil, err
+	}
+
+	form := loginForm(doc, opts.Form)
+	if form == nil {
+		return nil, fmt.Errorf("%w in %v", NoLoginForm, doc.URL)
+	}
+
+	options := opts.RequestOptions
+	if opts.CSRFHeader != "" {
+		if token := doc.CSRFToken(); token != "" {
+			options = append(options, Header(map[string]string{opts.CSRFHeader: token}))
+		}
+	}
+
+	self.debugLog().Println("LOGIN:", form.Method, form.Action)
+
+	resp, err = self.SubmitForm(form, fields, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if (opts.SuccessStatus == 0 && resp.StatusCode/100 != 2) || (opts.SuccessStatus != 0 && resp.StatusCode != opts.SuccessStatus) {
+		resp.Close()
+		return nil, fmt.Errorf("%w: status %v", LoginFailed, resp.Status)
+	}
+
+	if opts.SuccessSelector == "" && opts.FailureSelector == "" {
+		return resp, nil
+	}
+
+	body, err := resp.ContentE()
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	check := &HttpResponse{resp.Response}
+	check.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	page, err := check.HTML()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.FailureSelector != "" {
+		if nodes := page.Select(opts.FailureSelector); len(nodes) > 0 {
+			return resp, fmt.Errorf("%w: %v", LoginFailed, HTMLText(nodes[0]))
+		}
+	}
+
+	if opts.SuccessSelector != "" && len(page.Select(opts.SuccessSelector)) == 0 {
+		return resp, fmt.Errorf("%w: %q not found", LoginFailed, opts.SuccessSelector)
+	}
+
+	return resp, nil
+}
+
+// loginForm returns the form with the specified name or id, or the first form with a password field
+// (or the only form)
+func loginForm(doc *HTMLDocument, name string) *Form {
+	if name != "" {
+		return doc.Form(name)
+	}
+
+	forms := doc.Forms()
+	nodes := doc.Find("form")
+
+	for i, n := range nodes {
+		for _, input := range findAll(n, "input") {
+			if HTMLAttr(input, "type") == "password" && i < len(forms) {
+				return forms[i]
+			}
+		}
+	}
+
+	if len(forms) > 0 {
+		return forms[0]
+	}
+
+	return nil
+}
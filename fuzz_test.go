@@ -0,0 +1,91 @@
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func FuzzContentRange(f *testing.F) {
+	for _, s := range []string{"bytes 0-99/100", "bytes 10-19/*", "bytes */100", "bytes 5-1/10", "bytes -1-2/3", "bytes 0-0/0", "items 0-1/2", ""} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		first, last, total, err := ParseContentRange(s)
+		if err != nil {
+			if first != -1 || last != -1 || total != -1 {
+				t.Fatalf("%q: unexpected values on error: %d %d %d", s, first, last, total)
+			}
+
+			return
+		}
+
+		if first < 0 || last < first || (total >= 0 && last >= total) || total < -1 {
+			t.Fatalf("%q: invalid range %d-%d/%d", s, first, last, total)
+		}
+
+		// the formatted range parses to the same values
+		size := "*"
+		if total >= 0 {
+			size = fmt.Sprint(total)
+		}
+
+		f2, l2, t2, err := ParseContentRange(fmt.Sprintf("bytes %d-%d/%s", first, last, size))
+		if err != nil || f2 != first || l2 != last || t2 != total {
+			t.Fatalf("%q: round trip failed: %d %d %d %v", s, f2, l2, t2, err)
+		}
+	})
+}
+
+func FuzzContentDisposition(f *testing.F) {
+	for _, s := range []string{
+		`attachment; filename="test.txt"`,
+		`form-data; name="field"; filename="a;b.txt"`,
+		`attachment; filename*=UTF-8''%e2%82%ac%20rates.txt`,
+		`inline; filename="unterminated`,
+		`;;;=`,
+	} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		r := HttpResponse{http.Response{Header: http.Header{"Content-Disposition": []string{s}}}}
+
+		ctype, name, filename := r.ContentDisposition()
+		if strings.ContainsAny(ctype, ";") {
+			t.Fatalf("%q: unexpected type %q", s, ctype)
+		}
+		if len(name) > len(s) || len(filename) > len(s) {
+			t.Fatalf("%q: unexpected name %q or filename %q", s, name, filename)
+		}
+
+		if f := r.SuggestedFilename(); f == "" || strings.ContainsAny(f, "/\\\x00") || f == ".." {
+			t.Fatalf("%q: unsafe suggested filename %q", s, f)
+		}
+	})
+}
+
+func FuzzLinkHeader(f *testing.F) {
+	for _, s := range []string{
+		`<https://api.example.com/items?page=2>; rel="next", <https://api.example.com/items?page=9>; rel="last"`,
+		`<https://example.com/a,b>; rel="next prev"; title="x, y"`,
+		`<>; rel=next`,
+		`<;rel="next"`,
+		`"<`,
+	} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		for rel, u := range LinkHeader([]string{s}) {
+			if rel == "" || rel != strings.ToLower(rel) {
+				t.Fatalf("%q: unexpected relation %q", s, rel)
+			}
+			if !strings.Contains(s, "<"+u+">") {
+				t.Fatalf("%q: unexpected URL %q", s, u)
+			}
+		}
+	})
+}
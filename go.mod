@@ -0,0 +1,11 @@
+module github.com/gobs/httpclient
+
+go 1.24
+
+require (
+	github.com/google/uuid v1.6.0
+	golang.org/x/net v0.59.0
+	golang.org/x/text v0.42.0
+	google.golang.org/protobuf v1.36.12
+	gopkg.in/yaml.v3 v3.0.1
+)
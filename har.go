@@ -0,0 +1,485 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// HTTP Archive (HAR 1.2) format, see http://www.softwareishard.com/blog/har-12-spec/
+// (only the fields used for recording and replaying requests)
+
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator HARCreator  `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"` // milliseconds
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"` // not in the spec for postData, but used by some tools for binary data
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"` // "base64" for binary content
+	Hash     string `json:"_hash,omitempty"`    // the content hash, if the content is in a BodyStore
+}
+
+// Content returns the decoded content, reading it from the store if it was saved in a BodyStore
+func (c *HARContent) Content(store *BodyStore) ([]byte, error) {
+	if c.Hash != "" && c.Text == "" {
+		if store == nil {
+			return nil, fmt.Errorf("Content %v is in a BodyStore", c.Hash)
+		}
+
+		return store.Get(c.Hash)
+	}
+
+	if c.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(c.Text)
+	}
+
+	return []byte(c.Text), nil
+}
+
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// NewHAR returns an empty HAR archive
+func NewHAR() *HAR {
+	return &HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "github.com/gobs/httpclient", Version: "1.0"},
+		Entries: []*HAREntry{},
+	}}
+}
+
+// LoadHAR reads a HAR archive
+func LoadHAR(r io.Reader) (*HAR, error) {
+	var h HAR
+
+	if err := json.NewDecoder(r).Decode(&h); err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
+
+// ReadHARFile reads a HAR archive from a file
+func ReadHARFile(filename string) (*HAR, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadHAR(f)
+}
+
+// Write writes the HAR archive as indented JSON
+func (h *HAR) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(h)
+}
+
+// WriteFile writes the HAR archive to a file
+func (h *HAR) WriteFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	err = h.Write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// NewRequest returns an http.Request for the HAR entry
+func (e *HAREntry) NewRequest() (*http.Request, error) {
+	var body io.Reader
+
+	if pd := e.Request.PostData; pd != nil && pd.Text != "" {
+		if pd.Encoding == "base64" {
+			b, err := base64.StdEncoding.DecodeString(pd.Text)
+			if err != nil {
+				return nil, err
+			}
+
+			body = bytes.NewReader(b)
+		} else {
+			body = strings.NewReader(pd.Text)
+		}
+	}
+
+	req, err := http.NewRequest(e.Request.Method, e.Request.URL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range e.Request.Headers {
+		if strings.HasPrefix(h.Name, ":") { // HTTP/2 pseudo headers
+			continue
+		}
+
+		switch http.CanonicalHeaderKey(h.Name) {
+		case "Content-Length", "Host", "Connection", "Transfer-Encoding", "Accept-Encoding":
+			continue
+		}
+
+		req.Header.Add(h.Name, h.Value)
+	}
+
+	if pd := e.Request.PostData; pd != nil && pd.MimeType != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", pd.MimeType)
+	}
+
+	return req, nil
+}
+
+// ReplayHAR sends the requests in the HAR archive, in order, calling f (if not nil) with the result of each one.
+// The response body is closed after f returns. If f returns an error the replay stops and the error is returned.
+//
+// If the client has a BaseURL, the scheme and host of the recorded requests are replaced with the ones
+// of the BaseURL, so that a recorded session can be replayed against a different server.
+func (self *HttpClient) ReplayHAR(h *HAR, f func(entry *HAREntry, resp *HttpResponse, err error) error) error {
+	for _, e := range h.Log.Entries {
+		req, err := e.NewRequest()
+		if err == nil {
+			if self.BaseURL != nil {
+				req.URL.Scheme = self.BaseURL.Scheme
+				req.URL.Host = self.BaseURL.Host
+				req.Host = ""
+			}
+
+			self.addHeaders(req, nil)
+			self.addCookies(req)
+		}
+
+		var resp *HttpResponse
+		if err == nil {
+			resp, err = self.Do(req)
+		}
+
+		if f != nil {
+			err = f(e, resp, err)
+		}
+
+		if resp != nil {
+			resp.Close()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HARRecorder is a transport that records all the requests and responses in a HAR archive.
+//
+// The response body is read (and buffered) before returning the response.
+type HARRecorder struct {
+	t http.RoundTripper
+
+	// max request/response body size to record (default: 1MB). Bigger bodies are truncated in the archive.
+	MaxBodySize int
+
+	// if set, the response bodies are saved in the store (not truncated) and referenced by hash in the archive
+	Store *BodyStore
+
+	// if set, the selected fields of JSON request and response bodies are redacted in the archive
+	Redactor *Redactor
+
+	lock sync.Mutex
+	har  *HAR
+}
+
+// Wrap the transport into a HARRecorder
+func NewHARRecorder(t http.RoundTripper) *HARRecorder {
+	if t == nil {
+		t = DefaultTransport
+	}
+
+	return &HARRecorder{t: t, MaxBodySize: 1 << 20, har: NewHAR()}
+}
+
+// HAR returns a copy of the archive with the requests recorded so far
+func (r *HARRecorder) HAR() *HAR {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	h := *r.har
+	h.Log.Entries = append([]*HAREntry{}, r.har.Log.Entries...)
+	return &h
+}
+
+// Reset removes all the recorded entries
+func (r *HARRecorder) Reset() {
+	r.lock.Lock()
+	r.har = NewHAR()
+	r.lock.Unlock()
+}
+
+func (r *HARRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry := &HAREntry{StartedDateTime: time.Now()}
+
+	entry.Request = HARRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: protoOrDefault(req.Proto),
+		Cookies:     harCookies(req.Cookies()),
+		Headers:     harHeaders(redactHeaders(req)),
+		QueryString: harQuery(req.URL.Query()),
+		HeadersSize: -1,
+		BodySize:    req.ContentLength,
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		var body []byte
+		var err error
+
+		if req.GetBody != nil {
+			var rc io.ReadCloser
+			if rc, err = req.GetBody(); err == nil {
+				body, err = ioutil.ReadAll(rc)
+				rc.Close()
+			}
+		} else {
+			if body, err = ioutil.ReadAll(req.Body); err == nil {
+				req.Body.Close()
+				req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		text, encoding := r.harText(body)
+		entry.Request.PostData = &HARPostData{MimeType: req.Header.Get("Content-Type"), Text: text, Encoding: encoding}
+		entry.Request.BodySize = int64(len(body))
+	}
+
+	start := time.Now()
+	resp, err := r.t.RoundTrip(req)
+	wait := time.Since(start)
+
+	if err != nil {
+		entry.Comment = err.Error()
+		entry.Time = ms(wait)
+		entry.Timings = HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Wait: ms(wait)}
+		r.add(entry)
+		return nil, err
+	}
+
+	body, rerr := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	receive := time.Since(start) - wait
+
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	var text, encoding, hash string
+
+	if r.Store != nil && len(body) > 0 {
+		if hash, err = r.Store.Put(r.Redactor.RedactJSON(body)); err != nil {
+			return nil, err
+		}
+	} else {
+		text, encoding = r.harText(body)
+	}
+
+	entry.Response = HARResponse{
+		Status:      resp.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode))),
+		HTTPVersion: protoOrDefault(resp.Proto),
+		Cookies:     harCookies(resp.Cookies()),
+		Headers:     harHeaders(resp.Header),
+		Content: HARContent{
+			Size:     int64(len(body)),
+			MimeType: resp.Header.Get("Content-Type"),
+			Text:     text,
+			Encoding: encoding,
+			Hash:     hash,
+		},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+
+	entry.Time = ms(wait + receive)
+	entry.Timings = HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Wait: ms(wait), Receive: ms(receive)}
+
+	r.add(entry)
+	return resp, nil
+}
+
+func (r *HARRecorder) add(e *HAREntry) {
+	r.lock.Lock()
+	r.har.Log.Entries = append(r.har.Log.Entries, e)
+	r.lock.Unlock()
+}
+
+// return the body as text, or base64 encoded if it's binary
+func (r *HARRecorder) harText(body []byte) (string, string) {
+	body = r.Redactor.RedactJSON(body)
+
+	if r.MaxBodySize > 0 && len(body) > r.MaxBodySize {
+		body = body[:r.MaxBodySize]
+	}
+
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// Start recording the requests in HAR format for this client
+func (self *HttpClient) StartHAR() *HARRecorder {
+	if hr, ok := self.client.Transport.(*HARRecorder); ok {
+		return hr
+	}
+
+	hr := NewHARRecorder(self.client.Transport)
+	self.SetTransport(hr)
+	return hr
+}
+
+// Stop recording the requests, and return the recorded archive (nil if not recording)
+func (self *HttpClient) StopHAR() *HAR {
+	if hr, ok := self.client.Transport.(*HARRecorder); ok {
+		self.SetTransport(hr.t)
+		return hr.HAR()
+	}
+
+	return nil
+}
+
+func harHeaders(h http.Header) []HARNameValue {
+	return harValues(h)
+}
+
+func harQuery(q url.Values) []HARNameValue {
+	return harValues(q)
+}
+
+// return the values sorted by name
+func harValues(m map[string][]string) []HARNameValue {
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	nv := []HARNameValue{}
+
+	for _, k := range names {
+		for _, v := range m[k] {
+			nv = append(nv, HARNameValue{Name: k, Value: v})
+		}
+	}
+
+	return nv
+}
+
+func harCookies(cookies []*http.Cookie) []HARNameValue {
+	nv := []HARNameValue{}
+
+	for _, c := range cookies {
+		nv = append(nv, HARNameValue{Name: c.Name, Value: c.Value})
+	}
+
+	return nv
+}
+
+func protoOrDefault(proto string) string {
+	if proto == "" {
+		return "HTTP/1.1"
+	}
+
+	return proto
+}
+
+// duration in milliseconds
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,504 @@
+package httpclient
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HTMLDocument is a parsed HTML response (see HttpResponse.HTML)
+type HTMLDocument struct {
+	*html.Node
+
+	URL *url.URL // the document URL (or the <base href>), used to resolve links and form actions
+}
+
+// Link is an anchor (or area) element
+type Link struct {
+	URL  *url.URL // the resolved href
+	Href string   // the href value as in the document
+	Text string
+	Rel  string
+}
+
+// Form is a form element, with the default values of its fields
+type Form struct {
+	Name    string
+	ID      string
+	Method  string   // GET or POST
+	Action  *url.URL // the resolved action (the document URL if not specified)
+	Enctype string   // application/x-www-form-urlencoded or multipart/form-data
+
+	Fields url.Values // the values that would be submitted without changes
+}
+
+// HTML reads the response body (converted to UTF-8, see Text) and parses it as an HTML document
+func (resp *HttpResponse) HTML() (*HTMLDocument, error) {
+	text, err := resp.Text()
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := html.Parse(strings.NewReader(text))
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &HTMLDocument{Node: node}
+	if resp.Request != nil {
+		doc.URL = resp.Request.URL
+	}
+
+	if base := doc.Find("base"); len(base) > 0 {
+		if u, err := doc.resolve(HTMLAttr(base[0], "href")); err == nil && u != nil {
+			doc.URL = u
+		}
+	}
+
+	return doc, nil
+}
+
+// Links reads the response body and returns the document links (see HTMLDocument.Links)
+func (resp *HttpResponse) Links() ([]Link, error) {
+	doc, err := resp.HTML()
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.Links(), nil
+}
+
+// Forms reads the response body and returns the document forms (see HTMLDocument.Forms)
+func (resp *HttpResponse) Forms() ([]*Form, error) {
+	doc, err := resp.HTML()
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.Forms(), nil
+}
+
+// HTMLAttr returns the value of the node attribute ("" if not present)
+func HTMLAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+
+	return ""
+}
+
+// hasAttr returns true if the node has the attribute (i.e. checked, selected)
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HTMLText returns the text content of the node (with normalized spaces)
+func HTMLText(n *html.Node) string {
+	var b strings.Builder
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// findAll returns the elements under n with one of the specified tags, in document order
+func findAll(n *html.Node, tags ...string) (nodes []*html.Node) {
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for _, t := range tags {
+				if n.Data == t {
+					nodes = append(nodes, n)
+					break
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+
+	walk(n)
+	return
+}
+
+// Find returns the elements with the specified tag (i.e. "a", "img"), in document order
+func (doc *HTMLDocument) Find(tag string) []*html.Node {
+	return findAll(doc.Node, strings.ToLower(tag))
+}
+
+// Select returns the elements matching a simple selector, in document order.
+// The selector is a tag name, optionally followed by #id, .class (one or more) and [attr] or [attr=value]
+// conditions (i.e. "a.logout", "#user", "div.alert.error", "input[name=token]").
+// Descendant and other combinators are not supported.
+func (doc *HTMLDocument) Select(selector string) []*html.Node {
+	sel, ok := parseSelector(selector)
+	if !ok {
+		return nil
+	}
+
+	var nodes []*html.Node
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && sel.match(n) {
+			nodes = append(nodes, n)
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+
+	walk(doc.Node)
+	return nodes
+}
+
+// a simple (compound) selector
+type selector struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []selectorAttr
+}
+
+type selectorAttr struct {
+	name     string
+	value    string
+	hasValue bool // false: the attribute must be present
+}
+
+var (
+	reSelector     = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9-]*|\*)?((?:#[^#.\[\s]+|\.[^#.\[\s]+|\[[^=\]\s]+(?:=(?:"[^"]*"|'[^']*'|[^\]]*))?\])*)$`)
+	reSelectorPart = regexp.MustCompile(`#[^#.\[\s]+|\.[^#.\[\s]+|\[[^=\]\s]+(?:=(?:"[^"]*"|'[^']*'|[^\]]*))?\]`)
+)
+
+func parseSelector(s string) (sel selector, ok bool) {
+	s = strings.TrimSpace(s)
+
+	m := reSelector.FindStringSubmatch(s)
+	if s == "" || m == nil {
+		return sel, false
+	}
+
+	if m[1] != "*" {
+		sel.tag = strings.ToLower(m[1])
+	}
+
+	for _, p := range reSelectorPart.FindAllString(m[2], -1) {
+		switch p[0] {
+		case '#':
+			sel.id = p[1:]
+		case '.':
+			sel.classes = append(sel.classes, p[1:])
+		case '[':
+			name, value, found := strings.Cut(p[1:len(p)-1], "=")
+			sel.attrs = append(sel.attrs, selectorAttr{strings.ToLower(name), strings.Trim(value, `"'`), found})
+		}
+	}
+
+	return sel, true
+}
+
+func (sel selector) match(n *html.Node) bool {
+	if sel.tag != "" && n.Data != sel.tag {
+		return false
+	}
+
+	if sel.id != "" && HTMLAttr(n, "id") != sel.id {
+		return false
+	}
+
+	classes := strings.Fields(HTMLAttr(n, "class"))
+
+	for _, c := range sel.classes {
+		found := false
+		for _, nc := range classes {
+			if nc == c {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	for _, a := range sel.attrs {
+		if !hasAttr(n, a.name) || (a.hasValue && HTMLAttr(n, a.name) != a.value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Title returns the document title
+func (doc *HTMLDocument) Title() string {
+	if t := doc.Find("title"); len(t) > 0 {
+		return HTMLText(t[0])
+	}
+
+	return ""
+}
+
+func (doc *HTMLDocument) resolve(ref string) (*url.URL, error) {
+	ref = strings.TrimSpace(ref)
+
+	if doc.URL == nil {
+		return url.Parse(ref)
+	}
+
+	return doc.URL.Parse(ref)
+}
+
+// Links returns the a and area elements with an href attribute (invalid URLs are skipped)
+func (doc *HTMLDocument) Links() (links []Link) {
+	for _, n := range findAll(doc.Node, "a", "area") {
+		href := HTMLAttr(n, "href")
+		if href == "" && !hasAttr(n, "href") {
+			continue
+		}
+
+		u, err := doc.resolve(href)
+		if err != nil {
+			continue
+		}
+
+		links = append(links, Link{URL: u, Href: href, Text: HTMLText(n), Rel: HTMLAttr(n, "rel")})
+	}
+
+	return
+}
+
+// Forms returns the document forms
+func (doc *HTMLDocument) Forms() (forms []*Form) {
+	for _, n := range doc.Find("form") {
+		f := &Form{
+			Name:    HTMLAttr(n, "name"),
+			ID:      HTMLAttr(n, "id"),
+			Method:  strings.ToUpper(HTMLAttr(n, "method")),
+			Enctype: strings.ToLower(HTMLAttr(n, "enctype")),
+			Fields:  url.Values{},
+		}
+
+		if f.Method != "POST" {
+			f.Method = "GET"
+		}
+		if f.Enctype != "multipart/form-data" || f.Method == "GET" {
+			f.Enctype = "application/x-www-form-urlencoded"
+		}
+		if u, err := doc.resolve(HTMLAttr(n, "action")); err == nil {
+			f.Action = u
+		}
+
+		for _, field := range findAll(n, "input", "select", "textarea") {
+			name := HTMLAttr(field, "name")
+			if name == "" || hasAttr(field, "disabled") {
+				continue
+			}
+
+			switch field.Data {
+			case "input":
+				switch strings.ToLower(HTMLAttr(field, "type")) {
+				case "submit", "button", "image", "reset", "file":
+					continue
+				case "checkbox", "radio":
+					if !hasAttr(field, "checked") {
+						continue
+					}
+					if !hasAttr(field, "value") {
+						f.Fields.Add(name, "on")
+						continue
+					}
+				}
+
+				f.Fields.Add(name, HTMLAttr(field, "value"))
+
+			case "textarea":
+				var text strings.Builder
+				for c := field.FirstChild; c != nil; c = c.NextSibling {
+					if c.Type == html.TextNode {
+						text.WriteString(c.Data)
+					}
+				}
+
+				f.Fields.Add(name, strings.TrimPrefix(text.String(), "\n"))
+
+			case "select":
+				options := findAll(field, "option")
+				selected := false
+
+				for _, o := range options {
+					if hasAttr(o, "selected") {
+						f.Fields.Add(name, optionValue(o))
+						selected = true
+					}
+				}
+				if !selected && len(options) > 0 && !hasAttr(field, "multiple") {
+					f.Fields.Add(name, optionValue(options[0]))
+				}
+			}
+		}
+
+		forms = append(forms, f)
+	}
+
+	return
+}
+
+func optionValue(n *html.Node) string {
+	if hasAttr(n, "value") {
+		return HTMLAttr(n, "value")
+	}
+
+	return HTMLText(n)
+}
+
+// Form returns the form with the specified name or id (nil if not found)
+func (doc *HTMLDocument) Form(name string) *Form {
+	for _, f := range doc.Forms() {
+		if f.Name == name || f.ID == name {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// the names of the meta tags and form fields commonly used for CSRF tokens
+var csrfNames = []string{"csrf-token", "csrf_token", "_csrf", "csrfmiddlewaretoken", "authenticity_token", "_token", "__requestverificationtoken", "x-csrf-token"}
+
+func isCSRFName(name string) bool {
+	name = strings.ToLower(name)
+
+	for _, n := range csrfNames {
+		if name == n {
+			return true
+		}
+	}
+
+	return strings.Contains(name, "csrf") || strings.Contains(name, "xsrf")
+}
+
+// CSRFToken returns the CSRF token from the meta tags (i.e. <meta name="csrf-token" content="...">)
+// or the first form field with a CSRF token name ("" if not found)
+func (doc *HTMLDocument) CSRFToken() string {
+	for _, n := range doc.Find("meta") {
+		if isCSRFName(HTMLAttr(n, "name")) {
+			if v := HTMLAttr(n, "content"); v != "" {
+				return v
+			}
+		}
+	}
+
+	for _, f := range doc.Forms() {
+		if _, v := f.CSRFToken(); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// CSRFToken returns the name and value of the form CSRF token field (empty strings if not found)
+func (f *Form) CSRFToken() (name, value string) {
+	names := make([]string, 0, len(f.Fields))
+	for k := range f.Fields {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+	for _, k := range names {
+		if v := f.Fields[k]; isCSRFName(k) && len(v) > 0 {
+			return k, v[0]
+		}
+	}
+
+	return "", ""
+}
+
+// Set sets the value of a field (replacing the default values)
+func (f *Form) Set(name, value string) {
+	f.Fields.Set(name, value)
+}
+
+// RequestOptions returns the options to submit the form fields, updated with values
+// (set the method, URL and the query parameters or the body)
+func (f *Form) RequestOptions(values map[string]string) ([]RequestOption, error) {
+	fields := url.Values{}
+	for k, v := range f.Fields {
+		fields[k] = append([]string(nil), v...)
+	}
+	for k, v := range values {
+		fields.Set(k, v)
+	}
+
+	u := new(url.URL)
+	if f.Action != nil {
+		*u = *f.Action
+	}
+	u.Fragment = ""
+
+	if f.Method == "GET" {
+		u.RawQuery = fields.Encode()
+		return []RequestOption{Method("GET"), URL(u)}, nil
+	}
+
+	if f.Enctype == "multipart/form-data" {
+		var buf bytes.Buffer
+
+		w := multipart.NewWriter(&buf)
+		for k, vv := range fields {
+			for _, v := range vv {
+				if err := w.WriteField(k, v); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		return []RequestOption{Method("POST"), URL(u), Body(&buf), ContentType(w.FormDataContentType())}, nil
+	}
+
+	return []RequestOption{Method("POST"), URL(u), Body(strings.NewReader(fields.Encode())),
+		ContentType("application/x-www-form-urlencoded")}, nil
+}
+
+// SubmitForm submits the form with its fields, updated with values (options are applied after the form options)
+func (self *HttpClient) SubmitForm(f *Form, values map[string]string, options ...RequestOption) (*HttpResponse, error) {
+	opts, err := f.RequestOptions(values)
+	if err != nil {
+		return nil, err
+	}
+
+	return self.SendRequest(append(opts, options...)...)
+}
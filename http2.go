@@ -0,0 +1,73 @@
+package httpclient
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	NoHttpTransport = errors.New("No HTTP transport")
+	InvalidHTTP2    = errors.New("HTTP/2 prior knowledge requires HTTP/2")
+)
+
+// HTTP2Options configures the HTTP/2 support of a client (see ConfigureHTTP2)
+type HTTP2Options struct {
+	// if Disable, only use HTTP/1.1
+	Disable bool
+
+	// if PriorKnowledge, use unencrypted HTTP/2 (h2c) for http:// URLs, without the upgrade from HTTP/1.1
+	// (i.e. for gRPC-gateway or development servers). HTTP/1.1 is not used, also for https:// URLs.
+	PriorKnowledge bool
+
+	// send a PING health check if no frame is received on a connection for ReadIdleTimeout (0: no health check)
+	ReadIdleTimeout time.Duration
+
+	// close the connection if the PING response is not received within PingTimeout (default 15s)
+	PingTimeout time.Duration
+
+	// close the connection if a write is blocked for WriteByteTimeout (0: no timeout)
+	WriteByteTimeout time.Duration
+
+	// if StrictMaxStreams, when the server limit of concurrent streams is reached
+	// the requests wait for a stream instead of opening a new connection
+	StrictMaxStreams bool
+
+	// the largest frame the client is willing to read (0: default)
+	MaxReadFrameSize int
+}
+
+// ConfigureHTTP2 configures the HTTP/2 support for this client (unlike DisableHttp2, that changes the default transport
+// for all the clients created after the call).
+//
+// The configuration is applied to the client transport (cloned first if it's shared with other clients, i.e. the DefaultTransport),
+// so it's shared with the clients cloned from this one, and it should be done before the first request
+// (the transport HTTP/2 support is set up only once).
+func (self *HttpClient) ConfigureHTTP2(opts HTTP2Options) error {
+	tr := self.ownTransport()
+	if tr == nil {
+		return NoHttpTransport
+	}
+
+	if opts.Disable && opts.PriorKnowledge {
+		return InvalidHTTP2
+	}
+
+	var protocols http.Protocols
+	protocols.SetHTTP1(!opts.PriorKnowledge)
+	protocols.SetHTTP2(!opts.Disable)
+	protocols.SetUnencryptedHTTP2(opts.PriorKnowledge)
+
+	tr.Protocols = &protocols
+	tr.ForceAttemptHTTP2 = !opts.Disable
+
+	tr.HTTP2 = &http.HTTP2Config{
+		SendPingTimeout:             opts.ReadIdleTimeout,
+		PingTimeout:                 opts.PingTimeout,
+		WriteByteTimeout:            opts.WriteByteTimeout,
+		StrictMaxConcurrentRequests: opts.StrictMaxStreams,
+		MaxReadFrameSize:            opts.MaxReadFrameSize,
+	}
+
+	return nil
+}
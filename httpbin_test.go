@@ -0,0 +1,239 @@
+package httpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A local implementation of the httpbin.org endpoints used by the tests, so that they don't need network access:
+//
+//	/get, /post, /put, /patch, /delete, /anything   echo the request as JSON
+//	/headers                                         echo the request headers
+//	/status/{code}                                   return the status code
+//	/redirect-to?url=&status_code=                   redirect to url
+//	/redirect/{n}                                    redirect n times, then to /get
+//	/cookies                                         return the request cookies
+//	/cookies/set?name=value                          set the cookies and redirect to /cookies
+//	/delay/{ms}                                      wait before responding
+//	/gzip                                            a gzip encoded JSON response
+//	/bytes/{n}                                       n random (seeded) bytes, with Range support
+func httpbinHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	echo := func(w http.ResponseWriter, r *http.Request, extra map[string]interface{}) {
+		result := map[string]interface{}{
+			"args":    flatten(r.URL.Query()),
+			"headers": flatten(r.Header),
+			"method":  r.Method,
+			"url":     "http://" + r.Host + r.URL.String(),
+		}
+
+		for k, v := range extra {
+			result[k] = v
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+
+	anything := func(w http.ResponseWriter, r *http.Request) {
+		extra := map[string]interface{}{}
+
+		ctype := r.Header.Get("Content-Type")
+
+		switch {
+		case strings.HasPrefix(ctype, "multipart/form-data"):
+			if err := r.ParseMultipartForm(1 << 20); err == nil {
+				extra["form"] = flatten(r.MultipartForm.Value)
+
+				files := map[string]string{}
+				for name, fh := range r.MultipartForm.File {
+					if f, err := fh[0].Open(); err == nil {
+						b, _ := ioutil.ReadAll(f)
+						f.Close()
+						files[name] = string(b)
+					}
+				}
+
+				extra["files"] = files
+			}
+
+		case strings.HasPrefix(ctype, "application/x-www-form-urlencoded"):
+			if err := r.ParseForm(); err == nil {
+				extra["form"] = flatten(r.PostForm)
+			}
+
+		default:
+			body, _ := ioutil.ReadAll(r.Body)
+			extra["data"] = string(body)
+
+			var j interface{}
+			if json.Unmarshal(body, &j) == nil {
+				extra["json"] = j
+			}
+		}
+
+		echo(w, r, extra)
+	}
+
+	method := func(m string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != m {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			anything(w, r)
+		}
+	}
+
+	mux.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		echo(w, r, nil)
+	})
+
+	mux.HandleFunc("/post", method("POST"))
+	mux.HandleFunc("/put", method("PUT"))
+	mux.HandleFunc("/patch", method("PATCH"))
+	mux.HandleFunc("/delete", method("DELETE"))
+	mux.HandleFunc("/anything", anything)
+	mux.HandleFunc("/anything/", anything)
+
+	mux.HandleFunc("/headers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"headers": flatten(r.Header)})
+	})
+
+	mux.HandleFunc("/status/", func(w http.ResponseWriter, r *http.Request) {
+		code, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/status/"))
+		if err != nil || code < 100 || code > 999 {
+			code = http.StatusBadRequest
+		}
+
+		w.WriteHeader(code)
+	})
+
+	mux.HandleFunc("/redirect-to", func(w http.ResponseWriter, r *http.Request) {
+		code, err := strconv.Atoi(r.URL.Query().Get("status_code"))
+		if err != nil || code < 300 || code > 399 {
+			code = http.StatusFound
+		}
+
+		w.Header().Set("Location", r.URL.Query().Get("url"))
+		w.WriteHeader(code)
+	})
+
+	mux.HandleFunc("/redirect/", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/redirect/"))
+		if err != nil || n < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if n == 1 {
+			http.Redirect(w, r, "/get", http.StatusFound)
+		} else {
+			http.Redirect(w, r, "/redirect/"+strconv.Itoa(n-1), http.StatusFound)
+		}
+	})
+
+	mux.HandleFunc("/cookies", func(w http.ResponseWriter, r *http.Request) {
+		cookies := map[string]string{}
+		for _, c := range r.Cookies() {
+			cookies[c.Name] = c.Value
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"cookies": cookies})
+	})
+
+	mux.HandleFunc("/cookies/set", func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range r.URL.Query() {
+			http.SetCookie(w, &http.Cookie{Name: k, Value: v[0], Path: "/"})
+		}
+
+		http.Redirect(w, r, "/cookies", http.StatusFound)
+	})
+
+	mux.HandleFunc("/delay/", func(w http.ResponseWriter, r *http.Request) {
+		ms, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/delay/"))
+
+		select {
+		case <-time.After(time.Duration(ms) * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+
+		echo(w, r, nil)
+	})
+
+	mux.HandleFunc("/gzip", func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+
+		gz := gzip.NewWriter(&buf)
+		json.NewEncoder(gz).Encode(map[string]interface{}{"gzipped": true, "headers": flatten(r.Header)})
+		gz.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(buf.Bytes())
+	})
+
+	mux.HandleFunc("/bytes/", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/bytes/"))
+		if err != nil || n < 0 || n > 10<<20 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(testBytes(n)))
+	})
+
+	return mux
+}
+
+// join the values for each key
+func flatten(values map[string][]string) map[string]string {
+	m := make(map[string]string, len(values))
+	for k, v := range values {
+		m[k] = strings.Join(v, ",")
+	}
+
+	return m
+}
+
+// n pseudo-random bytes (always the same for the same n)
+func testBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+func TestMain(m *testing.M) {
+	ts := httptest.NewServer(httpbinHandler())
+
+	BASE_URL = ts.URL + "/"
+	GET_URL = BASE_URL + "get"
+	POST_URL = BASE_URL + "post"
+	REDIRECT_URL = BASE_URL + "redirect-to?url=/get"
+
+	code := m.Run()
+
+	ts.Close()
+	os.Exit(code)
+}
@@ -4,23 +4,31 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"log"
+	"mime"
 	"mime/multipart"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptrace"
 	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gobs/pretty"
 	"github.com/gobs/simplejson"
@@ -41,6 +49,12 @@ var (
 	NoRedirect       = errors.New("No redirect")
 	TooManyRedirects = errors.New("stopped after 10 redirects")
 	NotModified      = errors.New("Not modified")
+
+	// ErrorHandler is called by the functions that don't return an error
+	// (ParamValues, URLWithPathParams, URLWithParams, NewHttpClient and HttpClient.Request)
+	// when the input is invalid. The default handler terminates the program:
+	// use the "E" variants of these functions (i.e. NewHttpClientE) to get the error instead.
+	ErrorHandler = func(err error) { log.Fatal(err) }
 )
 
 func init() {
@@ -55,9 +69,11 @@ func init() {
 // Disable HTTP/2 client support.
 // This is useful for doing stress tests when you want to create a lot of concurrent HTTP/1.1 connection
 // (the HTTP/2 client would try to multiplex the requests on a single connection).
+//
+// To disable HTTP/2 for a single client, use HttpClient.ConfigureHTTP2.
 func DisableHttp2() {
 	if err := os.Setenv("GODEBUG", "http2client=0"); err != nil {
-		log.Fatal(err)
+		log.Println(err)
 	}
 
 	if tr, ok := DefaultTransport.(*http.Transport); ok {
@@ -85,13 +101,40 @@ func SetTimeout(t time.Duration) {
 	DefaultClient.Timeout = t
 }
 
-// HTTP error
+// HTTP error: the error returned for a response with an error status (see ResponseError).
+// The underlying error (reading or decoding the body), if any, is available via errors.Is and errors.As.
+//
+// Note that the transport errors (i.e. connection errors and timeouts) are returned as they are
+// (usually a *url.Error), not wrapped in an HttpError.
 type HttpError struct {
 	Code       int
 	Message    string
 	RetryAfter int
 	Body       []byte
 	Header     http.Header
+
+	// the fields decoded from a JSON error body (see ErrorDecoding)
+	Details map[string]interface{}
+
+	// the underlying error: the error reading or decoding the response body
+	Err error
+}
+
+func (e HttpError) Unwrap() error {
+	return e.Err
+}
+
+// Is allows checking for a specific status code with errors.Is(err, HttpError{Code: code})
+// (a zero Code matches any HttpError)
+func (e HttpError) Is(target error) bool {
+	switch t := target.(type) {
+	case HttpError:
+		return t.Code == 0 || t.Code == e.Code
+	case *HttpError:
+		return t != nil && (t.Code == 0 || t.Code == e.Code)
+	}
+
+	return false
 }
 
 func (e HttpError) Error() string {
@@ -110,6 +153,54 @@ func (e HttpError) String() string {
 	}
 }
 
+// IsStatus returns true if err is (or wraps) an HttpError with the specified status code
+func IsStatus(err error, code int) bool {
+	return errors.Is(err, HttpError{Code: code})
+}
+
+// IsTimeout returns true if err is (or wraps) a timeout error
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
+
+// IsTemporary returns true if err is (or wraps) an error that may go away
+// by retrying the request: timeouts, connection errors and
+// "retryable" HTTP status codes (408, 425, 429, 502, 503, 504)
+func IsTemporary(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if IsTimeout(err) {
+		return true
+	}
+
+	var herr HttpError
+	if errors.As(err, &herr) && herr.Code != 0 {
+		switch herr.Code {
+		case http.StatusRequestTimeout,
+			http.StatusTooEarly,
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		}
+
+		return false
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
 // CloseResponse makes sure we close the response body
 func CloseResponse(r *http.Response) {
 	if r != nil && r.Body != nil {
@@ -134,27 +225,191 @@ func (r *HttpResponse) ContentType() string {
 }
 
 // ContentDisposition returns the content disposition type, field name and filename values
+// (filename* is decoded, if present). See ContentDispositionParams for all the parameters.
 func (r *HttpResponse) ContentDisposition() (ctype, name, filename string) {
-	content_disp := r.Header.Get("Content-Disposition")
-	if len(content_disp) == 0 {
-		return
+	ctype, params := r.ContentDispositionParams()
+	return ctype, params["name"], params["filename"]
+}
+
+// ContentDispositionParams returns the content disposition type and all the parameters (with lowercase names).
+//
+// The extended parameters (RFC 5987 and RFC 6266, i.e. filename*=UTF-8'en'%e2%82%ac%20rates.txt) are decoded
+// and replace the plain ones (i.e. filename* is returned as filename). Headers that are not well formed
+// are parsed leniently.
+func (r *HttpResponse) ContentDispositionParams() (ctype string, params map[string]string) {
+	return parseContentDisposition(r.Header.Get("Content-Disposition"))
+}
+
+// SuggestedFilename returns a file name for saving the response body: the Content-Disposition filename,
+// or the last segment of the request URL path, without directories and control characters
+// ("download" if there are no usable names).
+func (r *HttpResponse) SuggestedFilename() string {
+	_, params := r.ContentDispositionParams()
+
+	names := []string{params["filename"]}
+	if r.Request != nil && r.Request.URL != nil {
+		names = append(names, r.Request.URL.Path)
+	}
+
+	for _, name := range names {
+		if name = safeFilename(name); name != "" {
+			return name
+		}
 	}
 
-	parts := strings.Split(content_disp, ";")
-	ctype = parts[0]
+	return "download"
+}
+
+func parseContentDisposition(s string) (string, map[string]string) {
+	if strings.TrimSpace(s) == "" {
+		return "", map[string]string{}
+	}
 
-	for _, p := range parts[1:] {
-		p = strings.TrimSpace(p)
-		if strings.HasPrefix(p, "name=") {
-			name = strings.Trim(p[5:], `"`)
-		} else if strings.HasPrefix(p, "filename=") {
-			filename = strings.Trim(p[9:], `"`)
-			//} else if strings.Hasprefix(p, "filename=") {
-			//    filename = strings.Trim(p[10:], `"`) // need decoding
+	disp, params, err := mime.ParseMediaType(s)
+	if err != nil || strings.Contains(s, "*=") {
+		// not well formed, or an extended parameter with a charset that ParseMediaType doesn't support
+		ldisp, lparams, extended := lenientDisposition(s)
+		if err != nil {
+			disp, params = ldisp, lparams
+		} else {
+			for k, v := range lparams {
+				if _, ok := params[k]; !ok || extended[k] {
+					params[k] = v
+				}
+			}
 		}
 	}
 
-	return
+	return disp, params
+}
+
+// parse a Content-Disposition that is not well formed: get what we can
+// (also returns the names of the decoded extended parameters)
+func lenientDisposition(s string) (string, map[string]string, map[string]bool) {
+	disp, s, _ := strings.Cut(s, ";")
+	disp = strings.ToLower(strings.TrimSpace(disp))
+
+	var parts []string
+
+	// split the parameters on the semicolons that are not in a quoted string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case '\\':
+			if quoted {
+				i++
+			}
+		case ';':
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	parts = append(parts, s[start:])
+
+	params := map[string]string{}
+	extended := map[string]bool{}
+
+	for _, p := range parts {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok {
+			continue
+		}
+
+		k = strings.ToLower(strings.TrimSpace(k))
+		v = strings.TrimSpace(v)
+		if k == "" {
+			continue
+		}
+
+		if strings.HasSuffix(k, "*") {
+			if dv, ok := decodeExtValue(v); ok {
+				k = k[:len(k)-1]
+				params[k] = dv
+				extended[k] = true
+			}
+
+			continue
+		}
+
+		if extended[k] { // the extended parameter takes precedence
+			continue
+		}
+
+		if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+			v = v[1 : len(v)-1]
+		} else {
+			v = strings.Trim(v, `"`)
+		}
+
+		params[k] = strings.ReplaceAll(v, `\"`, `"`)
+	}
+
+	return disp, params, extended
+}
+
+// decode an RFC 5987 extended value (charset'language'percent-encoded-value)
+func decodeExtValue(v string) (string, bool) {
+	parts := strings.SplitN(v, "'", 3)
+	if len(parts) != 3 {
+		return "", false
+	}
+
+	for i := 0; i < len(parts[2]); i++ {
+		if parts[2][i] >= utf8.RuneSelf { // non-ASCII characters must be percent-encoded
+			return "", false
+		}
+	}
+
+	value, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return "", false
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "utf-8", "us-ascii":
+		return value, utf8.ValidString(value)
+
+	case "iso-8859-1", "latin1":
+		runes := make([]rune, len(value))
+		for i := 0; i < len(value); i++ {
+			runes[i] = rune(value[i])
+		}
+
+		return string(runes), true
+	}
+
+	return "", false
+}
+
+// return the base name of a file name or path, without control or reserved characters ("" if not usable)
+func safeFilename(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < ' ' || r == 0x7f || r == utf8.RuneError:
+			return -1
+		case strings.ContainsRune(`<>:"|?*`, r):
+			return '_'
+		}
+
+		return r
+	}, name)
+
+	name = strings.TrimSpace(name)
+	if strings.Trim(name, ".") == "" {
+		return ""
+	}
+
+	return name
 }
 
 // Close makes sure that all data from the body is read
@@ -168,7 +423,8 @@ func (r *HttpResponse) Close() {
 }
 
 // ResponseError checks the StatusCode and return an error if needed.
-// The error is of type HttpError
+// The error is of type HttpError, with the first bytes of the body and, if configured,
+// the fields of a JSON error body (see SetErrorDecoding)
 func (r *HttpResponse) ResponseError() error {
 	class := r.StatusCode / 100
 	if class != 2 && class != 3 {
@@ -178,18 +434,40 @@ func (r *HttpResponse) ResponseError() error {
 			rt, _ = strconv.Atoi(h)
 		}
 
-		var body [256]byte
-		var blen int
+		d := responseErrorDecoding(r)
+
+		limit := d.BodyLimit
+		if limit <= 0 {
+			limit = DefaultErrorBodyLimit
+		}
+
+		var body []byte
+		var err error
 
 		if r.Body != nil {
-			blen, _ = r.Body.Read(body[:])
+			body = make([]byte, limit)
+
+			var n int
+			n, err = io.ReadFull(r.Body, body)
+			body = body[:n]
+
+			if err == io.EOF || err == io.ErrUnexpectedEOF { // shorter than the limit
+				err = nil
+			}
+		}
+
+		details, derr := d.details(r.Header.Get("Content-Type"), body)
+		if err == nil {
+			err = derr
 		}
 
 		return HttpError{Code: r.StatusCode,
 			Message:    "HTTP " + r.Status,
 			RetryAfter: rt,
 			Header:     r.Header,
-			Body:       body[:blen],
+			Body:       body,
+			Details:    details,
+			Err:        err,
 		}
 	}
 
@@ -229,6 +507,17 @@ func canStringify(v reflect.Value) bool {
 
 // ParamValues fills the input url.Values according to params
 func ParamValues(params map[string]interface{}, q url.Values) url.Values {
+	q, err := ParamValuesE(params, q)
+	if err != nil {
+		ErrorHandler(err)
+	}
+
+	return q
+}
+
+// ParamValuesE fills the input url.Values according to params, returning an error
+// if a parameter cannot be converted to a string
+func ParamValuesE(params map[string]interface{}, q url.Values) (url.Values, error) {
 	if q == nil {
 		q = url.Values{}
 	}
@@ -257,41 +546,71 @@ func ParamValues(params map[string]interface{}, q url.Values) url.Values {
 			if canStringify(val) {
 				q.Set(k, fmt.Sprintf("%v", v))
 			} else {
-				log.Fatal("Invalid type ", val)
+				return q, fmt.Errorf("Invalid type %v for parameter %q", val.Type(), k)
 			}
 		}
 	}
 
-	return q
+	return q, nil
 }
 
 // Given a base URL and a bag of parameteters returns the URL with the encoded parameters
 func URLWithPathParams(base string, path string, params map[string]interface{}) (u *url.URL) {
+	u, err := URLWithPathParamsE(base, path, params)
+	if err != nil {
+		ErrorHandler(err)
+	}
 
+	return u
+}
+
+// Given a base URL and a bag of parameteters returns the URL with the encoded parameters,
+// or an error if the URL or the parameters are invalid
+func URLWithPathParamsE(base string, path string, params map[string]interface{}) (*url.URL, error) {
 	u, err := url.Parse(base)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	if len(path) > 0 {
 		u, err = u.Parse(path)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 	}
 
-	q := ParamValues(params, u.Query())
+	q, err := ParamValuesE(params, u.Query())
+	if err != nil {
+		return nil, err
+	}
+
 	u.RawQuery = q.Encode()
-	return u
+	return u, nil
 }
 
 func URLWithParams(base string, params map[string]interface{}) (u *url.URL) {
 	return URLWithPathParams(base, "", params)
 }
 
+func URLWithParamsE(base string, params map[string]interface{}) (*url.URL, error) {
+	return URLWithPathParamsE(base, "", params)
+}
+
 // http.Get with params
 func Get(urlStr string, params map[string]interface{}) (*HttpResponse, error) {
-	resp, err := DefaultClient.Get(URLWithParams(urlStr, params).String())
+	u, err := URLWithParamsE(urlStr, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *http.Response
+
+	if h, ok := schemeHandler(u); ok { // i.e. file:// or data: URLs
+		resp, err = fetchScheme(h, &http.Request{Method: "GET", URL: u, Header: http.Header{}})
+	} else {
+		resp, err = DefaultClient.Get(u.String())
+	}
+
 	if err == nil {
 		return &HttpResponse{*resp}, nil
 	} else {
@@ -302,7 +621,12 @@ func Get(urlStr string, params map[string]interface{}) (*HttpResponse, error) {
 
 // http.Post with params
 func Post(urlStr string, params map[string]interface{}) (*HttpResponse, error) {
-	resp, err := DefaultClient.PostForm(urlStr, URLWithParams(urlStr, params).Query())
+	u, err := URLWithParamsE(urlStr, params)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := DefaultClient.PostForm(urlStr, u.Query())
 	if err == nil {
 		return &HttpResponse{*resp}, nil
 	} else {
@@ -312,16 +636,48 @@ func Post(urlStr string, params map[string]interface{}) (*HttpResponse, error) {
 }
 
 // Read the body
+//
+// In case of errors, the error is logged and the data read so far is returned
+// (use ContentE to get the error)
 func (resp *HttpResponse) Content() []byte {
+	body, err := resp.ContentE()
+	if err != nil {
+		log.Println(err, "- read", len(body), "bytes")
+	}
+	return body
+}
+
+// Read the body, returning the data read and the error, if any
+func (resp *HttpResponse) ContentE() ([]byte, error) {
 	if resp == nil {
-		return nil
+		return nil, nil
 	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatal(err, " - read ", len(body), " bytes")
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if resp.ContentLength > 0 && resp.ContentLength < maxPooledBuffer {
+		buf.Grow(int(resp.ContentLength) + bytes.MinRead)
 	}
+
+	_, err := buf.ReadFrom(resp.Body)
 	resp.Body.Close()
-	return body
+
+	body := make([]byte, buf.Len())
+	copy(body, buf.Bytes())
+	return body, err
+}
+
+// Read the body into buf (appending to the current content), returning the number of bytes read.
+// This allows reusing the same buffer for multiple responses.
+func (resp *HttpResponse) ContentInto(buf *bytes.Buffer) (int64, error) {
+	if resp == nil {
+		return 0, nil
+	}
+
+	n, err := buf.ReadFrom(resp.Body)
+	resp.Body.Close()
+	return n, err
 }
 
 // Try to parse the response body as JSON
@@ -348,6 +704,85 @@ func (resp *HttpResponse) XmlDecode(out interface{}, strict bool) error {
 	return dec.Decode(out)
 }
 
+// WriteTo copies the response body to w (without buffering it in memory) and closes the body
+func (resp *HttpResponse) WriteTo(w io.Writer) (int64, error) {
+	defer resp.Body.Close()
+	return io.Copy(w, resp.Body)
+}
+
+// Reader returns the response body, limited to limit bytes (0: no limit).
+// Reading more than limit bytes returns a *BodyTooLargeError.
+func (resp *HttpResponse) Reader(limit int64) io.ReadCloser {
+	if limit <= 0 || resp.Body == nil || resp.Body == http.NoBody {
+		return resp.Body
+	}
+
+	return &limitedBody{ReadCloser: resp.Body, limit: limit, remaining: limit, clen: resp.ContentLength}
+}
+
+// SaveToFile writes the response body to the file, atomically (the body is written to a temporary file
+// in the same directory, that is renamed when complete) and returns the number of bytes written.
+//
+// If checksum is not empty (in the form "algorithm:hex-digest", with algorithm sha256, sha512, sha1 or md5)
+// the file is saved only if the checksum of the body matches.
+func (resp *HttpResponse) SaveToFile(path, checksum string) (int64, error) {
+	defer resp.Body.Close()
+
+	var h hash.Hash
+	var expected string
+
+	if checksum != "" {
+		parts := strings.SplitN(checksum, ":", 2)
+		if len(parts) != 2 {
+			return 0, fmt.Errorf("Invalid checksum %q", checksum)
+		}
+
+		_, newHash, err := checksumHash(parts[0])
+		if err != nil {
+			return 0, err
+		}
+
+		h = newHash()
+
+		expected = strings.ToLower(parts[1])
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return 0, err
+	}
+
+	defer os.Remove(f.Name()) // no-op after the rename
+
+	var w io.Writer = f
+	if h != nil {
+		w = io.MultiWriter(f, h)
+	}
+
+	n, err := io.Copy(w, resp.Body)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return n, err
+	}
+
+	if h != nil {
+		if actual := hex.EncodeToString(h.Sum(nil)); actual != expected {
+			return n, fmt.Errorf("Checksum mismatch: expected %v, got %v", expected, actual)
+		}
+	}
+
+	if err := os.Chmod(f.Name(), 0644); err != nil { // TempFile creates the file with mode 0600
+		return n, err
+	}
+
+	return n, os.Rename(f.Name(), path)
+}
+
 ////////////////////////////////////////////////////////////////////////
 
 // http.Client with some defaults and stuff
@@ -364,10 +799,13 @@ type HttpClient struct {
 	// the client UserAgent string
 	UserAgent string
 
-	// Common headers to be passed on each request
+	// Common headers to be passed on each request (to the hosts in HeaderScope)
 	Headers map[string]string
 
-	// Cookies to be passed on each request
+	// Hosts the client headers are sent to (default: the BaseURL host, see SetHeaderScope)
+	HeaderScope []string
+
+	// Cookies to be passed on the requests to the matching hosts (see AddCookie)
 	Cookies []*http.Cookie
 
 	// if FollowRedirects is false, a 30x response will be returned as is
@@ -382,11 +820,86 @@ type HttpClient struct {
 	// if Close, all requests will set Connection: close
 	// (no keep-alive)
 	Close bool
+
+	// if RetryTooEarly, retryable requests (see IsRetryable) that receive a 425 Too Early response
+	// are automatically replayed once (RFC 8470).
+	//
+	// Note that crypto/tls doesn't support sending TLS 1.3 early data (0-RTT), but a 425
+	// can still be returned by intermediaries that accepted early data from a previous hop.
+	RetryTooEarly bool
+
+	// request metrics (see EnableStats)
+	stats *statsCollector
+
+	// request traces (see SetTraceCollector)
+	traces *TraceCollector
+
+	// the logger for the Verbose messages and the LoggingTransport (see SetLogger)
+	logger *log.Logger
+
+	// max response body size (see SetMaxResponseBytes)
+	maxResponseBytes int64
+
+	// the response bodies archive directory (see SetResponseArchive)
+	archiveDir string
+
+	// digest authentication (see SetDigestAuth)
+	digest *DigestAuthenticator
+
+	// error responses decoding (see SetErrorDecoding)
+	errorDecoding *ErrorDecoding
+
+	// PROXY protocol dialer (see SetProxyProtocol)
+	proxyProtocol *proxyProtocolDialer
+
+	// DNS cache dialer (see SetDNSCache)
+	dnsCache *dnsCacheDialer
+
+	// IP family preference dialer (see SetIPPreference)
+	ipFamily *ipFamilyDialer
+
+	// request events sink (see SetEventSink)
+	events func(e *Event)
+
+	// outstanding requests limiter (see SetMaxInFlight)
+	inFlight *InFlightLimiter
+
+	// concurrent requests coalescing (see SetSingleFlight)
+	singleFlight *singleFlight
+
+	// request signer (see SetSigner)
+	signer Signer
+
+	// the methods of the requests that are not sent (see DryRun)
+	dryRun map[string]bool
+
+	// the options of the cookie jar (see SetCookieJarOptions)
+	jarOptions *cookiejar.Options
+
+	// the resolver of the secret references in the client headers (see SetSecretResolver)
+	secretResolver func(ref string) (string, error)
+
+	// request and response hooks (see OnRequest, OnResponse)
+	requestHooks  []func(*http.Request)
+	responseHooks []func(*HttpResponse)
 }
 
+// clone the DefaultTransport, so that each client has its own transport that can be configured independently
+// (a LoggingTransport set by StartLogging is kept, wrapping a clone of the logged transport)
 func cloneDefaultTransport() http.RoundTripper {
-	if cl, ok := DefaultTransport.(interface{ Clone() http.RoundTripper }); ok {
-		return cl.Clone()
+	switch t := DefaultTransport.(type) {
+	case *http.Transport:
+		return t.Clone()
+
+	case *LoggingTransport:
+		if tr, ok := t.t.(*http.Transport); ok {
+			lt := *t
+			lt.t = tr.Clone()
+			return &lt
+		}
+
+	case interface{ Clone() http.RoundTripper }:
+		return t.Clone()
 	}
 
 	return DefaultTransport
@@ -394,7 +907,17 @@ func cloneDefaultTransport() http.RoundTripper {
 
 // Create a new HttpClient
 func NewHttpClient(base string) (httpClient *HttpClient) {
-	httpClient = new(HttpClient)
+	httpClient, err := NewHttpClientE(base)
+	if err != nil {
+		ErrorHandler(err)
+	}
+
+	return
+}
+
+// Create a new HttpClient, returning an error if the base URL is invalid
+func NewHttpClientE(base string) (*HttpClient, error) {
+	httpClient := new(HttpClient)
 	httpClient.client = &http.Client{
 		CheckRedirect: httpClient.checkRedirect,
 		Transport:     cloneDefaultTransport(),
@@ -404,10 +927,10 @@ func NewHttpClient(base string) (httpClient *HttpClient) {
 	httpClient.FollowRedirects = true
 
 	if err := httpClient.SetBase(base); err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	return
+	return httpClient, nil
 }
 
 // Clone an HttpClient (re-use the same http.Client but duplicate the headers)
@@ -418,9 +941,41 @@ func (self *HttpClient) Clone() *HttpClient {
 		clone.Headers[k] = v
 	}
 
+	clone.requestHooks = append(([]func(*http.Request))(nil), self.requestHooks...)
+	clone.responseHooks = append(([]func(*HttpResponse))(nil), self.responseHooks...)
 	return &clone
 }
 
+// clone the HttpClient with its own http.Client (that shares the transport and the cookie jar)
+// and cookies, so that the clone configuration can be changed independently
+func (self *HttpClient) cloneClient() *HttpClient {
+	clone := self.Clone()
+	clone.Cookies = append([]*http.Cookie(nil), self.Cookies...)
+
+	client := *self.client
+	client.CheckRedirect = clone.checkRedirect
+	clone.client = &client
+	return clone
+}
+
+// Add a hook called before sending each request (hooks are called in the order they are added).
+// The hook can modify the request (i.e. add headers).
+func (self *HttpClient) OnRequest(hook func(req *http.Request)) {
+	self.requestHooks = append(self.requestHooks, hook)
+}
+
+// Add a hook called for each successful response, before returning it (hooks are called in the order they are added).
+// The hook should not consume the response body.
+func (self *HttpClient) OnResponse(hook func(resp *HttpResponse)) {
+	self.responseHooks = append(self.responseHooks, hook)
+}
+
+// Remove all request and response hooks
+func (self *HttpClient) ClearHooks() {
+	self.requestHooks = nil
+	self.responseHooks = nil
+}
+
 // Set Base
 func (self *HttpClient) SetBase(base string) error {
 	u, err := url.Parse(base)
@@ -442,9 +997,119 @@ func (self *HttpClient) GetTransport() http.RoundTripper {
 	return self.client.Transport
 }
 
+// return the underlying *http.Transport (unwrapping a LoggingTransport, BalancedTransport, LenientTransport or ProtocolTransport), or nil
+func (self *HttpClient) httpTransport() *http.Transport {
+	tr := self.client.Transport
+	if lt, ok := tr.(*LoggingTransport); ok {
+		tr = lt.t
+	}
+	if bt, ok := tr.(*BalancedTransport); ok {
+		tr = bt.Transport
+	}
+	if lt, ok := tr.(*LoggingTransport); ok { // logging started before the balancer was set
+		tr = lt.t
+	}
+
+	switch t := tr.(type) {
+	case *http.Transport:
+		return t
+	case *LenientTransport:
+		return t.Transport
+	case *ProtocolTransport:
+		return t.Transport
+	}
+
+	return nil
+}
+
+// return the underlying *http.Transport to be configured (see httpTransport).
+// If it's shared with other clients (the DefaultTransport or http.DefaultTransport, i.e. set with SetTransport)
+// it's replaced with a clone first, so that the changes only apply to this client (and the clients cloned from it).
+func (self *HttpClient) ownTransport() *http.Transport {
+	tr := self.httpTransport()
+	if tr == nil || !isDefaultTransport(tr) {
+		return tr
+	}
+
+	clone := tr.Clone()
+	if rt, ok := replaceTransport(self.client.Transport, tr, clone); ok {
+		self.client.Transport = rt
+		return clone
+	}
+
+	return tr
+}
+
+// check if tr is the DefaultTransport or http.DefaultTransport (or the transport they log)
+func isDefaultTransport(tr *http.Transport) bool {
+	for _, rt := range []http.RoundTripper{DefaultTransport, http.DefaultTransport} {
+		if lt, ok := rt.(*LoggingTransport); ok {
+			rt = lt.t
+		}
+		if rt == tr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// return a copy of the transport chain rt (the wrapping transports are copied, not changed)
+// with old replaced by new, and false if old is not found
+func replaceTransport(rt http.RoundTripper, old, new *http.Transport) (http.RoundTripper, bool) {
+	switch t := rt.(type) {
+	case *http.Transport:
+		if t == old {
+			return new, true
+		}
+
+	case *LoggingTransport:
+		if inner, ok := replaceTransport(t.t, old, new); ok {
+			lt := *t
+			lt.t = inner
+			return &lt, true
+		}
+
+	case *BalancedTransport:
+		if inner, ok := replaceTransport(t.Transport, old, new); ok {
+			bt := *t
+			bt.Transport = inner
+			return &bt, true
+		}
+
+	case *LenientTransport:
+		if t.Transport == old {
+			return &LenientTransport{Transport: new}, true
+		}
+
+	case *ProtocolTransport:
+		if t.Transport == old {
+			pt := *t
+			pt.Transport = new
+			return &pt, true
+		}
+	}
+
+	return rt, false
+}
+
 // Set CookieJar
 func (self *HttpClient) SetCookieJar(jar http.CookieJar) {
 	self.client.Jar = jar
+	self.jarOptions = nil
+}
+
+// Set a new cookie jar created with the specified options.
+// The options are also used for the cookie jars of the sessions (see NewSession).
+func (self *HttpClient) SetCookieJarOptions(opts *cookiejar.Options) error {
+	jar, err := cookiejar.New(opts)
+	if err != nil {
+		return err
+	}
+
+	self.client.Jar = jar
+	self.jarOptions = opts
+	return nil
 }
 
 // Get current CookieJar
@@ -453,28 +1118,19 @@ func (self *HttpClient) GetCookieJar() http.CookieJar {
 }
 
 // Allow connections via HTTPS even if something is wrong with the certificate
-// (self-signed or expired)
+// (self-signed or expired). The other TLS settings (see SetTLSConfig) are not changed.
 func (self *HttpClient) AllowInsecure(insecure bool) {
-	var config *tls.Config
-	if insecure {
-		config = &tls.Config{InsecureSkipVerify: true}
-	}
-
-	if tr, ok := self.client.Transport.(*http.Transport); ok {
-		tr.TLSClientConfig = config
-	} else if tr, ok := self.client.Transport.(*LoggingTransport); ok {
-		tr.t.(*http.Transport).TLSClientConfig = config
-	}
+	self.updateTLSConfig(func(config *tls.Config) {
+		config.InsecureSkipVerify = insecure
+	})
 }
 
 // Set connection timeout
 func (self *HttpClient) SetTimeout(t time.Duration) {
 	self.client.Timeout = t
 
-	if tr, ok := self.client.Transport.(*http.Transport); ok {
+	if tr := self.ownTransport(); tr != nil {
 		tr.TLSHandshakeTimeout = t
-	} else if tr, ok := self.client.Transport.(*LoggingTransport); ok {
-		tr.t.(*http.Transport).TLSHandshakeTimeout = t
 	}
 }
 
@@ -483,14 +1139,72 @@ func (self *HttpClient) GetTimeout() time.Duration {
 	return self.client.Timeout
 }
 
-// Enable request logging for this client
-func (self *HttpClient) StartLogging(requestBody, responseBody, timing bool) {
+// Enable request logging for this client (the options configure the body size limit and the redaction, see LogOption).
+// The logs are written to the client logger, if set (see SetLogger).
+func (self *HttpClient) StartLogging(requestBody, responseBody, timing bool, options ...LogOption) {
+	if self.logger != nil {
+		options = append([]LogOption{LogLogger(self.logger)}, options...)
+	}
+
 	if ltr, ok := self.client.Transport.(*LoggingTransport); ok {
 		ltr.requestBody = requestBody
 		ltr.responseBody = responseBody
 		ltr.timing = timing
+		for _, opt := range options {
+			opt(ltr)
+		}
 	} else {
-		self.SetTransport(LoggedTransport(self.client.Transport, true, true, true))
+		self.SetTransport(LoggedTransport(self.client.Transport, requestBody, responseBody, timing, options...))
+	}
+}
+
+// Set the logger for the Verbose messages and the request logging (nil: the standard logger)
+func (self *HttpClient) SetLogger(l *log.Logger) {
+	self.logger = l
+
+	if ltr, ok := self.client.Transport.(*LoggingTransport); ok {
+		ltr.Logger = l
+	}
+}
+
+// Write the Verbose messages and the request logging to w (see SetLogger)
+func (self *HttpClient) SetLogWriter(w io.Writer) {
+	self.SetLogger(log.New(w, "", log.LstdFlags))
+}
+
+// Return the client logger (nil if not set)
+func (self *HttpClient) GetLogger() *log.Logger {
+	return self.logger
+}
+
+// the logger for the Verbose messages
+func (self *HttpClient) debugLog() DebugLogger {
+	return DebugLogger{Enabled: self.Verbose, Logger: self.logger}
+}
+
+// Enable or disable the collection of request metrics for this client
+// (clones share the metrics of the original client)
+func (self *HttpClient) EnableStats(enable bool) {
+	if !enable {
+		self.stats = nil
+	} else if self.stats == nil {
+		self.stats = &statsCollector{}
+	}
+}
+
+// Return the request metrics collected since the stats were enabled or reset
+func (self *HttpClient) Stats() Stats {
+	if self.stats == nil {
+		return Stats{}
+	}
+
+	return self.stats.get()
+}
+
+// Reset the request metrics
+func (self *HttpClient) ResetStats() {
+	if self.stats != nil {
+		self.stats.reset()
 	}
 }
 
@@ -508,14 +1222,14 @@ func (self *HttpClient) addHeaders(req *http.Request, headers map[string]string)
 		req.Header.Set("User-Agent", self.UserAgent)
 	}
 
-	for k, v := range self.Headers {
-		if _, add := headers[k]; !add {
-			req.Header.Set(k, v)
-		}
-	}
-
-	for _, c := range self.Cookies {
-		req.AddCookie(c)
+	if self.InScope(req.URL) {
+		for k, v := range self.Headers {
+			if _, add := headers[k]; !add {
+				req.Header.Set(k, v)
+			}
+		}
+	} else {
+		self.stripHeaders(req)
 	}
 
 	for k, v := range headers {
@@ -531,6 +1245,15 @@ func (self *HttpClient) addHeaders(req *http.Request, headers map[string]string)
 	}
 }
 
+// add the client cookies that match the request URL (and are not already in the request)
+func (self *HttpClient) addCookies(req *http.Request) {
+	for _, c := range self.matchCookies(req.URL) {
+		if _, err := req.Cookie(c.Name); err != nil {
+			req.AddCookie(c)
+		}
+	}
+}
+
 // the callback for CheckRedirect, used to pass along the headers in case of redirection
 func (self *HttpClient) checkRedirect(req *http.Request, via []*http.Request) error {
 	if !self.FollowRedirects {
@@ -543,9 +1266,9 @@ func (self *HttpClient) checkRedirect(req *http.Request, via []*http.Request) er
 		return NoRedirect
 	}
 
-	DebugLog(self.Verbose).Println("REDIRECT:", len(via), req.URL)
+	self.debugLog().Println("REDIRECT:", len(via), req.URL)
 	if len(req.Cookies()) > 0 {
-		DebugLog(self.Verbose).Println("COOKIES:", req.Cookies())
+		self.debugLog().Println("COOKIES:", req.Cookies())
 	}
 
 	if len(via) >= 10 {
@@ -555,20 +1278,39 @@ func (self *HttpClient) checkRedirect(req *http.Request, via []*http.Request) er
 	if len(via) > 0 {
 		last := via[len(via)-1]
 		if len(last.Cookies()) > 0 {
-			DebugLog(self.Verbose).Println("LAST COOKIES:", last.Cookies())
+			self.debugLog().Println("LAST COOKIES:", last.Cookies())
 		}
 	}
 
-	// TODO: check for same host before adding headers
+	// the client headers are only added (or kept) if the new host is in scope
 	self.addHeaders(req, nil)
+
+	if len(via) > 0 && !sameHost(req.URL, via[0].URL) {
+		// don't send the credentials to a different host
+		req.Header.Del("Authorization")
+		req.Header.Del("Cookie")
+	}
+
+	self.addCookies(req)
 	return nil
 }
 
 // Create a request object given the method, path, body and extra headers
 func (self *HttpClient) Request(method string, urlpath string, body io.Reader, headers map[string]string) (req *http.Request) {
+	req, err := self.RequestE(method, urlpath, body, headers)
+	if err != nil {
+		ErrorHandler(err)
+	}
+
+	return
+}
+
+// Create a request object given the method, path, body and extra headers,
+// returning an error if the path is invalid
+func (self *HttpClient) RequestE(method string, urlpath string, body io.Reader, headers map[string]string) (*http.Request, error) {
 	if self.BaseURL != nil {
 		if u, err := self.BaseURL.Parse(urlpath); err != nil {
-			log.Fatal(err)
+			return nil, err
 		} else {
 			urlpath = u.String()
 		}
@@ -576,15 +1318,16 @@ func (self *HttpClient) Request(method string, urlpath string, body io.Reader, h
 
 	req, err := http.NewRequest(strings.ToUpper(method), urlpath, body)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	req.Close = self.Close
 	req.Host = self.Host
 
 	self.addHeaders(req, headers)
+	self.addCookies(req)
 
-	return
+	return req, nil
 }
 
 ////////////////////////////////////////////////////////////////////////////////////
@@ -602,11 +1345,13 @@ func Method(m string) RequestOption {
 }
 
 var (
-	HEAD   = Method("HEAD")
-	GET    = Method("GET")
-	POST   = Method("POST")
-	PUT    = Method("PUT")
-	DELETE = Method("DELETE")
+	HEAD    = Method("HEAD")
+	GET     = Method("GET")
+	POST    = Method("POST")
+	PUT     = Method("PUT")
+	PATCH   = Method("PATCH")
+	DELETE  = Method("DELETE")
+	OPTIONS = Method("OPTIONS")
 )
 
 // set the request URL
@@ -676,8 +1421,12 @@ func (c *HttpClient) Path(path string) RequestOption {
 // set the request URL parameters
 func Params(params map[string]interface{}) RequestOption {
 	return func(req *http.Request) (*http.Request, error) {
-		u := req.URL.String()
-		req.URL = URLWithParams(u, params)
+		u, err := URLWithParamsE(req.URL.String(), params)
+		if err != nil {
+			return nil, err
+		}
+
+		req.URL = u
 		return req, nil
 	}
 }
@@ -694,6 +1443,85 @@ func StringParams(params map[string]string) RequestOption {
 	}
 }
 
+// add a cache-busting parameter (the current time in nanoseconds) to the request URL
+// (if param is empty, "_" is used)
+func CacheBuster(param string) RequestOption {
+	if param == "" {
+		param = "_"
+	}
+
+	return func(req *http.Request) (*http.Request, error) {
+		q := req.URL.Query()
+		q.Set(param, strconv.FormatInt(time.Now().UnixNano(), 10))
+		req.URL.RawQuery = q.Encode()
+		return req, nil
+	}
+}
+
+// set the request headers to bypass caches (Cache-Control: no-cache, Pragma: no-cache)
+func NoCacheBuster() RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		req.Header.Set("Cache-Control", "no-cache")
+		req.Header.Set("Pragma", "no-cache")
+		return req, nil
+	}
+}
+
+// Query parameters removed by CanonicalURL
+// (entries ending with "*" are prefixes)
+var TrackingParams = []string{"utm_*", "gclid", "fbclid", "msclkid", "mc_cid", "mc_eid", "_ga"}
+
+func isTrackingParam(name string, params []string) bool {
+	for _, p := range params {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(name, p[:len(p)-1]) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanonicalURL returns a normalized copy of the input URL, useful to deduplicate URLs:
+// lowercase scheme and host, no default port, no fragment, sorted query parameters
+// and no tracking parameters (TrackingParams plus the specified ones)
+func CanonicalURL(u *url.URL, strip ...string) *url.URL {
+	c := *u
+	c.Scheme = strings.ToLower(c.Scheme)
+	c.Host = strings.ToLower(c.Host)
+	c.Fragment = ""
+	c.RawFragment = ""
+
+	if (c.Scheme == "http" && strings.HasSuffix(c.Host, ":80")) ||
+		(c.Scheme == "https" && strings.HasSuffix(c.Host, ":443")) {
+		c.Host = c.Host[:strings.LastIndex(c.Host, ":")]
+	}
+
+	if c.Path == "" && c.Opaque == "" {
+		c.Path = "/"
+	}
+
+	q := c.Query()
+	for k := range q {
+		if isTrackingParam(k, TrackingParams) || isTrackingParam(k, strip) {
+			q.Del(k)
+		}
+	}
+	c.RawQuery = q.Encode() // Encode sorts by key
+	return &c
+}
+
+// canonicalize the request URL (see CanonicalURL)
+func Canonicalize(strip ...string) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		req.URL = CanonicalURL(req.URL, strip...)
+		return req, nil
+	}
+}
+
 // set the request body as an io.Reader
 func Body(r io.Reader) RequestOption {
 	return func(req *http.Request) (*http.Request, error) {
@@ -713,21 +1541,118 @@ func Body(r io.Reader) RequestOption {
 			req.ContentLength = int64(v.Len())
 		} else if v, ok := r.(interface{ Size() int64 }); ok {
 			req.ContentLength = v.Size()
+		} else if f, ok := r.(*os.File); ok {
+			// the file is sent as is (not wrapped), so that the transport can use sendfile
+			if size, ok := fileRemaining(f); ok {
+				req.ContentLength = size
+			}
+		}
+
+		// allow the request to be replayed (redirects, authentication)
+		switch v := r.(type) {
+		case *bytes.Buffer:
+			buf := v.Bytes()
+			req.GetBody = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(buf)), nil
+			}
+		case *bytes.Reader:
+			snapshot := *v
+			req.GetBody = func() (io.ReadCloser, error) {
+				r := snapshot
+				return ioutil.NopCloser(&r), nil
+			}
+		case *strings.Reader:
+			snapshot := *v
+			req.GetBody = func() (io.ReadCloser, error) {
+				r := snapshot
+				return ioutil.NopCloser(&r), nil
+			}
+		case io.ReadSeeker:
+			// rewind to the current position (not for closers, i.e. files, that are closed after the request)
+			req.GetBody = nil
+
+			if _, ok := r.(io.Closer); !ok {
+				if start, err := v.Seek(0, io.SeekCurrent); err == nil {
+					req.GetBody = func() (io.ReadCloser, error) {
+						if _, err := v.Seek(start, io.SeekStart); err != nil {
+							return nil, err
+						}
+
+						return ioutil.NopCloser(v), nil
+					}
+				}
+			}
+		default:
+			req.GetBody = nil
+		}
+
+		return req, nil
+	}
+}
+
+// set the request body from a function that returns a new reader for the body at each call,
+// so that the request can be replayed (redirects, retries, authentication).
+// Use BodyFunc instead of Body for streaming bodies (i.e. generated via io.Pipe) that can be recreated.
+//
+// The content length is set if the reader has a Len or Size method, otherwise the body is sent
+// with chunked encoding, unless the length is set with ContentLength.
+func BodyFunc(f func() (io.ReadCloser, error)) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		body, err := f()
+		if err != nil {
+			return nil, err
+		}
+
+		req.Body = body
+		req.GetBody = f
+
+		if v, ok := body.(interface{ Len() int }); ok {
+			req.ContentLength = int64(v.Len())
+		} else if v, ok := body.(interface{ Size() int64 }); ok {
+			req.ContentLength = v.Size()
+		} else if f, ok := body.(*os.File); ok {
+			if size, ok := fileRemaining(f); ok {
+				req.ContentLength = size
+			}
 		}
 
 		return req, nil
 	}
 }
 
+// set the request body from the file at path. The file is opened when the request is built
+// (and reopened if the request is replayed) and closed after the request is sent.
+// The content length is set from the file size, so that the transport can use sendfile.
+func FileBody(path string) RequestOption {
+	return BodyFunc(func() (io.ReadCloser, error) {
+		return os.Open(path)
+	})
+}
+
+// return the size of a regular file from the current position
+func fileRemaining(f *os.File) (int64, bool) {
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return 0, false
+	}
+
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil || pos > fi.Size() {
+		return 0, false
+	}
+
+	return fi.Size() - pos, true
+}
+
 // set the request body as a JSON object
 func JsonBody(body interface{}) RequestOption {
 	return func(req *http.Request) (*http.Request, error) {
-		b, err := simplejson.DumpBytes(body)
+		b, err := json.Marshal(body)
 		if err != nil {
 			return nil, err
 		}
-		req.Body = ioutil.NopCloser(bytes.NewBuffer(b))
-		req.ContentLength = int64(len(b))
+
+		setBytesBody(req, b)
 		req.Header.Set("Content-Type", "application/json; charset=utf-8")
 		return req, nil
 	}
@@ -736,15 +1661,52 @@ func JsonBody(body interface{}) RequestOption {
 // set the request body as a form object
 func FormBody(params map[string]interface{}) RequestOption {
 	return func(req *http.Request) (*http.Request, error) {
-		data := ParamValues(params, nil)
-		r := strings.NewReader(data.Encode())
-		req.Body = ioutil.NopCloser(r)
-		req.ContentLength = int64(r.Len())
+		data, err := ParamValuesE(params, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		encodeValues(&buf, data)
+
+		setBytesBody(req, buf.Bytes())
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		return req, nil
 	}
 }
 
+// set the request body to b, that can be recreated (see http.Request.GetBody) so that the request can be replayed
+func setBytesBody(req *http.Request, b []byte) {
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	req.ContentLength = int64(len(b))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+}
+
+// write the values in "URL encoded" form, as url.Values.Encode
+func encodeValues(buf *bytes.Buffer, v url.Values) {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		ek := url.QueryEscape(k)
+
+		for _, v := range v[k] {
+			if buf.Len() > 0 {
+				buf.WriteByte('&')
+			}
+
+			buf.WriteString(ek)
+			buf.WriteByte('=')
+			buf.WriteString(url.QueryEscape(v))
+		}
+	}
+}
+
 // set the Accept header
 func Accept(ct string) RequestOption {
 	return func(req *http.Request) (*http.Request, error) {
@@ -790,13 +1752,52 @@ func Header(headers map[string]string) RequestOption {
 	}
 }
 
-// set request context
+// set request context. The values set by the previous options (i.e. Timeout or Sign) are preserved.
 func Context(ctx context.Context) RequestOption {
 	return func(req *http.Request) (*http.Request, error) {
-		return req.WithContext(ctx), nil
+		return req.WithContext(valuesContext{Context: ctx, values: req.Context()}), nil
+	}
+}
+
+// a context that falls back to the values of another context
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c valuesContext) Value(key interface{}) interface{} {
+	if v := c.Context.Value(key); v != nil {
+		return v
+	}
+
+	return c.values.Value(key)
+}
+
+type timeoutKey struct{}
+
+// set a timeout for this request, that replaces the client timeout.
+// As for the client timeout, this includes reading the response body.
+//
+// The timeout starts when the request is sent (and it's released when the response body is closed,
+// or if the request fails), so it doesn't depend on the order of the options.
+func Timeout(d time.Duration) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		return req.WithContext(context.WithValue(req.Context(), timeoutKey{}, d)), nil
 	}
 }
 
+// a response body that releases the request context when closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
 // set request ClientTrace
 func Trace(tracer *httptrace.ClientTrace) RequestOption {
 	return func(req *http.Request) (*http.Request, error) {
@@ -811,8 +1812,8 @@ func Trace(tracer *httptrace.ClientTrace) RequestOption {
 	}
 } */
 
-// Execute request
-func (self *HttpClient) SendRequest(options ...RequestOption) (*HttpResponse, error) {
+// Create a request object, applying the request options
+func (self *HttpClient) makeRequest(options ...RequestOption) (*http.Request, error) {
 	var path string
 	if self.BaseURL != nil {
 		path = self.BaseURL.String()
@@ -834,6 +1835,19 @@ func (self *HttpClient) SendRequest(options ...RequestOption) (*HttpResponse, er
 		}
 	}
 
+	// after the options, since they can change the URL
+	self.stripHeaders(req)
+	self.addCookies(req)
+	return req, nil
+}
+
+// Execute request
+func (self *HttpClient) SendRequest(options ...RequestOption) (*HttpResponse, error) {
+	req, err := self.makeRequest(options...)
+	if err != nil {
+		return nil, err
+	}
+
 	return self.Do(req)
 }
 
@@ -841,25 +1855,189 @@ func (self *HttpClient) SendRequest(options ...RequestOption) (*HttpResponse, er
 //
 // Old style requests
 
+// send the request via the http.Client
+func (self *HttpClient) do(req *http.Request) (*http.Response, error) {
+	client := self.client
+
+	if _, timeout := req.Context().Value(timeoutKey{}).(time.Duration); timeout && client.Timeout > 0 {
+		// the request timeout replaces the client timeout
+		c := *client
+		c.Timeout = 0
+		client = &c
+	}
+
+	if err := self.sign(req); err != nil {
+		return nil, err
+	}
+
+	if h, ok := schemeHandler(req.URL); ok {
+		return fetchScheme(h, req)
+	}
+
+	resp, err := client.Do(prepareBody(req))
+	if errors.Is(err, NoRedirect) {
+		err = nil // redirect on HEAD is not an error
+	}
+
+	return resp, err
+}
+
 // Execute request
 func (self *HttpClient) Do(req *http.Request) (*HttpResponse, error) {
+	for _, hook := range self.requestHooks {
+		hook(req)
+	}
+
+	if sf := self.singleFlight; sf != nil && sf.eligible(req) {
+		return sf.do(req, self.send)
+	}
+
+	return self.send(req)
+}
+
+// send executes the request (after the request hooks), with the request timeout if set (see Timeout)
+func (self *HttpClient) send(req *http.Request) (*HttpResponse, error) {
+	d, ok := req.Context().Value(timeoutKey{}).(time.Duration)
+	if !ok {
+		return self.sendRequest(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), d)
+
+	resp, err := self.sendRequest(req.WithContext(ctx))
+	if resp != nil && resp.Body != nil {
+		// release the request timeout when the body is closed
+		resp.Body = cancelBody{resp.Body, cancel}
+	} else {
+		cancel()
+	}
+
+	return resp, err
+}
+
+// sendRequest executes the request
+func (self *HttpClient) sendRequest(req *http.Request) (*HttpResponse, error) {
 	var logClen string
 
 	if req.Header.Get("Content-Length") == "" {
 		logClen = fmt.Sprintf(" (Content-Length: %v)", req.ContentLength)
 	}
 
-	DebugLog(self.Verbose).Println("REQUEST:", req.Method, req.URL, pretty.PrettyFormat(req.Header)+logClen)
+	self.debugLog().Println("REQUEST:", req.Method, req.URL, pretty.PrettyFormat(req.Header)+logClen)
 
-	resp, err := self.client.Do(req)
-	if urlerr, ok := err.(*url.Error); ok && urlerr.Err == NoRedirect {
-		err = nil // redirect on HEAD is not an error
+	if self.isDryRun(req) {
+		return self.dryRunResponse(req)
+	}
+
+	// resolve the secret references after logging the request, so that the values are never logged
+	req, err := self.resolveSecrets(req)
+	if err != nil {
+		return nil, err
+	}
+
+	req = self.errorDecodingRequest(req)
+
+	var startTime time.Time
+
+	if self.stats != nil {
+		req = self.stats.trace(req)
+		startTime = time.Now()
+	}
+
+	var rtrace *RequestTrace
+
+	if self.traces != nil {
+		req, rtrace = self.traces.trace(req)
+	}
+
+	var event *requestEvent
+
+	if self.events != nil {
+		req, event = newRequestEvent(req, self.events)
+	}
+
+	release, err := self.acquireInFlight(req)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := self.digestAuth(req)
+	if digest != nil {
+		if err := digest.Authorize(req); err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	retries := 0
+
+	resp, err := self.do(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && digest != nil && digest.Challenge(resp) {
+		if rreq, ok := rewindRequest(req); ok {
+			self.debugLog().Println("DIGEST: authenticate", req.Method, req.URL)
+			CloseResponse(resp)
+			req = rreq
+			retries++
+			if err = digest.Authorize(req); err == nil {
+				resp, err = self.do(req)
+			}
+		}
+	}
+	if err == nil && resp.StatusCode == http.StatusTooEarly && self.RetryTooEarly {
+		if rreq, ok := replayRequest(req); ok {
+			self.debugLog().Println("TOO EARLY: replay", req.Method, req.URL)
+			CloseResponse(resp)
+			req = rreq
+			retries++
+			resp, err = self.do(req)
+		}
+	}
+	if err == nil && resp.Body != nil {
+		// release the in-flight slots when the body is closed
+		resp.Body = inFlightBody{resp.Body, release}
+	} else {
+		release()
+	}
+	if self.stats != nil {
+		self.stats.record(req, resp, err, time.Since(startTime))
+
+		if err == nil && resp.Body != nil {
+			resp.Body = countingReader{resp.Body, self.stats}
+		}
+	}
+	if self.traces != nil {
+		if err == nil && resp.Body != nil {
+			resp.Body = &traceBody{ReadCloser: resp.Body, c: self.traces, rt: rtrace}
+		} else if err != nil {
+			self.traces.AddError()
+		}
+	}
+	if event != nil {
+		if err == nil && resp.Body != nil {
+			resp.Body = &eventBody{ReadCloser: resp.Body, ev: event, req: req, resp: resp, retries: retries}
+		} else {
+			event.emit(req, resp, err, retries, 0)
+		}
 	}
 	if err == nil {
-		DebugLog(self.Verbose).Println("RESPONSE:", resp.Status, pretty.PrettyFormat(resp.Header))
-		return &HttpResponse{*resp}, nil
+		self.limitBody(req, resp)
+
+		if self.archiveDir != "" {
+			self.archiveBody(req, resp)
+		}
+
+		checksumResponse(req, resp)
+
+		self.debugLog().Println("RESPONSE:", resp.Status, pretty.PrettyFormat(resp.Header))
+
+		hresp := &HttpResponse{*resp}
+		for _, hook := range self.responseHooks {
+			hook(hresp)
+		}
+
+		return hresp, nil
 	} else {
-		DebugLog(self.Verbose).Println("ERROR:", err,
+		self.debugLog().Println("ERROR:", err,
 			"REQUEST:", req.Method, req.URL,
 			pretty.PrettyFormat(req.Header))
 		CloseResponse(resp)
@@ -867,28 +2045,84 @@ func (self *HttpClient) Do(req *http.Request) (*HttpResponse, error) {
 	}
 }
 
+// isIdempotent returns true for methods that can be safely replayed
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+
+	return false
+}
+
+// replayRequest returns a copy of req that can be sent again,
+// if the request is retryable and the body can be recreated
+func replayRequest(req *http.Request) (*http.Request, bool) {
+	if !IsRetryable(req) {
+		return nil, false
+	}
+
+	return rewindRequest(req)
+}
+
+// rewindRequest returns a copy of req that can be sent again, if the body can be recreated
+func rewindRequest(req *http.Request) (*http.Request, bool) {
+	rreq := req.Clone(req.Context())
+
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, false
+		}
+
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, false
+		}
+
+		rreq.Body = body
+	}
+
+	return rreq, true
+}
+
+// Create and execute a request
+func (self *HttpClient) doRequest(method, path string, body io.Reader, headers map[string]string) (*HttpResponse, error) {
+	req, err := self.RequestE(method, path, body, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	return self.Do(req)
+}
+
 // Execute a DELETE request
 func (self *HttpClient) Delete(path string, headers map[string]string) (*HttpResponse, error) {
-	req := self.Request("DELETE", path, nil, headers)
-	return self.Do(req)
+	return self.doRequest("DELETE", path, nil, headers)
 }
 
 // Execute a HEAD request
 func (self *HttpClient) Head(path string, params map[string]interface{}, headers map[string]string) (*HttpResponse, error) {
-	req := self.Request("HEAD", URLWithParams(path, params).String(), nil, headers)
-	return self.Do(req)
+	u, err := URLWithParamsE(path, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return self.doRequest("HEAD", u.String(), nil, headers)
 }
 
 // Execute a GET request
 func (self *HttpClient) Get(path string, params map[string]interface{}, headers map[string]string) (*HttpResponse, error) {
-	req := self.Request("GET", URLWithParams(path, params).String(), nil, headers)
-	return self.Do(req)
+	u, err := URLWithParamsE(path, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return self.doRequest("GET", u.String(), nil, headers)
 }
 
 // Execute a POST request
 func (self *HttpClient) Post(path string, content io.Reader, headers map[string]string) (*HttpResponse, error) {
-	req := self.Request("POST", path, content, headers)
-	return self.Do(req)
+	return self.doRequest("POST", path, content, headers)
 }
 
 func (self *HttpClient) PostForm(path string, data url.Values, headers map[string]string) (*HttpResponse, error) {
@@ -896,14 +2130,12 @@ func (self *HttpClient) PostForm(path string, data url.Values, headers map[strin
 		headers = map[string]string{}
 	}
 	headers["Content-Type"] = "application/x-www-form-urlencoded"
-	req := self.Request("POST", path, strings.NewReader(data.Encode()), headers)
-	return self.Do(req)
+	return self.doRequest("POST", path, strings.NewReader(data.Encode()), headers)
 }
 
 // Execute a PUT request
 func (self *HttpClient) Put(path string, content io.Reader, headers map[string]string) (*HttpResponse, error) {
-	req := self.Request("PUT", path, content, headers)
-	return self.Do(req)
+	return self.doRequest("PUT", path, content, headers)
 }
 
 // Upload a file via form
@@ -921,8 +2153,9 @@ func (self *HttpClient) UploadFile(method, path, fileParam, filePath string, pay
 		reader = bytes.NewReader(payload)
 	}
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+	buf := new(bytes.Buffer)
+
+	writer := multipart.NewWriter(buf)
 	part, err := writer.CreateFormFile(fileParam, filepath.Base(filePath))
 	if err == nil {
 		_, err = io.Copy(part, reader)
@@ -941,9 +2174,9 @@ func (self *HttpClient) UploadFile(method, path, fileParam, filePath string, pay
 		headers = map[string]string{}
 	}
 
-	headers["Content-Type"] = writer.FormDataContentType()
-	headers["Content-Length"] = strconv.Itoa(body.Len())
-	req := self.Request(method, path, body, headers)
+	body := buf.Bytes() // a bytes.Reader, so that the request can be replayed (see http.NewRequest)
 
-	return self.Do(req)
+	headers["Content-Type"] = writer.FormDataContentType()
+	headers["Content-Length"] = strconv.Itoa(len(body))
+	return self.doRequest(method, path, bytes.NewReader(body), headers)
 }
@@ -0,0 +1,400 @@
+// Package httpclienttest implements a mock transport to test code that uses an HttpClient
+// without network access.
+//
+//	client, mock := httpclienttest.NewClient("http://api.example.com")
+//	mock.On("GET", "/users/1").RespondJSON(200, map[string]interface{}{"id": 1})
+//
+//	... code under test using client ...
+//
+//	mock.AssertCalled(t, "GET", "/users/1")
+//	mock.AssertExpectations(t)
+package httpclienttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gobs/httpclient"
+)
+
+// A recorded request
+type Call struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+}
+
+// Mock is a request matcher with its canned response
+type Mock struct {
+	method    string
+	path      string
+	query     url.Values
+	header    http.Header
+	bodyMatch func(body []byte) bool
+
+	status     int
+	respHeader http.Header
+	respBody   []byte
+	err        error
+
+	times int // max number of matches (0: unlimited)
+	calls int
+
+	lock *sync.Mutex // the MockTransport lock
+}
+
+// Match requests with the specified query parameter
+func (m *Mock) WithQuery(name, value string) *Mock {
+	m.query.Add(name, value)
+	return m
+}
+
+// Match requests with the specified header
+func (m *Mock) WithHeader(name, value string) *Mock {
+	m.header.Add(name, value)
+	return m
+}
+
+// Match requests with the specified body
+func (m *Mock) WithBody(body string) *Mock {
+	return m.WithBodyMatch(func(b []byte) bool { return string(b) == body })
+}
+
+// Match requests with a JSON body equivalent to v
+func (m *Mock) WithJSONBody(v interface{}) *Mock {
+	expected, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return m.WithBodyMatch(func(b []byte) bool {
+		var jv interface{}
+		if err := json.Unmarshal(b, &jv); err != nil {
+			return false
+		}
+
+		actual, _ := json.Marshal(jv)
+		return bytes.Equal(normalizeJSON(expected), actual)
+	})
+}
+
+// Match requests where the body satisfies the condition
+func (m *Mock) WithBodyMatch(match func(body []byte) bool) *Mock {
+	m.bodyMatch = match
+	return m
+}
+
+// Respond with the specified status and body
+func (m *Mock) Respond(status int, body string) *Mock {
+	m.status = status
+	m.respBody = []byte(body)
+	return m
+}
+
+// Respond with the specified status and v encoded as JSON
+func (m *Mock) RespondJSON(status int, v interface{}) *Mock {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	m.status = status
+	m.respBody = body
+	m.respHeader.Set("Content-Type", "application/json")
+	return m
+}
+
+// Add a response header
+func (m *Mock) RespondHeader(name, value string) *Mock {
+	m.respHeader.Add(name, value)
+	return m
+}
+
+// Return the error instead of a response (i.e. to simulate network errors)
+func (m *Mock) RespondError(err error) *Mock {
+	m.err = err
+	return m
+}
+
+// Match only the first n requests
+func (m *Mock) Times(n int) *Mock {
+	m.times = n
+	return m
+}
+
+// Return the number of requests matched
+func (m *Mock) Calls() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.calls
+}
+
+func (m *Mock) String() string {
+	method := m.method
+	if method == "" {
+		method = "*"
+	}
+
+	path := m.path
+	if path == "" {
+		path = "*"
+	}
+
+	return method + " " + path
+}
+
+func (m *Mock) match(req *http.Request, body []byte) bool {
+	if m.times > 0 && m.calls >= m.times {
+		return false
+	}
+
+	if m.method != "" && m.method != req.Method {
+		return false
+	}
+
+	if !matchPath(m.path, req.URL.Path) {
+		return false
+	}
+
+	q := req.URL.Query()
+	for k, values := range m.query {
+		for _, v := range values {
+			if !contains(q[k], v) {
+				return false
+			}
+		}
+	}
+
+	for k, values := range m.header {
+		for _, v := range values {
+			if !contains(req.Header.Values(k), v) {
+				return false
+			}
+		}
+	}
+
+	return m.bodyMatch == nil || m.bodyMatch(body)
+}
+
+func (m *Mock) response(req *http.Request) *http.Response {
+	status := m.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        m.respHeader.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(m.respBody)),
+		ContentLength: int64(len(m.respBody)),
+		Request:       req,
+	}
+}
+
+// match an exact path, any path ("" or "*") or a path prefix ("/users/*")
+func matchPath(pattern, path string) bool {
+	switch {
+	case pattern == "" || pattern == "*":
+		return true
+	case strings.HasSuffix(pattern, "/*"):
+		return strings.HasPrefix(path, pattern[:len(pattern)-1])
+	default:
+		return pattern == path
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func normalizeJSON(b []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return b
+	}
+
+	b, _ = json.Marshal(v)
+	return b
+}
+
+// MockTransport is an http.RoundTripper that returns canned responses for the registered mocks
+// and records all the requests.
+type MockTransport struct {
+	// if not nil, requests that don't match any mock are sent via Fallback,
+	// otherwise an error is returned
+	Fallback http.RoundTripper
+
+	lock  sync.Mutex
+	mocks []*Mock
+	calls []Call
+}
+
+// Create a new MockTransport
+func NewMockTransport() *MockTransport {
+	return &MockTransport{}
+}
+
+// Create a new HttpClient using a new MockTransport
+func NewClient(base string) (*httpclient.HttpClient, *MockTransport) {
+	mock := NewMockTransport()
+
+	client := httpclient.NewHttpClient(base)
+	client.SetTransport(mock)
+	return client, mock
+}
+
+// Register a mock for the specified method and path ("" matches any method, "" or "*" any path and
+// "/prefix/*" all the sub-paths). Mocks are matched in the order they are registered.
+func (t *MockTransport) On(method, path string) *Mock {
+	m := &Mock{
+		method:     strings.ToUpper(method),
+		path:       path,
+		query:      url.Values{},
+		header:     http.Header{},
+		respHeader: http.Header{},
+		lock:       &t.lock,
+	}
+
+	t.lock.Lock()
+	t.mocks = append(t.mocks, m)
+	t.lock.Unlock()
+	return m
+}
+
+// The http.RoundTripper interface
+func (t *MockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+
+	if req.Body != nil {
+		var err error
+
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.lock.Lock()
+
+	t.calls = append(t.calls, Call{
+		Method: req.Method,
+		URL:    req.URL,
+		Header: req.Header.Clone(),
+		Body:   body,
+	})
+
+	var matched *Mock
+
+	for _, m := range t.mocks {
+		if m.match(req, body) {
+			m.calls++
+			matched = m
+			break
+		}
+	}
+
+	fallback := t.Fallback
+	t.lock.Unlock()
+
+	if matched == nil {
+		if fallback != nil {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			return fallback.RoundTrip(req)
+		}
+
+		return nil, fmt.Errorf("No mock for %v %v", req.Method, req.URL)
+	}
+
+	if matched.err != nil {
+		return nil, matched.err
+	}
+
+	return matched.response(req), nil
+}
+
+// Return the recorded requests
+func (t *MockTransport) Calls() []Call {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return append([]Call(nil), t.calls...)
+}
+
+// Return the number of recorded requests for the method and path (same rules as On)
+func (t *MockTransport) CallCount(method, path string) int {
+	n := 0
+
+	for _, c := range t.Calls() {
+		if (method == "" || strings.EqualFold(method, c.Method)) && matchPath(path, c.URL.Path) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Remove all the mocks and recorded requests
+func (t *MockTransport) Reset() {
+	t.lock.Lock()
+	t.mocks = nil
+	t.calls = nil
+	t.lock.Unlock()
+}
+
+// Fail the test if no request was sent for the method and path
+func (t *MockTransport) AssertCalled(tb testing.TB, method, path string) {
+	tb.Helper()
+
+	if t.CallCount(method, path) == 0 {
+		tb.Errorf("expected call to %v %v", method, path)
+	}
+}
+
+// Fail the test if any request was sent for the method and path
+func (t *MockTransport) AssertNotCalled(tb testing.TB, method, path string) {
+	tb.Helper()
+
+	if n := t.CallCount(method, path); n > 0 {
+		tb.Errorf("unexpected %v calls to %v %v", n, method, path)
+	}
+}
+
+// Fail the test if any of the mocks was not called
+// (or called less than the expected number of times, for mocks with Times)
+func (t *MockTransport) AssertExpectations(tb testing.TB) {
+	tb.Helper()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, m := range t.mocks {
+		if m.calls == 0 || (m.times > 0 && m.calls < m.times) {
+			expected := m.times
+			if expected == 0 {
+				expected = 1
+			}
+
+			tb.Errorf("mock %v: expected %v calls, got %v", m, expected, m.calls)
+		}
+	}
+}
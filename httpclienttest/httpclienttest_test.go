@@ -0,0 +1,65 @@
+package httpclienttest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gobs/httpclient"
+)
+
+func TestMockTransport(test *testing.T) {
+	client, mock := NewClient("http://api.example.com")
+
+	mock.On("GET", "/users/1").RespondJSON(200, map[string]interface{}{"id": 1, "name": "test"})
+	mock.On("GET", "/users/*").Respond(404, "not found")
+	mock.On("POST", "/users").WithJSONBody(map[string]interface{}{"name": "new"}).Respond(201, "")
+	mock.On("GET", "/search").WithQuery("q", "x").Times(1).Respond(200, "found")
+	mock.On("GET", "/down").RespondError(errors.New("connection refused"))
+
+	var user struct {
+		Id   int
+		Name string
+	}
+
+	resp, err := client.SendRequest(client.Path("/users/1"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := resp.JsonDecode(&user, false); err != nil || user.Name != "test" {
+		test.Error("unexpected user", user, err)
+	}
+
+	resp, err = client.SendRequest(client.Path("/users/2"))
+	if err != nil || resp.StatusCode != 404 {
+		test.Error("expected 404, got", resp, err)
+	}
+	resp.Close()
+
+	resp, err = client.SendRequest(httpclient.POST, client.Path("/users"), httpclient.Body(strings.NewReader(`{ "name": "new" }`)))
+	if err != nil || resp.StatusCode != 201 {
+		test.Error("expected 201, got", resp, err)
+	}
+	resp.Close()
+
+	resp, err = client.SendRequest(client.Path("/search"), httpclient.StringParams(map[string]string{"q": "x"}))
+	if err != nil || string(resp.Content()) != "found" {
+		test.Error("unexpected search response", err)
+	}
+
+	if _, err = client.SendRequest(client.Path("/search"), httpclient.StringParams(map[string]string{"q": "x"})); err == nil {
+		test.Error("expected no match after Times(1)")
+	}
+
+	if _, err = client.SendRequest(client.Path("/down")); err == nil {
+		test.Error("expected error")
+	}
+
+	mock.AssertCalled(test, "GET", "/users/1")
+	mock.AssertNotCalled(test, "DELETE", "/users/1")
+	mock.AssertExpectations(test)
+
+	if n := mock.CallCount("GET", "/search"); n != 2 {
+		test.Error("expected 2 search calls, got", n)
+	}
+}
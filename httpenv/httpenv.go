@@ -0,0 +1,351 @@
+// Package httpenv loads named environments (base URL, headers, authentication, TLS)
+// from a YAML or JSON file and returns HttpClients configured for them.
+//
+//	default: dev
+//	environments:
+//	  dev:
+//	    base_url: http://localhost:8080/api/
+//	  prod:
+//	    base_url: https://api.example.com/
+//	    headers:
+//	      X-Api-Key: ${env:API_KEY}
+//	    auth:
+//	      type: bearer
+//	      token: ${file:/run/secrets/token}
+//	    tls:
+//	      ca_file: /etc/ssl/example-ca.pem
+//	    timeout: 10s
+//
+// String values can reference secrets as ${env:NAME} (or ${NAME}) for environment variables
+// and ${file:path} for the content of a file.
+package httpenv
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gobs/httpclient"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	NoEnvironment = errors.New("No environment specified")
+
+	reSecret = regexp.MustCompile(`\$\{(?:(env|file):)?([^}]+)\}`)
+)
+
+// Authentication configuration
+type Auth struct {
+	Type     string `json:"type" yaml:"type"` // basic, bearer or digest
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	Token    string `json:"token,omitempty" yaml:"token,omitempty"`
+}
+
+// TLS configuration
+type TLS struct {
+	Insecure   bool   `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+	CAFile     string `json:"ca_file,omitempty" yaml:"ca_file,omitempty"`
+	CertFile   string `json:"cert_file,omitempty" yaml:"cert_file,omitempty"`
+	KeyFile    string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+	ServerName string `json:"server_name,omitempty" yaml:"server_name,omitempty"`
+}
+
+// A named environment
+type Environment struct {
+	Name      string            `json:"-" yaml:"-"`
+	BaseURL   string            `json:"base_url" yaml:"base_url"`
+	Headers   map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty" yaml:"user_agent,omitempty"`
+	Timeout   string            `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Auth      *Auth             `json:"auth,omitempty" yaml:"auth,omitempty"`
+	TLS       *TLS              `json:"tls,omitempty" yaml:"tls,omitempty"`
+}
+
+// A set of environments
+type Config struct {
+	Default      string                  `json:"default,omitempty" yaml:"default,omitempty"`
+	Environments map[string]*Environment `json:"environments" yaml:"environments"`
+}
+
+// Load reads the environments from a YAML (.yaml, .yml) or JSON file
+func Load(filename string) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	return Parse(data, ext == ".yaml" || ext == ".yml")
+}
+
+// Parse parses the environments definitions, in YAML or JSON format
+func Parse(data []byte, isYaml bool) (*Config, error) {
+	var config Config
+	var err error
+
+	if isYaml {
+		err = yaml.Unmarshal(data, &config)
+	} else {
+		err = json.Unmarshal(data, &config)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for name, env := range config.Environments {
+		if env == nil {
+			env = &Environment{}
+			config.Environments[name] = env
+		}
+
+		env.Name = name
+	}
+
+	return &config, nil
+}
+
+// Names returns the sorted list of environment names
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Environments))
+	for name := range c.Environments {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the named environment (the default environment if name is empty),
+// with the secret references resolved
+func (c *Config) Get(name string) (*Environment, error) {
+	if name == "" {
+		name = c.Default
+	}
+
+	if name == "" {
+		return nil, NoEnvironment
+	}
+
+	env, ok := c.Environments[name]
+	if !ok {
+		return nil, fmt.Errorf("Environment not found: %v", name)
+	}
+
+	return env.Resolve()
+}
+
+// Client returns a new HttpClient for the named environment (the default environment if name is empty)
+func (c *Config) Client(name string) (*httpclient.HttpClient, error) {
+	env, err := c.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return env.Client()
+}
+
+// Resolve returns a copy of the environment with the secret references resolved
+func (e *Environment) Resolve() (*Environment, error) {
+	var err error
+
+	expand := func(s string) string {
+		if err != nil {
+			return s
+		}
+
+		var v string
+		v, err = Expand(s)
+		return v
+	}
+
+	r := &Environment{
+		Name:      e.Name,
+		BaseURL:   expand(e.BaseURL),
+		UserAgent: expand(e.UserAgent),
+		Timeout:   expand(e.Timeout),
+	}
+
+	if e.Headers != nil {
+		r.Headers = make(map[string]string, len(e.Headers))
+		for k, v := range e.Headers {
+			r.Headers[k] = expand(v)
+		}
+	}
+
+	if e.Auth != nil {
+		r.Auth = &Auth{
+			Type:     expand(e.Auth.Type),
+			Username: expand(e.Auth.Username),
+			Password: expand(e.Auth.Password),
+			Token:    expand(e.Auth.Token),
+		}
+	}
+
+	if e.TLS != nil {
+		r.TLS = &TLS{
+			Insecure:   e.TLS.Insecure,
+			CAFile:     expand(e.TLS.CAFile),
+			CertFile:   expand(e.TLS.CertFile),
+			KeyFile:    expand(e.TLS.KeyFile),
+			ServerName: expand(e.TLS.ServerName),
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Environment %v: %v", e.Name, err)
+	}
+
+	return r, nil
+}
+
+// Client returns a new HttpClient configured for the environment
+func (e *Environment) Client() (*httpclient.HttpClient, error) {
+	client, err := httpclient.NewHttpClientE("")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.Apply(client); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Apply configures the client for the environment (base URL, headers, authentication, TLS and timeout).
+// The secret references should be already resolved (see Resolve).
+func (e *Environment) Apply(client *httpclient.HttpClient) error {
+	if err := client.SetBase(e.BaseURL); err != nil {
+		return err
+	}
+
+	for k, v := range e.Headers {
+		client.Headers[k] = v
+	}
+
+	if e.UserAgent != "" {
+		client.UserAgent = e.UserAgent
+	}
+
+	if e.Auth != nil {
+		switch strings.ToLower(e.Auth.Type) {
+		case "basic":
+			client.SetBasicAuth(e.Auth.Username, e.Auth.Password)
+		case "bearer":
+			client.SetBearerToken(e.Auth.Token)
+		case "digest":
+			client.SetDigestAuth(e.Auth.Username, e.Auth.Password)
+		case "", "none":
+			client.ClearAuth()
+		default:
+			return fmt.Errorf("Unsupported authentication type %q", e.Auth.Type)
+		}
+	}
+
+	if e.TLS != nil {
+		config, err := e.TLS.Config()
+		if err != nil {
+			return err
+		}
+
+		tr, ok := httpclient.DefaultTransport.(*http.Transport)
+		if !ok {
+			return fmt.Errorf("Cannot set the TLS configuration on %T", httpclient.DefaultTransport)
+		}
+
+		tr = tr.Clone()
+		tr.TLSClientConfig = config
+		client.SetTransport(tr)
+	}
+
+	if e.Timeout != "" {
+		t, err := time.ParseDuration(e.Timeout)
+		if err != nil {
+			return err
+		}
+
+		client.SetTimeout(t)
+	}
+
+	return nil
+}
+
+// Config returns the tls.Config for the TLS configuration
+func (t *TLS) Config() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: t.Insecure,
+		ServerName:         t.ServerName,
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %v", t.CAFile)
+		}
+
+		config.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// Expand replaces the secret references in s: ${env:NAME} or ${NAME} with the value of the
+// environment variable and ${file:path} with the content of the file (without trailing newlines).
+func Expand(s string) (string, error) {
+	var err error
+
+	res := reSecret.ReplaceAllStringFunc(s, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+
+		m := reSecret.FindStringSubmatch(ref)
+		kind, name := m[1], strings.TrimSpace(m[2])
+
+		if kind == "file" {
+			b, ferr := os.ReadFile(name)
+			if ferr != nil {
+				err = ferr
+				return ref
+			}
+
+			return strings.TrimRight(string(b), "\r\n")
+		}
+
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			err = fmt.Errorf("Undefined environment variable %v", name)
+			return ref
+		}
+
+		return v
+	})
+
+	return res, err
+}
@@ -0,0 +1,75 @@
+package httpenv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvironments(test *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-token" || r.Header.Get("X-Api-Key") != "key1" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+
+	tokenFile := filepath.Join(test.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret-token\n"), 0600); err != nil {
+		test.Fatal(err)
+	}
+
+	os.Setenv("HTTPENV_TEST_KEY", "key1")
+	defer os.Unsetenv("HTTPENV_TEST_KEY")
+
+	config, err := Parse([]byte(`{
+		"default": "test",
+		"environments": {
+			"test": {
+				"base_url": "`+ts.URL+`/api/",
+				"headers": {"X-Api-Key": "${env:HTTPENV_TEST_KEY}"},
+				"auth": {"type": "bearer", "token": "${file:`+tokenFile+`}"},
+				"timeout": "5s"
+			},
+			"missing": {
+				"base_url": "${HTTPENV_TEST_UNDEFINED}"
+			}
+		}
+	}`), false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if names := config.Names(); len(names) != 2 || names[0] != "missing" || names[1] != "test" {
+		test.Error("unexpected names", names)
+	}
+
+	client, err := config.Client("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if client.BaseURL.String() != ts.URL+"/api/" || client.GetTimeout().Seconds() != 5 {
+		test.Error("unexpected client configuration", client.BaseURL, client.GetTimeout())
+	}
+
+	resp, err := client.Get("users", nil, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+	resp.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		test.Error("expected 200, got", resp.Status)
+	}
+
+	if _, err := config.Get("missing"); err == nil {
+		test.Error("expected error for undefined variable")
+	}
+
+	if _, err := config.Get("other"); err == nil {
+		test.Error("expected error for unknown environment")
+	}
+}
@@ -1,18 +1,27 @@
 package httpclient
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 // HttpFile is a file-like object that allows reading and seeking from an
-// http resources (via an HTTP GET with Range request)
+// http resources (via an HTTP GET with Range request), or a resource
+// for a registered URL scheme (see RegisterScheme)
 type HttpFile struct {
 	Url     string
 	Headers map[string]string
@@ -20,14 +29,42 @@ type HttpFile struct {
 
 	Buffer []byte
 
-	origUrl string
-	client  *http.Client
-	pos     int64
-	flen    int64
+	origUrl   string
+	client    *http.Client
+	transport http.RoundTripper
+	logger    *log.Logger
+	pos       int64
+	flen      int64
+	mtime     time.Time
+
+	noHead      bool
+	retries     int
+	retryWait   time.Duration
+	retryErrors bool // retry on network errors and truncated responses (only if set with FileRetries)
+	backoff     float64
+	retryStatus []int
 
 	bpos   int64 // seek position for buffered reads
 	bstart int   // first available byte in buffer
 	bend   int   // last available byte in buffer
+
+	readAhead int
+	prefetch  map[int64]*prefetchBlock
+	pwg       sync.WaitGroup
+
+	chunkSize int
+	parallel  int
+
+	ulock sync.Mutex // protects Url, that can change on redirect
+}
+
+// a buffer being read in background
+type prefetchBlock struct {
+	data   []byte
+	n      int
+	err    error
+	done   chan struct{}
+	cancel context.CancelFunc
 }
 
 // HttpFileError wraps a network error
@@ -39,8 +76,13 @@ func (e *HttpFileError) Error() string {
 	return "HttpFileError: " + e.Err.Error()
 }
 
+func (e *HttpFileError) Unwrap() error {
+	return e.Err
+}
+
 func (e *HttpFileError) Temporary() bool {
-	if ue, ok := e.Err.(*url.Error); ok {
+	var ue *url.Error
+	if errors.As(e.Err, &ue) {
 		return ue.Temporary()
 	}
 
@@ -48,7 +90,8 @@ func (e *HttpFileError) Temporary() bool {
 }
 
 func (e *HttpFileError) Timeout() bool {
-	if ue, ok := e.Err.(*url.Error); ok {
+	var ue *url.Error
+	if errors.As(e.Err, &ue) {
 		return ue.Timeout()
 	}
 
@@ -57,29 +100,125 @@ func (e *HttpFileError) Timeout() bool {
 
 type headersType map[string]string
 
+// Default values for HttpFile options
 var HttpFileNoHead = false
 var HttpFileRetries = 10
 var HttpFileRetryWait = 60 * time.Second
 
+// HttpFileOption configures an HttpFile (see OpenHttpFile)
+type HttpFileOption func(f *HttpFile)
+
+// Use the specified http.Client (redirects are still handled by HttpFile)
+func FileClient(client *http.Client) HttpFileOption {
+	return func(f *HttpFile) {
+		c := *client
+		c.CheckRedirect = f.client.CheckRedirect
+		f.client = &c
+	}
+}
+
+// Use the specified transport (also with the http.Client set with FileClient, regardless of the order of the options)
+func FileTransport(tr http.RoundTripper) HttpFileOption {
+	return func(f *HttpFile) {
+		f.transport = tr
+	}
+}
+
+// Write the debug and retry messages to the logger (nil: the standard logger)
+func FileLogger(l *log.Logger) HttpFileOption {
+	return func(f *HttpFile) {
+		f.logger = l
+	}
+}
+
+// Don't use HEAD requests to get the file size (some servers don't support HEAD)
+func FileNoHead(nohead bool) HttpFileOption {
+	return func(f *HttpFile) {
+		f.noHead = nohead
+	}
+}
+
+// Set the max number of retries and the wait time before the first retry.
+// The requests are retried on the status codes set with FileRetryStatus and, only with this option,
+// on network errors (but not if the connection is refused) and truncated responses
+func FileRetries(retries int, wait time.Duration) HttpFileOption {
+	return func(f *HttpFile) {
+		f.retries = retries
+		f.retryWait = wait
+		f.retryErrors = true
+	}
+}
+
+// Multiply the retry wait time by factor after each retry (exponential backoff)
+func FileBackoff(factor float64) HttpFileOption {
+	return func(f *HttpFile) {
+		f.backoff = factor
+	}
+}
+
+// Retry requests that return one of the specified status codes
+// (i.e. 429, 502, 503, 504)
+func FileRetryStatus(codes ...int) HttpFileOption {
+	return func(f *HttpFile) {
+		f.retryStatus = append(f.retryStatus, codes...)
+	}
+}
+
+// Use a read buffer of the specified size
+func FileBuffer(size int) HttpFileOption {
+	return func(f *HttpFile) {
+		f.Buffer = make([]byte, size)
+	}
+}
+
+// Prefetch the next n buffers in background, while the current one is consumed.
+// This requires a read buffer (see FileBuffer)
+func FileReadAhead(n int) HttpFileOption {
+	return func(f *HttpFile) {
+		f.readAhead = n
+	}
+}
+
+// Split ReadAt requests larger than chunk bytes in multiple range requests,
+// executed with up to parallel concurrent requests
+func FileParallelRanges(chunk, parallel int) HttpFileOption {
+	return func(f *HttpFile) {
+		f.chunkSize = chunk
+		f.parallel = parallel
+	}
+}
+
 // Creates an HttpFile object. At this point the "file" is "open"
-func OpenHttpFile(url string, headers map[string]string) (*HttpFile, error) {
+func OpenHttpFile(url string, headers map[string]string, options ...HttpFileOption) (*HttpFile, error) {
 	client := &http.Client{
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return NoRedirect
 		},
 	}
 
-	f := HttpFile{Url: url, Headers: headers, origUrl: url, client: client, pos: 0, flen: -1}
+	f := HttpFile{Url: url, Headers: headers, origUrl: url, client: client, pos: 0, flen: -1,
+		noHead:    HttpFileNoHead,
+		retries:   HttpFileRetries,
+		retryWait: HttpFileRetryWait,
+	}
+
+	for _, opt := range options {
+		opt(&f)
+	}
+
+	if f.transport != nil {
+		f.client.Transport = f.transport
+	}
 
 	hmethod := "HEAD"
 	var hheaders map[string]string
 
-	if HttpFileNoHead { // some servers don't support HEAD, try with a GET of 0 bytes (actually 1)
+	if f.noHead { // some servers don't support HEAD, try with a GET of 0 bytes (actually 1)
 		hmethod = "GET"
 		hheaders = headersType{"Range": "bytes=0-0"}
 	}
 
-	resp, err := f.do(hmethod, hheaders)
+	resp, err := f.do(context.Background(), hmethod, hheaders)
 	defer CloseResponse(resp)
 
 	if err != nil {
@@ -88,6 +227,8 @@ func OpenHttpFile(url string, headers map[string]string) (*HttpFile, error) {
 	if resp.StatusCode == http.StatusNotFound {
 		return nil, os.ErrNotExist
 	}
+	f.mtime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+
 	if resp.StatusCode == http.StatusOK {
 		f.flen = resp.ContentLength
 	} else if resp.StatusCode == http.StatusPartialContent {
@@ -104,9 +245,9 @@ func OpenHttpFile(url string, headers map[string]string) (*HttpFile, error) {
 	return &f, nil
 }
 
-func (f *HttpFile) do(method string, headers map[string]string) (*http.Response, error) {
+func (f *HttpFile) do(ctx context.Context, method string, headers map[string]string) (*http.Response, error) {
 retry_redir:
-	req, err := http.NewRequest(method, f.Url, nil)
+	req, err := http.NewRequestWithContext(ctx, method, f.getUrl(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -123,30 +264,51 @@ retry_redir:
 	retry := 0
 
 	for {
-		res, err := f.client.Do(req)
-		if uerr, ok := err.(*url.Error); ok && uerr.Err == NoRedirect {
+		res, err := f.send(req)
+		if errors.Is(err, NoRedirect) {
 			if redirect { // we already redirected once
 				return res, err
 			}
 
 			redirect = true
-			f.Url = res.Header.Get("Location")
+			CloseResponse(res)
+
+			loc, err := req.URL.Parse(res.Header.Get("Location")) // the location can be relative
+			if err != nil {
+				return nil, err
+			}
+
+			f.setUrl(loc.String())
 			goto retry_redir
 		}
 
 		if err != nil {
+			retry++
+
+			if f.retryErrors && retry < f.retries && retryableFileError(err) {
+				f.debugLog().Println("Retry", retry, "error", err)
+				CloseResponse(res)
+				if err := sleepContext(ctx, f.retryDelay(retry)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
 			return res, err
 		}
 
 		if res.StatusCode == 403 {
 			if res.Header.Get("X-Cache") == "Error from cloudfront" {
-				log.Println(req, err)
+				stdLogger(f.logger).Println(req, err)
 
 				retry++
 
-				if retry < HttpFileRetries {
-					log.Println("Retry", retry, "Sleep...")
-					time.Sleep(HttpFileRetryWait)
+				if retry < f.retries {
+					stdLogger(f.logger).Println("Retry", retry, "Sleep...")
+					CloseResponse(res)
+					if err := sleepContext(ctx, f.retryDelay(retry)); err != nil {
+						return nil, err
+					}
 					continue
 				}
 			} else if res.Header.Get("X-AMZ-Request-ID") != "" {
@@ -155,32 +317,151 @@ retry_redir:
 				if err == nil {
 					errbody := string(buf[:n])
 
-					log.Println(req, err, errbody)
+					stdLogger(f.logger).Println(req, err, errbody)
 
 					if strings.Contains(errbody, `<Message>Request has expired</Message>`) &&
-						f.Url != f.origUrl { // retry redirect
-						log.Println("Retry redirect")
-						f.Url = f.origUrl
+						f.getUrl() != f.origUrl { // retry redirect
+						stdLogger(f.logger).Println("Retry redirect")
+						f.setUrl(f.origUrl)
 						goto retry_redir
 					}
 				}
 			}
+		} else if f.retryable(res.StatusCode) {
+			retry++
+
+			if retry < f.retries {
+				f.debugLog().Println("Retry", retry, "status", res.Status)
+				CloseResponse(res)
+				if err := sleepContext(ctx, f.retryDelay(retry)); err != nil {
+					return nil, err
+				}
+				continue
+			}
 		}
 
 		return res, err
 	}
 }
 
-func (f *HttpFile) getContentRange(resp *http.Response) (first, last, total int64, err error) {
-	content_range := resp.Header.Get("Content-Range")
+// send the request via the client, or the registered handler for the URL scheme (see RegisterScheme)
+func (f *HttpFile) send(req *http.Request) (*http.Response, error) {
+	if h, ok := schemeHandler(req.URL); ok {
+		return fetchScheme(h, req)
+	}
 
-	n, err := fmt.Sscanf(content_range, "bytes %d-%d/%d", &first, &last, &total)
+	return f.client.Do(req)
+}
+
+// the logger for the debug messages (if Debug is set)
+func (f *HttpFile) debugLog() DebugLogger {
+	return DebugLogger{Enabled: f.Debug, Logger: f.logger}
+}
+
+func (f *HttpFile) getUrl() string {
+	f.ulock.Lock()
+	defer f.ulock.Unlock()
+	return f.Url
+}
+
+func (f *HttpFile) setUrl(u string) {
+	f.ulock.Lock()
+	f.Url = u
+	f.ulock.Unlock()
+}
+
+func (f *HttpFile) retryable(status int) bool {
+	for _, s := range f.retryStatus {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// network errors and truncated responses can be retried (but not a refused connection, that usually won't succeed)
+func retryableFileError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, syscall.ECONNREFUSED) {
+		return false
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) { // connection closed
+		return true
+	}
+
+	var ue *url.Error
+	if errors.As(err, &ue) { // the client errors are all url.Error, check the wrapped one
+		err = ue.Err
+	}
+
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// returns the wait time before the specified retry
+func (f *HttpFile) retryDelay(retry int) time.Duration {
+	wait := f.retryWait
+
+	for i := 1; i < retry && f.backoff > 1; i++ {
+		wait = time.Duration(float64(wait) * f.backoff)
+	}
+
+	return wait
+}
+
+func (f *HttpFile) getContentRange(resp *http.Response) (first, last, total int64, err error) {
+	first, last, total, err = ParseContentRange(resp.Header.Get("Content-Range"))
 	if err != nil {
-		DebugLog(f.Debug).Println("Error", err)
-		return -1, -1, -1, err
+		f.debugLog().Println("Error", err)
+		return -1, -1, -1, &HttpFileError{Err: err}
 	}
-	if n != 3 {
-		return -1, -1, -1, &HttpFileError{Err: fmt.Errorf("Unexpected Content-Range %q (%d)", content_range, n)}
+
+	return first, last, total, nil
+}
+
+// ParseContentRange parses a Content-Range header ("bytes first-last/total") and returns the first and last byte positions
+// and the total size (-1 if the total is "*", unknown).
+func ParseContentRange(content_range string) (first, last, total int64, err error) {
+	invalid := func() (int64, int64, int64, error) {
+		return -1, -1, -1, fmt.Errorf("Unexpected Content-Range %q", content_range)
+	}
+
+	unit, rest, ok := strings.Cut(strings.TrimSpace(content_range), " ")
+	if !ok || !strings.EqualFold(unit, "bytes") {
+		return invalid()
+	}
+
+	brange, size, ok := strings.Cut(strings.TrimSpace(rest), "/")
+	if !ok {
+		return invalid()
+	}
+
+	sfirst, slast, ok := strings.Cut(brange, "-")
+	if !ok {
+		return invalid()
+	}
+
+	parse := func(s string) (int64, bool) {
+		if s == "" || s[0] < '0' || s[0] > '9' { // no signs or spaces
+			return 0, false
+		}
+
+		n, err := strconv.ParseInt(s, 10, 64)
+		return n, err == nil
+	}
+
+	if first, ok = parse(sfirst); !ok {
+		return invalid()
+	}
+	if last, ok = parse(slast); !ok || last < first {
+		return invalid()
+	}
+
+	if size == "*" {
+		total = -1
+	} else if total, ok = parse(size); !ok || last >= total {
+		return invalid()
 	}
 
 	return first, last, total, nil
@@ -188,12 +469,111 @@ func (f *HttpFile) getContentRange(resp *http.Response) (first, last, total int6
 
 // Returns the file size
 func (f *HttpFile) Size() int64 {
-	DebugLog(f.Debug).Println("Size", f.flen)
+	f.debugLog().Println("Size", f.flen)
 	return f.flen
 }
 
-func (f *HttpFile) readAt(p []byte, off int64) (int, error) {
-	DebugLog(f.Debug).Println("readAt", off, len(p))
+// Returns the file modification time (from the Last-Modified header, if available)
+func (f *HttpFile) ModTime() time.Time {
+	return f.mtime
+}
+
+// The fs.File interface
+func (f *HttpFile) Stat() (fs.FileInfo, error) {
+	if f.client == nil {
+		return nil, os.ErrInvalid
+	}
+
+	name := f.origUrl
+	if u, err := url.Parse(name); err == nil {
+		name = path.Base(u.Path)
+	}
+
+	return &fileInfo{name: name, size: f.flen, mtime: f.mtime}, nil
+}
+
+// read p from the file, splitting the request in parallel range requests if needed
+func (f *HttpFile) readAt(ctx context.Context, p []byte, off int64) (int, error) {
+	if f.chunkSize <= 0 || len(p) <= f.chunkSize || f.client == nil || off >= f.flen {
+		return f.readRange(ctx, p, off)
+	}
+
+	plen := len(p)
+	if rem := f.flen - off; rem < int64(plen) {
+		plen = int(rem)
+	}
+
+	parallel := f.parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+
+	nchunks := (plen + f.chunkSize - 1) / f.chunkSize
+	counts := make([]int, nchunks)
+	errs := make([]error, nchunks)
+	sem := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < nchunks; i++ {
+		start := i * f.chunkSize
+		end := start + f.chunkSize
+		if end > plen {
+			end = plen
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i, start, end int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			counts[i], errs[i] = f.readRange(ctx, p[start:end], off+int64(start))
+		}(i, start, end)
+	}
+
+	wg.Wait()
+
+	n := 0
+
+	for i := range counts {
+		n += counts[i]
+
+		if errs[i] != nil {
+			return n, errs[i]
+		}
+		if n < (i+1)*f.chunkSize && n < plen { // short read
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+
+	f.debugLog().Println("readAt", nchunks, "chunks", n)
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// read p from the file with a single range request, retrying if the response is truncated
+func (f *HttpFile) readRange(ctx context.Context, p []byte, off int64) (int, error) {
+	for retry := 1; ; retry++ {
+		n, err := f.readRangeOnce(ctx, p, off)
+		if err != io.ErrUnexpectedEOF || !f.retryErrors || retry >= f.retries {
+			return n, err
+		}
+
+		f.debugLog().Println("Retry", retry, "truncated response", n)
+		if err := sleepContext(ctx, f.retryDelay(retry)); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (f *HttpFile) readRangeOnce(ctx context.Context, p []byte, off int64) (int, error) {
+	f.debugLog().Println("readRange", off, len(p))
 
 	if f.client == nil {
 		return 0, os.ErrInvalid
@@ -205,39 +585,45 @@ func (f *HttpFile) readAt(p []byte, off int64) (int, error) {
 	}
 
 	end := off + int64(plen)
-	if end > f.flen {
+	if f.flen >= 0 && end > f.flen {
 		end = f.flen
 	}
 
 	bytes_range := fmt.Sprintf("bytes=%d-%d", off, end-1)
-	resp, err := f.do("GET", headersType{"Range": bytes_range})
+	resp, err := f.do(ctx, "GET", headersType{"Range": bytes_range})
 	defer CloseResponse(resp)
 
 	switch {
 	case err != nil:
-		DebugLog(f.Debug).Println("readAt error", err)
+		f.debugLog().Println("readRange error", err)
 		return 0, &HttpFileError{Err: err}
 
 	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
-		DebugLog(f.Debug).Println("readAt http.StatusRequestedRangeNotSatisfiable")
+		f.debugLog().Println("readRange http.StatusRequestedRangeNotSatisfiable")
 		return 0, io.EOF
 
 	case resp.StatusCode != http.StatusPartialContent:
-		DebugLog(f.Debug).Println("readAt error", resp.Status)
+		f.debugLog().Println("readRange error", resp.Status)
 		return 0, &HttpFileError{Err: fmt.Errorf("Unexpected Status %s", resp.Status)}
 	}
 
 	first, last, total, err := f.getContentRange(resp)
-	DebugLog(f.Debug).Println("Range", bytes_range, "Content-Range", first, last, total)
+	f.debugLog().Println("Range", bytes_range, "Content-Range", first, last, total)
 
 	n, err := io.ReadFull(resp.Body, p)
 	if n > 0 && err == io.EOF {
 		// read reached EOF, but archive/zip doesn't like this!
-		DebugLog(f.Debug).Println("readAt", n, "reached EOF")
+		f.debugLog().Println("readRange", n, "reached EOF")
 		err = nil
+	} else if err == io.ErrUnexpectedEOF && f.flen >= 0 && off+int64(n) >= f.flen {
+		// short read at the end of the file
+		err = io.EOF
+	} else if err == io.ErrUnexpectedEOF && f.flen < 0 && (resp.ContentLength < 0 || int64(n) >= resp.ContentLength) {
+		// complete but short response: this is the end of a file of unknown size
+		err = io.EOF
 	}
 
-	DebugLog(f.Debug).Println("readAt", n, err)
+	f.debugLog().Println("readRange", n, err)
 	return n, err
 }
 
@@ -246,7 +632,7 @@ func (f *HttpFile) readFromBuffer(p []byte, off int64) (int, error) {
 	plen := len(p)
 
 	if plen == 0 {
-		DebugLog(f.Debug).Println("readFrom", off, "zero bbuffer")
+		f.debugLog().Println("readFrom", off, "zero bbuffer")
 		return 0, nil
 	}
 
@@ -260,9 +646,9 @@ func (f *HttpFile) readFromBuffer(p []byte, off int64) (int, error) {
 			drop := int(off - f.bpos)
 			f.bstart += drop
 
-			DebugLog(f.Debug).Println("readFrom", off, "pos", f.bpos, "drop", drop, "bytes, saved", blen-drop, "bytes")
+			f.debugLog().Println("readFrom", off, "pos", f.bpos, "drop", drop, "bytes, saved", blen-drop, "bytes")
 		} else {
-			DebugLog(f.Debug).Println("readFrom", off, "pos", f.bpos, "dropping", blen, "bytes")
+			f.debugLog().Println("readFrom", off, "pos", f.bpos, "dropping", blen, "bytes")
 
 			f.bstart = 0
 			f.bend = 0
@@ -272,7 +658,7 @@ func (f *HttpFile) readFromBuffer(p []byte, off int64) (int, error) {
 	}
 
 	for ppos < plen {
-		DebugLog(f.Debug).Println("readFromBuffer", ppos, plen, "pos", f.bpos)
+		f.debugLog().Println("readFromBuffer", ppos, plen, "pos", f.bpos)
 
 		if f.bstart < f.bend { // there is already some data
 			n := copy(p[ppos:], f.Buffer[f.bstart:f.bend])
@@ -282,7 +668,7 @@ func (f *HttpFile) readFromBuffer(p []byte, off int64) (int, error) {
 			ppos += n
 
 			if ppos >= plen {
-				DebugLog(f.Debug).Println("readFromBuffer", ppos, "done", "pos", f.bpos)
+				f.debugLog().Println("readFromBuffer", ppos, "done", "pos", f.bpos)
 				return ppos, nil
 			}
 		}
@@ -291,53 +677,214 @@ func (f *HttpFile) readFromBuffer(p []byte, off int64) (int, error) {
 			f.bstart = 0
 			f.bend = 0
 
-			return f.readAt(p[ppos:], f.bpos)
+			return f.readAt(context.Background(), p[ppos:], f.bpos)
 		}
 
-		n, err := f.readAt(f.Buffer, f.bpos)
+		n, err := f.fillBuffer(f.bpos)
 
 		f.bstart = 0
 		f.bend = n
 
 		if err != nil && n == 0 { // don't return an error if we read something
-			DebugLog(f.Debug).Println("readFromBuffer", "error", err)
+			f.debugLog().Println("readFromBuffer", "error", err)
 			return 0, err
 		}
 	}
 
-	log.Println("ppos", ppos, "plen", plen, "bstart", f.bstart, "bend", f.bend)
+	stdLogger(f.logger).Println("ppos", ppos, "plen", plen, "bstart", f.bstart, "bend", f.bend)
 
 	panic("should not get here")
 	return 0, nil
 }
 
+// fill the buffer with data from the specified position, using the prefetched
+// block if available, and start prefetching the next ones
+func (f *HttpFile) fillBuffer(off int64) (int, error) {
+	if f.readAhead <= 0 {
+		return f.readAt(context.Background(), f.Buffer, off)
+	}
+
+	var n int
+	var err error
+
+	if b, ok := f.prefetch[off]; ok && len(b.data) == len(f.Buffer) {
+		<-b.done
+
+		if b.err != nil && b.n == 0 { // try again
+			n, err = f.readAt(context.Background(), f.Buffer, off)
+		} else {
+			f.debugLog().Println("fillBuffer", off, "prefetched", b.n)
+			n, err = copy(f.Buffer, b.data[:b.n]), b.err
+		}
+	} else {
+		n, err = f.readAt(context.Background(), f.Buffer, off)
+	}
+
+	blen := int64(len(f.Buffer))
+	last := off + blen*int64(f.readAhead)
+
+	f.cancelPrefetch(func(boff int64) bool {
+		return boff <= off || boff > last // not needed anymore
+	})
+
+	if f.prefetch == nil {
+		f.prefetch = make(map[int64]*prefetchBlock)
+	}
+
+	for boff := off + blen; boff <= last && (f.flen < 0 || boff < f.flen); boff += blen {
+		if _, ok := f.prefetch[boff]; !ok {
+			f.prefetch[boff] = f.startPrefetch(boff)
+		}
+	}
+
+	return n, err
+}
+
+func (f *HttpFile) startPrefetch(off int64) *prefetchBlock {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &prefetchBlock{data: make([]byte, len(f.Buffer)), done: make(chan struct{}), cancel: cancel}
+
+	f.pwg.Add(1)
+
+	go func() {
+		defer f.pwg.Done()
+		defer close(b.done)
+		defer cancel()
+
+		b.n, b.err = f.readAt(ctx, b.data, off)
+	}()
+
+	return b
+}
+
+// cancel and remove the prefetched blocks at the offsets selected by drop
+func (f *HttpFile) cancelPrefetch(drop func(off int64) bool) {
+	for boff, b := range f.prefetch {
+		if drop(boff) {
+			b.cancel()
+			delete(f.prefetch, boff)
+		}
+	}
+}
+
 // The ReaderAt interface
 func (f *HttpFile) ReadAt(p []byte, off int64) (int, error) {
-	DebugLog(f.Debug).Println("ReadAt", off, "len", len(p))
+	f.debugLog().Println("ReadAt", off, "len", len(p))
 
 	if f.Buffer != nil {
 		return f.readFromBuffer(p, off)
 	}
 
-	return f.readAt(p, off)
+	return f.readAt(context.Background(), p, off)
 }
 
 // The Reader interface
 func (f *HttpFile) Read(p []byte) (int, error) {
-	DebugLog(f.Debug).Println("Read from", f.pos, "len", len(p))
+	f.debugLog().Println("Read from", f.pos, "len", len(p))
+
+	if f.client != nil && f.flen >= 0 && f.pos >= f.flen { // with an unknown size, read until a short or empty range
+		return 0, io.EOF
+	}
 
 	n, err := f.ReadAt(p, f.pos)
 	if n > 0 {
 		f.pos += int64(n)
+
+		if err == io.ErrUnexpectedEOF || err == io.EOF { // short read at end of file
+			err = nil
+		}
+	}
+
+	f.debugLog().Println("Read", n, err)
+	return n, err
+}
+
+// send a GET request for length bytes starting at off (or until the end of the file if length < 0)
+func (f *HttpFile) getRange(off, length int64) (*http.Response, error) {
+	if f.client == nil {
+		return nil, os.ErrInvalid
+	}
+
+	bytes_range := fmt.Sprintf("bytes=%d-", off)
+	if length >= 0 {
+		bytes_range = fmt.Sprintf("bytes=%d-%d", off, off+length-1)
+	}
+
+	resp, err := f.do(context.Background(), "GET", headersType{"Range": bytes_range})
+
+	switch {
+	case err != nil:
+		CloseResponse(resp)
+		return nil, &HttpFileError{Err: err}
+
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		CloseResponse(resp)
+		return nil, io.EOF
+
+	case resp.StatusCode == http.StatusOK && off == 0: // no range support, but we can still read
+		return resp, nil
+
+	case resp.StatusCode != http.StatusPartialContent:
+		CloseResponse(resp)
+		return nil, &HttpFileError{Err: fmt.Errorf("Unexpected Status %s", resp.Status)}
+	}
+
+	return resp, nil
+}
+
+// The WriterTo interface: copy the file content from the current position to w,
+// with a single request
+func (f *HttpFile) WriteTo(w io.Writer) (int64, error) {
+	f.debugLog().Println("WriteTo from", f.pos)
+
+	if f.client != nil && f.flen >= 0 && f.pos >= f.flen {
+		return 0, nil
 	}
 
-	DebugLog(f.Debug).Println("Read", n, err)
+	resp, err := f.getRange(f.pos, -1)
+	if err != nil {
+		return 0, err
+	}
+	defer CloseResponse(resp)
+
+	n, err := io.Copy(w, resp.Body)
+	f.pos += n
+
+	f.debugLog().Println("WriteTo", n, err)
 	return n, err
 }
 
+type sectionReader struct {
+	io.Reader
+	io.Closer
+}
+
+// Section returns a reader for length bytes of the file starting at off.
+// The reader should be closed after use.
+func (f *HttpFile) Section(off, length int64) (io.ReadCloser, error) {
+	f.debugLog().Println("Section", off, length)
+
+	if off < 0 {
+		return nil, os.ErrInvalid
+	}
+	if length <= 0 {
+		return http.NoBody, nil
+	}
+
+	resp, err := f.getRange(off, length)
+	if err != nil {
+		return nil, err
+	}
+
+	return sectionReader{io.LimitReader(resp.Body, length), resp.Body}, nil
+}
+
 // The Closer interface
 func (f *HttpFile) Close() error {
-	DebugLog(f.Debug).Println("Close")
+	f.debugLog().Println("Close")
+	f.cancelPrefetch(func(int64) bool { return true })
+	f.pwg.Wait() // wait for the canceled prefetches to return
+	f.prefetch = nil
 	f.client = nil
 	f.pos = -1
 	f.flen = -1
@@ -346,7 +893,7 @@ func (f *HttpFile) Close() error {
 
 // The Seeker interface
 func (f *HttpFile) Seek(offset int64, whence int) (int64, error) {
-	DebugLog(f.Debug).Println("Seek", offset, whence)
+	f.debugLog().Println("Seek", offset, whence)
 
 	var newpos int64 = -1
 
@@ -359,7 +906,9 @@ func (f *HttpFile) Seek(offset int64, whence int) (int64, error) {
 			newpos = f.pos + offset
 
 		case 2: // from end
-			newpos = f.flen + offset
+			if f.flen >= 0 {
+				newpos = f.flen + offset
+			}
 		}
 	}
 
@@ -368,6 +917,7 @@ func (f *HttpFile) Seek(offset int64, whence int) (int64, error) {
 	} else {
 		if f.pos != newpos {
 			f.pos = newpos
+			f.cancelPrefetch(func(int64) bool { return true }) // the read ahead restarts from the new position
 		}
 
 		return f.pos, nil
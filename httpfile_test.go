@@ -0,0 +1,439 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var fileContent = strings.Repeat("the quick brown fox jumps over the lazy dog\n", 100)
+
+func fileServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "test.txt", time.Time{}, strings.NewReader(fileContent))
+	}))
+}
+
+func TestHttpFileRetryStatus(test *testing.T) {
+	failures := 2
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		http.ServeContent(w, r, "test.txt", time.Time{}, strings.NewReader(fileContent))
+	}))
+	defer ts.Close()
+
+	f, err := OpenHttpFile(ts.URL, nil,
+		FileRetries(3, time.Millisecond),
+		FileBackoff(2),
+		FileRetryStatus(http.StatusServiceUnavailable))
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	if f.Size() != int64(len(fileContent)) {
+		test.Error("unexpected size", f.Size())
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.NewSectionReader(f, 0, f.Size())); err != nil {
+		test.Fatal(err)
+	}
+
+	if buf.String() != fileContent {
+		test.Error("content mismatch")
+	}
+}
+
+func TestHttpFileReadAhead(test *testing.T) {
+	ts := fileServer()
+	defer ts.Close()
+
+	f, err := OpenHttpFile(ts.URL, nil, FileBuffer(256), FileReadAhead(3))
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(io.LimitReader(f, f.Size()))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if string(b) != fileContent {
+		test.Error("content mismatch")
+	}
+}
+
+func TestHttpFileParallelRanges(test *testing.T) {
+	ts := fileServer()
+	defer ts.Close()
+
+	f, err := OpenHttpFile(ts.URL, nil, FileParallelRanges(300, 4))
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	p := make([]byte, len(fileContent)-10)
+
+	n, err := f.ReadAt(p, 10)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if string(p[:n]) != fileContent[10:] {
+		test.Error("content mismatch")
+	}
+}
+
+func TestHttpFileWriteTo(test *testing.T) {
+	ts := fileServer()
+	defer ts.Close()
+
+	f, err := OpenHttpFile(ts.URL, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Seek(100, io.SeekStart)
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, f); err != nil {
+		test.Fatal(err)
+	}
+
+	if buf.String() != fileContent[100:] {
+		test.Error("content mismatch")
+	}
+
+	r, err := f.Section(44, 10)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer r.Close()
+
+	b, _ := io.ReadAll(r)
+	if string(b) != fileContent[44:54] {
+		test.Errorf("unexpected section %q", b)
+	}
+}
+
+func TestSchemeHandler(test *testing.T) {
+	RegisterScheme("mem", SchemeHandlerFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host != "bucket" {
+			return &http.Response{StatusCode: http.StatusNotFound}, nil
+		}
+
+		return ContentResponse(req, strings.NewReader(fileContent), int64(len(fileContent)), time.Time{}), nil
+	}))
+	defer RegisterScheme("mem", nil)
+
+	f, err := OpenHttpFile("mem://bucket/test.txt", nil, FileParallelRanges(300, 4))
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	if f.Size() != int64(len(fileContent)) {
+		test.Error("unexpected size", f.Size())
+	}
+
+	p := make([]byte, 1000)
+	if n, err := f.ReadAt(p, 50); err != nil || string(p[:n]) != fileContent[50:1050] {
+		test.Error("content mismatch", n, err)
+	}
+
+	if _, err := OpenHttpFile("mem://missing/test.txt", nil); err == nil {
+		test.Error("expected error for missing resource")
+	}
+
+	client := NewHttpClient("mem://bucket/")
+
+	resp, err := CheckStatus(client.SendRequest(client.Path("test.txt"), Header(map[string]string{"Range": "bytes=-4"})))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusPartialContent || string(resp.Content()) != "dog\n" {
+		test.Error("unexpected response", resp.Status)
+	}
+}
+
+func TestFileAndDataURLs(test *testing.T) {
+	path := filepath.Join(test.TempDir(), "test.txt")
+	if err := os.WriteFile(path, []byte(fileContent), 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	furl := "file://" + filepath.ToSlash(path)
+
+	f, err := OpenHttpFile(furl, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	p := make([]byte, 10)
+	if n, err := f.ReadAt(p, 44); err != nil || string(p[:n]) != fileContent[44:54] {
+		test.Error("content mismatch", n, err)
+	}
+
+	resp, err := Get(furl, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if string(resp.Content()) != fileContent || !strings.HasPrefix(resp.ContentType(), "text/plain") {
+		test.Error("unexpected file response", resp.Header)
+	}
+
+	if resp, err := Get(furl+".missing", nil); err != nil || resp.StatusCode != http.StatusNotFound {
+		test.Error("expected 404 for missing file", err)
+	}
+
+	for durl, expected := range map[string]string{
+		"data:,Hello%2C%20World%21":                   "Hello, World!",
+		"data:text/plain;base64,SGVsbG8sIFdvcmxkIQ==": "Hello, World!",
+		"data:;base64,SGVsbG8":                        "Hello",
+	} {
+		resp, err := Get(durl, nil)
+		if err != nil {
+			test.Fatal(durl, err)
+		}
+
+		if b := resp.Content(); string(b) != expected || !strings.HasPrefix(resp.ContentType(), "text/plain") {
+			test.Errorf("%v: unexpected content %q", durl, b)
+		}
+	}
+
+	df, err := OpenHttpFile("data:application/octet-stream;base64,SGVsbG8sIFdvcmxkIQ==", nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if n, err := df.ReadAt(p[:5], 7); err != nil || string(p[:n]) != "World" {
+		test.Error("unexpected data content", string(p[:n]), err)
+	}
+}
+
+func TestHttpFS(test *testing.T) {
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	files := map[string]string{
+		"/a.txt":     fileContent,
+		"/sub/b.txt": "hello",
+	}
+	dirs := map[string][]indexEntry{
+		"/":     {{Name: "a.txt", Type: "file", Size: int64(len(fileContent))}, {Name: "sub", Type: "directory"}},
+		"/sub/": {{Name: "b.txt", Type: "file", Size: 5}},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if content, ok := files[r.URL.Path]; ok {
+			http.ServeContent(w, r, r.URL.Path, mtime, strings.NewReader(content))
+		} else if _, ok := dirs[r.URL.Path+"/"]; ok {
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+		} else if entries, ok := dirs[r.URL.Path]; ok {
+			for i := range entries {
+				entries[i].MTime = mtime.Format(http.TimeFormat)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(entries)
+		} else {
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	fsys, err := HttpFS(ts.URL, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := fstest.TestFS(fsys, "a.txt", "sub/b.txt"); err != nil {
+		test.Error(err)
+	}
+
+	// the server redirects sub to sub/
+	if info, err := fs.Stat(fsys, "sub"); err != nil || !info.IsDir() {
+		test.Error("expected a directory, got", info, err)
+	}
+}
+
+func TestHttpFileRetryErrors(test *testing.T) {
+	var lock sync.Mutex
+	truncated := 2
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		truncate := r.Method == "GET" && truncated > 0
+		if truncate {
+			truncated--
+		}
+		lock.Unlock()
+
+		if !truncate {
+			http.ServeContent(w, r, "test.txt", time.Time{}, strings.NewReader(fileContent))
+			return
+		}
+
+		rec := httptest.NewRecorder()
+		http.ServeContent(rec, r, "test.txt", time.Time{}, strings.NewReader(fileContent))
+
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes()[:rec.Body.Len()/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler) // close the connection
+	}))
+	defer ts.Close()
+
+	requests := 0
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return http.DefaultTransport.RoundTrip(req)
+	})
+
+	// the transport is used with the client, regardless of the order of the options
+	f, err := OpenHttpFile(ts.URL, nil,
+		FileTransport(transport),
+		FileClient(&http.Client{}),
+		FileRetries(3, time.Millisecond))
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	p := make([]byte, 100)
+	if n, err := f.ReadAt(p, 10); err != nil || string(p[:n]) != fileContent[10:110] {
+		test.Error("unexpected content", n, err)
+	}
+
+	if requests != 4 { // HEAD and 3 GET
+		test.Error("expected 4 requests via the transport, got", requests)
+	}
+}
+
+func TestHttpFileUnknownSize(test *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			w.WriteHeader(http.StatusOK) // no Content-Length
+			return
+		}
+
+		http.ServeContent(w, r, "test.txt", time.Time{}, strings.NewReader(fileContent))
+	}))
+	defer ts.Close()
+
+	for _, options := range [][]HttpFileOption{nil, {FileBuffer(256), FileReadAhead(2)}} {
+		f, err := OpenHttpFile(ts.URL, nil, options...)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if f.Size() != -1 {
+			test.Error("expected unknown size, got", f.Size())
+		}
+
+		b, err := io.ReadAll(f)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if string(b) != fileContent {
+			test.Error("content mismatch, got", len(b), "bytes")
+		}
+
+		f.Close()
+	}
+}
+
+func TestHttpFileCloseCancelsPrefetch(test *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rng := r.Header.Get("Range")
+		if r.Method == "GET" && !strings.HasPrefix(rng, "bytes=0-") && !strings.HasPrefix(rng, "bytes=10-") {
+			w.WriteHeader(http.StatusServiceUnavailable) // the prefetches wait for a retry
+			return
+		}
+
+		http.ServeContent(w, r, "test.txt", time.Time{}, strings.NewReader(fileContent))
+	}))
+	defer ts.Close()
+
+	f, err := OpenHttpFile(ts.URL, nil, FileBuffer(256), FileReadAhead(2),
+		FileRetries(3, time.Hour),
+		FileRetryStatus(http.StatusServiceUnavailable))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	p := make([]byte, 100)
+	if _, err := f.Read(p); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := f.Seek(10, io.SeekStart); err != nil {
+		test.Fatal(err)
+	}
+
+	if len(f.prefetch) != 0 {
+		test.Error("expected the prefetches to be canceled on seek")
+	}
+
+	if n, err := f.Read(p); err != nil || string(p[:n]) != fileContent[10:110] {
+		test.Error("unexpected content", n, err)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		f.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		test.Fatal("Close blocked by the prefetches")
+	}
+}
+
+func TestHttpFileConnectionRefused(test *testing.T) {
+	ts := fileServer()
+	url := ts.URL
+	ts.Close()
+
+	for _, options := range [][]HttpFileOption{nil, {FileRetries(3, time.Second)}} {
+		start := time.Now()
+
+		if _, err := OpenHttpFile(url, nil, options...); err == nil {
+			test.Fatal("expected connection error")
+		}
+
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			test.Error("expected the refused connection not to be retried, elapsed", elapsed)
+		}
+	}
+}
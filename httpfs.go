@@ -0,0 +1,282 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HttpFileSystem is an fs.FS implementation for remote trees, where files are read via HttpFile.
+//
+// Directory listing requires server support: by default the directory URL is requested
+// with "Accept: application/json" and the response is parsed as a JSON index
+// (as returned by nginx autoindex_format json or caddy file_server browse).
+// Other listing methods can be used by setting ReadDirFunc (see webdav.Client.FS for WebDAV shares).
+//
+// A directory is recognized when the server redirects the directory name to name/ (as most servers do):
+// a server that returns the directory index for the name without the trailing slash makes it look like a file.
+type HttpFileSystem struct {
+	// the base URL for the file system
+	BaseURL *url.URL
+
+	// headers to be passed on each request
+	Headers map[string]string
+
+	// the client used for requests (default: DefaultClient)
+	Client *http.Client
+
+	// if set, returns the list of entries in the specified directory
+	// (name is a valid fs path, "." for the root)
+	ReadDirFunc func(name string) ([]fs.DirEntry, error)
+
+	options []HttpFileOption
+}
+
+// HttpFS returns a file system for the specified base URL.
+// The options are used when opening files.
+func HttpFS(base string, headers map[string]string, options ...HttpFileOption) (*HttpFileSystem, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+
+	return &HttpFileSystem{BaseURL: u, Headers: headers, options: options}, nil
+}
+
+func (fsys *HttpFileSystem) client() *http.Client {
+	if fsys.Client != nil {
+		return fsys.Client
+	}
+
+	return DefaultClient
+}
+
+func (fsys *HttpFileSystem) url(name string) string {
+	if name == "." {
+		return fsys.BaseURL.String()
+	}
+
+	return fsys.BaseURL.ResolveReference(&url.URL{Path: name}).String()
+}
+
+// The fs.FS interface. If name is not a file, Open tries to open it as a directory.
+func (fsys *HttpFileSystem) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name != "." {
+		options := append([]HttpFileOption{FileClient(fsys.client())}, fsys.options...)
+
+		f, err := OpenHttpFile(fsys.url(name), fsys.Headers, options...)
+		switch {
+		case err == nil:
+			if u, err := url.Parse(f.getUrl()); err != nil || !strings.HasSuffix(u.Path, "/") {
+				return f, nil
+			}
+
+			f.Close() // redirected to name/, this is a directory
+
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+
+	entries, err := fsys.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &httpDir{info: fileInfo{name: path.Base(name), mode: fs.ModeDir}, entries: entries}
+
+	if name != "." { // get the directory info from the parent
+		if pentries, err := fsys.ReadDir(path.Dir(name)); err == nil {
+			for _, e := range pentries {
+				if e.Name() != d.info.name {
+					continue
+				}
+
+				if info, err := e.Info(); err == nil {
+					d.info.mtime = info.ModTime()
+				}
+				break
+			}
+		}
+	}
+
+	return d, nil
+}
+
+// The fs.ReadDirFS interface
+func (fsys *HttpFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	var entries []fs.DirEntry
+	var err error
+
+	if fsys.ReadDirFunc != nil {
+		entries, err = fsys.ReadDirFunc(name)
+	} else {
+		entries, err = fsys.readIndex(name)
+	}
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// a JSON index entry (nginx or caddy format)
+type indexEntry struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	IsDir   bool   `json:"is_dir"`
+	Size    int64  `json:"size"`
+	MTime   string `json:"mtime"`
+	ModTime string `json:"mod_time"`
+}
+
+func parseIndexTime(s string) time.Time {
+	if t, err := http.ParseTime(s); err == nil {
+		return t
+	}
+
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+// read a directory as a JSON index
+func (fsys *HttpFileSystem) readIndex(name string) ([]fs.DirEntry, error) {
+	u := fsys.url(name)
+	if !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range fsys.Headers {
+		req.Header.Set(k, v)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := fsys.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseResponse(resp)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fs.ErrNotExist
+
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("Unexpected Status %s", resp.Status)
+
+	case !strings.Contains(resp.Header.Get("Content-Type"), "json"):
+		return nil, fmt.Errorf("Unexpected Content-Type %q", resp.Header.Get("Content-Type"))
+	}
+
+	var index []indexEntry
+
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, 0, len(index))
+
+	for _, e := range index {
+		info := &fileInfo{name: strings.TrimSuffix(e.Name, "/"), size: e.Size}
+
+		if e.IsDir || e.Type == "directory" || strings.HasSuffix(e.Name, "/") {
+			info.mode = fs.ModeDir
+		}
+
+		if e.MTime != "" {
+			info.mtime = parseIndexTime(e.MTime)
+		} else if e.ModTime != "" {
+			info.mtime = parseIndexTime(e.ModTime)
+		}
+
+		if info.name == "" || info.name == "." || info.name == ".." {
+			continue
+		}
+
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+
+	return entries, nil
+}
+
+// fs.FileInfo implementation for remote files and directories
+type fileInfo struct {
+	name  string
+	size  int64
+	mode  fs.FileMode
+	mtime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() fs.FileMode  { return fi.mode | 0444 }
+func (fi *fileInfo) ModTime() time.Time { return fi.mtime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+// fs.ReadDirFile implementation for remote directories
+type httpDir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	pos     int
+}
+
+func (d *httpDir) Stat() (fs.FileInfo, error) {
+	return &d.info, nil
+}
+
+func (d *httpDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *httpDir) Close() error {
+	return nil
+}
+
+func (d *httpDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.pos:]
+
+	if n <= 0 {
+		d.pos = len(d.entries)
+		return rest, nil
+	}
+
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(rest) {
+		n = len(rest)
+	}
+
+	d.pos += n
+	return rest[:n], nil
+}
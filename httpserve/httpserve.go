@@ -0,0 +1,365 @@
+// Package httpserve implements a simple, programmable HTTP server,
+// useful as a test fixture (static files, mock routes and request recording)
+package httpserve
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	AlreadyStarted = errors.New("Server already started")
+)
+
+// A recorded request
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+	Time   time.Time
+
+	RemoteAddr string
+}
+
+type route struct {
+	method  string
+	path    string
+	prefix  bool
+	handler http.Handler
+}
+
+// Server is an HTTP server that can serve static files and mock routes,
+// and record the incoming requests.
+type Server struct {
+	// the address to listen on (use ":0" or "127.0.0.1:0" for a random port)
+	Addr string
+
+	// if Verbose, log requests
+	Verbose bool
+
+	lock     sync.Mutex
+	routes   []route
+	static   http.Handler
+	record   bool
+	requests []Request
+	recorded chan struct{} // closed (and replaced) when a request is recorded
+
+	tlsConfig *tls.Config
+	server    *http.Server
+	listener  net.Listener
+	done      chan error
+}
+
+// Create a new Server listening on addr (if empty, "127.0.0.1:0")
+func New(addr string) *Server {
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+
+	return &Server{Addr: addr}
+}
+
+// Serve the files in dir for requests that don't match any route
+func (s *Server) Static(dir string) *Server {
+	s.lock.Lock()
+	s.static = http.FileServer(http.Dir(dir))
+	s.lock.Unlock()
+	return s
+}
+
+// Handle requests for the specified method and path with handler.
+// An empty method matches all methods and a path ending with "/" matches all the sub-paths.
+// Routes are matched in the order they are added.
+func (s *Server) Handle(method, path string, handler http.Handler) *Server {
+	s.lock.Lock()
+	s.routes = append(s.routes, route{
+		method:  strings.ToUpper(method),
+		path:    path,
+		prefix:  strings.HasSuffix(path, "/"),
+		handler: handler,
+	})
+	s.lock.Unlock()
+	return s
+}
+
+// HandleFunc is like Handle, for a handler function
+func (s *Server) HandleFunc(method, path string, handler func(w http.ResponseWriter, r *http.Request)) *Server {
+	return s.Handle(method, path, http.HandlerFunc(handler))
+}
+
+// Respond to requests for the specified method and path with a canned response
+func (s *Server) Respond(method, path string, status int, body string, headers map[string]string) *Server {
+	return s.HandleFunc(method, path, func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range headers {
+			w.Header().Set(k, v)
+		}
+
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	})
+}
+
+// Enable or disable request recording
+func (s *Server) Record(enable bool) *Server {
+	s.lock.Lock()
+	s.record = enable
+	s.lock.Unlock()
+	return s
+}
+
+// Return the recorded requests
+func (s *Server) Requests() []Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// Wait until at least n requests have been recorded (or ctx is done) and return the recorded requests
+func (s *Server) WaitRequests(ctx context.Context, n int) ([]Request, error) {
+	for {
+		s.lock.Lock()
+		if len(s.requests) >= n {
+			requests := append([]Request(nil), s.requests...)
+			s.lock.Unlock()
+			return requests, nil
+		}
+
+		if s.recorded == nil {
+			s.recorded = make(chan struct{})
+		}
+
+		recorded := s.recorded
+		s.lock.Unlock()
+
+		select {
+		case <-recorded:
+		case <-ctx.Done():
+			return s.Requests(), ctx.Err()
+		}
+	}
+}
+
+// Clear the recorded requests
+func (s *Server) Reset() {
+	s.lock.Lock()
+	s.requests = nil
+	s.lock.Unlock()
+}
+
+// Serve via HTTPS, using the specified certificate and key files
+func (s *Server) TLS(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	return nil
+}
+
+// Serve via HTTPS, using a self-signed certificate for localhost
+// (clients will need to allow insecure connections)
+func (s *Server) SelfSigned() error {
+	cert, err := selfSignedCert()
+	if err != nil {
+		return err
+	}
+
+	s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	return nil
+}
+
+func selfSignedCert() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{Organization: []string{"httpserve"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// The http.Handler interface
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	record := s.record
+	routes := s.routes
+	static := s.static
+	verbose := s.Verbose
+	s.lock.Unlock()
+
+	if verbose {
+		log.Println(r.RemoteAddr, r.Method, r.URL, r.Proto, r.ContentLength)
+	}
+
+	if record {
+		var body []byte
+
+		if r.Body != nil {
+			body, _ = io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		s.lock.Lock()
+		s.requests = append(s.requests, Request{
+			Method: r.Method,
+			URL:    r.URL.String(),
+			Header: r.Header.Clone(),
+			Body:   body,
+			Time:   time.Now(),
+
+			RemoteAddr: r.RemoteAddr,
+		})
+
+		if s.recorded != nil {
+			close(s.recorded)
+			s.recorded = nil
+		}
+		s.lock.Unlock()
+	}
+
+	for _, rt := range routes {
+		if rt.method != "" && rt.method != r.Method {
+			continue
+		}
+
+		if r.URL.Path == rt.path || (rt.prefix && strings.HasPrefix(r.URL.Path, rt.path)) {
+			rt.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	if static != nil {
+		static.ServeHTTP(w, r)
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// Start listening and serving requests in background
+func (s *Server) Start() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.server != nil {
+		return AlreadyStarted
+	}
+
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	if s.tlsConfig != nil {
+		l = tls.NewListener(l, s.tlsConfig)
+	}
+
+	s.listener = l
+	s.server = &http.Server{Handler: s}
+	s.done = make(chan error, 1)
+
+	go func(server *http.Server, done chan error) {
+		done <- server.Serve(l)
+	}(s.server, s.done)
+
+	return nil
+}
+
+// Start the server and wait until it's closed
+func (s *Server) Serve() error {
+	if err := s.Start(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	done := s.done
+	s.lock.Unlock()
+
+	if err := <-done; err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+// Return the server base URL (only valid after Start)
+func (s *Server) URL() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.listener == nil {
+		return ""
+	}
+
+	scheme := "http"
+	if s.tlsConfig != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + s.listener.Addr().String()
+}
+
+// Gracefully shutdown the server, waiting for active requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.lock.Lock()
+	server := s.server
+	s.server = nil
+	s.listener = nil
+	s.lock.Unlock()
+
+	if server == nil {
+		return nil
+	}
+
+	return server.Shutdown(ctx)
+}
+
+// Close the server immediately
+func (s *Server) Close() error {
+	s.lock.Lock()
+	server := s.server
+	s.server = nil
+	s.listener = nil
+	s.lock.Unlock()
+
+	if server == nil {
+		return nil
+	}
+
+	return server.Close()
+}
@@ -0,0 +1,84 @@
+package httpserve
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(test *testing.T) {
+	s := New("").
+		Respond("GET", "/hello", 200, "hello world", map[string]string{"Content-Type": "text/plain"}).
+		Record(true)
+
+	if err := s.Start(); err != nil {
+		test.Fatal(err)
+	}
+	defer s.Close()
+
+	resp, err := http.Post(s.URL()+"/hello", "text/plain", strings.NewReader("body"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		test.Error("expected 404 for POST, got", resp.Status)
+	}
+
+	resp, err = http.Get(s.URL() + "/hello")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "hello world" {
+		test.Errorf("unexpected body %q", body)
+	}
+
+	requests := s.Requests()
+	if len(requests) != 2 || string(requests[0].Body) != "body" {
+		test.Error("unexpected recorded requests", requests)
+	}
+}
+
+func TestWaitRequests(test *testing.T) {
+	s := New("").Respond("", "/", 204, "", nil).Record(true)
+
+	if err := s.Start(); err != nil {
+		test.Fatal(err)
+	}
+	defer s.Close()
+
+	go func() {
+		for i := 0; i < 2; i++ {
+			if resp, err := http.Get(s.URL() + "/hook"); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	requests, err := s.WaitRequests(ctx, 2)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(requests) != 2 || requests[1].URL != "/hook" || requests[1].RemoteAddr == "" {
+		test.Error("unexpected recorded requests", requests)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := s.WaitRequests(ctx, 3); err != context.DeadlineExceeded {
+		test.Error("expected timeout, got", err)
+	}
+}
@@ -0,0 +1,205 @@
+// Package icap implements a minimal ICAP (RFC 3507) client.
+//
+// It is built on httpclient.ProtocolTransport, as an example of an HTTP-like text protocol
+// that shares the httpclient configuration, hooks, logging and tracing.
+package icap
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gobs/httpclient"
+)
+
+const DefaultPort = "1344"
+
+// Protocol implements the ICAP/1.0 wire format for httpclient.ProtocolTransport.
+//
+// The request body, if any, is written as is: it must contain the encapsulated sections,
+// as described by the Encapsulated header (if not set, "null-body=0" is sent).
+//
+// The response body contains the encapsulated HTTP headers followed by the (de-chunked) encapsulated body, if any.
+type Protocol struct{}
+
+func (Protocol) Addr(u *url.URL) (string, bool) {
+	return httpclient.URLAddr(u, DefaultPort), u.Scheme == "icaps"
+}
+
+func (Protocol) WriteRequest(w *bufio.Writer, req *http.Request) error {
+	header := req.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	header.Set("Host", host)
+
+	if header.Get("Encapsulated") == "" {
+		header.Set("Encapsulated", "null-body=0")
+	}
+
+	if err := httpclient.WriteRequestHeader(w, req.Method, req.URL.String(), "ICAP/1.0", header); err != nil {
+		return err
+	}
+
+	if req.Body != nil {
+		if _, err := io.Copy(w, req.Body); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (Protocol) ReadResponse(r *bufio.Reader, req *http.Request) (*http.Response, error) {
+	resp, err := httpclient.ReadResponseHeader(r, req, "ICAP")
+	if err != nil {
+		return nil, err
+	}
+
+	resp.ContentLength = -1
+	resp.Body = http.NoBody
+
+	enc := resp.Header.Get("Encapsulated")
+	if enc == "" {
+		return resp, nil
+	}
+
+	section, offset, err := lastSection(enc)
+	if err != nil {
+		return nil, err
+	}
+
+	if section == "null-body" {
+		resp.ContentLength = offset
+		resp.Body = ioutil.NopCloser(io.LimitReader(r, offset))
+	} else {
+		resp.Body = ioutil.NopCloser(io.MultiReader(io.LimitReader(r, offset), httputil.NewChunkedReader(r)))
+	}
+
+	return resp, nil
+}
+
+// return the last section of the Encapsulated header (the body, or null-body) and its offset
+func lastSection(enc string) (string, int64, error) {
+	parts := strings.Split(enc, ",")
+	kv := strings.SplitN(strings.TrimSpace(parts[len(parts)-1]), "=", 2)
+
+	if len(kv) == 2 && strings.HasSuffix(kv[0], "-body") {
+		if offset, err := strconv.ParseInt(kv[1], 10, 64); err == nil && offset >= 0 {
+			return kv[0], offset, nil
+		}
+	}
+
+	return "", 0, fmt.Errorf("Malformed Encapsulated header %q", enc)
+}
+
+// NewClient creates an HttpClient for the ICAP server at base (i.e. "icap://localhost:1344/")
+func NewClient(base string) (*httpclient.HttpClient, error) {
+	client, err := httpclient.NewHttpClientE(base)
+	if err != nil {
+		return nil, err
+	}
+
+	tr, _ := client.GetTransport().(*http.Transport)
+	client.SetTransport(&httpclient.ProtocolTransport{Protocol: Protocol{}, Transport: tr})
+	client.FollowRedirects = false
+	return client, nil
+}
+
+// Options contains the service capabilities, as returned by an OPTIONS request
+type Options struct {
+	Methods        []string
+	Service        string
+	ISTag          string
+	Allow204       bool
+	Preview        int // -1 if not supported
+	MaxConnections int // 0 if not specified
+	TTL            int // 0 if not specified
+}
+
+// GetOptions returns the capabilities of the specified service
+func GetOptions(client *httpclient.HttpClient, service string) (*Options, error) {
+	resp, err := httpclient.CheckStatus(client.SendRequest(httpclient.Method("OPTIONS"), client.Path(service)))
+	defer resp.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	atoi := func(h string, def int) int {
+		if v, err := strconv.Atoi(resp.Header.Get(h)); err == nil {
+			return v
+		}
+
+		return def
+	}
+
+	opts := &Options{
+		Service:        resp.Header.Get("Service"),
+		ISTag:          strings.Trim(resp.Header.Get("ISTag"), `"`),
+		Preview:        atoi("Preview", -1),
+		MaxConnections: atoi("Max-Connections", 0),
+		TTL:            atoi("Options-TTL", 0),
+	}
+
+	for _, m := range strings.Split(resp.Header.Get("Methods"), ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			opts.Methods = append(opts.Methods, m)
+		}
+	}
+
+	for _, a := range strings.Split(resp.Header.Get("Allow"), ",") {
+		if strings.TrimSpace(a) == "204" {
+			opts.Allow204 = true
+		}
+	}
+
+	return opts, nil
+}
+
+// ReqMod sends the headers of the HTTP request to the specified service for request modification (REQMOD)
+// and returns the modified request. If the service doesn't modify the request (204 No Content), req is returned.
+//
+// The request body is not sent.
+func ReqMod(client *httpclient.HttpClient, service string, req *http.Request) (*http.Request, error) {
+	head, err := httputil.DumpRequest(req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpclient.CheckStatus(client.SendRequest(
+		httpclient.Method("REQMOD"),
+		client.Path(service),
+		httpclient.Header(map[string]string{
+			"Allow":        "204",
+			"Encapsulated": fmt.Sprintf("req-hdr=0, null-body=%d", len(head)),
+		}),
+		httpclient.Body(bytes.NewReader(head))))
+	defer resp.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return req, nil
+	}
+
+	mreq, err := http.ReadRequest(bufio.NewReader(resp.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	return mreq.WithContext(req.Context()), nil
+}
@@ -0,0 +1,117 @@
+package icap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// a fake ICAP server, adding a header to the REQMOD requests
+func serve(test *testing.T, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+
+			r := bufio.NewReader(conn)
+
+			line, _ := r.ReadString('\n')
+			parts := strings.Fields(line)
+			if len(parts) != 3 || parts[2] != "ICAP/1.0" {
+				test.Error("unexpected request line", line)
+				return
+			}
+
+			header := http.Header{}
+			for {
+				line, _ := r.ReadString('\n')
+				if line = strings.TrimSpace(line); line == "" {
+					break
+				}
+
+				kv := strings.SplitN(line, ":", 2)
+				header.Add(kv[0], strings.TrimSpace(kv[1]))
+			}
+
+			switch parts[0] {
+			case "OPTIONS":
+				fmt.Fprint(conn, "ICAP/1.0 200 OK\r\nMethods: REQMOD\r\nService: test\r\nISTag: \"v1\"\r\nAllow: 204\r\nPreview: 0\r\nEncapsulated: null-body=0\r\n\r\n")
+
+			case "REQMOD":
+				hreq, err := http.ReadRequest(r)
+				if err != nil {
+					test.Error(err)
+					return
+				}
+
+				if hreq.URL.Path == "/unmodified" {
+					fmt.Fprint(conn, "ICAP/1.0 204 No Content\r\nEncapsulated: null-body=0\r\n\r\n")
+					return
+				}
+
+				hreq.Header.Set("X-Scanned", "yes")
+
+				var sb strings.Builder
+				fmt.Fprintf(&sb, "%v %v HTTP/1.1\r\nHost: %v\r\n", hreq.Method, hreq.URL, hreq.Host)
+				hreq.Header.Write(&sb)
+				sb.WriteString("\r\n")
+
+				fmt.Fprintf(conn, "ICAP/1.0 200 OK\r\nISTag: \"v1\"\r\nEncapsulated: req-hdr=0, null-body=%d\r\n\r\n%s", sb.Len(), sb.String())
+
+			default:
+				io.WriteString(conn, "ICAP/1.0 405 Method Not Allowed\r\n\r\n")
+			}
+		}(conn)
+	}
+}
+
+func TestICAP(test *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer ln.Close()
+
+	go serve(test, ln)
+
+	client, err := NewClient("icap://" + ln.Addr().String() + "/")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	opts, err := GetOptions(client, "scan")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if opts.Service != "test" || opts.ISTag != "v1" || !opts.Allow204 || opts.Preview != 0 || len(opts.Methods) != 1 {
+		test.Errorf("unexpected options %+v", opts)
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com/page", nil)
+
+	mreq, err := ReqMod(client, "scan", req)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if mreq.Header.Get("X-Scanned") != "yes" || mreq.URL.Path != "/page" {
+		test.Error("expected modified request, got", mreq.URL, mreq.Header)
+	}
+
+	req, _ = http.NewRequest("GET", "http://example.com/unmodified", nil)
+
+	if mreq, err := ReqMod(client, "scan", req); err != nil {
+		test.Fatal(err)
+	} else if mreq != req {
+		test.Error("expected unmodified request")
+	}
+}
@@ -0,0 +1,67 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// the header used to send the idempotency key (see IdempotencyKey)
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+type retryableKey struct{}
+
+// set the Idempotency-Key header, so that the server can safely deduplicate a repeated request.
+// If key is empty a random UUID is used.
+//
+// Requests with an idempotency key are considered retryable even if the method is not idempotent (i.e. POST, PATCH).
+// Note that the key is set once, so it is the same for all the retries of the request.
+func IdempotencyKey(key string) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		k := key
+		if k == "" { // a new key for each request, also when the option is reused
+			uuid, err := newUUID()
+			if err != nil {
+				return nil, err
+			}
+
+			k = uuid
+		}
+
+		req.Header.Set(IdempotencyKeyHeader, k)
+		return req, nil
+	}
+}
+
+// mark this request as retryable (or not), overriding the default classification (see IsRetryable)
+func Retryable(retry bool) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		return req.WithContext(context.WithValue(req.Context(), retryableKey{}, retry)), nil
+	}
+}
+
+// IsRetryable returns true if the request can be automatically retried:
+// the method is idempotent (GET, HEAD, OPTIONS, TRACE, PUT, DELETE), or the request has an idempotency key,
+// unless this was overridden with the Retryable option
+func IsRetryable(req *http.Request) bool {
+	if retry, ok := req.Context().Value(retryableKey{}).(bool); ok {
+		return retry
+	}
+
+	return isIdempotent(req.Method) || req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// return a random (version 4) UUID
+func newUUID() (string, error) {
+	var u [16]byte
+
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // variant 10
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
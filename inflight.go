@@ -0,0 +1,154 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+var (
+	TooManyRequests = errors.New("Too many requests in flight")
+)
+
+// InFlightLimiter limits the number of outstanding requests: a request is outstanding
+// until the response body is closed (or the request fails).
+//
+// When the limit is reached, a new request waits for a slot (until the request context is done)
+// or, if FailFast, fails immediately with TooManyRequests.
+type InFlightLimiter struct {
+	FailFast bool
+
+	sem chan struct{}
+}
+
+// Create a new InFlightLimiter for n concurrent requests
+func NewInFlightLimiter(n int, failFast bool) *InFlightLimiter {
+	return &InFlightLimiter{FailFast: failFast, sem: make(chan struct{}, n)}
+}
+
+// Acquire a slot, waiting if needed (see FailFast)
+func (l *InFlightLimiter) Acquire(ctx context.Context) error {
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if l.FailFast {
+		return TooManyRequests
+	}
+
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release a slot acquired with Acquire
+func (l *InFlightLimiter) Release() {
+	<-l.sem
+}
+
+// Return the number of outstanding requests
+func (l *InFlightLimiter) InFlight() int {
+	return len(l.sem)
+}
+
+// Return the max number of outstanding requests
+func (l *InFlightLimiter) Limit() int {
+	return cap(l.sem)
+}
+
+var (
+	globalInFlightLock sync.RWMutex
+	globalInFlight     *InFlightLimiter
+)
+
+// Set the max number of outstanding requests for all the clients (0: no limit).
+// The global limit applies in addition to the client limit (see SetMaxInFlight).
+func SetGlobalMaxInFlight(n int, failFast bool) {
+	var l *InFlightLimiter
+	if n > 0 {
+		l = NewInFlightLimiter(n, failFast)
+	}
+
+	globalInFlightLock.Lock()
+	globalInFlight = l
+	globalInFlightLock.Unlock()
+}
+
+func globalLimiter() *InFlightLimiter {
+	globalInFlightLock.RLock()
+	defer globalInFlightLock.RUnlock()
+	return globalInFlight
+}
+
+// Set the max number of outstanding requests for this client (0: no limit).
+// If failFast, the requests over the limit fail with TooManyRequests instead of waiting.
+//
+// The limiter is shared with the clones of the client.
+func (self *HttpClient) SetMaxInFlight(n int, failFast bool) {
+	if n > 0 {
+		self.inFlight = NewInFlightLimiter(n, failFast)
+	} else {
+		self.inFlight = nil
+	}
+}
+
+// Set the limiter for the outstanding requests, that can be shared by multiple clients (nil to disable)
+func (self *HttpClient) SetInFlightLimiter(l *InFlightLimiter) {
+	self.inFlight = l
+}
+
+// Get the limiter for the outstanding requests
+func (self *HttpClient) GetInFlightLimiter() *InFlightLimiter {
+	return self.inFlight
+}
+
+// acquire a slot from the client and global limiters, returning the function that releases them.
+// The client slot is acquired first, so that a client waiting for its own limit doesn't hold a global slot.
+func (self *HttpClient) acquireInFlight(req *http.Request) (func(), error) {
+	var limiters []*InFlightLimiter
+
+	for _, l := range []*InFlightLimiter{self.inFlight, globalLimiter()} {
+		if l == nil {
+			continue
+		}
+
+		if err := l.Acquire(req.Context()); err != nil {
+			for _, al := range limiters {
+				al.Release()
+			}
+
+			return nil, err
+		}
+
+		limiters = append(limiters, l)
+	}
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			for i := len(limiters) - 1; i >= 0; i-- {
+				limiters[i].Release()
+			}
+		})
+	}, nil
+}
+
+// a response body that releases the in-flight slots when closed
+type inFlightBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b inFlightBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
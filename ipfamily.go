@@ -0,0 +1,258 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IP family preferences for dual-stack hosts (see SetIPPreference)
+type IPPreference int
+
+const (
+	IPDefault IPPreference = iota // the system resolver order, with the transport dialer fallback
+	IPv4First                     // connect via IPv4, falling back to IPv6
+	IPv6First                     // connect via IPv6, falling back to IPv4
+	IPv4Only                      // connect only via IPv4
+	IPv6Only                      // connect only via IPv6
+)
+
+// The delay before starting the connection with the fallback IP family (as net.Dialer FallbackDelay)
+var DefaultFallbackDelay = 300 * time.Millisecond
+
+func (p IPPreference) String() string {
+	switch p {
+	case IPv4First:
+		return "4"
+	case IPv6First:
+		return "6"
+	case IPv4Only:
+		return "4only"
+	case IPv6Only:
+		return "6only"
+	}
+
+	return "any"
+}
+
+// ParseIPPreference parses an IP preference: any, 4, 6, 4only or 6only (also as ipv4, ipv6only, etc.)
+func ParseIPPreference(s string) (IPPreference, error) {
+	switch strings.TrimPrefix(strings.ToLower(s), "ipv") {
+	case "any", "", "default":
+		return IPDefault, nil
+	case "4":
+		return IPv4First, nil
+	case "6":
+		return IPv6First, nil
+	case "4only":
+		return IPv4Only, nil
+	case "6only":
+		return IPv6Only, nil
+	}
+
+	return IPDefault, fmt.Errorf("Invalid IP preference %q", s)
+}
+
+// a transport dialer that connects with the preferred IP family
+type ipFamilyDialer struct {
+	tr   *http.Transport
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	lock  sync.RWMutex
+	pref  IPPreference
+	delay time.Duration
+}
+
+func (d *ipFamilyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.lock.RLock()
+	pref, delay := d.pref, d.delay
+	d.lock.RUnlock()
+
+	if network != "tcp" || (pref == IPDefault && delay == 0) {
+		return d.dial(ctx, network, addr)
+	}
+
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); ip != nil { // i.e. resolved by the DNS cache
+			if (pref == IPv4Only && ip.To4() == nil) || (pref == IPv6Only && ip.To4() != nil) {
+				return nil, &net.AddrError{Err: "address family not allowed (" + pref.String() + ")", Addr: addr}
+			}
+
+			return d.dial(ctx, network, addr)
+		}
+	}
+
+	switch pref {
+	case IPv4Only:
+		return d.dial(ctx, "tcp4", addr)
+	case IPv6Only:
+		return d.dial(ctx, "tcp6", addr)
+	case IPv4First:
+		return d.race(ctx, "tcp4", "tcp6", addr, delay)
+	default: // as the Go resolver (RFC 6724) IPv6 is preferred
+		return d.race(ctx, "tcp6", "tcp4", addr, delay)
+	}
+}
+
+// race connects with the primary network and, if it fails or doesn't complete within delay,
+// with the fallback network. The first connection that succeeds is returned.
+// A negative delay starts the fallback only after the primary connection failed.
+func (d *ipFamilyDialer) race(ctx context.Context, primary, fallback, addr string, delay time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+
+	results := make(chan result, 2)
+	pending := 0
+
+	start := func(network string, primary bool) {
+		pending++
+		go func() {
+			conn, err := d.dial(ctx, network, addr)
+			results <- result{conn, err, primary}
+		}()
+	}
+
+	start(primary, true)
+
+	var timeout <-chan time.Time
+	if delay >= 0 {
+		if delay == 0 {
+			delay = DefaultFallbackDelay
+		}
+
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	fallbackStarted := false
+	var primaryErr, fallbackErr error
+
+	for pending > 0 {
+		select {
+		case <-timeout:
+			timeout = nil
+			if !fallbackStarted {
+				fallbackStarted = true
+				start(fallback, false)
+			}
+
+		case r := <-results:
+			pending--
+
+			if r.err == nil {
+				if pending > 0 { // close the other connection, if it succeeds
+					go func() {
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
+						}
+					}()
+				}
+
+				return r.conn, nil
+			}
+
+			if r.primary {
+				primaryErr = r.err
+			} else {
+				fallbackErr = r.err
+			}
+
+			if !fallbackStarted {
+				fallbackStarted = true
+				start(fallback, false)
+			}
+		}
+	}
+
+	if primaryErr != nil && !isNoSuchHost(primaryErr) {
+		return nil, primaryErr
+	}
+
+	return nil, fallbackErr
+}
+
+// isNoSuchHost returns true for lookup errors (i.e. no addresses for the IP family)
+func isNoSuchHost(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsNotFound
+	}
+
+	var addrErr *net.AddrError
+	return errors.As(err, &addrErr)
+}
+
+// Set the IP family preference for the connections to dual-stack hosts, and the delay before starting a connection
+// with the other family (0: DefaultFallbackDelay, negative: only after the first connection failed).
+// With IPDefault and a fallback delay, IPv6 is tried first (as the Go dialer does for the hosts with both families).
+//
+// Note that it only works with an *http.Transport (or a LoggingTransport or LenientTransport wrapping it),
+// that is cloned first if it's shared with other clients (i.e. the DefaultTransport).
+func (self *HttpClient) SetIPPreference(pref IPPreference, fallbackDelay time.Duration) error {
+	if pref < IPDefault || pref > IPv6Only {
+		return fmt.Errorf("Invalid IP preference %v", int(pref))
+	}
+
+	tr := self.ownTransport()
+	if tr == nil {
+		return fmt.Errorf("Unsupported transport %T", self.client.Transport)
+	}
+
+	d := self.ipFamily
+	if d == nil || d.tr != tr { // the transport may have been replaced
+		if pref == IPDefault && fallbackDelay == 0 {
+			return nil
+		}
+
+		d = &ipFamilyDialer{tr: tr, dial: tr.DialContext}
+		if d.dial == nil {
+			d.dial = (&net.Dialer{Timeout: DefaultTimeout, KeepAlive: DefaultTimeout}).DialContext
+		}
+
+		tr.DialContext = d.DialContext
+		self.ipFamily = d
+	}
+
+	d.lock.Lock()
+	d.pref, d.delay = pref, fallbackDelay
+	d.lock.Unlock()
+
+	// the pooled connections may use the other family
+	tr.CloseIdleConnections()
+	return nil
+}
+
+// Get the IP family preference and the fallback delay
+func (self *HttpClient) GetIPPreference() (IPPreference, time.Duration) {
+	if self.ipFamily == nil {
+		return IPDefault, 0
+	}
+
+	self.ipFamily.lock.RLock()
+	defer self.ipFamily.lock.RUnlock()
+	return self.ipFamily.pref, self.ipFamily.delay
+}
+
+// Connect via IPv4, falling back to IPv6 (see SetIPPreference)
+func (self *HttpClient) PreferIPv4() error {
+	_, delay := self.GetIPPreference()
+	return self.SetIPPreference(IPv4First, delay)
+}
+
+// Connect via IPv6, falling back to IPv4 (see SetIPPreference)
+func (self *HttpClient) PreferIPv6() error {
+	_, delay := self.GetIPPreference()
+	return self.SetIPPreference(IPv6First, delay)
+}
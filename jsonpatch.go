@@ -0,0 +1,127 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	JsonPatchType  = "application/json-patch+json"  // RFC 6902
+	MergePatchType = "application/merge-patch+json" // RFC 7386
+)
+
+// PatchOp is a JSON Patch (RFC 6902) operation: add, remove, replace, move, copy or test
+type PatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`  // for move and copy
+	Value interface{} `json:"value,omitempty"` // for add, replace and test
+}
+
+// MarshalJSON always includes the value for add, replace and test (also if nil or a zero value)
+func (op PatchOp) MarshalJSON() ([]byte, error) {
+	type patchOp PatchOp // without the MarshalJSON method
+
+	switch op.Op {
+	case "add", "replace", "test":
+		return json.Marshal(struct {
+			patchOp
+			Value interface{} `json:"value"`
+		}{patchOp(op), op.Value})
+	}
+
+	return json.Marshal(patchOp(op))
+}
+
+// Validate checks the operation name and the required fields
+func (op PatchOp) Validate() error {
+	validPath := func(p string) bool {
+		return p == "" || strings.HasPrefix(p, "/")
+	}
+
+	switch op.Op {
+	case "add", "remove", "replace", "test":
+	case "move", "copy":
+		if !validPath(op.From) || (op.From == "" && op.Path == "") {
+			return fmt.Errorf("Invalid JSON Patch %v from %q", op.Op, op.From)
+		}
+	default:
+		return fmt.Errorf("Invalid JSON Patch operation %q", op.Op)
+	}
+
+	if !validPath(op.Path) {
+		return fmt.Errorf("Invalid JSON Patch path %q (must be a JSON Pointer)", op.Path)
+	}
+
+	return nil
+}
+
+// set the request body as a JSON Patch document (RFC 6902), with Content-Type application/json-patch+json
+func JsonPatchBody(ops []PatchOp) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		for _, op := range ops {
+			if err := op.Validate(); err != nil {
+				return nil, err
+			}
+		}
+
+		if ops == nil {
+			ops = []PatchOp{}
+		}
+
+		b, err := json.Marshal(ops)
+		if err != nil {
+			return nil, err
+		}
+
+		return setPatchBody(req, b, JsonPatchType), nil
+	}
+}
+
+// set the request body as a JSON Merge Patch document (RFC 7386), with Content-Type application/merge-patch+json.
+// The document is usually an object, where a null value removes the field from the target.
+func MergePatchBody(doc interface{}) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		b, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		return setPatchBody(req, b, MergePatchType), nil
+	}
+}
+
+func setPatchBody(req *http.Request, b []byte, ct string) *http.Request {
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	req.ContentLength = int64(len(b))
+	req.Header.Set("Content-Type", ct)
+	return req
+}
+
+// ApplyMergePatch applies a JSON Merge Patch (RFC 7386) to the target document (as decoded by encoding/json)
+// and returns the result. The target is modified in place when possible.
+func ApplyMergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = ApplyMergePatch(t[k], v)
+		}
+	}
+
+	return t
+}
@@ -0,0 +1,61 @@
+package httpclient
+
+import (
+	"net/http"
+)
+
+// LenientTransport is an HTTP/1.1 transport that parses the responses with ReadLenientResponse,
+// for endpoints (i.e. IoT or embedded devices) that send responses rejected by the Go HTTP parser.
+//
+// It uses the dialer and TLS configuration of the wrapped Transport (if not nil),
+// but a new connection is opened for each request (no keep-alive) and HTTP proxies are not supported.
+type LenientTransport struct {
+	Transport *http.Transport
+}
+
+func (t *LenientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	pt := ProtocolTransport{Protocol: lenientProtocol{}, Transport: t.Transport, NextProtos: []string{"http/1.1"}}
+	return pt.RoundTrip(req)
+}
+
+// return the wrapped transport (or a new default transport)
+func (t *LenientTransport) unwrap() http.RoundTripper {
+	if t.Transport == nil {
+		return cloneDefaultTransport()
+	}
+
+	return t.Transport
+}
+
+// Enable (or disable) the lenient response parsing for this client (see LenientTransport)
+func (self *HttpClient) SetLenient(lenient bool) {
+	switch t := self.client.Transport.(type) {
+	case *LenientTransport:
+		if !lenient {
+			self.client.Transport = t.unwrap()
+		}
+
+	case *LoggingTransport:
+		if lt, ok := t.t.(*LenientTransport); ok && !lenient {
+			t.t = lt.unwrap()
+		} else if tr, ok := t.t.(*http.Transport); ok && lenient {
+			t.t = &LenientTransport{Transport: tr}
+		}
+
+	case *http.Transport:
+		if lenient {
+			self.client.Transport = &LenientTransport{Transport: t}
+		}
+	}
+}
+
+// Return true if the lenient response parsing is enabled
+func (self *HttpClient) GetLenient() bool {
+	tr := self.client.Transport
+	if lt, ok := tr.(*LoggingTransport); ok {
+		tr = lt.t
+	}
+
+	_, ok := tr.(*LenientTransport)
+	return ok
+}
@@ -0,0 +1,90 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type maxBodyKey struct{}
+
+// BodyTooLargeError is returned when reading a response body larger than the configured limit
+// (see HttpClient.SetMaxResponseBytes and MaxBody)
+type BodyTooLargeError struct {
+	Limit         int64
+	ContentLength int64 // -1 if unknown
+}
+
+func (e *BodyTooLargeError) Error() string {
+	if e.ContentLength >= 0 {
+		return fmt.Sprintf("response body too large (%v bytes, limit %v)", e.ContentLength, e.Limit)
+	}
+
+	return fmt.Sprintf("response body too large (limit %v)", e.Limit)
+}
+
+// set the max size of the response body for this request (overrides the client setting).
+//
+// Reading a response body larger than the limit returns a *BodyTooLargeError
+// (immediately, if the Content-Length is known, or after limit bytes have been read)
+func MaxBody(limit int64) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		return req.WithContext(context.WithValue(req.Context(), maxBodyKey{}, limit)), nil
+	}
+}
+
+// Set the max size of the response body for all requests (0: no limit)
+func (self *HttpClient) SetMaxResponseBytes(limit int64) {
+	self.maxResponseBytes = limit
+}
+
+// Get the max size of the response body
+func (self *HttpClient) GetMaxResponseBytes() int64 {
+	return self.maxResponseBytes
+}
+
+// wrap the response body if there is a limit for this request
+func (self *HttpClient) limitBody(req *http.Request, resp *http.Response) {
+	limit := self.maxResponseBytes
+	if v, ok := req.Context().Value(maxBodyKey{}).(int64); ok {
+		limit = v
+	}
+
+	if limit > 0 && resp.Body != nil && resp.Body != http.NoBody {
+		resp.Body = &limitedBody{ReadCloser: resp.Body, limit: limit, remaining: limit, clen: resp.ContentLength}
+	}
+}
+
+// a response body that fails when reading more than limit bytes
+type limitedBody struct {
+	io.ReadCloser
+
+	limit     int64
+	remaining int64
+	clen      int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.clen > b.limit {
+		return 0, &BodyTooLargeError{Limit: b.limit, ContentLength: b.clen}
+	}
+
+	if b.remaining <= 0 { // check if there is more data
+		var one [1]byte
+
+		if n, err := b.ReadCloser.Read(one[:]); n > 0 {
+			return 0, &BodyTooLargeError{Limit: b.limit, ContentLength: b.clen}
+		} else {
+			return 0, err
+		}
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
@@ -1,6 +1,7 @@
 package httpclient
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -9,8 +10,11 @@ import (
 	"net/http/httptrace"
 	"net/http/httputil"
 	"os"
+	"path"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // A transport that prints request and response
@@ -20,25 +24,182 @@ type LoggingTransport struct {
 	requestBody  bool
 	responseBody bool
 	timing       bool
+
+	// if set, the selected fields of JSON request and response bodies are redacted in the logs
+	Redactor *Redactor
+
+	// if MaxBodySize > 0, the logged bodies are truncated to MaxBodySize bytes
+	MaxBodySize int
+
+	// if LogBinary is false, binary bodies are not logged (only their length)
+	LogBinary bool
+
+	// the values of the headers matching these patterns (see RedactLogHeaders) are redacted in the logs
+	RedactHeaders []string
+
+	// the logger (nil: the standard logger)
+	Logger *log.Logger
+}
+
+// The headers that usually contain credentials (see RedactLogHeaders)
+var SensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "*-Api-Key", "*-Token"}
+
+// LogOption configures a LoggingTransport (see LoggedTransport)
+type LogOption func(lt *LoggingTransport)
+
+// truncate the logged bodies to n bytes
+func MaxLogBodySize(n int) LogOption {
+	return func(lt *LoggingTransport) {
+		lt.MaxBodySize = n
+	}
+}
+
+// log binary bodies (by default only their length is logged)
+func LogBinaryBodies(log bool) LogOption {
+	return func(lt *LoggingTransport) {
+		lt.LogBinary = log
+	}
+}
+
+// redact the values of the headers matching the patterns (case-insensitive, with * wildcards as in path.Match,
+// i.e. "X-*-Token"). Use SensitiveHeaders for the common credential headers.
+func RedactLogHeaders(patterns ...string) LogOption {
+	return func(lt *LoggingTransport) {
+		lt.RedactHeaders = patterns
+	}
+}
+
+// write the logs to the logger (nil: the standard logger)
+func LogLogger(l *log.Logger) LogOption {
+	return func(lt *LoggingTransport) {
+		lt.Logger = l
+	}
+}
+
+// write the logs to w (with the standard logger flags)
+func LogWriter(w io.Writer) LogOption {
+	return func(lt *LoggingTransport) {
+		lt.Logger = log.New(w, "", log.LstdFlags)
+	}
+}
+
+// redact the selected fields of JSON bodies (see Redactor)
+func RedactLogBodies(r *Redactor) LogOption {
+	return func(lt *LoggingTransport) {
+		lt.Redactor = r
+	}
+}
+
+// return a copy of the headers with the values of the headers matching RedactHeaders redacted
+// (or the original headers, if there are no matches)
+func (lt *LoggingTransport) redactHeaders(h http.Header) http.Header {
+	return RedactHeaders(h, lt.RedactHeaders...)
+}
+
+// RedactHeaders returns a copy of the headers with the values of the headers matching the patterns
+// (as in RedactLogHeaders) replaced by RedactedValue, or the original headers if there are no matches
+func RedactHeaders(h http.Header, patterns ...string) http.Header {
+	var redacted http.Header
+
+	for k := range h {
+		name := strings.ToLower(k)
+
+		for _, p := range patterns {
+			if ok, _ := path.Match(strings.ToLower(p), name); ok {
+				if redacted == nil {
+					redacted = h.Clone()
+				}
+
+				redacted[k] = []string{RedactedValue}
+				break
+			}
+		}
+	}
+
+	if redacted == nil {
+		return h
+	}
+
+	return redacted
+}
+
+// return true if the body looks binary (invalid UTF-8 or control characters in the first 1KB)
+func isBinary(b []byte) bool {
+	truncated := len(b) > 1024
+	if truncated {
+		b = b[:1024]
+	}
+
+	for i := 0; i < len(b); {
+		r, n := utf8.DecodeRune(b[i:])
+		if r == utf8.RuneError && n == 1 {
+			return !truncated || len(b)-i >= utf8.UTFMax // a rune split by the truncation is ok
+		}
+
+		if r < ' ' && r != '\t' && r != '\n' && r != '\r' && r != '\f' && r != 0x1b {
+			return true
+		}
+
+		i += n
+	}
+
+	return false
+}
+
+// redact, truncate or replace (if binary) the body of a request or response dump
+func (lt *LoggingTransport) redactDump(dump []byte) []byte {
+	i := bytes.Index(dump, []byte("\r\n\r\n"))
+	if i < 0 || i+4 == len(dump) {
+		return dump
+	}
+
+	head, body := dump[:i+4:i+4], dump[i+4:]
+
+	if !lt.LogBinary && isBinary(body) {
+		return append(head, fmt.Sprintf("[binary body, %d bytes]", len(body))...)
+	}
+
+	if lt.Redactor != nil {
+		body = lt.Redactor.RedactJSON(body)
+	}
+
+	if lt.MaxBodySize > 0 && len(body) > lt.MaxBodySize {
+		n := lt.MaxBodySize
+		for n > 0 && !utf8.RuneStart(body[n]) {
+			n--
+		}
+
+		return append(append(head, body[:n]...), fmt.Sprintf("... [truncated, %d bytes]", len(body))...)
+	}
+
+	return append(head, body...)
 }
 
 func (lt *LoggingTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	logger := stdLogger(lt.Logger)
+
+	// don't log the values of the secret headers
+	header := req.Header
+	req.Header = lt.redactHeaders(redactHeaders(req))
 	dreq, _ := httputil.DumpRequest(req, lt.requestBody)
+	dreq = lt.redactDump(dreq)
+	req.Header = header
+
 	//fmt.Println("REQUEST:", strconv.Quote(string(dreq)))
-	log.Println("URL:", req.URL)
-	log.Println("REQUEST:", string(dreq))
+	logger.Println("URL:", req.URL)
+	logger.Println("REQUEST:", string(dreq))
 
 	for _, t := range req.TransferEncoding {
-		log.Println("Transfer-Encoding:", t)
+		logger.Println("Transfer-Encoding:", t)
 	}
 
 	if req.Header.Get("Content-Length") == "" {
-		log.Println("Content-Length:", req.ContentLength)
+		logger.Println("Content-Length:", req.ContentLength)
 	} else {
-		log.Println("Content-Length: from-headers")
+		logger.Println("Content-Length: from-headers")
 	}
 
-	log.Println("")
+	logger.Println("")
 
 	var startTime time.Time
 	var elapsed time.Duration
@@ -56,24 +217,30 @@ func (lt *LoggingTransport) RoundTrip(req *http.Request) (resp *http.Response, e
 	if err != nil {
 		if lt.requestBody {
 			// don't print the body twice
+			req.Header = lt.redactHeaders(redactHeaders(req))
 			dreq, _ = httputil.DumpRequest(req, false)
+			req.Header = header
 		}
-		log.Println("ERROR:", err, "REQUEST:", strconv.Quote(string(dreq)))
+		logger.Println("ERROR:", err, "REQUEST:", strconv.Quote(string(dreq)))
 	}
 	if resp != nil {
+		rheader := resp.Header
+		resp.Header = lt.redactHeaders(rheader)
 		dresp, _ := httputil.DumpResponse(resp, lt.responseBody)
-		log.Println("RESPONSE:", string(dresp))
+		resp.Header = rheader
+		dresp = lt.redactDump(dresp)
+		logger.Println("RESPONSE:", string(dresp))
 
 		for _, t := range resp.Request.TransferEncoding {
-			log.Println("REQ Transfer-Encoding:", t)
+			logger.Println("REQ Transfer-Encoding:", t)
 		}
 	}
 
 	if elapsed > 0 {
-		log.Println("ELAPSED TIME:", elapsed.Round(time.Millisecond))
+		logger.Println("ELAPSED TIME:", elapsed.Round(time.Millisecond))
 	}
 
-	log.Println("")
+	logger.Println("")
 	return
 }
 
@@ -82,10 +249,12 @@ func (lt *LoggingTransport) RoundTrip(req *http.Request) (resp *http.Response, e
 // if requestBody == true, also log request body
 // if responseBody == true, also log response body
 // if timing == true, also log elapsed time
-func StartLogging(requestBody, responseBody, timing bool) {
-	http.DefaultTransport = &LoggingTransport{&http.Transport{}, requestBody, responseBody, timing}
+//
+// The options configure the body size limit and the redaction (see LogOption)
+func StartLogging(requestBody, responseBody, timing bool, options ...LogOption) {
+	http.DefaultTransport = LoggedTransport(&http.Transport{}, requestBody, responseBody, timing, options...)
 
-	DefaultTransport = &LoggingTransport{DefaultTransport, requestBody, responseBody, timing}
+	DefaultTransport = LoggedTransport(DefaultTransport, requestBody, responseBody, timing, options...)
 }
 
 // Disable logging requests/responses
@@ -101,9 +270,14 @@ func StopLogging() {
 	}
 }
 
-// Wrap input transport into a LoggingTransport
-func LoggedTransport(t http.RoundTripper, requestBody, responseBody, timing bool) http.RoundTripper {
-	return &LoggingTransport{t, requestBody, responseBody, timing}
+// Wrap input transport into a LoggingTransport, configured with the options
+func LoggedTransport(t http.RoundTripper, requestBody, responseBody, timing bool, options ...LogOption) http.RoundTripper {
+	lt := &LoggingTransport{t: t, requestBody: requestBody, responseBody: responseBody, timing: timing}
+	for _, opt := range options {
+		opt(lt)
+	}
+
+	return lt
 }
 
 // A Reader that "logs" progress
@@ -168,12 +342,41 @@ func (d DebugLog) Printf(fmt string, args ...interface{}) {
 	}
 }
 
+// A DebugLog that writes to a specific logger (nil: the standard logger)
+
+type DebugLogger struct {
+	Enabled bool
+	Logger  *log.Logger
+}
+
+func (d DebugLogger) Println(args ...interface{}) {
+	if d.Enabled {
+		stdLogger(d.Logger).Println(args...)
+	}
+}
+
+func (d DebugLogger) Printf(fmt string, args ...interface{}) {
+	if d.Enabled {
+		stdLogger(d.Logger).Printf(fmt, args...)
+	}
+}
+
+// return the logger, or the standard logger if nil
+func stdLogger(l *log.Logger) *log.Logger {
+	if l == nil {
+		return log.Default()
+	}
+
+	return l
+}
+
 // A ClientTrace implementation that collects request time
 
 type RequestTrace struct {
 	DNS          time.Duration
 	Connect      time.Duration
 	Connected    bool
+	Reused       bool
 	TLSHandshake time.Duration
 	Request      time.Duration
 	Wait         time.Duration
@@ -189,6 +392,7 @@ func (r *RequestTrace) Reset() {
 	r.DNS = 0
 	r.Connect = 0
 	r.Connected = false
+	r.Reused = false
 	r.TLSHandshake = 0
 	r.Request = 0
 	r.Wait = 0
@@ -199,6 +403,7 @@ func (r *RequestTrace) NewClientTrace(trace bool) *httptrace.ClientTrace {
 	return &httptrace.ClientTrace{
 		GotConn: func(info httptrace.GotConnInfo) {
 			r.Connected = info.WasIdle
+			r.Reused = info.Reused
 			r.Local = info.Conn.LocalAddr().String()
 			r.Remote = info.Conn.RemoteAddr().String()
 
@@ -297,10 +502,11 @@ func (r *RequestTrace) Done() {
 }
 
 func (r *RequestTrace) String() string {
-	return fmt.Sprintf("{DNS:%v, Connect:%v, Connected:%v, TLSHandshake:%v, Request:%v, Wait:%v, Response:%v}",
+	return fmt.Sprintf("{DNS:%v, Connect:%v, Connected:%v, Reused:%v, TLSHandshake:%v, Request:%v, Wait:%v, Response:%v}",
 		r.DNS.Truncate(100*time.Microsecond),
 		r.Connect.Truncate(100*time.Microsecond),
 		r.Connected,
+		r.Reused,
 		r.TLSHandshake.Truncate(100*time.Microsecond),
 		r.Request.Truncate(100*time.Microsecond),
 		r.Wait.Truncate(100*time.Microsecond),
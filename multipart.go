@@ -0,0 +1,107 @@
+package httpclient
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+var (
+	NotMultipart = errors.New("Not a multipart response")
+)
+
+// MultipartReader iterates over the parts of a multipart response (see HttpResponse.Multipart)
+type MultipartReader struct {
+	// the multipart subtype (i.e. mixed, byteranges, related)
+	Subtype string
+
+	r *multipart.Reader
+}
+
+// Part is a part of a multipart response. The Body must be read before calling Next again.
+type Part struct {
+	Header http.Header
+	Body   io.Reader
+
+	// for a multipart/byteranges part, the byte range (from the Content-Range header), otherwise -1
+	First, Last, Total int64
+}
+
+// Multipart returns a reader for the parts of a multipart response (i.e. multipart/mixed for batched responses
+// or multipart/byteranges for a multi-range request), or NotMultipart if the response is not multipart.
+// The parts are read from the response body, that should be closed after reading the parts.
+func (resp *HttpResponse) Multipart() (*MultipartReader, error) {
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, NotMultipart
+	}
+
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, fmt.Errorf("Missing multipart boundary")
+	}
+
+	return &MultipartReader{Subtype: strings.TrimPrefix(mediaType, "multipart/"), r: multipart.NewReader(resp.Body, boundary)}, nil
+}
+
+// Next returns the next part, or io.EOF if there are no more parts
+func (m *MultipartReader) Next() (*Part, error) {
+	p, err := m.r.NextPart()
+	if err != nil {
+		return nil, err
+	}
+
+	part := &Part{Header: http.Header(p.Header), Body: p, First: -1, Last: -1, Total: -1}
+
+	if cr := p.Header.Get("Content-Range"); cr != "" {
+		if part.First, part.Last, part.Total, err = ParseContentRange(cr); err != nil {
+			return nil, err
+		}
+	}
+
+	return part, nil
+}
+
+// ForEach calls f for each part, stopping at the first error
+func (m *MultipartReader) ForEach(f func(part *Part) error) error {
+	for {
+		part, err := m.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := f(part); err != nil {
+			return err
+		}
+	}
+}
+
+// ContentType returns the part media type (without parameters)
+func (p *Part) ContentType() string {
+	mediaType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+	return mediaType
+}
+
+// Response parses the part body as an HTTP response (Content-Type: application/http), as returned
+// in batched responses (i.e. OData and Google APIs batch requests). The response body must be read
+// before reading the next part.
+func (p *Part) Response() (*HttpResponse, error) {
+	if ct := p.ContentType(); ct != "application/http" {
+		return nil, fmt.Errorf("Unexpected part Content-Type %q", ct)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(p.Body), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HttpResponse{Response: *resp}, nil
+}
@@ -0,0 +1,486 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var OutboxClosed = errors.New("Outbox closed")
+
+// OutboxMessage is a request stored in the outbox (see OutboxClient)
+type OutboxMessage struct {
+	ID          string      `json:"id"`
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+	Created     time.Time   `json:"created"`
+	Attempts    int         `json:"attempts"`
+	NextAttempt time.Time   `json:"next_attempt"`
+	LastError   string      `json:"last_error,omitempty"`
+}
+
+// request creates the request to deliver the message
+func (m *OutboxMessage) request(ctx context.Context) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, m.Method, m.URL, bytes.NewReader(m.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(m.Body) == 0 {
+		req.Body, req.GetBody = http.NoBody, nil
+	}
+
+	req.Header = m.Header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
+	}
+
+	return req, nil
+}
+
+// OutboxClient delivers "fire-and-forget" requests (i.e. telemetry or webhooks) asynchronously, with at-least-once semantics:
+// the requests are saved in a local directory (one file per request) and removed only after a successful (2xx) response,
+// so they survive the process restarts.
+//
+// The requests that fail with a connection error, a 5xx, 408, 425 or 429 status are retried with exponential backoff
+// (or after the Retry-After delay), the others (or the ones that reach MaxAttempts) are moved to the "failed" subdirectory.
+// Since a request may be delivered more than once, an Idempotency-Key header (the message ID) is added if not set.
+//
+// Note that only the method, URL, headers and body of the requests are stored (the context values, as set by Timeout
+// or Retryable, are not), and that the headers are stored as is (including the client headers and credentials).
+type OutboxClient struct {
+	Client       *HttpClient
+	Workers      int           // the number of concurrent deliveries (default 1)
+	MaxAttempts  int           // the max number of delivery attempts (0: no limit)
+	RetryWait    time.Duration // the wait time before the first retry (default 1s), doubled after each retry
+	MaxRetryWait time.Duration // the max wait time between retries (default 5m)
+
+	// if set, called after a message was delivered (the response body is closed after the call)
+	OnDelivered func(m *OutboxMessage, resp *HttpResponse)
+
+	// if set, called when a message is moved to the failed directory
+	OnFailed func(m *OutboxMessage, err error)
+
+	dir string
+
+	lock     sync.Mutex
+	messages map[string]*OutboxMessage
+	inflight map[string]bool
+	changed  chan struct{} // closed (and replaced) when a message is removed
+	wake     chan struct{}
+	closed   bool
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// OpenOutbox opens (or creates) the outbox in dir, loading the pending messages, for the requests sent via client.
+// Call Start to start the delivery.
+func OpenOutbox(client *HttpClient, dir string) (*OutboxClient, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "failed"), 0700); err != nil {
+		return nil, err
+	}
+
+	o := &OutboxClient{
+		Client:   client,
+		dir:      dir,
+		messages: map[string]*OutboxMessage{},
+		inflight: map[string]bool{},
+		changed:  make(chan struct{}),
+		wake:     make(chan struct{}, 1),
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		var m OutboxMessage
+		if err := json.Unmarshal(b, &m); err != nil || m.ID+".json" != filepath.Base(f) {
+			return nil, fmt.Errorf("Invalid outbox message %v", f)
+		}
+
+		o.messages[m.ID] = &m
+	}
+
+	return o, nil
+}
+
+// Dir returns the outbox directory
+func (o *OutboxClient) Dir() string {
+	return o.dir
+}
+
+func (o *OutboxClient) path(id string) string {
+	return filepath.Join(o.dir, id+".json")
+}
+
+// save writes the message file (atomically, so that an interrupted write doesn't corrupt it)
+func (o *OutboxClient) save(m *OutboxMessage) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(o.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name()) // no-op after the rename
+
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), o.path(m.ID))
+}
+
+// Enqueue creates the request with the specified options (as SendRequest) and stores it for the delivery,
+// returning the message ID
+func (o *OutboxClient) Enqueue(options ...RequestOption) (string, error) {
+	req, err := o.Client.makeRequest(options...)
+	if err != nil {
+		return "", err
+	}
+
+	return o.EnqueueRequest(req)
+}
+
+// EnqueueRequest stores the request for the delivery (reading the request body), returning the message ID
+func (o *OutboxClient) EnqueueRequest(req *http.Request) (string, error) {
+	var body []byte
+
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	uuid, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	m := &OutboxMessage{
+		ID:          fmt.Sprintf("%016x-%s", now.UnixNano(), uuid),
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		Header:      req.Header.Clone(),
+		Body:        body,
+		Created:     now.UTC(),
+		NextAttempt: now.UTC(),
+	}
+
+	if m.Method == "" {
+		m.Method = "GET"
+	}
+	if m.Header == nil {
+		m.Header = http.Header{}
+	}
+	if req.Host != "" && req.Host != req.URL.Host {
+		m.Header.Set("Host", req.Host)
+	}
+	if m.Header.Get(IdempotencyKeyHeader) == "" {
+		m.Header.Set(IdempotencyKeyHeader, m.ID)
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.closed {
+		return "", OutboxClosed
+	}
+
+	if err := o.save(m); err != nil {
+		return "", err
+	}
+
+	o.messages[m.ID] = m
+	o.notify()
+	return m.ID, nil
+}
+
+// notify wakes up a worker (with the lock held)
+func (o *OutboxClient) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of messages waiting for the delivery
+func (o *OutboxClient) Len() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return len(o.messages)
+}
+
+// Pending returns a copy of the messages waiting for the delivery, ordered by creation
+func (o *OutboxClient) Pending() []OutboxMessage {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	messages := make([]OutboxMessage, 0, len(o.messages))
+	for _, m := range o.messages {
+		messages = append(messages, *m)
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages
+}
+
+// Start starts the delivery workers
+func (o *OutboxClient) Start() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.cancel != nil || o.closed {
+		return
+	}
+
+	workers := o.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	o.cancel = cancel
+
+	for i := 0; i < workers; i++ {
+		o.wg.Add(1)
+		go o.worker(ctx)
+	}
+}
+
+// Close stops the delivery (canceling the requests in progress, that will be sent again when the outbox is reopened)
+// and rejects new messages
+func (o *OutboxClient) Close() error {
+	o.lock.Lock()
+	o.closed = true
+	cancel := o.cancel
+	o.lock.Unlock()
+
+	if cancel != nil {
+		cancel()
+		o.wg.Wait()
+	}
+
+	return nil
+}
+
+// Flush waits until all the messages have been delivered (or moved to the failed directory)
+func (o *OutboxClient) Flush(ctx context.Context) error {
+	for {
+		o.lock.Lock()
+		if len(o.messages) == 0 {
+			o.lock.Unlock()
+			return nil
+		}
+
+		changed := o.changed
+		o.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// next returns the first message due for the delivery or, if none, the time to wait
+func (o *OutboxClient) next() (*OutboxMessage, time.Duration) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	now := time.Now()
+
+	var due *OutboxMessage
+	wait := time.Minute
+
+	for id, m := range o.messages {
+		if o.inflight[id] {
+			continue
+		}
+
+		if d := m.NextAttempt.Sub(now); d > 0 {
+			if d < wait {
+				wait = d
+			}
+		} else if due == nil || id < due.ID {
+			due = m
+		}
+	}
+
+	if due != nil {
+		o.inflight[due.ID] = true
+	}
+
+	return due, wait
+}
+
+func (o *OutboxClient) worker(ctx context.Context) {
+	defer o.wg.Done()
+
+	for ctx.Err() == nil {
+		m, wait := o.next()
+		if m != nil {
+			o.deliver(ctx, m)
+			continue
+		}
+
+		t := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+		case <-o.wake:
+		case <-t.C:
+		}
+
+		t.Stop()
+	}
+}
+
+// deliver sends the message and updates its state
+func (o *OutboxClient) deliver(ctx context.Context, m *OutboxMessage) {
+	req, err := m.request(ctx)
+
+	var resp *HttpResponse
+	if err == nil {
+		resp, err = CheckStatus(o.Client.Do(req))
+	}
+
+	if err == nil && o.OnDelivered != nil {
+		o.OnDelivered(m, resp)
+	}
+	if resp != nil {
+		resp.Close()
+	}
+
+	o.lock.Lock()
+	delete(o.inflight, m.ID)
+
+	failed := false
+
+	switch {
+	case err == nil:
+		o.remove(m, os.Remove(o.path(m.ID)))
+
+	case ctx.Err() != nil: // closed, not an attempt
+
+	default:
+		m.Attempts++
+		m.LastError = err.Error()
+
+		if !outboxRetryable(err) || (o.MaxAttempts > 0 && m.Attempts >= o.MaxAttempts) {
+			serr := o.save(m) // with the last error
+			if serr == nil {
+				serr = os.Rename(o.path(m.ID), filepath.Join(o.dir, "failed", m.ID+".json"))
+			}
+
+			o.remove(m, serr)
+			failed = true
+			break
+		}
+
+		m.NextAttempt = time.Now().Add(o.retryWait(m.Attempts, err)).UTC()
+
+		if serr := o.save(m); serr != nil {
+			o.Client.debugLog().Println("OUTBOX:", m.ID, serr)
+		}
+	}
+
+	o.lock.Unlock()
+
+	if failed && o.OnFailed != nil {
+		o.OnFailed(m, err)
+	}
+}
+
+// remove removes the message from the pending ones (with the lock held)
+func (o *OutboxClient) remove(m *OutboxMessage, err error) {
+	if err != nil && !os.IsNotExist(err) {
+		o.Client.debugLog().Println("OUTBOX:", m.ID, err)
+	}
+
+	delete(o.messages, m.ID)
+
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// retryWait returns the wait time before the next attempt
+func (o *OutboxClient) retryWait(attempts int, err error) time.Duration {
+	wait := o.RetryWait
+	if wait <= 0 {
+		wait = time.Second
+	}
+
+	max := o.MaxRetryWait
+	if max <= 0 {
+		max = 5 * time.Minute
+	}
+
+	for i := 1; i < attempts && wait < max; i++ {
+		wait *= 2
+	}
+
+	if wait > max {
+		wait = max
+	}
+
+	var herr HttpError
+	if errors.As(err, &herr) && herr.RetryAfter > 0 {
+		if ra := time.Duration(herr.RetryAfter) * time.Second; ra > wait {
+			wait = ra
+		}
+	}
+
+	return wait
+}
+
+// outboxRetryable returns true for the errors that may go away by retrying the delivery
+func outboxRetryable(err error) bool {
+	var herr HttpError
+	if !errors.As(err, &herr) || herr.Code == 0 {
+		return true // connection errors
+	}
+
+	return herr.Code >= 500 || IsTemporary(herr)
+}
@@ -0,0 +1,267 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+var (
+	// returned by the Paginate callback to stop the iteration without errors
+	StopPagination = errors.New("Stop pagination")
+)
+
+// PageOptions configures how Paginate requests the next page.
+//
+// The next page is found, in order of precedence, using:
+//   - NextField: the URL of the next page in the JSON body
+//   - CursorField and CursorParam: a cursor in the JSON body, sent as query parameter
+//   - PageParam: a page number query parameter
+//   - OffsetParam: an offset query parameter, incremented by PageSize
+//   - otherwise, the rel="next" link in the Link header (RFC 5988)
+type PageOptions struct {
+	// the request options for the first page (the same options are used for the next pages)
+	Options []RequestOption
+
+	// the path of the next page URL in the JSON body (i.e. "links.next")
+	NextField string
+
+	// the path of the next cursor in the JSON body (i.e. "meta.next_cursor") and the
+	// query parameter used to send it (i.e. "cursor")
+	CursorField string
+	CursorParam string
+
+	// page number query parameter, and first page (default 1)
+	PageParam string
+	FirstPage int
+
+	// offset query parameter
+	OffsetParam string
+
+	// the page size: if LimitParam is set, it's sent as query parameter.
+	// For page and offset pagination, the iteration stops when a page has less than PageSize items.
+	PageSize   int
+	LimitParam string
+
+	// the path of the items array in the JSON body (default: the body is an array)
+	// For page and offset pagination, the iteration stops when a page has no items.
+	ItemsField string
+
+	// max number of pages (0: no limit)
+	MaxPages int
+}
+
+// Paginate requests all the pages, calling f for each one.
+// The response body is buffered, so f can read it (and doesn't need to close it).
+// If f returns StopPagination the iteration stops and Paginate returns nil,
+// any other error is returned.
+func (self *HttpClient) Paginate(opts PageOptions, f func(page *HttpResponse) error) error {
+	var next []RequestOption
+
+	if opts.LimitParam != "" && opts.PageSize > 0 {
+		next = append(next, StringParams(map[string]string{opts.LimitParam: strconv.Itoa(opts.PageSize)}))
+	}
+
+	page := opts.FirstPage
+	if page == 0 {
+		page = 1
+	}
+
+	if opts.PageParam != "" && opts.NextField == "" && opts.CursorField == "" {
+		next = append(next, StringParams(map[string]string{opts.PageParam: strconv.Itoa(page)}))
+	}
+
+	offset := 0
+
+	for n := 1; opts.MaxPages <= 0 || n <= opts.MaxPages; n++ {
+		resp, err := self.SendRequest(append(append([]RequestOption(nil), opts.Options...), next...)...)
+		if err != nil {
+			return err
+		}
+
+		if err := resp.ResponseError(); err != nil {
+			resp.Close()
+			return err
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		if err := f(resp); err == StopPagination {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var data interface{}
+		if opts.NextField != "" || opts.CursorField != "" || opts.PageParam != "" || opts.OffsetParam != "" {
+			if err := json.Unmarshal(body, &data); err != nil {
+				return fmt.Errorf("Cannot parse page %v: %v", n, err)
+			}
+		}
+
+		switch {
+		case opts.NextField != "":
+			u := pageValue(data, opts.NextField)
+			if u == "" {
+				return nil
+			}
+
+			nu, err := resp.Request.URL.Parse(u)
+			if err != nil {
+				return err
+			}
+
+			next = []RequestOption{URL(nu)}
+
+		case opts.CursorField != "":
+			cursor := pageValue(data, opts.CursorField)
+			if cursor == "" {
+				return nil
+			}
+
+			next = append(next, StringParams(map[string]string{opts.CursorParam: cursor}))
+
+		case opts.PageParam != "" || opts.OffsetParam != "":
+			count, ok := pageItems(data, opts.ItemsField)
+			if !ok || count == 0 || (opts.PageSize > 0 && count < opts.PageSize) {
+				return nil
+			}
+
+			if opts.PageParam != "" {
+				page++
+				next = append(next, StringParams(map[string]string{opts.PageParam: strconv.Itoa(page)}))
+			} else {
+				if opts.PageSize > 0 {
+					offset += opts.PageSize
+				} else {
+					offset += count
+				}
+
+				next = append(next, StringParams(map[string]string{opts.OffsetParam: strconv.Itoa(offset)}))
+			}
+
+		default:
+			u := LinkHeader(resp.Header.Values("Link"))["next"]
+			if u == "" {
+				return nil
+			}
+
+			nu, err := resp.Request.URL.Parse(u)
+			if err != nil {
+				return err
+			}
+
+			next = []RequestOption{URL(nu)}
+		}
+	}
+
+	return nil
+}
+
+// return the value at the path as a string ("" if missing or null)
+func pageValue(data interface{}, path string) string {
+	for _, k := range strings.Split(path, ".") {
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+
+		data = m[k]
+	}
+
+	switch v := data.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// return the number of items in the page
+func pageItems(data interface{}, path string) (int, bool) {
+	if path != "" {
+		for _, k := range strings.Split(path, ".") {
+			m, ok := data.(map[string]interface{})
+			if !ok {
+				return 0, false
+			}
+
+			data = m[k]
+		}
+	}
+
+	items, ok := data.([]interface{})
+	return len(items), ok
+}
+
+// LinkHeader parses Link headers (RFC 5988) and returns the URLs by relation type
+// (i.e. "next", "prev", "last")
+func LinkHeader(values []string) map[string]string {
+	links := map[string]string{}
+
+	for _, h := range values {
+		for _, link := range splitLinks(h) {
+			parts := strings.Split(link, ";")
+
+			u := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(u, "<") || !strings.HasSuffix(u, ">") {
+				continue
+			}
+
+			u = u[1 : len(u)-1]
+
+			for _, p := range parts[1:] {
+				kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "rel") {
+					continue
+				}
+
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(kv[1]), `"`)) {
+					if _, ok := links[strings.ToLower(rel)]; !ok {
+						links[strings.ToLower(rel)] = u
+					}
+				}
+			}
+		}
+	}
+
+	return links
+}
+
+// split a Link header on the commas outside of <...> and quoted strings
+func splitLinks(h string) []string {
+	var links []string
+
+	inURL, inQuote := false, false
+	start := 0
+
+	for i, c := range h {
+		switch {
+		case c == '<' && !inQuote:
+			inURL = true
+		case c == '>' && !inQuote:
+			inURL = false
+		case c == '"' && !inURL:
+			inQuote = !inQuote
+		case c == ',' && !inURL && !inQuote:
+			links = append(links, h[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(links, h[start:])
+}
@@ -0,0 +1,135 @@
+package httpclient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// PinningError is returned by the TLS handshake (or reported, in report-only mode) when none of the certificates
+// in the server chain matches the pinned public keys (see PinCertificates)
+type PinningError struct {
+	Subject string   // the subject of the server (leaf) certificate
+	Pins    []string // the SPKI pins of the server certificate chain
+}
+
+func (e *PinningError) Error() string {
+	return fmt.Sprintf("Certificate pinning failed for %q: no pin matches %v", e.Subject, strings.Join(e.Pins, " "))
+}
+
+// SPKIPin returns the pin of the certificate public key: the base64 SHA-256 hash of the SubjectPublicKeyInfo
+// (as in `openssl x509 -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64`)
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// parsePin parses a base64 SHA-256 pin, also as sha256/<base64> or pin-sha256="<base64>"
+func parsePin(pin string) (string, error) {
+	p := strings.TrimSpace(pin)
+	p = strings.TrimPrefix(p, "sha256/")
+	p = strings.Trim(strings.TrimPrefix(p, "pin-sha256="), `"`)
+
+	if b, err := base64.StdEncoding.DecodeString(p); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("Invalid SHA-256 pin %q", pin)
+	}
+
+	return p, nil
+}
+
+// PinCertificates enables public key pinning: the connections fail with a *PinningError if none of the certificates
+// in the verified server chains has one of the SPKI pins (see SPKIPin). With AllowInsecure the chain is not verified,
+// so only the server (leaf) certificate is checked: the other certificates sent by the server can't be trusted. The list should include one or more backup pins (i.e. for the key of the next certificate,
+// or of the intermediate CA) so that the server keys can be rotated without breaking the client.
+//
+// Pinning is checked in addition to the normal CA validation, and only applies to this client (and its clones).
+// An empty list disables pinning.
+func (self *HttpClient) PinCertificates(sha256Pins []string) error {
+	return self.pinCertificates(sha256Pins, false, nil)
+}
+
+// PinCertificatesReportOnly is like PinCertificates but the pinning failures are only reported, calling report
+// (or logging them if report is nil), without failing the connections. This can be used to test the pins before enforcing them.
+func (self *HttpClient) PinCertificatesReportOnly(sha256Pins []string, report func(err *PinningError)) error {
+	if report == nil {
+		report = func(err *PinningError) {
+			stdLogger(self.logger).Println("PINNING:", err)
+		}
+	}
+
+	return self.pinCertificates(sha256Pins, true, report)
+}
+
+func (self *HttpClient) pinCertificates(sha256Pins []string, reportOnly bool, report func(err *PinningError)) error {
+	pins := map[string]bool{}
+
+	for _, pin := range sha256Pins {
+		p, err := parsePin(pin)
+		if err != nil {
+			return err
+		}
+
+		pins[p] = true
+	}
+
+	return self.updateTLSConfig(func(config *tls.Config) {
+		if len(pins) == 0 {
+			config.VerifyPeerCertificate = nil
+			return
+		}
+
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			err := verifyPins(pins, rawCerts, verifiedChains)
+			if err == nil { // a *PinningError, not an error
+				return nil
+			}
+
+			if reportOnly {
+				report(err)
+				return nil
+			}
+
+			return err
+		}
+	})
+}
+
+// verifyPins checks that one of the certificates in the verified chains has one of the pins.
+// If the chain is not verified, only the leaf certificate is checked (the handshake proves that the server has its key,
+// but any certificate can be added to the chain).
+func verifyPins(pins map[string]bool, rawCerts [][]byte, verifiedChains [][]*x509.Certificate) *PinningError {
+	var certs []*x509.Certificate
+
+	if len(verifiedChains) > 0 {
+		for _, chain := range verifiedChains {
+			certs = append(certs, chain...)
+		}
+	} else if len(rawCerts) > 0 {
+		if cert, err := x509.ParseCertificate(rawCerts[0]); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+
+	perr := &PinningError{}
+	seen := map[string]bool{}
+
+	for i, cert := range certs {
+		pin := SPKIPin(cert)
+		if pins[pin] {
+			return nil
+		}
+
+		if i == 0 {
+			perr.Subject = cert.Subject.String()
+		}
+		if !seen[pin] {
+			seen[pin] = true
+			perr.Pins = append(perr.Pins, pin)
+		}
+	}
+
+	return perr
+}
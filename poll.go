@@ -0,0 +1,219 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	OperationFailed = errors.New("Operation failed")
+	PollTimeout     = errors.New("Polling timeout")
+)
+
+// PollOptions configures PollOperation (all optional)
+type PollOptions struct {
+	// additional options for the polling requests (i.e. headers)
+	Options []RequestOption
+
+	// the path of the operation status in the JSON body of the operation (default "status")
+	StatusField string
+
+	// the terminal states (case insensitive, default "Succeeded" and "Failed", "Canceled" or "Cancelled")
+	SucceededStates []string
+	FailedStates    []string
+
+	// the polling interval (default 1s), doubled after each attempt up to MaxInterval, if set.
+	// A Retry-After header in the response overrides the interval.
+	Interval    time.Duration
+	MaxInterval time.Duration
+
+	// the max polling time (0: no limit)
+	Timeout time.Duration
+
+	// the context for the polling requests and waits (default context.Background())
+	Context context.Context
+}
+
+// PollOperation waits for the completion of a long running operation (i.e. Azure-style LRO), started by a request
+// that returned 201 Created or 202 Accepted. Any other response is returned as is.
+//
+// If the response has an Operation-Location (or Azure-AsyncOperation) header, the operation URL is polled until
+// the status field of the JSON body is in a terminal state; if succeeded, the final response is from the Location URL,
+// if set, otherwise the last operation response. If only Location is set, it's polled until the response is not 202.
+//
+// The initial response is closed; the body of the returned response is buffered. If the operation failed
+// the last operation response is returned with an error wrapping OperationFailed.
+func (self *HttpClient) PollOperation(resp *HttpResponse, opts PollOptions) (*HttpResponse, error) {
+	if resp.StatusCode != 201 && resp.StatusCode != 202 {
+		return resp, nil
+	}
+
+	location, err := pollLocation(resp, "Location")
+	if err != nil {
+		return resp, err
+	}
+
+	operation, err := pollLocation(resp, "Operation-Location", "Azure-AsyncOperation")
+	if err != nil {
+		return resp, err
+	}
+
+	if operation == nil && location == nil {
+		return resp, nil
+	}
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if opts.StatusField == "" {
+		opts.StatusField = "status"
+	}
+	if opts.SucceededStates == nil {
+		opts.SucceededStates = []string{"Succeeded"}
+	}
+	if opts.FailedStates == nil {
+		opts.FailedStates = []string{"Failed", "Canceled", "Cancelled"}
+	}
+
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	var deadline time.Time
+	if opts.Timeout > 0 {
+		deadline = time.Now().Add(opts.Timeout)
+	}
+
+	poll := operation
+	if poll == nil {
+		poll = location
+		location = nil
+	}
+
+	next := resp
+
+	for {
+		delay, ok := retryAfter(next.Header, time.Now())
+		if !ok {
+			delay = interval
+
+			if opts.MaxInterval > interval {
+				if interval *= 2; interval > opts.MaxInterval {
+					interval = opts.MaxInterval
+				}
+			}
+		}
+
+		next.Close()
+
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			return nil, PollTimeout
+		}
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+
+		var body []byte
+
+		next, body, err = self.pollGet(ctx, poll, opts.Options)
+		if err != nil {
+			return next, err
+		}
+
+		if operation == nil { // Location polling
+			if next.StatusCode == 202 {
+				if u, _ := pollLocation(next, "Location"); u != nil {
+					poll = u
+				}
+
+				continue
+			}
+
+			return next, nil
+		}
+
+		var data interface{}
+		json.Unmarshal(body, &data)
+
+		state := pageValue(data, opts.StatusField)
+
+		switch {
+		case matchState(state, opts.FailedStates):
+			return next, fmt.Errorf("%w: %v", OperationFailed, state)
+
+		case matchState(state, opts.SucceededStates):
+			if location == nil {
+				return next, nil
+			}
+
+			next.Close()
+			next, _, err = self.pollGet(ctx, location, opts.Options)
+			return next, err
+		}
+	}
+}
+
+// GET the polling URL, returning the response with a buffered body (or the response error)
+func (self *HttpClient) pollGet(ctx context.Context, u *url.URL, options []RequestOption) (*HttpResponse, []byte, error) {
+	resp, err := CheckStatus(self.SendRequest(append([]RequestOption{Method("GET"), URL(u), Context(ctx)}, options...)...))
+	if err != nil {
+		return resp, nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, body, nil
+}
+
+// return the first of the location headers, resolved against the request URL
+func pollLocation(resp *HttpResponse, headers ...string) (*url.URL, error) {
+	for _, h := range headers {
+		if v := resp.Header.Get(h); v != "" {
+			if resp.Request == nil {
+				return url.Parse(v)
+			}
+
+			return resp.Request.URL.Parse(v)
+		}
+	}
+
+	return nil, nil
+}
+
+func matchState(state string, states []string) bool {
+	for _, s := range states {
+		if strings.EqualFold(state, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,255 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostConfig contains the per-host settings for the clients of a Pool
+type HostConfig struct {
+	// TLS configuration for this host (the host gets its own transport)
+	TLSConfig *tls.Config
+
+	// max number of connections to this host (0: use the shared transport settings).
+	// If set, the host gets its own transport.
+	MaxConns int
+
+	// request timeout for this host (0: use the template timeout)
+	Timeout time.Duration
+
+	// headers added to the template headers
+	Headers map[string]string
+
+	// if set, called to further configure the client (i.e. to set the authentication)
+	Configure func(client *HttpClient) error
+}
+
+// Pool manages one configured HttpClient per host, for services that call many backends.
+//
+// The clients are cloned from the Template, so they share its transport (and connection pool),
+// unless the host configuration requires a dedicated transport (see HostConfig).
+type Pool struct {
+	// the client used as a template for the per-host clients
+	Template *HttpClient
+
+	// if set, called to configure the client for a host without a HostConfig
+	Configure func(host string, client *HttpClient) error
+
+	lock    sync.Mutex
+	configs map[string]*HostConfig
+	clients map[string]*HttpClient
+}
+
+// Create a new Pool, with the specified template client (if nil, a new default client is used)
+func NewPool(template *HttpClient) *Pool {
+	if template == nil {
+		template, _ = NewHttpClientE("")
+	}
+
+	return &Pool{Template: template}
+}
+
+// Set the configuration for the specified host (as in URL.Host, i.e. "api.example.com" or "localhost:8080").
+// The current client for the host, if any, is discarded.
+func (p *Pool) SetHost(host string, config HostConfig) {
+	host = strings.ToLower(host)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.configs == nil {
+		p.configs = make(map[string]*HostConfig)
+	}
+
+	p.configs[host] = &config
+	p.removeClient(host)
+}
+
+// Remove the configuration and the client for the specified host
+func (p *Pool) Remove(host string) {
+	host = strings.ToLower(host)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.configs, host)
+	p.removeClient(host)
+}
+
+// remove the clients for the host (for any scheme)
+func (p *Pool) removeClient(host string) {
+	for k, client := range p.clients {
+		if !strings.HasSuffix(k, "://"+host) {
+			continue
+		}
+
+		delete(p.clients, k)
+
+		if tr := client.httpTransport(); tr != nil && tr != p.Template.httpTransport() {
+			tr.CloseIdleConnections()
+		}
+	}
+}
+
+// For returns the client for the host of the specified URL, creating it if needed.
+// The client BaseURL is set to the URL scheme and host.
+func (p *Pool) For(urlStr string) (*HttpClient, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.ForURL(u)
+}
+
+// ForURL returns the client for the host of the specified URL, creating it if needed.
+func (p *Pool) ForURL(u *url.URL) (*HttpClient, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("No host in URL %q", u.String())
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	host := strings.ToLower(u.Host)
+	key := scheme + "://" + host
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if client, ok := p.clients[key]; ok {
+		return client, nil
+	}
+
+	client, err := p.newClient(host)
+	if err != nil {
+		return nil, err
+	}
+
+	client.BaseURL = &url.URL{Scheme: scheme, Host: u.Host}
+
+	if p.clients == nil {
+		p.clients = make(map[string]*HttpClient)
+	}
+
+	p.clients[key] = client
+	return client, nil
+}
+
+func (p *Pool) newClient(host string) (*HttpClient, error) {
+	client := p.Template.cloneClient()
+
+	config, ok := p.configs[host]
+	if !ok {
+		if p.Configure != nil {
+			if err := p.Configure(host, client); err != nil {
+				return nil, err
+			}
+		}
+
+		return client, nil
+	}
+
+	if config.TLSConfig != nil || config.MaxConns > 0 {
+		tr := cloneTransport(client.GetTransport())
+		if tr == nil {
+			return nil, fmt.Errorf("Unsupported transport %T", client.GetTransport())
+		}
+
+		client.SetTransport(tr)
+
+		ht := client.httpTransport()
+		if config.TLSConfig != nil {
+			ht.TLSClientConfig = config.TLSConfig.Clone()
+		}
+		if config.MaxConns > 0 {
+			ht.MaxConnsPerHost = config.MaxConns
+			ht.MaxIdleConnsPerHost = config.MaxConns
+		}
+	}
+
+	if config.Timeout > 0 { // don't use SetTimeout, that would change the shared transport
+		client.client.Timeout = config.Timeout
+	}
+
+	for k, v := range config.Headers {
+		client.Headers[k] = v
+	}
+
+	if config.Configure != nil {
+		if err := config.Configure(client); err != nil {
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// Hosts returns the list of hosts (as scheme://host) with an active client
+func (p *Pool) Hosts() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	hosts := make([]string, 0, len(p.clients))
+	for k := range p.clients {
+		hosts = append(hosts, k)
+	}
+
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Close the idle connections of all the clients in the pool
+func (p *Pool) CloseIdleConnections() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, client := range p.clients {
+		if tr := client.httpTransport(); tr != nil {
+			tr.CloseIdleConnections()
+		}
+	}
+
+	if tr := p.Template.httpTransport(); tr != nil {
+		tr.CloseIdleConnections()
+	}
+}
+
+// return a copy of the transport with a new *http.Transport (preserving a LoggingTransport, LenientTransport
+// or ProtocolTransport wrapper),
+// or nil if the transport is not supported
+func cloneTransport(rt http.RoundTripper) http.RoundTripper {
+	switch t := rt.(type) {
+	case *http.Transport:
+		return t.Clone()
+
+	case *LenientTransport:
+		if tr, ok := t.unwrap().(*http.Transport); ok {
+			return &LenientTransport{Transport: tr.Clone()}
+		}
+
+	case *ProtocolTransport:
+		if t.Transport != nil {
+			pt := *t
+			pt.Transport = t.Transport.Clone()
+			return &pt
+		}
+
+	case *LoggingTransport:
+		if inner := cloneTransport(t.t); inner != nil {
+			lt := *t
+			lt.t = inner
+			return &lt
+		}
+	}
+
+	return nil
+}
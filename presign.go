@@ -0,0 +1,157 @@
+package httpclient
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	NoSigner         = errors.New("No signer")
+	PresignExpired   = errors.New("Presigned URL expired")
+	InvalidSignature = errors.New("Invalid signature")
+)
+
+// Presigner is implemented by the signers that can put the signature in the URL query parameters (presigned URLs),
+// so that the URL can be used by another HTTP client (i.e. a browser) without the credentials
+type Presigner interface {
+	Presign(req *http.Request, expires time.Duration) (string, error)
+}
+
+// PresignURL returns a presigned URL for the request (method and URL), valid for the specified time.
+// The signer must implement Presigner (i.e. SigV4Signer or HMACSigner).
+//
+// Note that the presigned URL only covers the method, the URL and the Host: the other headers and the body are not signed.
+func PresignURL(req *http.Request, signer Signer, expires time.Duration) (string, error) {
+	p, ok := signer.(Presigner)
+	if !ok {
+		return "", fmt.Errorf("Signer %T doesn't support presigned URLs", signer)
+	}
+
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return "", fmt.Errorf("Unsupported scheme %q", req.URL.Scheme)
+	}
+
+	return p.Presign(req, expires)
+}
+
+// PresignURL returns a presigned URL for the request with the specified options (see BuildRequest),
+// signed with the request signer (see Sign) or the client signer
+func (self *HttpClient) PresignURL(expires time.Duration, options ...RequestOption) (string, error) {
+	req, err := self.BuildRequest(options...)
+	if err != nil {
+		return "", err
+	}
+
+	s := self.requestSigner(req)
+	if s == nil {
+		return "", NoSigner
+	}
+
+	return PresignURL(req, s, expires)
+}
+
+// the query parameter for the expiration time of the HMAC presigned URLs (Unix time)
+const hmacExpiresParam = "X-Expires"
+
+// Presign returns a presigned URL for the request: the timestamp, key id and signature are set in query parameters
+// named as the headers (see TimestampHeader, KeyIDHeader and SignatureHeader) and the expiration time (Unix time)
+// in the X-Expires parameter, that is also signed. Only the Host of the signed Headers is signed,
+// and the body hash is the hash of an empty body (see VerifyPresigned).
+func (s *HMACSigner) Presign(req *http.Request, expires time.Duration) (string, error) {
+	if expires <= 0 {
+		return "", fmt.Errorf("Invalid expiration %v", expires)
+	}
+
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+
+	now = now.UTC()
+	timestamp := s.timestamp(now)
+
+	u := *req.URL
+	query := u.Query()
+	query.Del(defaultString(s.SignatureHeader, "X-Signature"))
+	query.Set(defaultString(s.TimestampHeader, "X-Timestamp"), timestamp)
+	query.Set(hmacExpiresParam, strconv.FormatInt(now.Add(expires).Unix(), 10))
+	if s.KeyID != "" {
+		query.Set(defaultString(s.KeyIDHeader, "X-Key-Id"), s.KeyID)
+	}
+
+	u.RawQuery = query.Encode()
+
+	signature := s.presignature(&http.Request{Method: req.Method, URL: &u, Host: req.Host, Header: http.Header{}}, timestamp, now)
+
+	query.Set(defaultString(s.SignatureHeader, "X-Signature"), signature)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// VerifyPresigned verifies a request for a presigned URL (see Presign), on the server side. It returns PresignExpired
+// if the URL is expired and InvalidSignature if the signature doesn't match. Note that the key id is not checked.
+func (s *HMACSigner) VerifyPresigned(req *http.Request) error {
+	query := req.URL.Query()
+
+	signature := query.Get(defaultString(s.SignatureHeader, "X-Signature"))
+	timestamp := query.Get(defaultString(s.TimestampHeader, "X-Timestamp"))
+
+	expires, err := strconv.ParseInt(query.Get(hmacExpiresParam), 10, 64)
+	if err != nil || signature == "" || timestamp == "" {
+		return InvalidSignature
+	}
+
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+
+	if now.Unix() > expires {
+		return PresignExpired
+	}
+
+	var signed time.Time
+	if s.TimestampFormat != "" {
+		signed, err = time.Parse(s.TimestampFormat, timestamp)
+	} else {
+		var ts int64
+		ts, err = strconv.ParseInt(timestamp, 10, 64)
+		signed = time.Unix(ts, 0)
+	}
+	if err != nil {
+		return InvalidSignature
+	}
+
+	query.Del(defaultString(s.SignatureHeader, "X-Signature"))
+
+	u := *req.URL
+	u.RawQuery = query.Encode()
+
+	expected := s.presignature(&http.Request{Method: req.Method, URL: &u, Host: req.Host, Header: http.Header{}}, timestamp, signed)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return InvalidSignature
+	}
+
+	return nil
+}
+
+// the hex signature of a presigned request (without headers and body, except Host if signed)
+func (s *HMACSigner) presignature(req *http.Request, timestamp string, now time.Time) string {
+	ps := *s
+	ps.Headers = nil
+
+	for _, h := range s.Headers {
+		if strings.EqualFold(h, "Host") {
+			ps.Headers = []string{h}
+		}
+	}
+
+	canonical := ps.CanonicalRequest(req, timestamp, nil)
+	return hex.EncodeToString(hmacSHA256(s.signingKey(now), []byte(canonical)))
+}
@@ -0,0 +1,155 @@
+// Package protobody implements the protobuf and gRPC-Web request bodies and response decoding,
+// in a separate package so that the httpclient package doesn't depend on protobuf.
+package protobody
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gobs/httpclient"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	ProtobufContentType = "application/x-protobuf"
+	GrpcWebContentType  = "application/grpc-web+proto"
+)
+
+var (
+	InvalidGrpcWebFrame = errors.New("Invalid gRPC-Web frame")
+	CompressedGrpcWeb   = errors.New("Compressed gRPC-Web messages are not supported")
+)
+
+// GrpcError is the error returned by Decode for gRPC-Web responses with a non-zero grpc-status
+type GrpcError struct {
+	Code    int
+	Message string
+}
+
+func (e GrpcError) Error() string {
+	return fmt.Sprintf("grpc-status %d: %s", e.Code, e.Message)
+}
+
+// set the request body as a binary protobuf message (Content-Type application/x-protobuf)
+func Body(msg proto.Message) httpclient.RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		b, err := proto.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", ProtobufContentType)
+		return httpclient.Body(bytes.NewReader(b))(req)
+	}
+}
+
+// set the request body as a gRPC-Web message (Content-Type application/grpc-web+proto).
+// gRPC-Web calls are POST requests to /package.Service/Method.
+func GrpcWebBody(msg proto.Message) httpclient.RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		b, err := proto.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		frame := make([]byte, 5, 5+len(b))
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(b)))
+		frame = append(frame, b...)
+
+		req.Header.Set("Content-Type", GrpcWebContentType)
+		req.Header.Set("Accept", GrpcWebContentType)
+		req.Header.Set("X-Grpc-Web", "1")
+		return httpclient.Body(bytes.NewReader(frame))(req)
+	}
+}
+
+// Decode decodes the response body as a protobuf message.
+//
+// For gRPC-Web responses (application/grpc-web and application/grpc-web-text) the message is extracted
+// from the data frame and a GrpcError is returned if the grpc-status (in the trailer frame or in the headers)
+// is not 0.
+func Decode(resp *httpclient.HttpResponse, msg proto.Message) error {
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	ctype := resp.ContentType()
+	if !strings.HasPrefix(ctype, "application/grpc-web") {
+		return proto.Unmarshal(b, msg)
+	}
+
+	if strings.HasPrefix(ctype, "application/grpc-web-text") {
+		if b, err = base64.StdEncoding.DecodeString(string(b)); err != nil {
+			return err
+		}
+	}
+
+	return decodeGrpcWeb(b, resp.Header, msg)
+}
+
+// decode the gRPC-Web frames: the first data frame is decoded into msg
+func decodeGrpcWeb(b []byte, header http.Header, msg proto.Message) error {
+	var data []byte
+
+	trailer := http.Header{}
+
+	for len(b) > 0 {
+		if len(b) < 5 {
+			return InvalidGrpcWebFrame
+		}
+
+		flags := b[0]
+		n := binary.BigEndian.Uint32(b[1:5])
+		if uint64(n) > uint64(len(b)-5) {
+			return InvalidGrpcWebFrame
+		}
+
+		frame := b[5 : 5+n]
+		b = b[5+n:]
+
+		switch {
+		case flags&0x80 != 0: // trailers
+			for _, line := range strings.Split(string(frame), "\r\n") {
+				if k, v, ok := strings.Cut(line, ":"); ok {
+					trailer.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+				}
+			}
+
+		case flags&0x01 != 0:
+			return CompressedGrpcWeb
+
+		case data == nil:
+			data = frame
+		}
+	}
+
+	status, message := trailer.Get("Grpc-Status"), trailer.Get("Grpc-Message")
+	if status == "" { // trailers-only response
+		status, message = header.Get("Grpc-Status"), header.Get("Grpc-Message")
+	}
+
+	if status != "" && status != "0" {
+		code, err := strconv.Atoi(status)
+		if err != nil {
+			return InvalidGrpcWebFrame
+		}
+
+		if m, err := url.PathUnescape(message); err == nil {
+			message = m
+		}
+
+		return GrpcError{Code: code, Message: message}
+	}
+
+	return proto.Unmarshal(data, msg)
+}
@@ -0,0 +1,96 @@
+package protobody
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gobs/httpclient"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestBody(test *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		grpcWeb := r.Header.Get("Content-Type") == GrpcWebContentType
+		if grpcWeb {
+			if len(body) < 5 || r.Header.Get("X-Grpc-Web") != "1" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			body = body[5:]
+		} else if r.Header.Get("Content-Type") != ProtobufContentType {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		var in wrapperspb.StringValue
+		if err := proto.Unmarshal(body, &in); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		out, _ := proto.Marshal(wrapperspb.String(strings.ToUpper(in.GetValue())))
+
+		if !grpcWeb {
+			w.Header().Set("Content-Type", ProtobufContentType)
+			w.Write(out)
+			return
+		}
+
+		w.Header().Set("Content-Type", GrpcWebContentType)
+
+		frame := func(flags byte, b []byte) {
+			w.Write([]byte{flags, 0, 0, byte(len(b) >> 8), byte(len(b))})
+			w.Write(b)
+		}
+
+		if r.URL.Path == "/fail" {
+			frame(0x80, []byte("grpc-status: 5\r\ngrpc-message: not%20found\r\n"))
+			return
+		}
+
+		frame(0, out)
+		frame(0x80, []byte("grpc-status: 0\r\n"))
+	}))
+	defer ts.Close()
+
+	client := httpclient.NewHttpClient(ts.URL)
+
+	for _, grpcWeb := range []bool{false, true} {
+		body := Body(wrapperspb.String("hello"))
+		if grpcWeb {
+			body = GrpcWebBody(wrapperspb.String("hello"))
+		}
+
+		resp, err := httpclient.CheckStatus(client.SendRequest(httpclient.POST, body))
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		var out wrapperspb.StringValue
+		if err := Decode(resp, &out); err != nil {
+			test.Fatal(err)
+		}
+
+		if out.GetValue() != "HELLO" {
+			test.Errorf("grpc-web=%v: expected HELLO, got %q", grpcWeb, out.GetValue())
+		}
+	}
+
+	resp, err := httpclient.CheckStatus(client.SendRequest(httpclient.POST, httpclient.Path("/fail"), GrpcWebBody(wrapperspb.String("hello"))))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	var gerr GrpcError
+	if err := Decode(resp, &wrapperspb.StringValue{}); !errors.As(err, &gerr) || gerr.Code != 5 || gerr.Message != "not found" {
+		test.Error("expected grpc-status 5, got", err)
+	}
+}
@@ -0,0 +1,216 @@
+package httpclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Protocol implements the wire format of an HTTP-like text protocol (i.e. ICAP or RTSP),
+// so that it can be sent via ProtocolTransport, with the HttpClient configuration, hooks, logging and tracing.
+//
+// See the icap package for an example.
+type Protocol interface {
+	// Addr returns the address (host:port) of the server for the URL, and true if the connection uses TLS
+	Addr(u *url.URL) (addr string, secure bool)
+
+	// WriteRequest writes the request (including the body, if any)
+	WriteRequest(w *bufio.Writer, req *http.Request) error
+
+	// ReadResponse reads the response. The response body must be read from r
+	// (the connection is closed when the body is closed).
+	ReadResponse(r *bufio.Reader, req *http.Request) (*http.Response, error)
+}
+
+// ProtocolTransport is an http.RoundTripper that sends the requests using the specified Protocol,
+// opening a new connection for each request (closed when the response body is closed).
+//
+// It uses the dialer and TLS configuration of the wrapped Transport (if not nil) and calls the
+// httptrace hooks for the connection, the TLS handshake, the request and the first response byte.
+type ProtocolTransport struct {
+	Protocol  Protocol
+	Transport *http.Transport
+
+	// ALPN protocols for TLS connections
+	NextProtos []string
+}
+
+func (t *ProtocolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	trace := httptrace.ContextClientTrace(ctx)
+
+	closeBody := func() {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+	}
+
+	addr, secure := t.Protocol.Addr(req.URL)
+
+	if trace != nil && trace.GetConn != nil {
+		trace.GetConn(addr)
+	}
+
+	conn, err := Dial(ctx, t.Transport, addr, secure, t.NextProtos...)
+	if err != nil {
+		closeBody()
+		return nil, err
+	}
+
+	if trace != nil && trace.GotConn != nil {
+		trace.GotConn(httptrace.GotConnInfo{Conn: conn})
+	}
+
+	done := make(chan struct{})
+	var once sync.Once
+	stop := func() { once.Do(func() { close(done) }) }
+
+	go func() { // unblock read/write on cancel
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	fail := func(err error) (*http.Response, error) {
+		stop()
+		conn.Close()
+		return nil, err
+	}
+
+	w := bufio.NewWriter(conn)
+	err = t.Protocol.WriteRequest(w, req)
+	if err == nil {
+		err = w.Flush()
+	}
+
+	closeBody()
+
+	if trace != nil && trace.WroteRequest != nil {
+		trace.WroteRequest(httptrace.WroteRequestInfo{Err: err})
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+
+	r := bufio.NewReader(conn)
+	if _, err := r.Peek(1); err == nil && trace != nil && trace.GotFirstResponseByte != nil {
+		trace.GotFirstResponseByte()
+	}
+
+	resp, err := t.Protocol.ReadResponse(r, req)
+	if err != nil {
+		return fail(err)
+	}
+
+	if resp.Request == nil {
+		resp.Request = req
+	}
+
+	resp.Body = rawBody{resp.Body, conn, stop}
+	return resp, nil
+}
+
+// Dial opens a connection to addr (host:port) using the dialer of the transport, if not nil
+// (so that i.e. the PROXY protocol settings apply).
+//
+// If secure, it also performs the TLS handshake using the transport TLS configuration,
+// with the specified ALPN protocols, calling the httptrace TLS hooks of the context.
+func Dial(ctx context.Context, tr *http.Transport, addr string, secure bool, nextProtos ...string) (net.Conn, error) {
+	dial := (&net.Dialer{Timeout: DefaultTimeout}).DialContext
+	if tr != nil && tr.DialContext != nil {
+		dial = tr.DialContext
+	}
+
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil || !secure {
+		return conn, err
+	}
+
+	var config *tls.Config
+	if tr != nil && tr.TLSClientConfig != nil {
+		config = tr.TLSClientConfig.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+
+	config.NextProtos = nextProtos
+
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+
+	tconn := tls.Client(conn, config)
+	err = tconn.HandshakeContext(ctx)
+
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(tconn.ConnectionState(), err)
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tconn, nil
+}
+
+// URLAddr returns the address (host:port) for the URL host, using defaultPort if the URL has no port
+func URLAddr(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+// WriteRequestHeader writes the request line (method, URI and protocol version, i.e. "ICAP/1.0")
+// and the headers of a request for an HTTP-like text protocol, followed by an empty line
+func WriteRequestHeader(w io.Writer, method, uri, proto string, header http.Header) error {
+	if _, err := fmt.Fprintf(w, "%s %s %s\r\n", method, uri, proto); err != nil {
+		return err
+	}
+
+	if err := header.Write(w); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\r\n")
+	return err
+}
+
+// the HTTP/1.1 protocol, with lenient response parsing (see LenientTransport)
+type lenientProtocol struct{}
+
+func (lenientProtocol) Addr(u *url.URL) (string, bool) {
+	if u.Scheme == "https" {
+		return URLAddr(u, "443"), true
+	}
+
+	return URLAddr(u, "80"), false
+}
+
+func (lenientProtocol) WriteRequest(w *bufio.Writer, req *http.Request) error {
+	wreq := *req
+	wreq.Close = true // no keep-alive
+	return wreq.Write(w)
+}
+
+func (lenientProtocol) ReadResponse(r *bufio.Reader, req *http.Request) (*http.Response, error) {
+	return ReadLenientResponse(r, req)
+}
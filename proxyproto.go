@@ -0,0 +1,205 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// PROXY protocol versions (see SetProxyProtocol)
+const (
+	ProxyProtocolNone = 0
+	ProxyProtocolV1   = 1 // human readable header
+	ProxyProtocolV2   = 2 // binary header
+)
+
+// the PROXY protocol v2 signature
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// a dialer that sends the PROXY protocol header on each new connection
+type proxyProtocolDialer struct {
+	tr   *http.Transport
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	lock    sync.RWMutex
+	version int
+	source  *net.TCPAddr
+}
+
+// Send the PROXY protocol header (version 1 or 2, 0 to disable) at the beginning of each new connection,
+// for backends behind HAProxy (or similar load balancers) that expect it.
+//
+// The header advertises source as the client address (nil: the local address of the connection),
+// and the remote address of the connection as the destination.
+// For HTTPS connections the header is sent before the TLS handshake, as expected by the backends.
+//
+// Note that it only works with an *http.Transport (or a LoggingTransport or LenientTransport wrapping it),
+// that is cloned first if it's shared with other clients (i.e. the DefaultTransport).
+func (self *HttpClient) SetProxyProtocol(version int, source *net.TCPAddr) error {
+	if version != ProxyProtocolNone && version != ProxyProtocolV1 && version != ProxyProtocolV2 {
+		return fmt.Errorf("Invalid PROXY protocol version %v", version)
+	}
+
+	tr := self.ownTransport()
+	if tr == nil {
+		return fmt.Errorf("Unsupported transport %T", self.client.Transport)
+	}
+
+	pd, ok := self.proxyDialer(tr)
+	if !ok {
+		if version == ProxyProtocolNone {
+			return nil
+		}
+
+		pd = &proxyProtocolDialer{tr: tr, dial: tr.DialContext}
+		if pd.dial == nil {
+			pd.dial = (&net.Dialer{Timeout: DefaultTimeout, KeepAlive: DefaultTimeout}).DialContext
+		}
+
+		tr.DialContext = pd.DialContext
+		self.proxyProtocol = pd
+	}
+
+	pd.lock.Lock()
+	pd.version, pd.source = version, source
+	pd.lock.Unlock()
+
+	// the pooled connections were opened with the previous settings
+	tr.CloseIdleConnections()
+	return nil
+}
+
+// Get the PROXY protocol version (0 if disabled)
+func (self *HttpClient) GetProxyProtocol() int {
+	if self.proxyProtocol == nil {
+		return ProxyProtocolNone
+	}
+
+	self.proxyProtocol.lock.RLock()
+	defer self.proxyProtocol.lock.RUnlock()
+	return self.proxyProtocol.version
+}
+
+// return the PROXY protocol dialer, if it was installed on this transport
+func (self *HttpClient) proxyDialer(tr *http.Transport) (*proxyProtocolDialer, bool) {
+	if self.proxyProtocol == nil || self.proxyProtocol.tr != tr { // the transport may have been replaced
+		return nil, false
+	}
+
+	return self.proxyProtocol, true
+}
+
+func (d *proxyProtocolDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	d.lock.RLock()
+	version, source := d.version, d.source
+	d.lock.RUnlock()
+
+	if version == ProxyProtocolNone {
+		return conn, nil
+	}
+
+	src, _ := conn.LocalAddr().(*net.TCPAddr)
+	if source != nil {
+		src = source
+	}
+
+	dst, _ := conn.RemoteAddr().(*net.TCPAddr)
+
+	if _, err := conn.Write(ProxyHeader(version, src, dst)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// ProxyHeader returns the PROXY protocol header (version 1 or 2) for a TCP connection from src to dst.
+// If one of the addresses is nil the header is for an UNKNOWN (v1) or LOCAL (v2) connection,
+// and if the addresses are of different families they are both sent as IPv6.
+func ProxyHeader(version int, src, dst *net.TCPAddr) []byte {
+	family := 0
+
+	if src != nil && dst != nil {
+		if src.IP.To4() != nil && dst.IP.To4() != nil {
+			family = 4
+		} else {
+			family = 6
+		}
+	}
+
+	if version == ProxyProtocolV1 {
+		switch family {
+		case 4:
+			return []byte(fmt.Sprintf("PROXY TCP4 %v %v %v %v\r\n", src.IP.To4(), dst.IP.To4(), src.Port, dst.Port))
+		case 6:
+			return []byte(fmt.Sprintf("PROXY TCP6 %v %v %v %v\r\n", ip6(src.IP), ip6(dst.IP), src.Port, dst.Port))
+		default:
+			return []byte("PROXY UNKNOWN\r\n")
+		}
+	}
+
+	var buf bytes.Buffer
+
+	buf.Write(proxyV2Signature)
+
+	if family == 0 {
+		buf.Write([]byte{0x20, 0x00, 0, 0}) // version 2, LOCAL, UNSPEC
+		return buf.Bytes()
+	}
+
+	var addrs []byte
+
+	if family == 4 {
+		buf.Write([]byte{0x21, 0x11}) // version 2, PROXY, TCP over IPv4
+		addrs = append(append(addrs, src.IP.To4()...), dst.IP.To4()...)
+	} else {
+		buf.Write([]byte{0x21, 0x21}) // version 2, PROXY, TCP over IPv6
+		addrs = append(append(addrs, src.IP.To16()...), dst.IP.To16()...)
+	}
+
+	var ports [4]byte
+	binary.BigEndian.PutUint16(ports[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(ports[2:], uint16(dst.Port))
+	addrs = append(addrs, ports[:]...)
+
+	binary.Write(&buf, binary.BigEndian, uint16(len(addrs)))
+	buf.Write(addrs)
+	return buf.Bytes()
+}
+
+// format an IP address in IPv6 form (IPv4 addresses as ::ffff:a.b.c.d)
+func ip6(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return "::ffff:" + ip4.String()
+	}
+
+	return ip.String()
+}
+
+// ParseProxyVersion parses a PROXY protocol version ("v1", "v2", "1", "2", "off")
+func ParseProxyVersion(s string) (int, error) {
+	switch s {
+	case "", "off", "none", "0":
+		return ProxyProtocolNone, nil
+	case "v1", "V1":
+		return ProxyProtocolV1, nil
+	case "v2", "V2":
+		return ProxyProtocolV2, nil
+	}
+
+	if v, err := strconv.Atoi(s); err == nil && (v == ProxyProtocolV1 || v == ProxyProtocolV2) {
+		return v, nil
+	}
+
+	return 0, fmt.Errorf("Invalid PROXY protocol version %q", s)
+}
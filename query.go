@@ -0,0 +1,285 @@
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueryEncoder is implemented by types that encode themselves as query parameters
+type QueryEncoder interface {
+	EncodeValues(key string, v *url.Values) error
+}
+
+var (
+	timeType         = reflect.TypeOf(time.Time{})
+	queryEncoderType = reflect.TypeOf(new(QueryEncoder)).Elem()
+)
+
+// set the request query parameters from a struct, using the `url` field tags
+// (see QueryValues)
+func QueryStruct(v interface{}) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		values, err := QueryValues(v)
+		if err != nil {
+			return nil, err
+		}
+
+		q := req.URL.Query()
+		for k, vv := range values {
+			q[k] = vv
+		}
+
+		req.URL.RawQuery = q.Encode()
+		return req, nil
+	}
+}
+
+// QueryValues encodes a struct into query parameters, using the `url` field tags
+// (compatible with github.com/google/go-querystring):
+//
+//	Name  string    `url:"name"`            // name=value
+//	Skip  string    `url:"-"`               // ignored
+//	Opt   int       `url:"opt,omitempty"`   // omitted if zero value
+//	List  []string  `url:"list,comma"`      // list=a,b,c (also space, semicolon)
+//	Arr   []int     `url:"arr,brackets"`    // arr[]=1&arr[]=2 (default: arr=1&arr=2)
+//	Num   []int     `url:"num,numbered"`    // num0=1&num1=2
+//	Flag  bool      `url:"flag,int"`        // flag=1 or flag=0
+//	When  time.Time `url:"when,unix"`       // seconds since epoch (also unixmilli, unixnano; default RFC3339)
+//	Inner Struct    `url:"inner"`           // inner[field]=value
+//
+// Fields without a tag use the field name, embedded structs are flattened.
+func QueryValues(v interface{}) (url.Values, error) {
+	values := url.Values{}
+	if v == nil {
+		return values, nil
+	}
+
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return values, nil
+		}
+
+		val = val.Elem()
+	}
+
+	if val.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("QueryValues expects a struct, got %v", val.Type())
+	}
+
+	err := encodeStruct(values, val, "")
+	return values, err
+}
+
+func encodeStruct(values url.Values, val reflect.Value, scope string) error {
+	typ := val.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous { // unexported
+			continue
+		}
+
+		sv := val.Field(i)
+
+		tag := sf.Tag.Get("url")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := parseQueryTag(tag)
+
+		if name == "" {
+			if sf.Anonymous {
+				ev := sv
+				for ev.Kind() == reflect.Ptr {
+					if ev.IsNil() {
+						break
+					}
+					ev = ev.Elem()
+				}
+
+				if ev.Kind() == reflect.Struct && ev.Type() != timeType {
+					if err := encodeStruct(values, ev, scope); err != nil {
+						return err
+					}
+
+					continue
+				}
+			}
+
+			name = sf.Name
+		}
+
+		if scope != "" {
+			name = scope + "[" + name + "]"
+		}
+
+		if opts.has("omitempty") && isEmptyValue(sv) {
+			continue
+		}
+
+		if sv.Type().Implements(queryEncoderType) {
+			if sv.Kind() == reflect.Ptr && sv.IsNil() {
+				continue
+			}
+
+			if err := sv.Interface().(QueryEncoder).EncodeValues(name, &values); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		for sv.Kind() == reflect.Ptr {
+			if sv.IsNil() {
+				break
+			}
+
+			sv = sv.Elem()
+		}
+
+		if sv.Kind() == reflect.Ptr { // nil pointer
+			values.Add(name, "")
+			continue
+		}
+
+		switch {
+		case sv.Kind() == reflect.Slice || sv.Kind() == reflect.Array:
+			if sv.Kind() == reflect.Slice && sv.Type().Elem().Kind() == reflect.Uint8 { // []byte
+				values.Add(name, string(sv.Bytes()))
+				continue
+			}
+
+			encodeList(values, name, sv, opts)
+
+		case sv.Type() == timeType:
+			values.Add(name, queryValue(sv, opts))
+
+		case sv.Kind() == reflect.Struct:
+			if err := encodeStruct(values, sv, name); err != nil {
+				return err
+			}
+
+		default:
+			values.Add(name, queryValue(sv, opts))
+		}
+	}
+
+	return nil
+}
+
+func encodeList(values url.Values, name string, sv reflect.Value, opts queryTagOptions) {
+	var sep string
+
+	switch {
+	case opts.has("comma"):
+		sep = ","
+	case opts.has("space"):
+		sep = " "
+	case opts.has("semicolon"):
+		sep = ";"
+	}
+
+	if sep != "" {
+		items := make([]string, sv.Len())
+		for i := range items {
+			items[i] = queryValue(sv.Index(i), opts)
+		}
+
+		values.Add(name, strings.Join(items, sep))
+		return
+	}
+
+	for i := 0; i < sv.Len(); i++ {
+		k := name
+		if opts.has("brackets") {
+			k = name + "[]"
+		} else if opts.has("numbered") {
+			k = name + strconv.Itoa(i)
+		}
+
+		values.Add(k, queryValue(sv.Index(i), opts))
+	}
+}
+
+// queryValue returns the string representation of a scalar value
+func queryValue(v reflect.Value, opts queryTagOptions) string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Bool && opts.has("int") {
+		if v.Bool() {
+			return "1"
+		}
+
+		return "0"
+	}
+
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+
+		switch {
+		case opts.has("unix"):
+			return strconv.FormatInt(t.Unix(), 10)
+		case opts.has("unixmilli"):
+			return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+		case opts.has("unixnano"):
+			return strconv.FormatInt(t.UnixNano(), 10)
+		default:
+			return t.Format(time.RFC3339)
+		}
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).IsZero()
+	}
+
+	return false
+}
+
+type queryTagOptions []string
+
+func (o queryTagOptions) has(opt string) bool {
+	for _, s := range o {
+		if s == opt {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseQueryTag(tag string) (string, queryTagOptions) {
+	parts := strings.Split(tag, ",")
+	return parts[0], parts[1:]
+}
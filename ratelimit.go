@@ -0,0 +1,313 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter paces the requests according to the rate limits signaled by the server:
+//
+//   - Retry-After (seconds or HTTP date), for 429 Too Many Requests and 503 Service Unavailable responses
+//   - RateLimit-Remaining and RateLimit-Reset (or the X-RateLimit- variants): when there are no requests left,
+//     the requests are paused until the reset time (in seconds, or as a Unix timestamp)
+//
+// The pause is global: all the requests waiting on the limiter are blocked.
+// It is used by DrainWithRateLimit, but it can also be used directly (Wait before each request,
+// Update after each response).
+type RateLimiter struct {
+	// minimum interval between requests (0: no limit)
+	Interval time.Duration
+
+	// max number of concurrent requests in DrainWithRateLimit (default 1)
+	Concurrency int
+
+	// max number of retries for a rate-limited request (429 or 503) in DrainWithRateLimit (default 5, -1: no retries)
+	MaxRetries int
+
+	// pause for a rate-limited response without Retry-After or reset (default 1s)
+	DefaultWait time.Duration
+
+	// max pause (0: no limit)
+	MaxWait time.Duration
+
+	lock      sync.Mutex
+	until     time.Time // paused until
+	last      time.Time // last request
+	remaining int       // remaining requests (-1: unknown)
+	known     bool      // remaining is valid
+}
+
+// Create a new RateLimiter with the specified minimum interval between requests and concurrency
+func NewRateLimiter(interval time.Duration, concurrency int) *RateLimiter {
+	return &RateLimiter{Interval: interval, Concurrency: concurrency}
+}
+
+// Wait blocks until a request can be sent, or the context is canceled
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		l.lock.Lock()
+		now := time.Now()
+
+		next := l.until
+		if l.Interval > 0 {
+			if t := l.last.Add(l.Interval); t.After(next) {
+				next = t
+			}
+		}
+
+		if !next.After(now) {
+			l.last = now
+			l.lock.Unlock()
+			return nil
+		}
+
+		l.lock.Unlock()
+
+		t := time.NewTimer(next.Sub(now))
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Update updates the limiter state from the response headers and returns the pause
+// required before the next request (0 if the requests can continue)
+func (l *RateLimiter) Update(resp *http.Response) time.Duration {
+	now := time.Now()
+
+	var wait time.Duration
+
+	limited := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+
+	remaining, hasRemaining := headerInt(resp.Header, "RateLimit-Remaining", "X-RateLimit-Remaining")
+	reset, hasReset := rateLimitReset(resp.Header, now)
+
+	if limited {
+		if ra, ok := retryAfter(resp.Header, now); ok {
+			wait = ra
+		} else if !hasReset {
+			wait = l.DefaultWait
+			if wait <= 0 {
+				wait = time.Second
+			}
+		}
+	}
+
+	if hasReset && reset > wait && (limited || (hasRemaining && remaining <= 0)) {
+		wait = reset
+	}
+
+	if l.MaxWait > 0 && wait > l.MaxWait {
+		wait = l.MaxWait
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if hasRemaining {
+		l.remaining, l.known = int(remaining), true
+	}
+
+	if wait > 0 {
+		if until := now.Add(wait); until.After(l.until) {
+			l.until = until
+		}
+	}
+
+	return wait
+}
+
+// Remaining returns the number of requests left in the current window, as signaled by the server
+// (-1 if unknown)
+func (l *RateLimiter) Remaining() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if !l.known {
+		return -1
+	}
+
+	return l.remaining
+}
+
+func (l *RateLimiter) maxRetries() int {
+	switch {
+	case l.MaxRetries < 0:
+		return 0
+	case l.MaxRetries == 0:
+		return 5
+	}
+
+	return l.MaxRetries
+}
+
+// return the value of the first header found, as an integer
+func headerInt(h http.Header, names ...string) (int64, bool) {
+	for _, name := range names {
+		if v := strings.TrimSpace(h.Get(name)); v != "" {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// return the time until the rate limit reset (the value can be in seconds, or a Unix timestamp)
+func rateLimitReset(h http.Header, now time.Time) (time.Duration, bool) {
+	reset, ok := headerInt(h, "RateLimit-Reset", "X-RateLimit-Reset")
+	if !ok || reset < 0 {
+		return 0, false
+	}
+
+	if reset > 1000000000 { // a timestamp
+		d := time.Unix(reset, 0).Sub(now)
+		if d < 0 {
+			d = 0
+		}
+
+		return d, true
+	}
+
+	return time.Duration(reset) * time.Second, true
+}
+
+// return the Retry-After value (in seconds, or an HTTP date)
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+
+		return d, true
+	}
+
+	return 0, false
+}
+
+// DrainWithRateLimit sends all the requests (each one described by its request options), pacing them with the limiter:
+// rate-limited requests (429 or 503) are retried after the pause signaled by the server, if the request body can be replayed,
+// and all the requests are paused when the server signals that the rate limit is exhausted.
+//
+// f is called for each request (by index) with the final response or error; the response is closed when f returns.
+// The calls to f are serialized, but with Concurrency > 1 they are not in the request order.
+// If f returns an error, no more requests are sent and the error is returned.
+func (self *HttpClient) DrainWithRateLimit(ctx context.Context, requests [][]RequestOption, limiter *RateLimiter,
+	f func(i int, resp *HttpResponse, err error) error) error {
+	if limiter == nil {
+		limiter = &RateLimiter{}
+	}
+
+	workers := limiter.Concurrency
+	if workers <= 0 {
+		workers = 1
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var flock sync.Mutex
+	var ferr error
+
+	jobs := make(chan int)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				resp, err := self.sendLimited(ctx, requests[i], limiter)
+
+				flock.Lock()
+				if ferr == nil {
+					if err := f(i, resp, err); err != nil {
+						ferr = err
+						cancel()
+					}
+				}
+				flock.Unlock()
+
+				resp.Close()
+			}
+		}()
+	}
+
+feed:
+	for i := range requests {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if ferr != nil {
+		return ferr
+	}
+
+	return parent.Err()
+}
+
+// send a request, waiting for the limiter and retrying if rate-limited
+func (self *HttpClient) sendLimited(ctx context.Context, options []RequestOption, limiter *RateLimiter) (*HttpResponse, error) {
+	req, err := self.makeRequest(append([]RequestOption{Context(ctx)}, options...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	for retry := 0; ; retry++ {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		resp, err := self.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		limiter.Update(&resp.Response)
+
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+			return resp, nil
+		}
+
+		if retry >= limiter.maxRetries() {
+			return resp, nil
+		}
+
+		rreq, ok := rewindRequest(req)
+		if !ok {
+			return resp, nil
+		}
+
+		self.debugLog().Println("RATE LIMITED: retry", req.Method, req.URL)
+		resp.Close()
+		req = rreq
+	}
+}
@@ -0,0 +1,303 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SendRaw sends a raw HTTP/1.1 request (as constructed by the caller, without any validation or modification)
+// to the BaseURL host, using the client transport dialer and TLS configuration, and returns the response.
+//
+// The response is parsed leniently (see ReadLenientResponse), to support testing how a server handles malformed requests,
+// and talking to servers that don't fully follow the protocol. The connection is closed when the response body is closed.
+//
+// Note that the client headers, cookies, hooks and redirect policy are not applied.
+func (self *HttpClient) SendRaw(ctx context.Context, raw []byte) (*HttpResponse, error) {
+	if self.BaseURL == nil {
+		return nil, NoBaseURL
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if _, ok := ctx.Deadline(); !ok && self.client.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, self.client.Timeout)
+		defer cancel()
+	}
+
+	conn, err := self.dialRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() { // unblock read/write on cancel
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	self.debugLog().Printf("RAW REQUEST: %v\n%s", self.BaseURL.Host, raw)
+
+	if _, err := conn.Write(raw); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// parse the request (if valid), so that the response has a Request
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(raw)))
+	if err == nil {
+		req.URL = self.BaseURL.ResolveReference(req.URL)
+		req = req.WithContext(ctx)
+	} else {
+		req = nil
+	}
+
+	resp, err := ReadLenientResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{}) // the caller is responsible for reading the body
+	resp.Body = rawBody{resp.Body, conn, nil}
+
+	self.debugLog().Println("RAW RESPONSE:", resp.Status, resp.Header)
+	return &HttpResponse{*resp}, nil
+}
+
+// dial a connection to the BaseURL host (with TLS for https)
+func (self *HttpClient) dialRaw(ctx context.Context) (net.Conn, error) {
+	return dialConn(ctx, self.httpTransport(), self.BaseURL)
+}
+
+// dial a connection to the URL host (with TLS for https), using the transport dialer and TLS configuration, if available
+func dialConn(ctx context.Context, tr *http.Transport, u *url.URL) (net.Conn, error) {
+	addr, secure := lenientProtocol{}.Addr(u)
+	return Dial(ctx, tr, addr, secure, "http/1.1")
+}
+
+// a response body that closes the connection
+type rawBody struct {
+	io.ReadCloser
+	conn net.Conn
+	stop func() // if not nil, called on close
+}
+
+func (b rawBody) Close() error {
+	if b.stop != nil {
+		b.stop()
+	}
+
+	b.ReadCloser.Close()
+	return b.conn.Close()
+}
+
+// ReadLenientResponse reads an HTTP/1.x response, like http.ReadResponse, but accepts some common protocol violations:
+//
+//   - bare LF line endings
+//   - a missing reason phrase in the status line
+//   - malformed header lines (that are ignored)
+//   - a missing or invalid Content-Length (the body is read until the connection is closed)
+//   - a wrong Content-Length, if the server closes the connection after the response
+//     (Connection: close, or HTTP/1.0 without keep-alive): the body is read until the connection is closed
+//
+// Since the end of the body may only be known when the connection is closed, the response is marked with Close.
+func ReadLenientResponse(r *bufio.Reader, req *http.Request) (*http.Response, error) {
+	resp, err := ReadResponseHeader(r, req, "HTTP")
+	if err != nil {
+		return nil, err
+	}
+
+	resp.ContentLength = -1
+
+	switch {
+	case resp.StatusCode/100 == 1 || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified ||
+		(req != nil && req.Method == "HEAD"):
+		resp.Body = http.NoBody
+		resp.ContentLength = 0
+
+	case strings.EqualFold(resp.Header.Get("Transfer-Encoding"), "chunked"):
+		resp.Body = ioutil.NopCloser(httputil.NewChunkedReader(r))
+		resp.TransferEncoding = []string{"chunked"}
+		resp.Header.Del("Transfer-Encoding")
+
+	default:
+		cl, err := strconv.ParseInt(strings.TrimSpace(resp.Header.Get("Content-Length")), 10, 64)
+
+		if err == nil && cl >= 0 && closeDelimited(resp) {
+			resp.Body = ioutil.NopCloser(lenientBody{r}) // ignore the Content-Length
+		} else if err == nil && cl >= 0 {
+			resp.ContentLength = cl
+			resp.Body = ioutil.NopCloser(io.LimitReader(r, cl))
+		} else {
+			resp.Body = ioutil.NopCloser(lenientBody{r}) // read until close
+		}
+	}
+
+	return resp, nil
+}
+
+// ReadResponseHeader reads the status line and the headers of a response for an HTTP-like text protocol
+// (name is the protocol name in the status line, i.e. "HTTP", "ICAP" or "RTSP"), accepting the same protocol violations
+// as ReadLenientResponse. The response body is not set, and should be read from r according to the protocol rules.
+func ReadResponseHeader(r *bufio.Reader, req *http.Request, name string) (*http.Response, error) {
+	resp := &http.Response{Request: req, Header: http.Header{}, Close: true}
+
+	line, err := readLine(r)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(line), " ", 2)
+	proto := parts[0]
+
+	var code, reason string
+
+	if len(parts) > 1 {
+		parts = strings.SplitN(strings.TrimSpace(parts[1]), " ", 2)
+		code = parts[0]
+		if len(parts) > 1 {
+			reason = parts[1]
+		}
+	}
+
+	if !strings.HasPrefix(proto, name+"/") {
+		return nil, fmt.Errorf("Malformed %v response %q", name, line)
+	}
+
+	resp.StatusCode, err = strconv.Atoi(code)
+	if err != nil || resp.StatusCode < 100 || resp.StatusCode > 999 {
+		return nil, fmt.Errorf("Malformed %v status code %q", name, code)
+	}
+
+	if reason = strings.TrimSpace(reason); reason == "" {
+		reason = http.StatusText(resp.StatusCode)
+	}
+
+	resp.Status = strings.TrimSpace(code + " " + reason)
+
+	var ok bool
+	if resp.ProtoMajor, resp.ProtoMinor, ok = parseVersion(proto[len(name)+1:]); !ok {
+		resp.ProtoMajor, resp.ProtoMinor = 1, 1
+		proto = name + "/1.1"
+	}
+
+	resp.Proto = proto
+
+	var last string
+
+	for {
+		line, err := readLine(r)
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				break // no body
+			}
+
+			return nil, err
+		}
+
+		if line == "" {
+			break
+		}
+
+		if (line[0] == ' ' || line[0] == '\t') && last != "" { // obsolete line folding
+			vv := resp.Header[last]
+			vv[len(vv)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		kv := strings.SplitN(line, ":", 2)
+		if k := strings.TrimSpace(kv[0]); len(kv) != 2 || k == "" || strings.ContainsAny(k, " \t") {
+			last = ""
+			continue // ignore malformed header lines
+		}
+
+		last = http.CanonicalHeaderKey(strings.TrimSpace(kv[0]))
+		resp.Header.Add(last, strings.TrimSpace(kv[1]))
+	}
+
+	return resp, nil
+}
+
+// parse a protocol version ("major.minor")
+func parseVersion(v string) (major, minor int, ok bool) {
+	parts := strings.SplitN(v, ".", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil || major < 0 {
+		return 0, 0, false
+	}
+
+	minor, err = strconv.Atoi(parts[1])
+	if err != nil || minor < 0 {
+		return 0, 0, false
+	}
+
+	return major, minor, true
+}
+
+// closeDelimited returns true if the server closes the connection after the response
+func closeDelimited(resp *http.Response) bool {
+	conn := strings.ToLower(resp.Header.Get("Connection"))
+
+	if strings.Contains(conn, "close") {
+		return true
+	}
+
+	return resp.ProtoMajor == 1 && resp.ProtoMinor == 0 && !strings.Contains(conn, "keep-alive")
+}
+
+// a close-delimited body, where a connection reset is the end of the body
+type lenientBody struct {
+	r io.Reader
+}
+
+func (b lenientBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && isConnClosed(err) {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// isConnClosed returns true for the errors returned when reading from a connection closed by the peer
+func isConnClosed(err error) bool {
+	return err == io.EOF || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, net.ErrClosed)
+}
+
+// read a line, terminated by CRLF or LF
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
@@ -0,0 +1,250 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Redactor replaces the values of selected fields in JSON bodies with RedactedValue,
+// so that exported captures (HAR files, request history, logs) don't leak credentials.
+//
+// The fields are selected with a subset of JSONPath:
+//
+//	$.password          a top level field
+//	$.user.token        a nested field
+//	$['api-key']        a field with special characters
+//	$.items[*].secret   a field in all the elements of an array (or all the fields of an object)
+//	$.items[0].secret   a field in a specific element
+//	$..token            a field at any level
+type Redactor struct {
+	paths [][]pathStep
+}
+
+type pathStep struct {
+	name      string
+	index     int
+	wildcard  bool
+	recursive bool
+	isIndex   bool
+}
+
+// NewRedactor returns a Redactor for the specified paths
+func NewRedactor(paths ...string) (*Redactor, error) {
+	r := &Redactor{}
+
+	for _, p := range paths {
+		steps, err := parsePath(p)
+		if err != nil {
+			return nil, err
+		}
+
+		r.paths = append(r.paths, steps)
+	}
+
+	return r, nil
+}
+
+func parsePath(p string) ([]pathStep, error) {
+	invalid := fmt.Errorf("Invalid JSON path %q", p)
+
+	s := strings.TrimSpace(p)
+	if !strings.HasPrefix(s, "$") {
+		return nil, invalid
+	}
+
+	s = s[1:]
+
+	var steps []pathStep
+
+	for len(s) > 0 {
+		var step pathStep
+
+		switch {
+		case strings.HasPrefix(s, ".."):
+			step.recursive = true
+			s = s[2:]
+
+		case strings.HasPrefix(s, "."):
+			s = s[1:]
+
+		case strings.HasPrefix(s, "["):
+			// handled below
+
+		default:
+			return nil, invalid
+		}
+
+		if strings.HasPrefix(s, "[") {
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, invalid
+			}
+
+			sel := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+
+			switch {
+			case sel == "*":
+				step.wildcard = true
+			case len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0]:
+				step.name = sel[1 : len(sel)-1]
+			default:
+				n, err := strconv.Atoi(sel)
+				if err != nil {
+					return nil, invalid
+				}
+
+				step.index = n
+				step.isIndex = true
+			}
+		} else {
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+
+			step.name = s[:end]
+			s = s[end:]
+
+			if step.name == "*" {
+				step.name = ""
+				step.wildcard = true
+			} else if step.name == "" {
+				return nil, invalid
+			}
+		}
+
+		steps = append(steps, step)
+	}
+
+	if len(steps) == 0 {
+		return nil, invalid
+	}
+
+	return steps, nil
+}
+
+// Redact redacts the selected fields in the decoded JSON value (in place) and returns true if any field was redacted
+func (r *Redactor) Redact(v interface{}) bool {
+	redacted := false
+
+	for _, steps := range r.paths {
+		if redactPath(v, steps) {
+			redacted = true
+		}
+	}
+
+	return redacted
+}
+
+// RedactJSON returns the JSON body with the selected fields redacted
+// (the body is returned unchanged if it's not JSON, or if no field was redacted)
+func (r *Redactor) RedactJSON(body []byte) []byte {
+	if r == nil || len(r.paths) == 0 {
+		return body
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return body
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return body
+	}
+
+	if !r.Redact(v) {
+		return body
+	}
+
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return body
+	}
+
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+// RedactString is like RedactJSON, for strings
+func (r *Redactor) RedactString(body string) string {
+	return string(r.RedactJSON([]byte(body)))
+}
+
+// apply the path to the value, redacting the final fields
+func redactPath(v interface{}, steps []pathStep) bool {
+	step := steps[0]
+	last := len(steps) == 1
+	redacted := false
+
+	apply := func(get func() interface{}, set func()) {
+		if last {
+			set()
+			redacted = true
+		} else if redactPath(get(), steps[1:]) {
+			redacted = true
+		}
+	}
+
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		for k, child := range vv {
+			k, child := k, child
+
+			if step.wildcard || (!step.isIndex && k == step.name) {
+				apply(func() interface{} { return child }, func() { vv[k] = RedactedValue })
+			}
+		}
+
+	case []interface{}:
+		for i, child := range vv {
+			i, child := i, child
+
+			if step.wildcard || (step.isIndex && (i == step.index || (step.index < 0 && i == len(vv)+step.index))) {
+				apply(func() interface{} { return child }, func() { vv[i] = RedactedValue })
+			}
+		}
+	}
+
+	if step.recursive { // also look for the same steps at any depth
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			for _, child := range vv {
+				if redactPath(child, steps) {
+					redacted = true
+				}
+			}
+
+		case []interface{}:
+			for _, child := range vv {
+				if redactPath(child, steps) {
+					redacted = true
+				}
+			}
+		}
+	}
+
+	return redacted
+}
+
+// Redact redacts the request and response bodies in the archive
+func (h *HAR) Redact(r *Redactor) {
+	for _, e := range h.Log.Entries {
+		if pd := e.Request.PostData; pd != nil && pd.Encoding == "" {
+			pd.Text = r.RedactString(pd.Text)
+		}
+
+		if c := &e.Response.Content; c.Encoding == "" {
+			c.Text = r.RedactString(c.Text)
+		}
+	}
+}
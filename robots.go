@@ -0,0 +1,343 @@
+package httpclient
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// the max size of a robots.txt file (the rest is ignored)
+	robotsMaxSize = 500 * 1024
+
+	// how long the robots.txt rules are cached, if not specified
+	DefaultRobotsExpire = 24 * time.Hour
+)
+
+// Robots fetches the robots.txt file of each host (caching the rules) and checks
+// if a URL can be fetched by the specified user agent (see RFC 9309).
+//
+// A missing robots.txt (4xx status) allows everything, while a server error
+// or a network error disallows everything (the latter is not cached).
+type Robots struct {
+	// the client used to fetch robots.txt
+	Client *HttpClient
+
+	// the user agent to match (the client UserAgent, if empty)
+	UserAgent string
+
+	// how long the rules are cached (DefaultRobotsExpire, if 0)
+	Expire time.Duration
+
+	lock  sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	lock    sync.Mutex
+	rules   *robotsRules
+	expires time.Time
+}
+
+// the rules of the group matching the user agent
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration // -1 if not specified
+}
+
+type robotsRule struct {
+	allow bool
+	path  string
+}
+
+// Create a new Robots that fetches robots.txt via the specified client
+func NewRobots(client *HttpClient) *Robots {
+	return &Robots{Client: client}
+}
+
+// Allowed returns true if the URL can be fetched, according to the robots.txt rules of its host
+// (fetching them if not cached, or expired)
+func (r *Robots) Allowed(ctx context.Context, u *url.URL) bool {
+	if u.Path == "/robots.txt" {
+		return true
+	}
+
+	return r.get(ctx, u).allowed(u)
+}
+
+// CrawlDelay returns the Crawl-delay of the specified host, or -1 if not specified
+// (or if the rules for the host have not been fetched yet)
+func (r *Robots) CrawlDelay(host string) time.Duration {
+	r.lock.Lock()
+	e := r.hosts[strings.ToLower(host)]
+	r.lock.Unlock()
+
+	if e == nil {
+		return -1
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.rules == nil {
+		return -1
+	}
+
+	return e.rules.crawlDelay
+}
+
+func (r *Robots) userAgent() string {
+	if r.UserAgent != "" {
+		return r.UserAgent
+	}
+
+	return r.Client.UserAgent
+}
+
+func (r *Robots) get(ctx context.Context, u *url.URL) *robotsRules {
+	host := strings.ToLower(u.Host)
+
+	r.lock.Lock()
+	if r.hosts == nil {
+		r.hosts = make(map[string]*robotsEntry)
+	}
+
+	e, ok := r.hosts[host]
+	if !ok {
+		e = &robotsEntry{}
+		r.hosts[host] = e
+	}
+	r.lock.Unlock()
+
+	// the entry lock is held while fetching, so that robots.txt is fetched once per host
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.rules != nil && time.Now().Before(e.expires) {
+		return e.rules
+	}
+
+	rules, cache := r.fetch(ctx, u)
+	if cache {
+		expire := r.Expire
+		if expire <= 0 {
+			expire = DefaultRobotsExpire
+		}
+
+		e.rules = rules
+		e.expires = time.Now().Add(expire)
+	}
+
+	return rules
+}
+
+// fetch and parse robots.txt, returning the rules and if they can be cached
+func (r *Robots) fetch(ctx context.Context, u *url.URL) (*robotsRules, bool) {
+	ru := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", ru.String(), nil)
+	if err != nil {
+		return disallowAll, false
+	}
+
+	if ua := r.userAgent(); ua != "" {
+		req.Header.Set("User-Agent", ua)
+	}
+
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return disallowAll, false
+	}
+
+	defer resp.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return parseRobots(io.LimitReader(resp.Body, robotsMaxSize), r.userAgent()), true
+
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return allowAll, true
+	}
+
+	return disallowAll, true
+}
+
+var (
+	allowAll    = &robotsRules{crawlDelay: -1}
+	disallowAll = &robotsRules{rules: []robotsRule{{allow: false, path: "/"}}, crawlDelay: -1}
+)
+
+// the product token of a user agent (i.e. "MyBot" for "MyBot/1.0 (+http://example.com/bot)")
+func robotsToken(ua string) string {
+	if i := strings.IndexAny(ua, "/ ;("); i >= 0 {
+		ua = ua[:i]
+	}
+
+	return strings.ToLower(ua)
+}
+
+// parse robots.txt, returning the rules of the groups that match the user agent product token
+// (case insensitive), or of the "*" groups
+func parseRobots(r io.Reader, ua string) *robotsRules {
+	token := robotsToken(ua)
+
+	type group struct {
+		agents []string
+		rules  robotsRules
+	}
+
+	var groups []*group
+	var current *group
+	inAgents := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = &group{rules: robotsRules{crawlDelay: -1}}
+				groups = append(groups, current)
+				inAgents = true
+			}
+
+			current.agents = append(current.agents, strings.ToLower(value))
+
+		case "allow", "disallow":
+			inAgents = false
+			if current == nil || value == "" {
+				continue
+			}
+
+			current.rules.rules = append(current.rules.rules, robotsRule{allow: key == "allow", path: value})
+
+		case "crawl-delay":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+
+			if secs, err := strconv.ParseFloat(value, 64); err == nil && secs >= 0 {
+				current.rules.crawlDelay = time.Duration(secs * float64(time.Second))
+			}
+		}
+	}
+
+	// the groups for the user agent win over the "*" groups
+	var matched *robotsRules
+	best := -1
+
+	for _, g := range groups {
+		n := -1
+
+		for _, agent := range g.agents {
+			if token != "" && agent == token {
+				n = 1
+			} else if agent == "*" && n < 0 {
+				n = 0
+			}
+		}
+
+		switch {
+		case n < 0:
+			continue
+
+		case n > best:
+			best = n
+			rules := g.rules
+			rules.rules = append([]robotsRule(nil), g.rules.rules...)
+			matched = &rules
+
+		case n == best:
+			matched.rules = append(matched.rules, g.rules.rules...)
+			if matched.crawlDelay < 0 {
+				matched.crawlDelay = g.rules.crawlDelay
+			}
+		}
+	}
+
+	if matched == nil {
+		return allowAll
+	}
+
+	return matched
+}
+
+// allowed returns true if the URL path is allowed by the rules:
+// the longest matching rule wins, and Allow wins over Disallow for rules of the same length
+func (rr *robotsRules) allowed(u *url.URL) bool {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	allow := true
+	best := -1
+
+	for _, rule := range rr.rules {
+		if !robotsMatch(rule.path, path) {
+			continue
+		}
+
+		if n := len(rule.path); n > best || (n == best && rule.allow) {
+			best = n
+			allow = rule.allow
+		}
+	}
+
+	return allow
+}
+
+// robotsMatch returns true if the path matches the pattern, where "*" matches any sequence
+// of characters and a final "$" matches the end of the path
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+
+	path = path[len(parts[0]):]
+
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(path, part)
+		}
+
+		j := strings.Index(path, part)
+		if j < 0 {
+			return false
+		}
+
+		path = path[j+len(part):]
+	}
+
+	return !anchored || path == ""
+}
@@ -0,0 +1,244 @@
+// Package s3 implements a minimal client for S3-compatible object stores (AWS S3, MinIO, Ceph, R2, ...):
+// list, head, get and put objects, and presigned URLs, with requests signed by httpclient.SigV4Signer.
+//
+// Ranged reads are done with httpclient.HttpFile (see Client.Open).
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gobs/httpclient"
+)
+
+// Client is a client for a bucket
+type Client struct {
+	*httpclient.HttpClient
+
+	// the request signer (also used for the presigned URLs)
+	Signer *httpclient.SigV4Signer
+
+	// the expiration of the presigned URLs used by Open (default: 1 hour)
+	OpenExpires time.Duration
+}
+
+// NewClient creates a client for the bucket at bucketURL, that can be the virtual-hosted style URL
+// (i.e. "https://bucket.s3.us-east-1.amazonaws.com/") or the path style URL (i.e. "http://localhost:9000/bucket/").
+// The signer Service should be "s3".
+func NewClient(bucketURL string, signer *httpclient.SigV4Signer) (*Client, error) {
+	if !strings.HasSuffix(bucketURL, "/") {
+		bucketURL += "/"
+	}
+
+	client, err := httpclient.NewHttpClientE(bucketURL)
+	if err != nil {
+		return nil, err
+	}
+
+	client.SetSigner(signer)
+	return &Client{HttpClient: client, Signer: signer}, nil
+}
+
+// Object describes an object in the bucket
+type Object struct {
+	Key          string
+	Size         int64
+	ModTime      time.Time
+	ETag         string
+	ContentType  string // only for Head
+	StorageClass string // only for List
+}
+
+// the URL of the object (the key is not resolved as a relative path, i.e. "a/../b" is a valid key)
+func (self *Client) objectURL(key string) *url.URL {
+	u := *self.BaseURL
+	u.Path = self.BaseURL.Path + key
+	u.RawPath = escapePath(self.BaseURL.Path) + escapePath(key)
+	u.RawQuery = ""
+	return &u
+}
+
+// send a request for the object, returning os.ErrNotExist for a 404 response
+func (self *Client) send(method, key string, options ...httpclient.RequestOption) (*httpclient.HttpResponse, error) {
+	options = append([]httpclient.RequestOption{httpclient.Method(method), httpclient.URL(self.objectURL(key))}, options...)
+
+	resp, err := httpclient.CheckStatus(self.SendRequest(options...))
+	if err != nil {
+		resp.Close()
+
+		if httpclient.IsStatus(err, http.StatusNotFound) {
+			return nil, os.ErrNotExist
+		}
+
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Head returns the object properties (os.ErrNotExist if not found)
+func (self *Client) Head(key string) (*Object, error) {
+	resp, err := self.send("HEAD", key)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Close()
+
+	obj := &Object{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ETag:        resp.Header.Get("ETag"),
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+
+	obj.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return obj, nil
+}
+
+// Get returns the object content (os.ErrNotExist if not found). The caller must close the returned reader.
+func (self *Client) Get(key string) (io.ReadCloser, error) {
+	resp, err := self.send("GET", key)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// Open opens the object as an HttpFile, for random access with ranged GET requests.
+// The requests use a presigned URL, valid for OpenExpires.
+func (self *Client) Open(key string, options ...httpclient.HttpFileOption) (*httpclient.HttpFile, error) {
+	expires := self.OpenExpires
+	if expires == 0 {
+		expires = time.Hour
+	}
+
+	u, err := self.Presign("GET", key, expires)
+	if err != nil {
+		return nil, err
+	}
+
+	// the presigned URL is only valid for GET: use a ranged GET instead of HEAD to get the size
+	options = append([]httpclient.HttpFileOption{httpclient.FileTransport(self.GetTransport()), httpclient.FileNoHead(true)}, options...)
+	return httpclient.OpenHttpFile(u, nil, options...)
+}
+
+// Put writes the content of r to the object (size is the content length, or -1 if unknown).
+//
+// Note that the body is read in memory to sign the request, unless the signer UnsignedPayload is set.
+func (self *Client) Put(key string, r io.Reader, size int64, contentType string) error {
+	options := []httpclient.RequestOption{httpclient.Body(r), httpclient.ContentLength(size)}
+	if contentType != "" {
+		options = append(options, httpclient.ContentType(contentType))
+	}
+
+	resp, err := self.send("PUT", key, options...)
+	resp.Close()
+	return err
+}
+
+// Presign returns a presigned URL for the object, that can be used for a request with the specified method
+// (i.e. GET or PUT) until it expires (max 7 days)
+func (self *Client) Presign(method, key string, expires time.Duration) (string, error) {
+	req, err := http.NewRequest(strings.ToUpper(method), self.objectURL(key).String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	if self.Host != "" {
+		req.Host = self.Host
+	}
+
+	return httpclient.PresignURL(req, self.Signer, expires)
+}
+
+// the ListObjectsV2 response
+type listBucketResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int64
+		StorageClass string
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+}
+
+// List returns the objects with the specified prefix (all the pages). If delimiter is set (i.e. "/"),
+// the keys that contain the delimiter after the prefix are grouped and returned as common prefixes ("directories").
+func (self *Client) List(prefix, delimiter string) ([]Object, []string, error) {
+	var objects []Object
+	var prefixes []string
+
+	token := ""
+
+	for {
+		params := map[string]interface{}{"list-type": "2"}
+		if prefix != "" {
+			params["prefix"] = prefix
+		}
+		if delimiter != "" {
+			params["delimiter"] = delimiter
+		}
+		if token != "" {
+			params["continuation-token"] = token
+		}
+
+		resp, err := self.send("GET", "", httpclient.Params(params))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var result listBucketResult
+
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid ListObjectsV2 response: %w", err)
+		}
+
+		for _, c := range result.Contents {
+			obj := Object{Key: c.Key, Size: c.Size, ETag: c.ETag, StorageClass: c.StorageClass}
+			obj.ModTime, _ = time.Parse(time.RFC3339, c.LastModified)
+			objects = append(objects, obj)
+		}
+		for _, p := range result.CommonPrefixes {
+			prefixes = append(prefixes, p.Prefix)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+
+		token = result.NextContinuationToken
+	}
+
+	return objects, prefixes, nil
+}
+
+// URI-encode the path as the SigV4 canonical path for S3 (all the characters except the unreserved ones and '/')
+func escapePath(p string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
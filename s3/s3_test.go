@@ -0,0 +1,158 @@
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobs/httpclient"
+)
+
+// a fake object store, with a bucket at /bucket/
+func server(test *testing.T) *httptest.Server {
+	var lock sync.Mutex
+	objects := map[string][]byte{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		q := r.URL.Query()
+
+		if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AK/") &&
+			(q.Get("X-Amz-Signature") == "" || q.Get("X-Amz-Credential") == "" || r.Method != "GET") {
+			test.Errorf("unsigned request %v %v", r.Method, r.URL)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+
+		switch {
+		case r.Method == "PUT":
+			body, _ := io.ReadAll(r.Body)
+			objects[key] = body
+
+		case r.Method == "GET" && key == "" && q.Get("list-type") == "2":
+			// one object per page
+			var keys []string
+			for k := range objects {
+				if strings.HasPrefix(k, q.Get("prefix")) {
+					keys = append(keys, k)
+				}
+			}
+
+			sort.Strings(keys)
+
+			i := 0
+			if t := q.Get("continuation-token"); t != "" {
+				fmt.Sscan(t, &i)
+			}
+
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`)
+			if i < len(keys) {
+				fmt.Fprintf(w, `<Contents><Key>%v</Key><LastModified>2024-01-02T03:04:05.000Z</LastModified><ETag>"e"</ETag><Size>%v</Size><StorageClass>STANDARD</StorageClass></Contents>`,
+					keys[i], len(objects[keys[i]]))
+			}
+			if i+1 < len(keys) {
+				fmt.Fprintf(w, `<IsTruncated>true</IsTruncated><NextContinuationToken>%v</NextContinuationToken>`, i+1)
+			} else {
+				fmt.Fprint(w, `<IsTruncated>false</IsTruncated>`)
+			}
+			fmt.Fprint(w, `<CommonPrefixes><Prefix>dir/</Prefix></CommonPrefixes></ListBucketResult>`)
+
+		case r.Method == "GET" || r.Method == "HEAD":
+			body, ok := objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/plain")
+			http.ServeContent(w, r, key, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), bytes.NewReader(body))
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func TestClient(test *testing.T) {
+	ts := server(test)
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL+"/bucket", httpclient.NewSigV4Signer("AK", "SK", "us-east-1", "s3"))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, key := range []string{"a/one.txt", "a/two words.txt", "b/three.txt"} {
+		if err := client.Put(key, strings.NewReader("content of "+key), -1, "text/plain"); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	objects, prefixes, err := client.List("a/", "/")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	var keys []string
+	for _, o := range objects {
+		keys = append(keys, o.Key)
+	}
+
+	if !reflect.DeepEqual(keys, []string{"a/one.txt", "a/two words.txt"}) || objects[1].Size != 26 || objects[1].ModTime.Year() != 2024 {
+		test.Errorf("unexpected objects %+v", objects)
+	}
+	if len(prefixes) != 2 || prefixes[0] != "dir/" {
+		test.Errorf("unexpected prefixes %v", prefixes)
+	}
+
+	obj, err := client.Head("a/two words.txt")
+	if err != nil || obj.Size != 26 || obj.ContentType != "text/plain" {
+		test.Errorf("unexpected object %+v %v", obj, err)
+	}
+
+	if _, err := client.Head("missing"); err != os.ErrNotExist {
+		test.Error("expected not exist, got", err)
+	}
+
+	r, err := client.Get("b/three.txt")
+	if err != nil {
+		test.Fatal(err)
+	}
+	b, _ := io.ReadAll(r)
+	r.Close()
+
+	if string(b) != "content of b/three.txt" {
+		test.Errorf("unexpected content %q", b)
+	}
+
+	// ranged reads with a presigned URL
+	f, err := client.Open("a/two words.txt")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	b = make([]byte, 9)
+	if _, err := f.ReadAt(b, 11); err != nil || string(b) != "a/two wor" || f.Size() != 26 {
+		test.Errorf("unexpected range %q %v", b, err)
+	}
+
+	u, err := client.Presign("get", "a/two words.txt", time.Minute)
+	if err != nil || !strings.Contains(u, "/bucket/a/two%20words.txt?") || !strings.Contains(u, "X-Amz-Expires=60") {
+		test.Error("unexpected presigned URL", u, err)
+	}
+}
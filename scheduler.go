@@ -0,0 +1,227 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	Disallowed = errors.New("Disallowed by crawl policy")
+)
+
+// Scheduler enforces per-domain "politeness" rules (delay between requests and
+// maximum number of concurrent requests to the same host), as needed by crawlers.
+type Scheduler struct {
+	// minimum delay between requests to the same host
+	Delay time.Duration
+
+	// max number of concurrent requests to the same host (0: no limit)
+	MaxConcurrency int
+
+	// if set, called before each request to check if the URL can be fetched
+	// (i.e. custom crawl rules, see also Robots)
+	Allow func(u *url.URL) bool
+
+	// if set, returns the delay for the specified host, overriding Delay
+	// (i.e. the robots.txt Crawl-delay). A negative value means "use Delay"
+	CrawlDelay func(host string) time.Duration
+
+	// if set, the URLs are checked against the robots.txt rules of their host,
+	// and the robots.txt Crawl-delay, if any, overrides Delay (but not CrawlDelay)
+	Robots *Robots
+
+	lock  sync.Mutex
+	hosts map[string]*hostSchedule
+}
+
+type hostSchedule struct {
+	slots chan struct{}
+	lock  sync.Mutex
+	next  time.Time
+}
+
+// Create a new Scheduler with the specified per-domain delay and concurrency
+func NewScheduler(delay time.Duration, concurrency int) *Scheduler {
+	return &Scheduler{Delay: delay, MaxConcurrency: concurrency}
+}
+
+func (s *Scheduler) host(host string) *hostSchedule {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.hosts == nil {
+		s.hosts = make(map[string]*hostSchedule)
+	}
+
+	h, ok := s.hosts[host]
+	if !ok {
+		h = &hostSchedule{}
+		if s.MaxConcurrency > 0 {
+			h.slots = make(chan struct{}, s.MaxConcurrency)
+		}
+
+		s.hosts[host] = h
+	}
+
+	return h
+}
+
+func (s *Scheduler) delay(host string) time.Duration {
+	if s.CrawlDelay != nil {
+		if d := s.CrawlDelay(host); d >= 0 {
+			return d
+		}
+	}
+
+	if s.Robots != nil {
+		if d := s.Robots.CrawlDelay(host); d >= 0 {
+			return d
+		}
+	}
+
+	return s.Delay
+}
+
+// Wait blocks until a request to the specified URL can be executed, according to the
+// scheduler rules. The returned function must be called when the request is completed,
+// to release the slot (it can be called more than once).
+//
+// Wait returns Disallowed if the URL is rejected by the Allow function or by robots.txt,
+// or the context error if the context is canceled while waiting.
+func (s *Scheduler) Wait(ctx context.Context, u *url.URL) (release func(), err error) {
+	if s.Allow != nil && !s.Allow(u) {
+		return nil, Disallowed
+	}
+
+	if s.Robots != nil && !s.Robots.Allowed(ctx, u) {
+		return nil, Disallowed
+	}
+
+	hostname := strings.ToLower(u.Host)
+	h := s.host(hostname)
+
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	var once sync.Once
+
+	release = func() {
+		once.Do(func() {
+			if h.slots != nil {
+				<-h.slots
+			}
+		})
+	}
+
+	h.lock.Lock()
+	now := time.Now()
+	start := h.next
+	if start.Before(now) {
+		start = now
+	}
+	h.next = start.Add(s.delay(hostname))
+	h.lock.Unlock()
+
+	if wait := start.Sub(now); wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+
+	return release, nil
+}
+
+// Do executes the request via the client, after waiting for the scheduler.
+// The request slot is released when the response body is closed (or if the request fails).
+func (s *Scheduler) Do(client *HttpClient, req *http.Request) (*HttpResponse, error) {
+	release, err := s.Wait(req.Context(), req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if resp != nil && resp.Body != nil {
+		resp.Body = inFlightBody{ReadCloser: resp.Body, release: release}
+	} else {
+		release()
+	}
+
+	return resp, err
+}
+
+// SendRequest creates a request with the specified options and executes it via the client,
+// after waiting for the scheduler
+func (s *Scheduler) SendRequest(client *HttpClient, options ...RequestOption) (*HttpResponse, error) {
+	req, err := client.makeRequest(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Do(client, req)
+}
+
+// Batch executes the requests via the client with the specified number of workers (at least 1),
+// waiting for the scheduler before each request, and calls handle with the response (or the error)
+// of each request. The response is closed when handle returns.
+//
+// The handle function is called from the worker goroutines, so it should be safe for concurrent use.
+// A worker waiting for a busy host doesn't execute other requests in the meantime,
+// so the requests should be ordered (i.e. interleaving the hosts) to keep the workers busy.
+//
+// Batch returns when all the requests have been executed, or the context is canceled
+// (the remaining requests are not executed, the requests in flight are canceled by their own context).
+func (s *Scheduler) Batch(ctx context.Context, client *HttpClient, requests []*http.Request, workers int,
+	handle func(req *http.Request, resp *HttpResponse, err error)) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	queue := make(chan *http.Request)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for req := range queue {
+				resp, err := s.Do(client, req)
+				handle(req, resp, err)
+				resp.Close()
+			}
+		}()
+	}
+
+	var err error
+
+loop:
+	for _, req := range requests {
+		select {
+		case queue <- req:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break loop
+		}
+	}
+
+	close(queue)
+	wg.Wait()
+	return err
+}
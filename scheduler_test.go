@@ -0,0 +1,265 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerDelay(test *testing.T) {
+	s := NewScheduler(50*time.Millisecond, 1)
+	u, _ := url.Parse("http://example.com/page")
+
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		release, err := s.Wait(context.Background(), u)
+		if err != nil {
+			test.Fatal(err)
+		}
+		release()
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		test.Error("requests were not delayed", elapsed)
+	}
+}
+
+func TestSchedulerAllow(test *testing.T) {
+	s := NewScheduler(0, 0)
+	s.Allow = func(u *url.URL) bool { return u.Path != "/private" }
+
+	u, _ := url.Parse("http://example.com/private")
+
+	if _, err := s.Wait(context.Background(), u); err != Disallowed {
+		test.Error("expected Disallowed, got", err)
+	}
+}
+
+func TestSchedulerRelease(test *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	client := NewHttpClient(ts.URL)
+	s := NewScheduler(0, 1)
+
+	resp, err := s.SendRequest(client, Path("/first"))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// the slot is held until the response body is closed
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	u, _ := url.Parse(ts.URL)
+	if _, err := s.Wait(ctx, u); err != context.DeadlineExceeded {
+		test.Error("expected the slot to be busy, got", err)
+	}
+
+	if b := resp.Content(); string(b) != "/first" {
+		test.Error("unexpected response", string(b))
+	}
+
+	resp.Close() // twice
+
+	if resp, err = s.SendRequest(client, Path("/second")); err != nil {
+		test.Fatal(err)
+	}
+	resp.Close()
+}
+
+func TestSchedulerBatch(test *testing.T) {
+	var lock sync.Mutex
+	var inFlight, maxInFlight int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		lock.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprint(w, r.URL.Path)
+
+		lock.Lock()
+		inFlight--
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	client := NewHttpClient(ts.URL)
+	s := NewScheduler(0, 2)
+
+	var requests []*http.Request
+	for i := 0; i < 10; i++ {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("%v/%v", ts.URL, i), nil)
+		requests = append(requests, req)
+	}
+
+	results := map[string]bool{}
+
+	err := s.Batch(context.Background(), client, requests, 5, func(req *http.Request, resp *HttpResponse, err error) {
+		if err != nil {
+			test.Error(err)
+			return
+		}
+
+		b := resp.Content()
+
+		lock.Lock()
+		results[string(b)] = true
+		lock.Unlock()
+	})
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(results) != 10 {
+		test.Error("expected 10 responses, got", len(results))
+	}
+
+	if maxInFlight > 2 {
+		test.Error("expected at most 2 concurrent requests, got", maxInFlight)
+	}
+}
+
+func TestRobotsRules(test *testing.T) {
+	robots := `
+# comment
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+
+User-agent: OtherBot
+User-agent: MyBot
+Disallow: /
+Allow: /open
+Crawl-delay: 1.5
+
+User-agent: mybot
+Disallow: /open/closed
+`
+
+	rules := parseRobots(strings.NewReader(robots), "MyBot/1.0 (+http://example.com/bot)")
+
+	if rules.crawlDelay != 1500*time.Millisecond {
+		test.Error("unexpected crawl delay", rules.crawlDelay)
+	}
+
+	for path, allowed := range map[string]bool{
+		"/":               false,
+		"/open":           true,
+		"/open/page?q=1":  true,
+		"/open/closed/x":  false,
+		"/private/public": false,
+	} {
+		u, _ := url.Parse("http://example.com" + path)
+		if rules.allowed(u) != allowed {
+			test.Errorf("MyBot %v: expected allowed=%v", path, allowed)
+		}
+	}
+
+	rules = parseRobots(strings.NewReader(robots), "Crawler/2.0")
+
+	if rules.crawlDelay != -1 {
+		test.Error("unexpected crawl delay", rules.crawlDelay)
+	}
+
+	for path, allowed := range map[string]bool{
+		"/":                    true,
+		"/private":             false,
+		"/private/x":           false,
+		"/private/public/page": true,
+		"/doc.pdf":             false,
+		"/doc.pdf?download":    true,
+		"/a/b/doc.pdf":         false,
+	} {
+		u, _ := url.Parse("http://example.com" + path)
+		if rules.allowed(u) != allowed {
+			test.Errorf("Crawler %v: expected allowed=%v", path, allowed)
+		}
+	}
+}
+
+func TestSchedulerRobots(test *testing.T) {
+	var fetches int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			atomic.AddInt32(&fetches, 1)
+
+			if r.Header.Get("User-Agent") != "MyBot/1.0" {
+				test.Error("unexpected user agent", r.Header.Get("User-Agent"))
+			}
+
+			fmt.Fprint(w, "User-agent: mybot\nDisallow: /private\nCrawl-delay: 0.05\n")
+			return
+		}
+
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	client := NewHttpClient(ts.URL)
+	client.UserAgent = "MyBot/1.0"
+
+	s := NewScheduler(0, 0)
+	s.Robots = NewRobots(client)
+
+	if _, err := s.SendRequest(client, Path("/private/page")); err != Disallowed {
+		test.Error("expected Disallowed, got", err)
+	}
+
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		resp, err := s.SendRequest(client, Path("/page"))
+		if err != nil {
+			test.Fatal(err)
+		}
+		resp.Close()
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		test.Error("requests were not delayed by the crawl delay", elapsed)
+	}
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		test.Error("expected robots.txt to be fetched once, got", n)
+	}
+}
+
+func TestRobotsMissing(test *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	robots := NewRobots(NewHttpClient(ts.URL))
+
+	u, _ := url.Parse(ts.URL + "/private")
+	if !robots.Allowed(context.Background(), u) {
+		test.Error("expected a missing robots.txt to allow everything")
+	}
+
+	u, _ = url.Parse("http://127.0.0.1:1/page")
+	if robots.Allowed(context.Background(), u) {
+		test.Error("expected an unreachable robots.txt to disallow everything")
+	}
+}
@@ -0,0 +1,327 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SchemeHandler fetches the resources for a non-HTTP URL scheme (i.e. s3:// or gs://),
+// so that they can be requested via HttpClient.SendRequest/Do and read via HttpFile.
+//
+// Fetch should return a response like an HTTP server would (i.e. 404 Not Found if the resource doesn't exist);
+// to be used with HttpFile it should also support HEAD and Range requests (see ContentResponse).
+type SchemeHandler interface {
+	Fetch(req *http.Request) (*http.Response, error)
+}
+
+// SchemeHandlerFunc is a function that implements SchemeHandler
+type SchemeHandlerFunc func(req *http.Request) (*http.Response, error)
+
+func (f SchemeHandlerFunc) Fetch(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+var (
+	schemesLock    sync.RWMutex
+	schemeHandlers = map[string]SchemeHandler{
+		"file": SchemeHandlerFunc(fileScheme),
+		"data": SchemeHandlerFunc(dataScheme),
+	}
+)
+
+// RegisterScheme registers (or replaces) the handler for the URL scheme (http and https can't be registered).
+// A nil handler removes the registration.
+//
+// The builtin handlers are:
+//
+//	file:///path/to/file   a local file (file:relative/path is relative to the current directory)
+//	data:[type][;base64],  an RFC 2397 data URL
+func RegisterScheme(scheme string, h SchemeHandler) {
+	scheme = strings.ToLower(scheme)
+	if scheme == "http" || scheme == "https" {
+		return
+	}
+
+	schemesLock.Lock()
+	defer schemesLock.Unlock()
+
+	if h == nil {
+		delete(schemeHandlers, scheme)
+	} else {
+		schemeHandlers[scheme] = h
+	}
+}
+
+// return the handler for the URL scheme, if registered
+func schemeHandler(u *url.URL) (SchemeHandler, bool) {
+	if u == nil {
+		return nil, false
+	}
+
+	schemesLock.RLock()
+	defer schemesLock.RUnlock()
+
+	h, ok := schemeHandlers[strings.ToLower(u.Scheme)]
+	return h, ok
+}
+
+// fetch the request with the registered scheme handler
+func fetchScheme(h SchemeHandler, req *http.Request) (*http.Response, error) {
+	resp, err := h.Fetch(req)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+
+		return nil, err
+	}
+
+	if resp.Request == nil {
+		resp.Request = req
+	}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	if resp.Body == nil {
+		resp.Body = http.NoBody
+	}
+	if resp.Status == "" {
+		resp.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	if resp.ProtoMajor == 0 {
+		resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/1.1", 1, 1
+	}
+
+	return resp, nil
+}
+
+// ContentResponse returns the response for a GET or HEAD request of content (with the specified size and modification time),
+// handling single Range requests like an HTTP server would. It can be used to implement a SchemeHandler.
+//
+// If content is also an io.Closer, it is closed when the response body is closed.
+func ContentResponse(req *http.Request, content io.ReadSeeker, size int64, modtime time.Time) *http.Response {
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+	}
+
+	closeContent := func() {
+		if c, ok := content.(io.Closer); ok {
+			c.Close()
+		}
+	}
+
+	status := func(code int) *http.Response {
+		resp.StatusCode = code
+		resp.Status = fmt.Sprintf("%d %s", code, http.StatusText(code))
+		return resp
+	}
+
+	if req.Method != "GET" && req.Method != "HEAD" {
+		closeContent()
+		resp.Header.Set("Allow", "GET, HEAD")
+		return status(http.StatusMethodNotAllowed)
+	}
+
+	resp.Header.Set("Accept-Ranges", "bytes")
+	if !modtime.IsZero() {
+		resp.Header.Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+	}
+
+	start, length := int64(0), size
+
+	if r := req.Header.Get("Range"); r != "" {
+		var ok bool
+		if start, length, ok = parseRange(r, size); !ok {
+			closeContent()
+			resp.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			return status(http.StatusRequestedRangeNotSatisfiable)
+		}
+
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+		status(http.StatusPartialContent)
+	} else {
+		status(http.StatusOK)
+	}
+
+	resp.ContentLength = length
+	resp.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+
+	if req.Method == "HEAD" || length == 0 {
+		closeContent()
+		return resp
+	}
+
+	if _, err := content.Seek(start, io.SeekStart); err != nil {
+		closeContent()
+		resp.ContentLength = 0
+		resp.Header.Del("Content-Length")
+		return status(http.StatusInternalServerError)
+	}
+
+	c, _ := content.(io.Closer)
+	resp.Body = contentBody{io.LimitReader(content, length), c}
+	return resp
+}
+
+// a response body that closes the content, if needed
+type contentBody struct {
+	io.Reader
+	c io.Closer
+}
+
+func (b contentBody) Close() error {
+	if b.c != nil {
+		return b.c.Close()
+	}
+
+	return nil
+}
+
+// serve a local file (file:///path or file://localhost/path)
+func fileScheme(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != "" && req.URL.Host != "localhost" {
+		return nil, fmt.Errorf("Unsupported file URL host %q", req.URL.Host)
+	}
+
+	path := req.URL.Path
+	if path == "" {
+		path, _ = url.PathUnescape(req.URL.Opaque) // file:relative/path
+	}
+
+	f, err := os.Open(filepath.FromSlash(path))
+	if err != nil {
+		return fileError(err)
+	}
+
+	fi, err := f.Stat()
+	if err == nil && fi.IsDir() {
+		err = os.ErrPermission
+	}
+	if err != nil {
+		f.Close()
+		return fileError(err)
+	}
+
+	resp := ContentResponse(req, f, fi.Size(), fi.ModTime())
+	if ct := mime.TypeByExtension(filepath.Ext(path)); ct != "" {
+		resp.Header.Set("Content-Type", ct)
+	}
+
+	return resp, nil
+}
+
+// return a "not found" or "forbidden" response for the file error, or the error
+func fileError(err error) (*http.Response, error) {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return &http.Response{StatusCode: http.StatusNotFound}, nil
+	case errors.Is(err, os.ErrPermission):
+		return &http.Response{StatusCode: http.StatusForbidden}, nil
+	}
+
+	return nil, err
+}
+
+// serve the content of a data URL (data:[mediatype][;base64],data)
+func dataScheme(req *http.Request) (*http.Response, error) {
+	data := req.URL.Opaque
+	if req.URL.RawQuery != "" || req.URL.ForceQuery {
+		data += "?" + req.URL.RawQuery
+	}
+
+	i := strings.Index(data, ",")
+	if i < 0 {
+		return nil, fmt.Errorf("Malformed data URL")
+	}
+
+	ctype, payload := data[:i], data[i+1:]
+
+	payload, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, fmt.Errorf("Malformed data URL: %v", err)
+	}
+
+	var content []byte
+
+	if strings.HasSuffix(strings.ToLower(ctype), ";base64") {
+		ctype = ctype[:len(ctype)-7]
+
+		payload = strings.TrimRight(strings.Join(strings.Fields(payload), ""), "=")
+		if content, err = base64.RawStdEncoding.DecodeString(payload); err != nil {
+			if content, err = base64.RawURLEncoding.DecodeString(payload); err != nil {
+				return nil, fmt.Errorf("Malformed data URL: %v", err)
+			}
+		}
+	} else {
+		content = []byte(payload)
+	}
+
+	if ctype == "" || strings.HasPrefix(ctype, ";") {
+		ctype = "text/plain;charset=US-ASCII" + ctype
+	}
+
+	resp := ContentResponse(req, bytes.NewReader(content), int64(len(content)), time.Time{})
+	resp.Header.Set("Content-Type", ctype)
+	return resp, nil
+}
+
+// parse a single range ("bytes=first-last", "bytes=first-" or "bytes=-suffix") and return the start and length
+func parseRange(r string, size int64) (start, length int64, ok bool) {
+	if !strings.HasPrefix(r, "bytes=") || strings.Contains(r, ",") {
+		return 0, 0, false
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(r[6:]), "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	first, last := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+	if first == "" { // suffix
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+
+		return size - n, n, size > 0
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return start, end - start + 1, true
+}
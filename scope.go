@@ -0,0 +1,105 @@
+package httpclient
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The client headers (HttpClient.Headers, including the authentication set with SetBasicAuth, SetBearerToken
+// and SetDigestAuth) and the client cookies without a domain are only sent to the hosts in the client scope:
+// the hosts matching the HeaderScope patterns or, if HeaderScope is empty, the BaseURL host and port
+// (all hosts if the client has no BaseURL).
+//
+// When following a redirect to a different host, the Authorization and Cookie headers are removed
+// (only the matching client cookies are sent) and the client headers are only added if the new host is in scope.
+
+// Set the hosts the client headers are sent to (see MatchHost for the patterns).
+// With no patterns only the BaseURL host is in scope, "*" sends the headers to all hosts.
+func (self *HttpClient) SetHeaderScope(patterns ...string) {
+	self.HeaderScope = patterns
+}
+
+// InScope returns true if the client headers are sent to the URL
+func (self *HttpClient) InScope(u *url.URL) bool {
+	if u == nil {
+		return true
+	}
+
+	if len(self.HeaderScope) == 0 {
+		return self.BaseURL == nil || self.BaseURL.Host == "" || sameHost(u, self.BaseURL)
+	}
+
+	for _, p := range self.HeaderScope {
+		if MatchHost(p, u) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchHost returns true if the URL host matches the pattern:
+//
+//	example.com       example.com (any port)
+//	example.com:8080  example.com on port 8080
+//	*.example.com     the subdomains of example.com
+//	*                 all hosts
+func MatchHost(pattern string, u *url.URL) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	pattern = strings.ToLower(pattern)
+
+	if h, port, err := net.SplitHostPort(pattern); err == nil {
+		if port != urlPort(u) {
+			return false
+		}
+
+		pattern = h
+	}
+
+	host := strings.ToLower(u.Hostname())
+
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+
+	return host == strings.Trim(pattern, "[]")
+}
+
+// remove the client headers (if they have the client values) from a request that is out of scope
+func (self *HttpClient) stripHeaders(req *http.Request) {
+	if self.InScope(req.URL) {
+		return
+	}
+
+	for k, v := range self.Headers {
+		if req.Header.Get(k) == v {
+			req.Header.Del(k)
+		}
+	}
+}
+
+// true if the two URLs have the same host and port
+func sameHost(u1, u2 *url.URL) bool {
+	return strings.EqualFold(u1.Hostname(), u2.Hostname()) && urlPort(u1) == urlPort(u2)
+}
+
+// return the URL port, or the default port for the scheme
+func urlPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		return "443"
+	case "http":
+		return "80"
+	}
+
+	return ""
+}
@@ -0,0 +1,336 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// SecretProvider resolves secret references in the form secret://PROVIDER/path#field
+type SecretProvider interface {
+	Secret(path, field string) (string, error)
+}
+
+// SecretProviderFunc is a function that implements SecretProvider
+type SecretProviderFunc func(path, field string) (string, error)
+
+func (f SecretProviderFunc) Secret(path, field string) (string, error) {
+	return f(path, field)
+}
+
+// the value that replaces the resolved secrets in the logs
+const RedactedValue = "[REDACTED]"
+
+var (
+	reSecretRef = regexp.MustCompile(`secret://[^\s,;"']+`)
+
+	secretsLock     sync.RWMutex
+	secretProviders = map[string]SecretProvider{
+		"env":   SecretProviderFunc(envSecret),
+		"vault": &VaultProvider{},
+	}
+
+	// FileSecrets reads the secrets from files (secret://file/path/to/file[#field]).
+	// It's not registered by default: use RegisterSecretProvider("file", FileSecrets) to enable it.
+	FileSecrets = SecretProviderFunc(fileSecret)
+
+	// ExecSecrets reads the secrets from the output of a command (secret://exec/command%20args[#field]).
+	// It's not registered by default: use RegisterSecretProvider("exec", ExecSecrets) to enable it.
+	ExecSecrets = SecretProviderFunc(execSecret)
+)
+
+type secretHeadersKey struct{}
+
+// RegisterSecretProvider registers (or replaces) the provider for secret://name/... references.
+// A nil provider removes the registration.
+func RegisterSecretProvider(name string, p SecretProvider) {
+	secretsLock.Lock()
+	defer secretsLock.Unlock()
+
+	if p == nil {
+		delete(secretProviders, name)
+	} else {
+		secretProviders[name] = p
+	}
+}
+
+// IsSecretRef returns true if s contains a secret reference
+func IsSecretRef(s string) bool {
+	return strings.Contains(s, "secret://")
+}
+
+// ResolveSecret resolves a secret reference (secret://PROVIDER/path#field).
+//
+// The builtin providers are:
+//
+//	secret://env/NAME                  the environment variable NAME
+//	secret://vault/path#field          a field in a Vault-style secrets store (see VaultProvider)
+//
+// and, if registered (see FileSecrets and ExecSecrets):
+//
+//	secret://file/path/to/file[#field] the content of the file (or a field, if the file contains a JSON object)
+//	secret://exec/command%20args       the output of the command
+func ResolveSecret(ref string) (string, error) {
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != "secret" || u.Host == "" {
+		return "", fmt.Errorf("Invalid secret reference %q", ref)
+	}
+
+	secretsLock.RLock()
+	p, ok := secretProviders[u.Host]
+	secretsLock.RUnlock()
+
+	if !ok {
+		return "", fmt.Errorf("Unknown secret provider %q", u.Host)
+	}
+
+	v, err := p.Secret(strings.TrimPrefix(u.Path, "/"), u.Fragment)
+	if err != nil {
+		return "", fmt.Errorf("Secret %v: %v", u.Host, err) // don't include the full reference, it may contain sensitive info
+	}
+
+	return v, nil
+}
+
+// ExpandSecrets replaces all the secret references in s with their values
+func ExpandSecrets(s string) (string, error) {
+	return expandSecrets(s, ResolveSecret)
+}
+
+func expandSecrets(s string, resolve func(ref string) (string, error)) (string, error) {
+	var err error
+
+	res := reSecretRef.ReplaceAllStringFunc(s, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+
+		v, rerr := resolve(ref)
+		if rerr != nil {
+			err = rerr
+			return ref
+		}
+
+		return v
+	})
+
+	return res, err
+}
+
+// Enable the resolution of the secret references in the client headers (see Headers, SetBasicAuth and SetBearerToken)
+// with the resolver (i.e. ResolveSecret), or disable it (nil, the default).
+//
+// The references are resolved for each request, after logging it, and the values are redacted in the logs.
+// Only the headers set by the client are resolved: the request headers (i.e. set with request options,
+// that may contain untrusted input) are sent as they are.
+func (self *HttpClient) SetSecretResolver(resolve func(ref string) (string, error)) {
+	self.secretResolver = resolve
+}
+
+// resolveSecrets replaces the secret references in the client headers of the request with their values,
+// and marks the headers so that they are redacted in the logs
+func (self *HttpClient) resolveSecrets(req *http.Request) (*http.Request, error) {
+	if self.secretResolver == nil {
+		return req, nil
+	}
+
+	var names []string
+
+	for k, v := range self.Headers {
+		if !IsSecretRef(v) {
+			continue
+		}
+
+		k = http.CanonicalHeaderKey(k)
+
+		if vv := req.Header[k]; len(vv) != 1 || vv[0] != v {
+			continue // not set by the client (or replaced by the request)
+		}
+
+		var rv string
+		var err error
+
+		if strings.HasPrefix(v, "Basic ") && k == "Authorization" {
+			// user:password with secret references (see SetBasicAuth)
+			if rv, err = expandSecrets(v[6:], self.secretResolver); err == nil {
+				rv = "Basic " + base64.StdEncoding.EncodeToString([]byte(rv))
+			}
+		} else {
+			rv, err = expandSecrets(v, self.secretResolver)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header[k] = []string{rv}
+		names = append(names, k)
+	}
+
+	if len(names) == 0 {
+		return req, nil
+	}
+
+	return req.WithContext(context.WithValue(req.Context(), secretHeadersKey{}, names)), nil
+}
+
+// redactHeaders returns a copy of the request headers with the values of resolved secrets redacted
+// (or the original headers, if there are no secrets)
+func redactHeaders(req *http.Request) http.Header {
+	names, _ := req.Context().Value(secretHeadersKey{}).([]string)
+	if len(names) == 0 {
+		return req.Header
+	}
+
+	h := req.Header.Clone()
+	for _, k := range names {
+		if _, ok := h[k]; ok {
+			h[k] = []string{RedactedValue}
+		}
+	}
+
+	return h
+}
+
+func envSecret(path, field string) (string, error) {
+	v, ok := os.LookupEnv(path)
+	if !ok {
+		return "", fmt.Errorf("undefined environment variable %v", path)
+	}
+
+	return v, nil
+}
+
+func fileSecret(path, field string) (string, error) {
+	b, err := os.ReadFile("/" + path)
+	if err != nil {
+		return "", err
+	}
+
+	if field == "" {
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+
+	return jsonField(b, field)
+}
+
+func execSecret(path, field string) (string, error) {
+	args := strings.Fields(path)
+	if len(args) == 0 {
+		return "", fmt.Errorf("missing command")
+	}
+
+	var out bytes.Buffer
+
+	c := exec.Command(args[0], args[1:]...)
+	c.Stdout = &out
+	if err := c.Run(); err != nil {
+		return "", err
+	}
+
+	if field == "" {
+		return strings.TrimRight(out.String(), "\r\n"), nil
+	}
+
+	return jsonField(out.Bytes(), field)
+}
+
+// return a top level field of a JSON object as a string
+func jsonField(b []byte, field string) (string, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "", err
+	}
+
+	return secretField(m, field)
+}
+
+func secretField(m map[string]interface{}, field string) (string, error) {
+	v, ok := m[field]
+	if !ok {
+		return "", fmt.Errorf("field %q not found", field)
+	}
+
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+
+	return fmt.Sprint(v), nil
+}
+
+// VaultProvider reads secrets from a HashiCorp Vault compatible HTTP API
+// (GET {Address}/v1/{path} with the X-Vault-Token header), supporting both the KV version 1
+// ({"data": {...}}) and version 2 ({"data": {"data": {...}}}) response formats.
+//
+// If Address or Token are empty, the VAULT_ADDR and VAULT_TOKEN environment variables are used.
+type VaultProvider struct {
+	Address string
+	Token   string
+	Client  *http.Client // default: http.DefaultClient
+}
+
+func (v *VaultProvider) Secret(path, field string) (string, error) {
+	addr, token := v.Address, v.Token
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	if addr == "" {
+		return "", fmt.Errorf("missing Vault address")
+	}
+
+	if field == "" {
+		return "", fmt.Errorf("missing field")
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("X-Vault-Token", token)
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Unexpected Status %s", resp.Status)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	data := body.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, meta := data["metadata"]; meta { // KV version 2
+			data = inner
+		}
+	}
+
+	return secretField(data, field)
+}
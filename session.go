@@ -0,0 +1,75 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+)
+
+// Session is an HttpClient with its own cookie jar, default headers, authentication and base path,
+// that shares the transport (and the connection pool) with the client it was created from.
+//
+// The session cookie jar is created with the options of the client cookie jar, if it was set with
+// SetCookieJarOptions (and with the default options otherwise).
+//
+// All the HttpClient methods are available on a Session.
+type Session struct {
+	*HttpClient
+}
+
+// Create a new Session, with the base URL resolved relative to the client base URL
+// (an empty path uses the same base URL).
+func (self *HttpClient) NewSession(path string) (*Session, error) {
+	s := &Session{HttpClient: self.cloneClient()}
+
+	jar, err := cookiejar.New(self.jarOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	s.client.Jar = jar
+
+	if path != "" {
+		u, err := url.Parse(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if self.BaseURL != nil {
+			u = self.BaseURL.ResolveReference(u)
+		}
+
+		s.BaseURL = u
+	}
+
+	return s, nil
+}
+
+// Return the cookies in the session cookie jar for the URL (relative to the session base URL)
+func (s *Session) SessionCookies(path string) []*http.Cookie {
+	jar := s.GetCookieJar()
+	if jar == nil {
+		return nil
+	}
+
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil
+	}
+
+	if s.BaseURL != nil {
+		u = s.BaseURL.ResolveReference(u)
+	}
+
+	return jar.Cookies(u)
+}
+
+// Reset the session state: clear the cookies, headers and authentication
+func (s *Session) Reset() {
+	jar, _ := cookiejar.New(s.jarOptions)
+
+	s.client.Jar = jar
+	s.Cookies = nil
+	s.Headers = map[string]string{}
+	s.ClearAuth()
+}
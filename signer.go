@@ -0,0 +1,229 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signer signs the requests, for APIs that require a custom signature
+// (canonicalize the request, compute the signature and set the headers).
+//
+// The request is signed before each attempt (i.e. also when a request is replayed for Digest authentication
+// or a 425 Too Early response), but not when following a redirect.
+type Signer interface {
+	Sign(req *http.Request) error
+}
+
+// SignerFunc is a function that implements Signer
+type SignerFunc func(req *http.Request) error
+
+func (f SignerFunc) Sign(req *http.Request) error {
+	return f(req)
+}
+
+type signerKey struct{}
+
+// sign this request with the specified signer (overrides the client signer)
+func Sign(s Signer) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		return req.WithContext(context.WithValue(req.Context(), signerKey{}, s)), nil
+	}
+}
+
+// Set the signer for all requests (nil to disable signing)
+func (self *HttpClient) SetSigner(s Signer) {
+	self.signer = s
+}
+
+// Get the client signer
+func (self *HttpClient) GetSigner() Signer {
+	return self.signer
+}
+
+// return the request signer (see Sign) or the client signer
+func (self *HttpClient) requestSigner(req *http.Request) Signer {
+	if rs, ok := req.Context().Value(signerKey{}).(Signer); ok {
+		return rs
+	}
+
+	return self.signer
+}
+
+// sign the request with the request or client signer, if any
+func (self *HttpClient) sign(req *http.Request) error {
+	s := self.requestSigner(req)
+	if s == nil {
+		return nil
+	}
+
+	return s.Sign(req)
+}
+
+// HMACSigner signs the requests with an HMAC-SHA256 of the canonical request:
+//
+//	METHOD "\n" PATH "\n" SORTED-QUERY "\n" TIMESTAMP "\n" HEX(SHA256(BODY))
+//
+// followed by a "\n" name ":" value line for each of the signed Headers (with lowercase names).
+//
+// The timestamp is set in the TimestampHeader, the hex encoded signature in the SignatureHeader
+// and, if KeyID is set, the key id in the KeyIDHeader.
+type HMACSigner struct {
+	// the secret key
+	Key []byte
+
+	// if set, sent in KeyIDHeader to identify the key
+	KeyID string
+
+	// if DateScoped, the signing key is HMAC-SHA256(Key, date), where date is the UTC date as YYYYMMDD
+	DateScoped bool
+
+	// additional headers to sign
+	Headers []string
+
+	// header names (the defaults are "X-Signature", "X-Timestamp" and "X-Key-Id")
+	SignatureHeader string
+	TimestampHeader string
+	KeyIDHeader     string
+
+	// time layout for the timestamp (default: Unix time in seconds)
+	TimestampFormat string
+
+	// if set, returns the current time (for testing)
+	Now func() time.Time
+}
+
+// Create a new HMAC-SHA256 signer with the specified key
+func NewHMACSigner(key []byte) *HMACSigner {
+	return &HMACSigner{Key: key}
+}
+
+func (s *HMACSigner) Sign(req *http.Request) error {
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+
+	now = now.UTC()
+	timestamp := s.timestamp(now)
+
+	body, err := requestBody(req)
+	if err != nil {
+		return err
+	}
+
+	key := s.signingKey(now)
+
+	req.Header.Set(defaultString(s.TimestampHeader, "X-Timestamp"), timestamp)
+	if s.KeyID != "" {
+		req.Header.Set(defaultString(s.KeyIDHeader, "X-Key-Id"), s.KeyID)
+	}
+
+	canonical := s.CanonicalRequest(req, timestamp, body)
+	req.Header.Set(defaultString(s.SignatureHeader, "X-Signature"), hex.EncodeToString(hmacSHA256(key, []byte(canonical))))
+	return nil
+}
+
+// the formatted timestamp
+func (s *HMACSigner) timestamp(now time.Time) string {
+	if s.TimestampFormat != "" {
+		return now.Format(s.TimestampFormat)
+	}
+
+	return strconv.FormatInt(now.Unix(), 10)
+}
+
+// the key used to sign the requests at the specified time
+func (s *HMACSigner) signingKey(now time.Time) []byte {
+	if s.DateScoped {
+		return hmacSHA256(s.Key, []byte(now.UTC().Format("20060102")))
+	}
+
+	return s.Key
+}
+
+// CanonicalRequest returns the string to sign for the request
+func (s *HMACSigner) CanonicalRequest(req *http.Request, timestamp string, body []byte) string {
+	hbody := sha256.Sum256(body)
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	lines := []string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		timestamp,
+		hex.EncodeToString(hbody[:]),
+	}
+
+	for _, h := range s.Headers {
+		var value string
+		if strings.EqualFold(h, "Host") {
+			value = req.Host
+			if value == "" {
+				value = req.URL.Host
+			}
+		} else {
+			value = strings.Join(req.Header.Values(h), ",")
+		}
+
+		lines = append(lines, strings.ToLower(h)+":"+strings.TrimSpace(value))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// return the request body, restoring it so that the request can still be sent
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	return body, nil
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func defaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+
+	return s
+}
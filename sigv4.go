@@ -0,0 +1,257 @@
+package httpclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+
+	// UnsignedPayload is the X-Amz-Content-Sha256 value for requests with an unsigned body (see SigV4Signer.UnsignedPayload)
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// the headers that are not signed (they can be changed or added by proxies or by the transport)
+var sigV4Unsigned = map[string]bool{
+	"Authorization":     true,
+	"User-Agent":        true,
+	"X-Amzn-Trace-Id":   true,
+	"Expect":            true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Host":              true, // always signed, from the request
+}
+
+// SigV4Signer signs the requests with AWS Signature Version 4 (for AWS and S3-compatible services),
+// setting the X-Amz-Date, X-Amz-Content-Sha256 and Authorization headers (and X-Amz-Security-Token for temporary credentials).
+// All the request headers are signed, except the ones that can be changed by proxies (i.e. User-Agent).
+type SigV4Signer struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string // for temporary credentials
+
+	Region  string // i.e. us-east-1
+	Service string // i.e. s3
+
+	// if UnsignedPayload, the body is not hashed (X-Amz-Content-Sha256: UNSIGNED-PAYLOAD, only supported by S3),
+	// so that it doesn't need to be read in memory (i.e. for large uploads).
+	// The body is also not hashed if the request already has an X-Amz-Content-Sha256 header.
+	UnsignedPayload bool
+
+	// if set, returns the current time (for testing)
+	Now func() time.Time
+}
+
+// Create a new AWS Signature Version 4 signer
+func NewSigV4Signer(accessKey, secretKey, region, service string) *SigV4Signer {
+	return &SigV4Signer{AccessKey: accessKey, SecretKey: secretKey, Region: region, Service: service}
+}
+
+func (s *SigV4Signer) now() time.Time {
+	if s.Now != nil {
+		return s.Now().UTC()
+	}
+
+	return time.Now().UTC()
+}
+
+func (s *SigV4Signer) Sign(req *http.Request) error {
+	now := s.now()
+
+	payload := req.Header.Get("X-Amz-Content-Sha256")
+	if payload == "" && s.UnsignedPayload {
+		payload = UnsignedPayload
+	}
+	if payload == "" {
+		body, err := requestBody(req)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(body)
+		payload = hex.EncodeToString(sum[:])
+	}
+
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	names := []string{"host"}
+	for k := range req.Header {
+		if !sigV4Unsigned[http.CanonicalHeaderKey(k)] {
+			names = append(names, strings.ToLower(k))
+		}
+	}
+
+	sort.Strings(names)
+
+	scope := s.scope(now)
+	signature := s.signature(now, s.CanonicalRequest(req, req.URL.Query(), names, payload))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%v Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		sigV4Algorithm, s.AccessKey, scope, strings.Join(names, ";"), signature))
+	return nil
+}
+
+// Presign returns the URL of the request with the signature in the query parameters (a presigned URL),
+// valid for the specified time (max 7 days). Only the Host header is signed, and the payload is unsigned,
+// so the URL can be used by any HTTP client (i.e. a browser) for the request method.
+func (s *SigV4Signer) Presign(req *http.Request, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > 7*24*time.Hour {
+		return "", fmt.Errorf("Invalid expiration %v", expires)
+	}
+
+	now := s.now()
+
+	query := req.URL.Query()
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", s.AccessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if s.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	signature := s.signature(now, s.CanonicalRequest(req, query, []string{"host"}, UnsignedPayload))
+
+	u := *req.URL
+	u.RawQuery = sigV4Query(query) + "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+// CanonicalRequest returns the SigV4 canonical request, with the specified query parameters and
+// (lowercase, sorted) signed headers
+func (s *SigV4Signer) CanonicalRequest(req *http.Request, query url.Values, headers []string, payload string) string {
+	var b strings.Builder
+
+	b.WriteString(req.Method + "\n")
+	b.WriteString(s.canonicalPath(req.URL) + "\n")
+	b.WriteString(sigV4Query(query) + "\n")
+
+	for _, h := range headers {
+		var value string
+		if h == "host" {
+			value = canonicalHost(req)
+		} else {
+			values := req.Header.Values(h)
+			for i, v := range values {
+				values[i] = strings.Join(strings.Fields(v), " ")
+			}
+
+			value = strings.Join(values, ",")
+		}
+
+		b.WriteString(h + ":" + value + "\n")
+	}
+
+	b.WriteString("\n" + strings.Join(headers, ";") + "\n")
+	b.WriteString(payload)
+	return b.String()
+}
+
+// the credential scope: date/region/service/aws4_request
+func (s *SigV4Signer) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.Region + "/" + s.Service + "/aws4_request"
+}
+
+// the hex signature of the canonical request
+func (s *SigV4Signer) signature(now time.Time, canonical string) string {
+	hcanonical := sha256.Sum256([]byte(canonical))
+	toSign := sigV4Algorithm + "\n" + now.Format(sigV4TimeFormat) + "\n" + s.scope(now) + "\n" + hex.EncodeToString(hcanonical[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), []byte(now.Format("20060102")))
+	key = hmacSHA256(key, []byte(s.Region))
+	key = hmacSHA256(key, []byte(s.Service))
+	key = hmacSHA256(key, []byte("aws4_request"))
+
+	return hex.EncodeToString(hmacSHA256(key, []byte(toSign)))
+}
+
+// the URI-encoded path (encoded twice, except for S3)
+func (s *SigV4Signer) canonicalPath(u *url.URL) string {
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		segments[i] = sigV4Escape(seg)
+		if s.Service != "s3" {
+			segments[i] = sigV4Escape(segments[i])
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// the request host, without the default port
+func canonicalHost(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	if (req.URL.Scheme == "http" && strings.HasSuffix(host, ":80")) || (req.URL.Scheme == "https" && strings.HasSuffix(host, ":443")) {
+		host = host[:strings.LastIndex(host, ":")]
+	}
+
+	return strings.ToLower(host)
+}
+
+// the query parameters, sorted by name and value and URI-encoded
+func sigV4Query(query url.Values) string {
+	type param struct{ k, v string }
+
+	params := make([]param, 0, len(query))
+
+	for k, values := range query {
+		for _, v := range values {
+			params = append(params, param{sigV4Escape(k), sigV4Escape(v)})
+		}
+	}
+
+	sort.Slice(params, func(i, j int) bool {
+		if params[i].k != params[j].k {
+			return params[i].k < params[j].k
+		}
+
+		return params[i].v < params[j].v
+	})
+
+	encoded := make([]string, len(params))
+	for i, p := range params {
+		encoded[i] = p.k + "=" + p.v
+	}
+
+	return strings.Join(encoded, "&")
+}
+
+// URI-encode all the characters except the unreserved ones (A-Z, a-z, 0-9, '-', '.', '_' and '~')
+func sigV4Escape(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,174 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The request headers that identify a request for the single-flight mode, in addition to method and URL
+// (see SetSingleFlight)
+var DefaultSingleFlightHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language", "Authorization", "Cookie"}
+
+type noSingleFlightKey struct{}
+
+// execute the request also if an identical request is in progress (see SetSingleFlight)
+func NoSingleFlight() RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		return req.WithContext(context.WithValue(req.Context(), noSingleFlightKey{}, true)), nil
+	}
+}
+
+// a request in progress
+type flightCall struct {
+	done chan struct{}
+
+	resp *http.Response // with the body removed
+	body []byte
+	err  error
+}
+
+// singleFlight coalesces the concurrent identical requests
+type singleFlight struct {
+	headers []string
+
+	lock  sync.Mutex
+	calls map[string]*flightCall
+
+	shared int64
+}
+
+func newSingleFlight(headers []string) *singleFlight {
+	if len(headers) == 0 {
+		headers = DefaultSingleFlightHeaders
+	}
+
+	canonical := make([]string, len(headers))
+	for i, h := range headers {
+		canonical[i] = textproto.CanonicalMIMEHeaderKey(h)
+	}
+
+	sort.Strings(canonical)
+	return &singleFlight{headers: canonical, calls: map[string]*flightCall{}}
+}
+
+// eligible returns true for the GET and HEAD requests without a body
+func (sf *singleFlight) eligible(req *http.Request) bool {
+	if req.Method != "GET" && req.Method != "HEAD" && req.Method != "" {
+		return false
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		return false
+	}
+
+	skip, _ := req.Context().Value(noSingleFlightKey{}).(bool)
+	return !skip
+}
+
+// key returns the request method, URL and headers
+func (sf *singleFlight) key(req *http.Request) string {
+	var b strings.Builder
+
+	b.WriteString(req.Method)
+	b.WriteByte(' ')
+	b.WriteString(req.URL.String())
+
+	for _, h := range sf.headers {
+		if v, ok := req.Header[h]; ok {
+			b.WriteString("\n" + h + ": " + strings.Join(v, ", "))
+		}
+	}
+
+	return b.String()
+}
+
+// do executes the request with send, or waits for the identical request in progress
+func (sf *singleFlight) do(req *http.Request, send func(*http.Request) (*HttpResponse, error)) (*HttpResponse, error) {
+	key := sf.key(req)
+
+	sf.lock.Lock()
+	if c, ok := sf.calls[key]; ok {
+		sf.lock.Unlock()
+
+		select {
+		case <-c.done:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+
+		atomic.AddInt64(&sf.shared, 1)
+		return c.response(req)
+	}
+
+	c := &flightCall{done: make(chan struct{})}
+	sf.calls[key] = c
+	sf.lock.Unlock()
+
+	resp, err := send(req)
+	if err == nil {
+		var body []byte
+		if body, err = resp.ContentE(); err == nil {
+			c.resp, c.body = &resp.Response, body
+		}
+	}
+
+	c.err = err
+
+	sf.lock.Lock()
+	delete(sf.calls, key)
+	sf.lock.Unlock()
+
+	close(c.done)
+	return c.response(req)
+}
+
+// response returns a copy of the shared response, for req
+func (c *flightCall) response(req *http.Request) (*HttpResponse, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	resp := &HttpResponse{*c.resp}
+	resp.Header = c.resp.Header.Clone()
+	resp.Trailer = c.resp.Trailer.Clone()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(c.body))
+	resp.Request = req
+
+	return resp, nil
+}
+
+// Coalesce the concurrent identical GET and HEAD requests (same URL and headers, see DefaultSingleFlightHeaders)
+// into one request, sharing the response with all the callers (false disables the mode). headers replaces
+// the list of headers used to identify the requests.
+//
+// The shared response body is read in memory (use it for small responses, i.e. metadata lookups)
+// and the request errors, including the cancellation of the first request, are returned to all the callers.
+// Use NoSingleFlight to always execute a request.
+func (self *HttpClient) SetSingleFlight(enabled bool, headers ...string) {
+	if enabled {
+		self.singleFlight = newSingleFlight(headers)
+	} else {
+		self.singleFlight = nil
+	}
+}
+
+// Return true if the single-flight mode is enabled
+func (self *HttpClient) GetSingleFlight() bool {
+	return self.singleFlight != nil
+}
+
+// Return the number of requests that shared the response of an identical request
+func (self *HttpClient) SingleFlightShared() int64 {
+	if self.singleFlight == nil {
+		return 0
+	}
+
+	return atomic.LoadInt64(&self.singleFlight.shared)
+}
@@ -0,0 +1,192 @@
+package httpclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"time"
+)
+
+// max number of latency samples kept to compute percentiles
+const statsSamples = 10000
+
+// Stats contains the request metrics collected by an HttpClient
+type Stats struct {
+	Requests int64 // number of requests
+	Errors   int64 // requests that failed with a network or protocol error
+	Timeouts int64 // requests that failed with a timeout
+
+	Status map[string]int64 // responses by status class ("2xx", "3xx", "4xx", "5xx")
+
+	NewConns    int64 // requests sent on a new connection
+	ReusedConns int64 // requests sent on a reused connection
+
+	BytesSent     int64 // request body bytes (from Content-Length)
+	BytesReceived int64 // response body bytes read
+
+	// request latency (time to response headers)
+	MinLatency  time.Duration
+	MaxLatency  time.Duration
+	MeanLatency time.Duration
+	P50Latency  time.Duration
+	P90Latency  time.Duration
+	P99Latency  time.Duration
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("{Requests:%v, Errors:%v, Timeouts:%v, Status:%v, NewConns:%v, ReusedConns:%v, BytesSent:%v, BytesReceived:%v, Latency:{Min:%v, Max:%v, Mean:%v, P50:%v, P90:%v, P99:%v}}",
+		s.Requests, s.Errors, s.Timeouts, s.Status,
+		s.NewConns, s.ReusedConns,
+		s.BytesSent, s.BytesReceived,
+		s.MinLatency.Truncate(100*time.Microsecond),
+		s.MaxLatency.Truncate(100*time.Microsecond),
+		s.MeanLatency.Truncate(100*time.Microsecond),
+		s.P50Latency.Truncate(100*time.Microsecond),
+		s.P90Latency.Truncate(100*time.Microsecond),
+		s.P99Latency.Truncate(100*time.Microsecond))
+}
+
+// statsCollector collects the request metrics
+type statsCollector struct {
+	lock sync.Mutex
+
+	stats     Stats
+	total     time.Duration
+	latencies []time.Duration
+	next      int
+}
+
+func (c *statsCollector) reset() {
+	c.lock.Lock()
+	c.stats = Stats{}
+	c.total = 0
+	c.latencies = nil
+	c.next = 0
+	c.lock.Unlock()
+}
+
+func (c *statsCollector) add(f func(s *Stats)) {
+	c.lock.Lock()
+	f(&c.stats)
+	c.lock.Unlock()
+}
+
+// add request tracing to collect connection metrics
+func (c *statsCollector) trace(req *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			c.add(func(s *Stats) {
+				if info.Reused {
+					s.ReusedConns++
+				} else {
+					s.NewConns++
+				}
+			})
+		},
+	}
+
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// record the request result
+func (c *statsCollector) record(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	s := &c.stats
+	s.Requests++
+
+	if req.ContentLength > 0 {
+		s.BytesSent += req.ContentLength
+	}
+
+	if err != nil {
+		if IsTimeout(err) {
+			s.Timeouts++
+		} else {
+			s.Errors++
+		}
+
+		return
+	}
+
+	if s.Status == nil {
+		s.Status = map[string]int64{}
+	}
+
+	s.Status[fmt.Sprintf("%dxx", resp.StatusCode/100)]++
+
+	if s.Requests-s.Errors-s.Timeouts == 1 || elapsed < s.MinLatency { // the first successful request
+		s.MinLatency = elapsed
+	}
+	if elapsed > s.MaxLatency {
+		s.MaxLatency = elapsed
+	}
+
+	c.total += elapsed
+
+	if len(c.latencies) < statsSamples {
+		c.latencies = append(c.latencies, elapsed)
+	} else {
+		c.latencies[c.next] = elapsed
+		c.next = (c.next + 1) % statsSamples
+	}
+}
+
+// return a copy of the current stats, with the computed latencies
+func (c *statsCollector) get() Stats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	s := c.stats
+	s.Status = make(map[string]int64, len(c.stats.Status))
+	for k, v := range c.stats.Status {
+		s.Status[k] = v
+	}
+
+	if n := len(c.latencies); n > 0 {
+		sorted := append([]time.Duration(nil), c.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		s.MeanLatency = c.total / time.Duration(s.Requests-s.Errors-s.Timeouts)
+		s.P50Latency = percentile(sorted, 50)
+		s.P90Latency = percentile(sorted, 90)
+		s.P99Latency = percentile(sorted, 99)
+	}
+
+	return s
+}
+
+// percentile returns the p-th percentile of the sorted list of durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+
+	return sorted[i]
+}
+
+// a ReadCloser that counts the bytes read
+type countingReader struct {
+	io.ReadCloser
+	c *statsCollector
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.c.add(func(s *Stats) { s.BytesReceived += int64(n) })
+	}
+
+	return n, err
+}
@@ -0,0 +1,281 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// BodyStore is a content-addressable store for response bodies.
+//
+// The bodies are saved in dir/objects/xx/hash (where hash is the hex SHA-256 of the content and xx its first two characters),
+// so identical payloads are stored only once, and dir/index.json maps URLs to hashes.
+type BodyStore struct {
+	dir string
+
+	lock  sync.Mutex
+	index map[string]string
+}
+
+// Open (or create) a BodyStore in the specified directory
+func OpenBodyStore(dir string) (*BodyStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0755); err != nil {
+		return nil, err
+	}
+
+	s := &BodyStore{dir: dir, index: map[string]string{}}
+
+	b, err := ioutil.ReadFile(s.indexPath())
+	if err == nil {
+		err = json.Unmarshal(b, &s.index)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Dir returns the store directory
+func (s *BodyStore) Dir() string {
+	return s.dir
+}
+
+func (s *BodyStore) indexPath() string {
+	return filepath.Join(s.dir, "index.json")
+}
+
+func (s *BodyStore) objectPath(hash string) (string, error) {
+	if len(hash) != sha256.Size*2 {
+		return "", fmt.Errorf("Invalid hash %q", hash)
+	}
+
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", fmt.Errorf("Invalid hash %q", hash)
+	}
+
+	return filepath.Join(s.dir, "objects", hash[:2], hash), nil
+}
+
+// Put stores the content and returns its hash
+func (s *BodyStore) Put(content []byte) (string, error) {
+	hash, _, err := s.PutReader(bytes.NewReader(content))
+	return hash, err
+}
+
+// PutReader stores the content of the reader and returns its hash and size
+func (s *BodyStore) PutReader(r io.Reader) (string, int64, error) {
+	tmp, err := ioutil.TempFile(filepath.Join(s.dir, "objects"), ".tmp-")
+	if err != nil {
+		return "", 0, err
+	}
+
+	defer os.Remove(tmp.Name()) // no-op after the rename
+
+	h := sha256.New()
+
+	n, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	path, _ := s.objectPath(hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, n, nil // already stored
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, err
+	}
+
+	return hash, n, nil
+}
+
+// Has returns true if the content with the specified hash is in the store
+func (s *BodyStore) Has(hash string) bool {
+	path, err := s.objectPath(hash)
+	if err != nil {
+		return false
+	}
+
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Open returns a reader for the content with the specified hash
+func (s *BodyStore) Open(hash string) (io.ReadCloser, error) {
+	path, err := s.objectPath(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(path)
+}
+
+// Get returns the content with the specified hash
+func (s *BodyStore) Get(hash string) ([]byte, error) {
+	path, err := s.objectPath(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(path)
+}
+
+// SetURL associates the URL with the content hash
+func (s *BodyStore) SetURL(u, hash string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.index[u] == hash {
+		return nil
+	}
+
+	s.index[u] = hash
+	return s.saveIndex()
+}
+
+// Lookup returns the content hash for the URL
+func (s *BodyStore) Lookup(u string) (string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	hash, ok := s.index[u]
+	return hash, ok
+}
+
+// GetURL returns the last content stored for the URL
+func (s *BodyStore) GetURL(u string) ([]byte, error) {
+	hash, ok := s.Lookup(u)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return s.Get(hash)
+}
+
+// URLs returns the sorted list of URLs in the index
+func (s *BodyStore) URLs() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	urls := make([]string, 0, len(s.index))
+	for u := range s.index {
+		urls = append(urls, u)
+	}
+
+	sort.Strings(urls)
+	return urls
+}
+
+// RemoveURL removes the URL from the index (the content is removed by Prune, if not referenced)
+func (s *BodyStore) RemoveURL(u string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.index[u]; !ok {
+		return nil
+	}
+
+	delete(s.index, u)
+	return s.saveIndex()
+}
+
+// Prune removes the content not referenced by the index, except the hashes in keep
+// (i.e. the ones referenced by a HAR file), and returns the number of objects removed
+func (s *BodyStore) Prune(keep ...string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	referenced := map[string]bool{}
+	for _, h := range s.index {
+		referenced[h] = true
+	}
+	for _, h := range keep {
+		referenced[h] = true
+	}
+
+	paths, err := filepath.Glob(filepath.Join(s.dir, "objects", "*", "*"))
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+
+	for _, p := range paths {
+		if referenced[filepath.Base(p)] {
+			continue
+		}
+
+		if err := os.Remove(p); err != nil {
+			return removed, err
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
+
+// save the index atomically (the lock must be held)
+func (s *BodyStore) saveIndex() error {
+	b, err := json.MarshalIndent(s.index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.indexPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.indexPath())
+}
+
+// StoreResponse saves the response body in the store, associated with the request URL,
+// and returns its hash. The response body is replaced, so it can still be read.
+func (s *BodyStore) StoreResponse(resp *HttpResponse) (string, error) {
+	if resp.Body == nil {
+		return "", nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := s.Put(body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.Request != nil {
+		if err := s.SetURL(resp.Request.URL.String(), hash); err != nil {
+			return "", err
+		}
+	}
+
+	return hash, nil
+}
@@ -0,0 +1,153 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Tee copies the response body to w while it's read (multiple calls add more writers).
+// A write error is returned by the body Read, as in io.TeeReader. w is not closed.
+func (resp *HttpResponse) Tee(w io.Writer) {
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+
+	resp.Body = &teeBody{ReadCloser: resp.Body, w: w}
+}
+
+// a response body that copies the data read to w
+type teeBody struct {
+	io.ReadCloser
+
+	w io.Writer
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if n, err := b.w.Write(p[:n]); err != nil {
+			return n, err
+		}
+	}
+
+	return n, err
+}
+
+// Set the directory where the response bodies of all the requests are archived ("" disables the archive).
+//
+// Each body is saved (as it's read) in a file named from the request URL and the response time
+// (i.e. example.com_api_items_20060102T150405.000000000.json). Errors writing the archive don't fail
+// the requests (they are logged, if Verbose).
+func (self *HttpClient) SetResponseArchive(dir string) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	self.archiveDir = dir
+	return nil
+}
+
+// Return the response archive directory ("" if not set)
+func (self *HttpClient) GetResponseArchive() string {
+	return self.archiveDir
+}
+
+var reArchiveName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// archiveName returns the archive file name for the response
+func archiveName(req *http.Request, resp *http.Response, t time.Time) string {
+	name := reArchiveName.ReplaceAllString(req.URL.Host+req.URL.Path, "_")
+	name = strings.Trim(name, "._")
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	if name == "" {
+		name = "response"
+	}
+
+	ext := ".body"
+	if ctype, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		switch ctype {
+		case "application/json":
+			ext = ".json"
+		case "text/plain":
+			ext = ".txt"
+		default:
+			if exts, _ := mime.ExtensionsByType(ctype); len(exts) > 0 {
+				ext = exts[0]
+			}
+		}
+	}
+
+	return fmt.Sprintf("%v_%v%v", name, t.UTC().Format("20060102T150405.000000000"), ext)
+}
+
+// archiveBody tees the response body to a new file in the archive directory
+func (self *HttpClient) archiveBody(req *http.Request, resp *http.Response) {
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+
+	name := archiveName(req, resp, time.Now())
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	var f *os.File
+	var err error
+
+	for i := 1; ; i++ {
+		f, err = os.OpenFile(filepath.Join(self.archiveDir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if !errors.Is(err, os.ErrExist) || i > 100 {
+			break
+		}
+
+		name = fmt.Sprintf("%v-%v%v", base, i, ext)
+	}
+
+	if err != nil {
+		self.debugLog().Println("ARCHIVE:", err)
+		return
+	}
+
+	self.debugLog().Println("ARCHIVE:", req.Method, req.URL, "to", f.Name())
+	resp.Body = &archiveBody{ReadCloser: resp.Body, f: f, client: self}
+}
+
+// a response body that copies the data read to the archive file, closed with the body
+type archiveBody struct {
+	io.ReadCloser
+
+	f      *os.File
+	client *HttpClient
+	err    error
+}
+
+func (b *archiveBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.err == nil {
+		if _, b.err = b.f.Write(p[:n]); b.err != nil {
+			b.client.debugLog().Println("ARCHIVE:", b.err)
+		}
+	}
+
+	return n, err
+}
+
+func (b *archiveBody) Close() error {
+	err := b.ReadCloser.Close()
+	if ferr := b.f.Close(); ferr != nil && b.err == nil {
+		b.client.debugLog().Println("ARCHIVE:", ferr)
+	}
+
+	return err
+}
@@ -0,0 +1,113 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var (
+	templateLock  sync.RWMutex
+	templateFuncs = template.FuncMap{
+		"env":     os.Getenv,
+		"json":    templateJSON,
+		"uuid":    newUUID,
+		"now":     time.Now,
+		"default": templateDefault,
+	}
+)
+
+// RegisterTemplateFunc registers (or replaces) a function available in the request templates.
+// A nil function removes the registration.
+//
+// The default functions are:
+//
+//	env "NAME"        the value of the environment variable NAME
+//	json value        value encoded as JSON (i.e. a quoted and escaped string)
+//	uuid              a random UUID
+//	now               the current time
+//	default def value value, or def if value is empty
+func RegisterTemplateFunc(name string, f interface{}) {
+	templateLock.Lock()
+	defer templateLock.Unlock()
+
+	if f == nil {
+		delete(templateFuncs, name)
+	} else {
+		templateFuncs[name] = f
+	}
+}
+
+// RenderTemplate renders the Go template (see text/template) with data and the registered template functions.
+// Referencing a missing map key is an error: use index for optional values (i.e. {{default 10 (index . "limit")}}).
+func RenderTemplate(tmpl string, data interface{}) ([]byte, error) {
+	return RenderTemplateFuncs(tmpl, data, nil)
+}
+
+// RenderTemplateFuncs is like RenderTemplate, with additional template functions (that override the registered ones)
+// only available to this template: use it for per-caller functions, instead of RegisterTemplateFunc.
+func RenderTemplateFuncs(tmpl string, data interface{}, funcs template.FuncMap) ([]byte, error) {
+	templateLock.RLock()
+	t := template.New("request").Funcs(templateFuncs)
+	templateLock.RUnlock()
+
+	t, err := t.Funcs(funcs).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// set the request body rendering the Go template with data (see RenderTemplate)
+func TemplateBody(tmpl string, data interface{}) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		b, err := RenderTemplate(tmpl, data)
+		if err != nil {
+			return nil, err
+		}
+
+		return Body(bytes.NewReader(b))(req)
+	}
+}
+
+// set the request path rendering the Go template with data (see RenderTemplate).
+// The values are not escaped: use the urlquery function for query parameters.
+func TemplatePath(tmpl string, data interface{}) RequestOption {
+	return func(req *http.Request) (*http.Request, error) {
+		b, err := RenderTemplate(tmpl, data)
+		if err != nil {
+			return nil, err
+		}
+
+		return Path(strings.TrimSpace(string(b)))(req)
+	}
+}
+
+func templateJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func templateDefault(def, v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil:
+		return def
+	case string:
+		if t == "" {
+			return def
+		}
+	}
+
+	return v
+}
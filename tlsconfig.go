@@ -0,0 +1,132 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// ParseTLSVersion parses a TLS version: 1.0, 1.1, 1.2 or 1.3 (also as tls1.2 or TLSv1.2)
+func ParseTLSVersion(s string) (uint16, error) {
+	v := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "tls"), "v")
+
+	switch v {
+	case "1.0", "1":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+
+	return 0, fmt.Errorf("Invalid TLS version %q", s)
+}
+
+// ParseCipherSuites parses a list of cipher suite names (as in tls.CipherSuiteName, i.e. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256),
+// including the insecure ones
+func ParseCipherSuites(names ...string) ([]uint16, error) {
+	suites := map[string]uint16{}
+
+	for _, c := range tls.CipherSuites() {
+		suites[c.Name] = c.ID
+	}
+	for _, c := range tls.InsecureCipherSuites() {
+		suites[c.Name] = c.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+
+	for _, name := range names {
+		id, ok := suites[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("Unknown cipher suite %q", name)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// ParseCurves parses a list of key exchange curve names: X25519, P256, P384, P521 or X25519MLKEM768 (also as P-256 or CurveP256)
+func ParseCurves(names ...string) ([]tls.CurveID, error) {
+	curves := make([]tls.CurveID, 0, len(names))
+
+	for _, name := range names {
+		switch strings.TrimPrefix(strings.Replace(strings.ToUpper(strings.TrimSpace(name)), "-", "", 1), "CURVE") {
+		case "X25519":
+			curves = append(curves, tls.X25519)
+		case "P256":
+			curves = append(curves, tls.CurveP256)
+		case "P384":
+			curves = append(curves, tls.CurveP384)
+		case "P521":
+			curves = append(curves, tls.CurveP521)
+		case "X25519MLKEM768":
+			curves = append(curves, tls.X25519MLKEM768)
+		default:
+			return nil, fmt.Errorf("Unknown curve %q", name)
+		}
+	}
+
+	return curves, nil
+}
+
+// update the TLS configuration of the client transport (a copy of the current one, that is replaced),
+// cloning the transport first if it's shared with other clients (see ownTransport).
+// Note that the idle connections are not closed, since this would also "freeze" the HTTP/2 configuration of the transport.
+func (self *HttpClient) updateTLSConfig(update func(config *tls.Config)) error {
+	tr := self.ownTransport()
+	if tr == nil {
+		return NoHttpTransport
+	}
+
+	config := &tls.Config{}
+	if tr.TLSClientConfig != nil {
+		config = tr.TLSClientConfig.Clone()
+		config.NextProtos = nil // set by the transport, according to the HTTP/2 configuration
+	}
+
+	update(config)
+
+	tr.TLSClientConfig = config // note: this doesn't apply to the pooled connections
+	return nil
+}
+
+// Set the TLS policy of the client: the min and max TLS versions (0: the Go default), the cipher suites
+// (only for TLS 1.2 and earlier, nil: the Go default) and the key exchange curves in order of preference (nil: the Go default).
+// The other TLS settings (i.e. AllowInsecure and SetServerName) are not changed.
+//
+// Note that it only applies to the new connections,
+// and that it only works with an *http.Transport (or a LoggingTransport or LenientTransport wrapping it).
+func (self *HttpClient) SetTLSConfig(min, max uint16, ciphers []uint16, curves []tls.CurveID) error {
+	if min != 0 && max != 0 && min > max {
+		return fmt.Errorf("Invalid TLS versions: min %v > max %v", tls.VersionName(min), tls.VersionName(max))
+	}
+
+	return self.updateTLSConfig(func(config *tls.Config) {
+		config.MinVersion = min
+		config.MaxVersion = max
+		config.CipherSuites = ciphers
+		config.CurvePreferences = curves
+	})
+}
+
+// Set the server name sent in the TLS handshake (SNI) and used to verify the server certificate,
+// for all the requests (i.e. when connecting to an IP address). An empty name restores the default (the request host).
+func (self *HttpClient) SetServerName(sni string) error {
+	return self.updateTLSConfig(func(config *tls.Config) {
+		config.ServerName = sni
+	})
+}
+
+// Return a copy of the TLS configuration of the client transport (nil if not set or not available)
+func (self *HttpClient) GetTLSConfig() *tls.Config {
+	if tr := self.httpTransport(); tr != nil && tr.TLSClientConfig != nil {
+		return tr.TLSClientConfig.Clone()
+	}
+
+	return nil
+}
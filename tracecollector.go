@@ -0,0 +1,261 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// The request phases aggregated by TraceCollector (TTFB is the time to the first response byte
+// and Total includes reading the response body)
+var TracePhases = []string{"dns", "connect", "tls", "request", "wait", "response", "ttfb", "total"}
+
+// PhaseStats contains the aggregated durations of a request phase
+type PhaseStats struct {
+	Count int64 // number of samples (dns, connect and tls are only sampled for new connections)
+
+	Min time.Duration
+	Avg time.Duration
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+// MarshalJSON encodes the durations in milliseconds
+func (p PhaseStats) MarshalJSON() ([]byte, error) {
+	ms := func(d time.Duration) float64 {
+		return float64(d.Microseconds()) / 1000
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"count":  p.Count,
+		"min_ms": ms(p.Min),
+		"avg_ms": ms(p.Avg),
+		"p50_ms": ms(p.P50),
+		"p95_ms": ms(p.P95),
+		"p99_ms": ms(p.P99),
+		"max_ms": ms(p.Max),
+	})
+}
+
+// TraceReport is the aggregation of the collected traces (see TraceCollector)
+type TraceReport struct {
+	Requests    int64 `json:"requests"`
+	Errors      int64 `json:"errors"`
+	NewConns    int64 `json:"new_conns"`
+	ReusedConns int64 `json:"reused_conns"`
+
+	Phases map[string]PhaseStats `json:"phases"` // by phase name (see TracePhases)
+}
+
+// WriteJSON writes the report as JSON
+func (r TraceReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteTable writes the report as a formatted table, with a row for each phase
+func (r TraceReport) WriteTable(w io.Writer) error {
+	fmt.Fprintf(w, "requests: %v errors: %v new conns: %v reused conns: %v\n\n",
+		r.Requests, r.Errors, r.NewConns, r.ReusedConns)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "phase\tcount\tmin\tavg\tp50\tp95\tp99\tmax\t")
+
+	round := func(d time.Duration) time.Duration {
+		return d.Round(10 * time.Microsecond)
+	}
+
+	for _, name := range TracePhases {
+		p, ok := r.Phases[name]
+		if !ok || p.Count == 0 {
+			continue
+		}
+
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t\n",
+			name, p.Count, round(p.Min), round(p.Avg), round(p.P50), round(p.P95), round(p.P99), round(p.Max))
+	}
+
+	return tw.Flush()
+}
+
+// the samples of a request phase
+type phaseCollector struct {
+	count    int64
+	total    time.Duration
+	min, max time.Duration
+	samples  []time.Duration
+	next     int
+}
+
+func (p *phaseCollector) add(d time.Duration) {
+	if p.count == 0 || d < p.min {
+		p.min = d
+	}
+	if d > p.max {
+		p.max = d
+	}
+
+	p.count++
+	p.total += d
+
+	if len(p.samples) < statsSamples {
+		p.samples = append(p.samples, d)
+	} else {
+		p.samples[p.next] = d
+		p.next = (p.next + 1) % statsSamples
+	}
+}
+
+func (p *phaseCollector) stats() PhaseStats {
+	if p.count == 0 {
+		return PhaseStats{}
+	}
+
+	sorted := append([]time.Duration(nil), p.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return PhaseStats{
+		Count: p.count,
+		Min:   p.min,
+		Avg:   p.total / time.Duration(p.count),
+		P50:   percentile(sorted, 50),
+		P95:   percentile(sorted, 95),
+		P99:   percentile(sorted, 99),
+		Max:   p.max,
+	}
+}
+
+// TraceCollector aggregates the RequestTraces of many requests (see HttpClient.SetTraceCollector).
+// It's safe for concurrent use. Percentiles are computed on the last 10000 samples of each phase.
+type TraceCollector struct {
+	lock sync.Mutex
+
+	requests    int64
+	errors      int64
+	newConns    int64
+	reusedConns int64
+
+	phases map[string]*phaseCollector
+}
+
+// NewTraceCollector creates an empty TraceCollector
+func NewTraceCollector() *TraceCollector {
+	c := &TraceCollector{}
+	c.Reset()
+	return c
+}
+
+// Reset removes the collected traces
+func (c *TraceCollector) Reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.requests, c.errors, c.newConns, c.reusedConns = 0, 0, 0, 0
+
+	c.phases = make(map[string]*phaseCollector, len(TracePhases))
+	for _, name := range TracePhases {
+		c.phases[name] = &phaseCollector{}
+	}
+}
+
+// Add adds the trace of a completed request (see RequestTrace.Done)
+func (c *TraceCollector) Add(rt *RequestTrace) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.requests++
+
+	if rt.Reused {
+		c.reusedConns++
+	} else {
+		c.newConns++
+	}
+
+	// these are only measured for new connections
+	for name, d := range map[string]time.Duration{"dns": rt.DNS, "connect": rt.Connect, "tls": rt.TLSHandshake} {
+		if d > 0 {
+			c.phases[name].add(d)
+		}
+	}
+
+	ttfb := rt.DNS + rt.Connect + rt.TLSHandshake + rt.Request + rt.Wait
+
+	c.phases["request"].add(rt.Request)
+	c.phases["wait"].add(rt.Wait)
+	c.phases["response"].add(rt.Response)
+	c.phases["ttfb"].add(ttfb)
+	c.phases["total"].add(ttfb + rt.Response)
+}
+
+// AddError counts a failed request
+func (c *TraceCollector) AddError() {
+	c.lock.Lock()
+	c.requests++
+	c.errors++
+	c.lock.Unlock()
+}
+
+// Report returns the aggregated traces
+func (c *TraceCollector) Report() TraceReport {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	r := TraceReport{
+		Requests:    c.requests,
+		Errors:      c.errors,
+		NewConns:    c.newConns,
+		ReusedConns: c.reusedConns,
+		Phases:      make(map[string]PhaseStats, len(c.phases)),
+	}
+
+	for name, p := range c.phases {
+		r.Phases[name] = p.stats()
+	}
+
+	return r
+}
+
+// Set the collector for the traces of all the requests sent by this client (nil disables the collection).
+// The trace of a request is added when the response body is closed.
+func (self *HttpClient) SetTraceCollector(c *TraceCollector) {
+	self.traces = c
+}
+
+// Return the client trace collector (nil if not set)
+func (self *HttpClient) GetTraceCollector() *TraceCollector {
+	return self.traces
+}
+
+// add a RequestTrace to the request
+func (c *TraceCollector) trace(req *http.Request) (*http.Request, *RequestTrace) {
+	rt := &RequestTrace{}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), rt.NewClientTrace(false))), rt
+}
+
+// a response body that adds the request trace to the collector when closed
+type traceBody struct {
+	io.ReadCloser
+
+	c    *TraceCollector
+	rt   *RequestTrace
+	once sync.Once
+}
+
+func (b *traceBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.rt.Done()
+		b.c.Add(b.rt)
+	})
+
+	return err
+}
@@ -0,0 +1,175 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+
+	v1 "github.com/gobs/httpclient"
+)
+
+type (
+	// Response is the response to a request (the v1 HttpResponse)
+	Response = v1.HttpResponse
+
+	// RequestOption modifies a request (see Client.Send)
+	RequestOption = v1.RequestOption
+
+	// HttpError is the error returned by CheckStatus for non-2xx responses
+	HttpError = v1.HttpError
+
+	// Form is an HTML form (see Response.Forms and Client.SubmitForm)
+	Form = v1.Form
+)
+
+// Client is an HTTP client with a base URL and common settings, headers and cookies,
+// safe for concurrent use once configured.
+type Client struct {
+	client *v1.HttpClient
+}
+
+// New creates a client for the base URL (that can be empty), applying the options in order
+func New(base string, options ...Option) (*Client, error) {
+	c, err := v1.NewHttpClientE(base)
+	if err != nil {
+		return nil, err
+	}
+
+	// each client has its own transport, so that the options (i.e. WithInsecure) only apply to it
+	if tr, ok := c.GetTransport().(*http.Transport); ok && (c.GetTransport() == v1.DefaultTransport || tr == http.DefaultTransport) {
+		c.SetTransport(tr.Clone())
+	}
+
+	self := &Client{client: c}
+
+	for _, opt := range options {
+		if err := opt(self); err != nil {
+			return nil, err
+		}
+	}
+
+	return self, nil
+}
+
+// Wrap returns a Client that uses the v1 client (changes to either one are visible to the other)
+func Wrap(c *v1.HttpClient) *Client {
+	return &Client{client: c}
+}
+
+// V1 returns the underlying v1 client
+func (self *Client) V1() *v1.HttpClient {
+	return self.client
+}
+
+// Clone returns a copy of the client, that shares the transport with the original one
+func (self *Client) Clone() *Client {
+	return &Client{client: self.client.Clone()}
+}
+
+// BaseURL returns the client base URL (nil if the client has no base URL)
+func (self *Client) BaseURL() *url.URL {
+	return self.client.BaseURL
+}
+
+// Send executes a request built from the client settings and the request options.
+// The default method is GET and the default URL is the client base URL (see Method and Path).
+func (self *Client) Send(ctx context.Context, options ...RequestOption) (*Response, error) {
+	// the context first, so that a Timeout option applies on top of it
+	opts := make([]RequestOption, 0, len(options)+1)
+	opts = append(opts, v1.Context(ctx))
+	opts = append(opts, options...)
+
+	return self.client.SendRequest(opts...)
+}
+
+// Do executes the request with the context (the client headers and cookies are not added:
+// use NewRequest to create the request)
+func (self *Client) Do(ctx context.Context, req *http.Request) (*Response, error) {
+	return self.client.Do(req.WithContext(ctx))
+}
+
+// NewRequest creates a request for the path (relative to the client base URL),
+// with the client headers and cookies
+func (self *Client) NewRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := self.client.RequestE(method, path, body, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req.WithContext(ctx), nil
+}
+
+// send a request with the method and path, followed by the other options
+func (self *Client) send(ctx context.Context, method, path string, body io.Reader, options []RequestOption) (*Response, error) {
+	opts := make([]RequestOption, 0, len(options)+3)
+	opts = append(opts, v1.Method(method), v1.Path(path))
+	if body != nil {
+		opts = append(opts, v1.Body(body))
+	}
+	opts = append(opts, options...)
+
+	return self.Send(ctx, opts...)
+}
+
+// Get executes a GET request for the path (relative to the client base URL)
+func (self *Client) Get(ctx context.Context, path string, options ...RequestOption) (*Response, error) {
+	return self.send(ctx, "GET", path, nil, options)
+}
+
+// Head executes a HEAD request for the path (relative to the client base URL)
+func (self *Client) Head(ctx context.Context, path string, options ...RequestOption) (*Response, error) {
+	return self.send(ctx, "HEAD", path, nil, options)
+}
+
+// Delete executes a DELETE request for the path (relative to the client base URL)
+func (self *Client) Delete(ctx context.Context, path string, options ...RequestOption) (*Response, error) {
+	return self.send(ctx, "DELETE", path, nil, options)
+}
+
+// Post executes a POST request for the path (relative to the client base URL) with the body (can be nil)
+func (self *Client) Post(ctx context.Context, path string, body io.Reader, options ...RequestOption) (*Response, error) {
+	return self.send(ctx, "POST", path, body, options)
+}
+
+// Put executes a PUT request for the path (relative to the client base URL) with the body (can be nil)
+func (self *Client) Put(ctx context.Context, path string, body io.Reader, options ...RequestOption) (*Response, error) {
+	return self.send(ctx, "PUT", path, body, options)
+}
+
+// Patch executes a PATCH request for the path (relative to the client base URL) with the body (can be nil)
+func (self *Client) Patch(ctx context.Context, path string, body io.Reader, options ...RequestOption) (*Response, error) {
+	return self.send(ctx, "PATCH", path, body, options)
+}
+
+// SubmitForm submits the HTML form with its fields, updated with values
+func (self *Client) SubmitForm(ctx context.Context, f *Form, values map[string]string, options ...RequestOption) (*Response, error) {
+	opts, err := f.RequestOptions(values)
+	if err != nil {
+		return nil, err
+	}
+
+	return self.Send(ctx, append(opts, options...)...)
+}
+
+// The v1 error helpers
+var (
+	IsStatus    = v1.IsStatus
+	IsTimeout   = v1.IsTimeout
+	IsTemporary = v1.IsTemporary
+)
+
+// CheckStatus returns an HttpError for non-2xx responses (see v1 CheckStatus)
+func CheckStatus(resp *Response, err error) (*Response, error) {
+	return v1.CheckStatus(resp, err)
+}
+
+// URLWithParams returns the base URL with the encoded parameters
+func URLWithParams(base string, params map[string]interface{}) (*url.URL, error) {
+	return v1.URLWithParamsE(base, params)
+}
+
+// URLWithPathParams returns the path (relative to the base URL) with the encoded parameters
+func URLWithPathParams(base, path string, params map[string]interface{}) (*url.URL, error) {
+	return v1.URLWithPathParamsE(base, path, params)
+}
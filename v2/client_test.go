@@ -0,0 +1,230 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/gobs/httpclient"
+)
+
+func testServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/slow":
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+				return
+			}
+
+		case "/api/missing":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, strings.Join([]string{r.Method, r.URL.RequestURI(),
+			r.Header.Get("Authorization"), r.Header.Get("User-Agent"), string(body)}, " "))
+	}))
+}
+
+func TestClient(test *testing.T) {
+	ts := testServer()
+	defer ts.Close()
+
+	client, err := New(ts.URL+"/api/",
+		WithTimeout(5*time.Second),
+		WithBearerToken("token"),
+		WithUserAgent("test/2"))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	content := func(resp *Response, err error) string {
+		test.Helper()
+
+		resp, err = CheckStatus(resp, err)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		b, err := resp.ContentE()
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		return string(b)
+	}
+
+	if c := content(client.Get(ctx, "items", Params(map[string]interface{}{"n": 1}))); c != "GET /api/items?n=1 Bearer token test/2 " {
+		test.Errorf("unexpected GET response %q", c)
+	}
+
+	if c := content(client.Post(ctx, "items", strings.NewReader("data"))); c != "POST /api/items Bearer token test/2 data" {
+		test.Errorf("unexpected POST response %q", c)
+	}
+
+	req, err := client.NewRequest(ctx, "PUT", "items/1", strings.NewReader("put"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if c := content(client.Do(ctx, req)); c != "PUT /api/items/1 Bearer token test/2 put" {
+		test.Errorf("unexpected PUT response %q", c)
+	}
+
+	if _, err := CheckStatus(client.Get(ctx, "missing")); !IsStatus(err, http.StatusNotFound) {
+		test.Error("expected 404, got", err)
+	}
+
+	// the context cancels the request
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.Get(cctx, "slow"); !IsTimeout(err) {
+		test.Error("expected timeout, got", err)
+	}
+
+	// the v1 client shares the settings
+	if c := content(client.V1().SendRequest(v1.Path("items"))); c != "GET /api/items Bearer token test/2 " {
+		test.Errorf("unexpected v1 response %q", c)
+	}
+}
+
+func TestNewErrors(test *testing.T) {
+	if _, err := New(":invalid"); err == nil {
+		test.Error("expected invalid base URL error")
+	}
+
+	if _, err := New("", WithHTTP2(v1.HTTP2Options{Disable: true, PriorKnowledge: true})); err != v1.InvalidHTTP2 {
+		test.Error("expected invalid HTTP/2 options error, got", err)
+	}
+
+	if _, err := URLWithParams(":invalid", nil); err == nil {
+		test.Error("expected invalid URL error")
+	}
+}
+
+func TestWrap(test *testing.T) {
+	c := v1.NewHttpClient("http://example.com/")
+
+	client := Wrap(c)
+	if client.V1() != c {
+		test.Error("expected the wrapped client")
+	}
+
+	if u := client.BaseURL(); u == nil || u.String() != "http://example.com/" {
+		test.Error("unexpected base URL", u)
+	}
+}
+
+// the v2 functions return the errors, and never call the v1 ErrorHandler (log.Fatal by default)
+func TestNoErrorHandler(test *testing.T) {
+	handler := v1.ErrorHandler
+	defer func() { v1.ErrorHandler = handler }()
+
+	v1.ErrorHandler = func(err error) {
+		test.Errorf("unexpected ErrorHandler call: %v", err)
+	}
+
+	ts := testServer()
+	defer ts.Close()
+
+	client, err := New(ts.URL+"/api/", WithTimeout(time.Second))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	calls := map[string]func() error{
+		"New": func() error {
+			_, err := New(":invalid")
+			return err
+		},
+		"New options": func() error {
+			_, err := New("", WithHTTP2(v1.HTTP2Options{Disable: true, PriorKnowledge: true}))
+			return err
+		},
+		"URLWithParams": func() error {
+			_, err := URLWithParams(":invalid", map[string]interface{}{"q": 1})
+			return err
+		},
+		"URLWithPathParams": func() error {
+			_, err := URLWithPathParams(":invalid", "path", map[string]interface{}{"q": 1})
+			return err
+		},
+		"NewRequest": func() error {
+			_, err := client.NewRequest(ctx, "GET", ":invalid", nil)
+			return err
+		},
+		"Get": func() error {
+			_, err := client.Get(ctx, ":invalid")
+			return err
+		},
+		"Post": func() error {
+			_, err := client.Post(canceled, "items", strings.NewReader("body"))
+			return err
+		},
+		"Send": func() error {
+			_, err := client.Send(ctx, v1.URLString("http://127.0.0.1:1/"))
+			return err
+		},
+		"CheckStatus": func() error {
+			_, err := CheckStatus(client.Get(ctx, "missing"))
+			return err
+		},
+		"SubmitForm": func() error {
+			_, err := client.SubmitForm(ctx, &Form{Action: &url.URL{Scheme: "http", Host: "127.0.0.1:1"}, Method: "POST"}, nil)
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		if err := call(); err == nil {
+			test.Errorf("%v: expected an error", name)
+		}
+	}
+}
+
+// the TLS options only apply to the client
+func TestClientTransport(test *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	insecure, err := New(ts.URL, WithInsecure(true), WithTLSConfig(tls.VersionTLS13, 0, nil, nil))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := insecure.Get(context.Background(), "/"); err != nil {
+		test.Error("unexpected error", err)
+	}
+
+	client, err := New(ts.URL)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := client.Get(context.Background(), "/"); err == nil {
+		test.Error("expected certificate error")
+	}
+
+	if config := client.V1().GetTLSConfig(); config != nil && (config.InsecureSkipVerify || config.MinVersion != 0) {
+		test.Error("unexpected TLS configuration", config)
+	}
+	if tr := v1.DefaultTransport.(*http.Transport); tr.TLSClientConfig != nil && tr.TLSClientConfig.InsecureSkipVerify {
+		test.Error("unexpected insecure DefaultTransport")
+	}
+}
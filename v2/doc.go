@@ -0,0 +1,27 @@
+// Package httpclient (github.com/gobs/httpclient/v2) is the context-first version of github.com/gobs/httpclient:
+//
+//   - every request takes a context.Context
+//   - all the functions return an error (nothing calls log.Fatal or the v1 ErrorHandler)
+//   - clients are created with New and functional options (see Option)
+//
+// The v2 Client is a thin layer over the v1 HttpClient, so that the two versions can be used together
+// while migrating: Client.V1 returns the underlying v1 client (to access features that are not wrapped yet)
+// and Wrap returns a v2 Client for an existing v1 HttpClient.
+//
+// The request options, responses and errors are the v1 ones, re-exported here.
+//
+//	client, err := httpclient.New("https://api.example.com/v1/",
+//		httpclient.WithTimeout(10*time.Second),
+//		httpclient.WithBearerToken(token))
+//	if err != nil {
+//		return err
+//	}
+//
+//	resp, err := httpclient.CheckStatus(client.Get(ctx, "users", httpclient.Params(params)))
+//	if err != nil {
+//		return err
+//	}
+//
+//	defer resp.Close()
+//	return resp.JsonDecode(&users, false)
+package httpclient
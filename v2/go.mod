@@ -0,0 +1,5 @@
+module github.com/gobs/httpclient/v2
+
+go 1.24
+
+require github.com/gobs/httpclient v1.0.0
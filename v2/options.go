@@ -0,0 +1,248 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"time"
+
+	v1 "github.com/gobs/httpclient"
+)
+
+// Option configures a client (see New)
+type Option func(c *Client) error
+
+// WithTimeout sets the client timeout (0: no timeout, the default is v1.DefaultTimeout)
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) error {
+		c.client.SetTimeout(d)
+		return nil
+	}
+}
+
+// WithTransport sets the client transport
+func WithTransport(tr http.RoundTripper) Option {
+	return func(c *Client) error {
+		c.client.SetTransport(tr)
+		return nil
+	}
+}
+
+// WithHTTP2 configures the HTTP/2 support of the client transport (see v1 HttpClient.ConfigureHTTP2)
+func WithHTTP2(opts v1.HTTP2Options) Option {
+	return func(c *Client) error {
+		return c.client.ConfigureHTTP2(opts)
+	}
+}
+
+// WithInsecure disables the verification of the server certificates
+func WithInsecure(insecure bool) Option {
+	return func(c *Client) error {
+		c.client.AllowInsecure(insecure)
+		return nil
+	}
+}
+
+// WithTLSConfig sets the TLS versions, cipher suites and curves (see v1 HttpClient.SetTLSConfig)
+func WithTLSConfig(min, max uint16, ciphers []uint16, curves []tls.CurveID) Option {
+	return func(c *Client) error {
+		return c.client.SetTLSConfig(min, max, ciphers, curves)
+	}
+}
+
+// WithServerName sets the server name sent in the TLS handshake (SNI)
+func WithServerName(sni string) Option {
+	return func(c *Client) error {
+		return c.client.SetServerName(sni)
+	}
+}
+
+// WithPinnedCertificates enables public key pinning with the specified SHA-256 SPKI pins (see v1 HttpClient.PinCertificates)
+func WithPinnedCertificates(sha256Pins ...string) Option {
+	return func(c *Client) error {
+		return c.client.PinCertificates(sha256Pins)
+	}
+}
+
+// WithHeader sets a header sent with every request (to the hosts in the client scope, see WithHeaderScope)
+func WithHeader(name, value string) Option {
+	return func(c *Client) error {
+		c.client.Headers[name] = value
+		return nil
+	}
+}
+
+// WithHeaderScope sets the hosts the client headers are sent to (see v1 MatchHost)
+func WithHeaderScope(patterns ...string) Option {
+	return func(c *Client) error {
+		c.client.SetHeaderScope(patterns...)
+		return nil
+	}
+}
+
+// WithUserAgent sets the User-Agent header
+func WithUserAgent(ua string) Option {
+	return func(c *Client) error {
+		c.client.UserAgent = ua
+		return nil
+	}
+}
+
+// WithBasicAuth sets the basic authentication credentials
+func WithBasicAuth(user, password string) Option {
+	return func(c *Client) error {
+		c.client.SetBasicAuth(user, password)
+		return nil
+	}
+}
+
+// WithBearerToken sets the bearer token sent in the Authorization header
+func WithBearerToken(token string) Option {
+	return func(c *Client) error {
+		c.client.SetBearerToken(token)
+		return nil
+	}
+}
+
+// WithCookieJar sets the client cookie jar
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(c *Client) error {
+		c.client.SetCookieJar(jar)
+		return nil
+	}
+}
+
+// WithRedirects sets if redirects are followed (the default) or returned as is
+func WithRedirects(follow bool) Option {
+	return func(c *Client) error {
+		c.client.FollowRedirects = follow
+		return nil
+	}
+}
+
+// WithMaxResponseBytes limits the size of the response bodies (see v1 HttpClient.SetMaxResponseBytes)
+func WithMaxResponseBytes(limit int64) Option {
+	return func(c *Client) error {
+		c.client.SetMaxResponseBytes(limit)
+		return nil
+	}
+}
+
+// WithBalancer balances the requests across the balancer endpoints (see v1 HttpClient.SetBalancer)
+func WithBalancer(b *v1.Balancer) Option {
+	return func(c *Client) error {
+		return c.client.SetBalancer(b)
+	}
+}
+
+// WithIPPreference sets the IP family preference and the fallback delay (see v1 HttpClient.SetIPPreference)
+func WithIPPreference(pref v1.IPPreference, fallbackDelay time.Duration) Option {
+	return func(c *Client) error {
+		return c.client.SetIPPreference(pref, fallbackDelay)
+	}
+}
+
+// WithSingleFlight coalesces the concurrent identical GET and HEAD requests (see v1 HttpClient.SetSingleFlight)
+func WithSingleFlight(headers ...string) Option {
+	return func(c *Client) error {
+		c.client.SetSingleFlight(true, headers...)
+		return nil
+	}
+}
+
+// WithMaxInFlight limits the number of outstanding requests (see v1 HttpClient.SetMaxInFlight)
+func WithMaxInFlight(n int, failFast bool) Option {
+	return func(c *Client) error {
+		c.client.SetMaxInFlight(n, failFast)
+		return nil
+	}
+}
+
+// WithEventSink emits an event for each request (see v1 HttpClient.SetEventSink)
+func WithEventSink(sink func(e *v1.Event)) Option {
+	return func(c *Client) error {
+		c.client.SetEventSink(sink)
+		return nil
+	}
+}
+
+// WithDNSCache resolves the host names with the DNS cache (see v1 HttpClient.SetDNSCache)
+func WithDNSCache(cache *v1.DNSCache) Option {
+	return func(c *Client) error {
+		return c.client.SetDNSCache(cache)
+	}
+}
+
+// WithResponseArchive saves all the response bodies in dir (see v1 HttpClient.SetResponseArchive)
+func WithResponseArchive(dir string) Option {
+	return func(c *Client) error {
+		return c.client.SetResponseArchive(dir)
+	}
+}
+
+// WithDryRun logs the requests (with the specified methods, or all) instead of sending them (see v1 HttpClient.DryRun)
+func WithDryRun(methods ...string) Option {
+	return func(c *Client) error {
+		c.client.DryRun(true, methods...)
+		return nil
+	}
+}
+
+// WithLogging logs the requests and responses (and the bodies, if requested), see v1 LogOption for the options
+func WithLogging(requestBody, responseBody, timing bool, options ...v1.LogOption) Option {
+	return func(c *Client) error {
+		c.client.StartLogging(requestBody, responseBody, timing, options...)
+		return nil
+	}
+}
+
+// WithLogger sets the logger for the verbose messages and the request logging (see WithLogging)
+func WithLogger(l *log.Logger) Option {
+	return func(c *Client) error {
+		c.client.SetLogger(l)
+		return nil
+	}
+}
+
+// WithStats enables the request metrics (see v1 HttpClient.Stats)
+func WithStats() Option {
+	return func(c *Client) error {
+		c.client.EnableStats(true)
+		return nil
+	}
+}
+
+// The v1 request options
+var (
+	Method        = v1.Method
+	Path          = v1.Path
+	URL           = v1.URL
+	URLString     = v1.URLString
+	Params        = v1.Params
+	StringParams  = v1.StringParams
+	Header        = v1.Header
+	Accept        = v1.Accept
+	ContentType   = v1.ContentType
+	ContentLength = v1.ContentLength
+	Body          = v1.Body
+	BodyFunc      = v1.BodyFunc
+	JsonBody      = v1.JsonBody
+	FormBody      = v1.FormBody
+	Timeout       = v1.Timeout
+	Trace         = v1.Trace
+	CacheBuster   = v1.CacheBuster
+	NoCacheBuster = v1.NoCacheBuster
+	Canonicalize  = v1.Canonicalize
+	TemplateBody  = v1.TemplateBody
+	TemplatePath  = v1.TemplatePath
+
+	NoSingleFlight = v1.NoSingleFlight
+	VerifyDigest   = v1.VerifyDigest
+	Checksums      = v1.Checksums
+	JsonPatchBody  = v1.JsonPatchBody
+	MergePatchBody = v1.MergePatchBody
+	ExpectContinue = v1.ExpectContinue
+	Trailer        = v1.Trailer
+	FileBody       = v1.FileBody
+	EventFields    = v1.EventFields
+)
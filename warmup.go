@@ -0,0 +1,109 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http/httptrace"
+	"sync"
+)
+
+var NoBaseURL = errors.New("No base URL")
+
+// Warmup pre-establishes n connections (DNS, TCP and TLS handshake) to the BaseURL,
+// so that they are available in the connection pool for the following requests.
+//
+// The connections are opened with concurrent HEAD requests (held until all the connections are established,
+// so that each one uses a new connection) and the response status is ignored.
+// If needed, the transport MaxIdleConnsPerHost is raised to n, so that the connections are kept in the pool.
+//
+// It returns the timings for each connection and the first error, if any.
+func (self *HttpClient) Warmup(ctx context.Context, n int) ([]*RequestTrace, error) {
+	if self.BaseURL == nil {
+		return nil, NoBaseURL
+	}
+
+	if n <= 0 {
+		return nil, nil
+	}
+
+	if tr := self.httpTransport(); tr != nil && tr.MaxIdleConnsPerHost < n {
+		tr.MaxIdleConnsPerHost = n
+	}
+
+	var wg, arrived sync.WaitGroup
+	arrived.Add(n)
+
+	all := make(chan struct{})
+	go func() {
+		arrived.Wait()
+		close(all)
+	}()
+
+	traces := make([]*RequestTrace, n)
+	errs := make([]error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			var once sync.Once
+			done := func() { once.Do(arrived.Done) }
+			defer done()
+
+			rt := &RequestTrace{}
+			ct := rt.NewClientTrace(false)
+
+			gotConn := ct.GotConn
+			ct.GotConn = func(info httptrace.GotConnInfo) {
+				gotConn(info)
+				done()
+
+				// hold the connection until all the others are established
+				select {
+				case <-all:
+				case <-ctx.Done():
+				}
+			}
+
+			resp, err := self.SendRequest(HEAD, Context(ctx), URL(self.BaseURL), Trace(ct))
+			if err == nil {
+				resp.Close()
+				rt.Done()
+			}
+
+			traces[i], errs[i] = rt, err
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return traces, err
+		}
+	}
+
+	return traces, nil
+}
+
+// Ping sends a HEAD request to the BaseURL and returns the request timings,
+// and an error if the request failed or the response status is not successful.
+func (self *HttpClient) Ping(ctx context.Context) (*RequestTrace, error) {
+	if self.BaseURL == nil {
+		return nil, NoBaseURL
+	}
+
+	rt := &RequestTrace{}
+
+	resp, err := self.SendRequest(HEAD, Context(ctx), URL(self.BaseURL), Trace(rt.NewClientTrace(false)))
+	if err != nil {
+		return rt, err
+	}
+
+	defer resp.Close()
+	rt.Done()
+
+	return rt, resp.ResponseError()
+}
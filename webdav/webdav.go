@@ -0,0 +1,397 @@
+// Package webdav implements a WebDAV (RFC 4918) client, built on httpclient:
+// listing (PROPFIND), collections (MKCOL), MOVE, COPY and DELETE, ranged reads and writes, and a file system (fs.FS).
+//
+// The paths are relative to the client base URL, that should be the root of the DAV share
+// and end with a slash (i.e. "https://dav.example.com/remote.php/dav/files/user/").
+package webdav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobs/httpclient"
+)
+
+// Client is a WebDAV client for the share at the HttpClient base URL
+type Client struct {
+	*httpclient.HttpClient
+}
+
+// New creates a WebDAV client that uses the specified HttpClient (and its settings, i.e. authentication)
+func New(client *httpclient.HttpClient) *Client {
+	return &Client{HttpClient: client}
+}
+
+// NewClient creates a WebDAV client for the share at base
+func NewClient(base string) (*Client, error) {
+	client, err := httpclient.NewHttpClientE(base)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(client), nil
+}
+
+// Resource describes a file or collection (directory), as returned by PROPFIND
+type Resource struct {
+	Path        string // the unescaped URL path
+	Name        string // the display name, or the last element of the path
+	IsDir       bool   // true for a collection
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+	ETag        string
+}
+
+// the PROPFIND request body
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:">
+  <D:prop>
+    <D:displayname/>
+    <D:resourcetype/>
+    <D:getcontentlength/>
+    <D:getlastmodified/>
+    <D:getcontenttype/>
+    <D:getetag/>
+  </D:prop>
+</D:propfind>`
+
+// the PROPFIND response (multistatus)
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				DisplayName   string `xml:"DAV: displayname"`
+				ContentLength string `xml:"DAV: getcontentlength"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+				ContentType   string `xml:"DAV: getcontenttype"`
+				ETag          string `xml:"DAV: getetag"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// parseMultistatus returns the resources in a PROPFIND response (only the properties with a 200 status are used)
+func parseMultistatus(r io.Reader) ([]Resource, error) {
+	var ms multistatus
+
+	if err := xml.NewDecoder(r).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("Invalid PROPFIND response: %w", err)
+	}
+
+	resources := make([]Resource, 0, len(ms.Responses))
+
+	for _, resp := range ms.Responses {
+		u, err := url.Parse(strings.TrimSpace(resp.Href))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid href %q: %w", resp.Href, err)
+		}
+
+		res := Resource{Path: u.Path}
+
+		for _, ps := range resp.Propstat {
+			if fields := strings.Fields(ps.Status); len(fields) < 2 || fields[1] != "200" {
+				continue
+			}
+
+			p := ps.Prop
+
+			if p.DisplayName != "" {
+				res.Name = p.DisplayName
+			}
+			if p.ResourceType.Collection != nil {
+				res.IsDir = true
+			}
+			if n, err := strconv.ParseInt(strings.TrimSpace(p.ContentLength), 10, 64); err == nil {
+				res.Size = n
+			}
+			if t, err := http.ParseTime(strings.TrimSpace(p.LastModified)); err == nil {
+				res.ModTime = t
+			}
+			if p.ContentType != "" {
+				res.ContentType = p.ContentType
+			}
+			if p.ETag != "" {
+				res.ETag = p.ETag
+			}
+		}
+
+		if res.Name == "" {
+			res.Name = path.Base(strings.TrimSuffix(res.Path, "/"))
+		}
+
+		resources = append(resources, res)
+	}
+
+	return resources, nil
+}
+
+// send a request and check the status, also returning an error for a 207 Multi-Status response
+// (a failure for some of the resources in a collection) unless multistatus is true
+func (self *Client) send(multistatus bool, options ...httpclient.RequestOption) (*httpclient.HttpResponse, error) {
+	resp, err := httpclient.CheckStatus(self.SendRequest(options...))
+	if err != nil {
+		resp.Close()
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusMultiStatus && !multistatus {
+		body := resp.Content()
+		resp.Close()
+		return nil, httpclient.HttpError{Code: resp.StatusCode, Message: "Partial failure", Body: body, Header: resp.Header}
+	}
+
+	return resp, nil
+}
+
+// propfind returns the resources at path, with the specified depth ("0" or "1")
+func (self *Client) propfind(p, depth string) ([]Resource, error) {
+	resp, err := self.send(true,
+		httpclient.Method("PROPFIND"),
+		self.Path(p),
+		httpclient.Header(map[string]string{"Depth": depth}),
+		httpclient.ContentType(`application/xml; charset="utf-8"`),
+		httpclient.Body(strings.NewReader(propfindBody)))
+	if err != nil {
+		if httpclient.IsStatus(err, http.StatusNotFound) {
+			return nil, os.ErrNotExist
+		}
+
+		return nil, err
+	}
+
+	defer resp.Close()
+	return parseMultistatus(resp.Body)
+}
+
+// Stat returns the properties of the resource at path (os.ErrNotExist if not found)
+func (self *Client) Stat(p string) (*Resource, error) {
+	resources, err := self.propfind(p, "0")
+	if err != nil {
+		return nil, err
+	}
+	if len(resources) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	return &resources[0], nil
+}
+
+// List returns the members of the collection at path (not including the collection itself)
+func (self *Client) List(p string) ([]Resource, error) {
+	if !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+
+	resources, err := self.propfind(p, "1")
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := self.BaseURL.Parse(p)
+	if err != nil {
+		return nil, err
+	}
+
+	collection := strings.TrimSuffix(u.Path, "/")
+
+	members := make([]Resource, 0, len(resources))
+
+	for _, r := range resources {
+		if strings.TrimSuffix(r.Path, "/") != collection {
+			members = append(members, r)
+		}
+	}
+
+	return members, nil
+}
+
+// Mkcol creates the collection at path (the parent collection must exist)
+func (self *Client) Mkcol(p string) error {
+	resp, err := self.send(false, httpclient.Method("MKCOL"), self.Path(p))
+	resp.Close()
+	return err
+}
+
+// Delete deletes the resource (or the collection, with its members) at path
+func (self *Client) Delete(p string) error {
+	resp, err := self.send(false, httpclient.Method("DELETE"), self.Path(p))
+	resp.Close()
+	return err
+}
+
+// Move moves the resource at src to dst (both relative to the base URL). If overwrite is false
+// and dst exists, the request fails with a 412 Precondition Failed error.
+func (self *Client) Move(src, dst string, overwrite bool) error {
+	return self.transfer("MOVE", src, dst, overwrite)
+}
+
+// Copy copies the resource (or the collection, with its members) at src to dst (see Move)
+func (self *Client) Copy(src, dst string, overwrite bool) error {
+	return self.transfer("COPY", src, dst, overwrite)
+}
+
+func (self *Client) transfer(method, src, dst string, overwrite bool) error {
+	u, err := self.BaseURL.Parse(dst)
+	if err != nil {
+		return err
+	}
+
+	ow := "F"
+	if overwrite {
+		ow = "T"
+	}
+
+	resp, err := self.send(false,
+		httpclient.Method(method),
+		self.Path(src),
+		httpclient.Header(map[string]string{"Destination": u.String(), "Overwrite": ow}))
+	resp.Close()
+	return err
+}
+
+// GetRange returns the content of the resource at path, starting at offset for length bytes
+// (the rest of the content if length is negative). The caller must close the returned reader.
+func (self *Client) GetRange(p string, offset, length int64) (io.ReadCloser, error) {
+	options := []httpclient.RequestOption{httpclient.Method("GET"), self.Path(p)}
+
+	if offset > 0 || length >= 0 {
+		r := fmt.Sprintf("bytes=%d-", offset)
+		if length >= 0 {
+			r += strconv.FormatInt(offset+length-1, 10)
+		}
+
+		options = append(options, httpclient.Header(map[string]string{"Range": r}))
+	}
+
+	resp, err := self.send(false, options...)
+	if err != nil {
+		if httpclient.IsStatus(err, http.StatusNotFound) {
+			return nil, os.ErrNotExist
+		}
+
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusOK && (offset > 0 || length >= 0) { // the server ignored the range
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Close()
+			return nil, err
+		}
+		if length >= 0 {
+			return struct {
+				io.Reader
+				io.Closer
+			}{io.LimitReader(resp.Body, length), resp.Body}, nil
+		}
+	}
+
+	return resp.Body, nil
+}
+
+// Open opens the resource at path as an HttpFile, for random access (with ranged GET requests).
+// The client headers (i.e. basic or bearer authentication) and transport are used.
+func (self *Client) Open(p string, options ...httpclient.HttpFileOption) (*httpclient.HttpFile, error) {
+	u, err := self.BaseURL.Parse(p)
+	if err != nil {
+		return nil, err
+	}
+
+	options = append([]httpclient.HttpFileOption{httpclient.FileTransport(self.GetTransport())}, options...)
+	return httpclient.OpenHttpFile(u.String(), self.Headers, options...)
+}
+
+// Put writes the content of r to the resource at path (size is the content length, or -1 if unknown)
+func (self *Client) Put(p string, r io.Reader, size int64) error {
+	resp, err := self.send(false,
+		httpclient.Method("PUT"),
+		self.Path(p),
+		httpclient.Body(r),
+		httpclient.ContentLength(size))
+	resp.Close()
+	return err
+}
+
+// PutRange writes length bytes of r to the resource at path, starting at offset, with a Content-Range header.
+// This is a partial update of an existing resource, and requires server support (i.e. Apache mod_dav):
+// other servers may reject the request, or replace the content.
+func (self *Client) PutRange(p string, offset int64, r io.Reader, length int64) error {
+	if length <= 0 {
+		return fmt.Errorf("Invalid range length %v", length)
+	}
+
+	resp, err := self.send(false,
+		httpclient.Method("PUT"),
+		self.Path(p),
+		httpclient.Header(map[string]string{"Content-Range": fmt.Sprintf("bytes %d-%d/*", offset, offset+length-1)}),
+		httpclient.Body(io.LimitReader(r, length)),
+		httpclient.ContentLength(length))
+	resp.Close()
+	return err
+}
+
+// FS returns a file system (fs.FS) for the share: the directories are listed with PROPFIND
+// and the files are read as HttpFile (with the client headers and transport, and the specified options).
+func (self *Client) FS(options ...httpclient.HttpFileOption) (*httpclient.HttpFileSystem, error) {
+	fsys, err := httpclient.HttpFS(self.BaseURL.String(), self.Headers, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys.Client = &http.Client{Transport: self.GetTransport()}
+	fsys.ReadDirFunc = self.readDir
+	return fsys, nil
+}
+
+// list the collection for a file system path ("." for the root)
+func (self *Client) readDir(name string) ([]fs.DirEntry, error) {
+	p := "./"
+	if name != "." {
+		p += (&url.URL{Path: name}).EscapedPath() + "/"
+	}
+
+	resources, err := self.List(p)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, len(resources))
+	for i, r := range resources {
+		entries[i] = fs.FileInfoToDirEntry(resourceInfo{r})
+	}
+
+	return entries, nil
+}
+
+// fs.FileInfo for a Resource (Sys returns the Resource)
+type resourceInfo struct {
+	r Resource
+}
+
+func (fi resourceInfo) Name() string       { return path.Base(strings.TrimSuffix(fi.r.Path, "/")) }
+func (fi resourceInfo) Size() int64        { return fi.r.Size }
+func (fi resourceInfo) ModTime() time.Time { return fi.r.ModTime }
+func (fi resourceInfo) IsDir() bool        { return fi.r.IsDir }
+func (fi resourceInfo) Sys() interface{}   { return fi.r }
+
+func (fi resourceInfo) Mode() fs.FileMode {
+	if fi.r.IsDir {
+		return fs.ModeDir | 0555
+	}
+
+	return 0444
+}
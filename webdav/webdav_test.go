@@ -0,0 +1,237 @@
+package webdav
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const listing = `<?xml version="1.0" encoding="utf-8"?>
+<d:multistatus xmlns:d="DAV:">
+  <d:response>
+    <d:href>/dav/docs/</d:href>
+    <d:propstat>
+      <d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop>
+      <d:status>HTTP/1.1 200 OK</d:status>
+    </d:propstat>
+  </d:response>
+  <d:response>
+    <d:href>/dav/docs/read%20me.txt</d:href>
+    <d:propstat>
+      <d:prop>
+        <d:resourcetype/>
+        <d:getcontentlength>10</d:getcontentlength>
+        <d:getlastmodified>Mon, 02 Jan 2006 15:04:05 GMT</d:getlastmodified>
+        <d:getcontenttype>text/plain</d:getcontenttype>
+        <d:getetag>"abc"</d:getetag>
+      </d:prop>
+      <d:status>HTTP/1.1 200 OK</d:status>
+    </d:propstat>
+    <d:propstat>
+      <d:prop><d:displayname/></d:prop>
+      <d:status>HTTP/1.1 404 Not Found</d:status>
+    </d:propstat>
+  </d:response>
+  <d:response>
+    <d:href>http://localhost/dav/docs/sub/</d:href>
+    <d:propstat>
+      <d:prop><d:displayname>Sub</d:displayname><d:resourcetype><d:collection/></d:resourcetype></d:prop>
+      <d:status>HTTP/1.1 200 OK</d:status>
+    </d:propstat>
+  </d:response>
+</d:multistatus>`
+
+// a fake DAV server, with a single file at /dav/docs/read me.txt
+func server(test *testing.T) (*httptest.Server, *[]string) {
+	var lock sync.Mutex
+	var requests []string
+
+	content := []byte("0123456789")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		requests = append(requests, strings.TrimSpace(fmt.Sprintf("%v %v %v %v %v", r.Method, r.URL.Path,
+			r.Header.Get("Depth"), r.Header.Get("Destination"), r.Header.Get("Overwrite"))))
+
+		switch {
+		case r.Method == "PROPFIND" && r.URL.Path == "/dav/docs/":
+			body, _ := io.ReadAll(r.Body)
+			if !bytes.Contains(body, []byte("getcontentlength")) {
+				test.Error("unexpected PROPFIND body", string(body))
+			}
+
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusMultiStatus)
+			io.WriteString(w, listing)
+
+		case r.Method == "PROPFIND":
+			http.NotFound(w, r)
+
+		case r.Method == "MKCOL" || r.Method == "COPY":
+			w.WriteHeader(http.StatusCreated)
+
+		case r.Method == "MOVE":
+			w.WriteHeader(http.StatusMultiStatus) // partial failure
+
+		case r.Method == "GET" || r.Method == "HEAD":
+			http.ServeContent(w, r, "read me.txt", time.Time{}, bytes.NewReader(content))
+
+		case r.Method == "PUT":
+			body, _ := io.ReadAll(r.Body)
+
+			if cr := r.Header.Get("Content-Range"); cr != "" {
+				var first, last int
+				fmt.Sscanf(cr, "bytes %d-%d/*", &first, &last)
+				copy(content[first:last+1], body)
+			} else {
+				content = body
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+
+	return ts, &requests
+}
+
+func TestWebDAV(test *testing.T) {
+	ts, requests := server(test)
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL + "/dav/")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	resources, err := client.List("docs")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(resources) != 2 {
+		test.Fatalf("expected 2 resources, got %+v", resources)
+	}
+
+	file, dir := resources[0], resources[1]
+
+	if file.Path != "/dav/docs/read me.txt" || file.Name != "read me.txt" || file.IsDir || file.Size != 10 ||
+		file.ContentType != "text/plain" || file.ETag != `"abc"` || file.ModTime.Year() != 2006 {
+		test.Errorf("unexpected file %+v", file)
+	}
+	if dir.Path != "/dav/docs/sub/" || dir.Name != "Sub" || !dir.IsDir {
+		test.Errorf("unexpected collection %+v", dir)
+	}
+
+	if _, err := client.Stat("missing"); err != os.ErrNotExist {
+		test.Error("expected not exist, got", err)
+	}
+
+	if err := client.Mkcol("docs/new/"); err != nil {
+		test.Error(err)
+	}
+	if err := client.Copy("docs/read%20me.txt", "docs/new/copy.txt", false); err != nil {
+		test.Error(err)
+	}
+	if err := client.Move("docs/sub/", "docs/moved/", true); err == nil {
+		test.Error("expected partial failure")
+	}
+
+	// ranged read and write
+	r, err := client.GetRange("docs/read%20me.txt", 2, 3)
+	if err != nil {
+		test.Fatal(err)
+	}
+	b, _ := io.ReadAll(r)
+	r.Close()
+
+	if string(b) != "234" {
+		test.Errorf("expected 234, got %q", b)
+	}
+
+	if err := client.PutRange("docs/read%20me.txt", 4, strings.NewReader("abcdef"), 2); err != nil {
+		test.Fatal(err)
+	}
+
+	f, err := client.Open("docs/read%20me.txt")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	b = make([]byte, 4)
+	if _, err := f.ReadAt(b, 3); err != nil || string(b) != "3ab6" {
+		test.Errorf("expected 3ab6, got %q %v", b, err)
+	}
+	f.Close()
+
+	if err := client.Put("docs/read%20me.txt", strings.NewReader("new"), 3); err != nil {
+		test.Fatal(err)
+	}
+	if r, err = client.GetRange("docs/read%20me.txt", 0, -1); err != nil {
+		test.Fatal(err)
+	}
+	b, _ = io.ReadAll(r)
+	r.Close()
+
+	if string(b) != "new" {
+		test.Errorf("expected new, got %q", b)
+	}
+
+	expected := []string{
+		"PROPFIND /dav/docs/ 1",
+		"PROPFIND /dav/missing 0",
+		"MKCOL /dav/docs/new/",
+		"COPY /dav/docs/read me.txt  " + ts.URL + "/dav/docs/new/copy.txt F",
+		"MOVE /dav/docs/sub/  " + ts.URL + "/dav/docs/moved/ T",
+	}
+
+	if !reflect.DeepEqual((*requests)[:len(expected)], expected) {
+		test.Errorf("unexpected requests %q", *requests)
+	}
+}
+
+func TestFS(test *testing.T) {
+	ts, _ := server(test)
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL + "/dav/")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fsys, err := client.FS()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	entries, err := fs.ReadDir(fsys, "docs")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0].Name() != "read me.txt" || entries[0].IsDir() ||
+		entries[1].Name() != "sub" || !entries[1].IsDir() {
+		test.Fatalf("unexpected entries %v", entries)
+	}
+
+	if info, _ := entries[0].Info(); info.Size() != 10 || info.ModTime().Year() != 2006 {
+		test.Errorf("unexpected info %v %v", info.Size(), info.ModTime())
+	}
+
+	if b, err := fs.ReadFile(fsys, "docs/read me.txt"); err != nil || string(b) != "0123456789" {
+		test.Errorf("unexpected content %q %v", b, err)
+	}
+}